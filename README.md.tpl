@@ -29,3 +29,15 @@ import (
 
 func main() {{ "ExampleInMem" | code }}
 ```
+
+## Testing
+
+The S3 test suite runs against a live AWS sandbox by default. To run it against a local
+S3-compatible store, such as [MinIO](https://min.io), point it to a custom endpoint:
+
+```
+docker run -d -p 9000:9000 minio/minio server /data
+export AWS_ACCESS_KEY_ID=minioadmin AWS_SECRET_ACCESS_KEY=minioadmin
+export BFS_LINT_S3_ENDPOINT=http://localhost:9000 BFS_LINT_S3_FORCE_PATH_STYLE=true BFS_LINT_S3_BUCKET=bfs-test
+cd bfss3 && go test ./...
+```
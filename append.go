@@ -0,0 +1,83 @@
+package bfs
+
+import (
+	"context"
+	"io/ioutil"
+)
+
+// Append appends data to an object, creating it if it does not exist. Object
+// stores do not support appends natively, so the existing content is read
+// and rewritten in full, i.e. the cost is O(n) in the size of the object.
+// Content type and metadata of existing objects are preserved.
+//
+// Append is NOT atomic. When an object is appended to concurrently, updates
+// may be lost. Please use AppendConditional if this is a concern.
+func Append(ctx context.Context, bucket Bucket, name string, data []byte) error {
+	existing, err := readAll(ctx, bucket, name)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	var opts *WriteOptions
+	if err == nil {
+		info, err := bucket.Head(ctx, name)
+		if err != nil && err != ErrNotFound {
+			return err
+		} else if info != nil {
+			opts = &WriteOptions{
+				ContentType:        info.ContentType,
+				Metadata:           info.Metadata,
+				CacheControl:       info.CacheControl,
+				ContentEncoding:    info.ContentEncoding,
+				ContentDisposition: info.ContentDisposition,
+				ContentLanguage:    info.ContentLanguage,
+			}
+		}
+	}
+
+	return WriteObject(ctx, bucket, name, concat(existing, data), opts)
+}
+
+// AppendConditional appends data to an object, like Append, but guards the
+// rewrite with preconditions (e.g. object generations on GCS). If the object
+// was modified concurrently, no data is written and an error is returned
+// which satisfies errors.Is(err, ErrConflict), so no updates are lost.
+// Callers may retry on conflicts.
+//
+// AppendConditional returns ErrNotSupported if the bucket does not support
+// conditional updates.
+func AppendConditional(ctx context.Context, bucket Bucket, name string, data []byte) error {
+	return ConditionalUpdate(ctx, bucket, name, func(existing []byte) ([]byte, error) {
+		return concat(existing, data), nil
+	})
+}
+
+// ConditionalUpdate reads the content of an object, or nil if it does not
+// exist, passes it to fn and writes the result back, guarded by
+// preconditions. If the object was modified concurrently, no data is written
+// and an error is returned which satisfies errors.Is(err, ErrConflict). Errors
+// returned by fn abort the update.
+//
+// ConditionalUpdate returns ErrNotSupported if the bucket does not support
+// conditional updates.
+func ConditionalUpdate(ctx context.Context, bucket Bucket, name string, fn func([]byte) ([]byte, error)) error {
+	if cu, ok := bucket.(supportsConditionalUpdate); ok {
+		return cu.ConditionalUpdate(ctx, name, fn)
+	}
+	return ErrNotSupported
+}
+
+func readAll(ctx context.Context, bucket Bucket, name string) ([]byte, error) {
+	r, err := bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func concat(a, b []byte) []byte {
+	buf := make([]byte, 0, len(a)+len(b))
+	return append(append(buf, a...), b...)
+}
@@ -0,0 +1,103 @@
+package bfs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Append", func() {
+	var bucket *bfs.InMem
+	var ctx = context.Background()
+
+	read := func(name string) string {
+		r, err := bucket.Open(ctx, name)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		buf := new(strings.Builder)
+		_, err = io.Copy(buf, r)
+		Expect(err).NotTo(HaveOccurred())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		bucket = bfs.NewInMem()
+	})
+
+	It("should create objects on first write", func() {
+		Expect(bfs.Append(ctx, bucket, "log.txt", []byte("a\n"))).To(Succeed())
+		Expect(read("log.txt")).To(Equal("a\n"))
+	})
+
+	It("should append to existing objects", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "log.txt", []byte("a\n"), &bfs.WriteOptions{
+			ContentType: "text/plain",
+			Metadata:    bfs.Metadata{"Foo": "Bar"},
+		})).To(Succeed())
+
+		Expect(bfs.Append(ctx, bucket, "log.txt", []byte("b\n"))).To(Succeed())
+		Expect(bfs.Append(ctx, bucket, "log.txt", []byte("c\n"))).To(Succeed())
+		Expect(read("log.txt")).To(Equal("a\nb\nc\n"))
+
+		info, err := bucket.Head(ctx, "log.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/plain"))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Foo": "Bar"}))
+	})
+
+	Describe("AppendConditional", func() {
+		It("should create and append", func() {
+			Expect(bfs.AppendConditional(ctx, bucket, "log.txt", []byte("a\n"))).To(Succeed())
+			Expect(bfs.AppendConditional(ctx, bucket, "log.txt", []byte("b\n"))).To(Succeed())
+			Expect(read("log.txt")).To(Equal("a\nb\n"))
+		})
+
+		It("should detect conflicts", func() {
+			Expect(bfs.WriteObject(ctx, bucket, "log.txt", []byte("a\n"), nil)).To(Succeed())
+
+			err := bucket.ConditionalUpdate(ctx, "log.txt", func(data []byte) ([]byte, error) {
+				Expect(bfs.Append(ctx, bucket, "log.txt", []byte("b\n"))).To(Succeed())
+				return append(data, "c\n"...), nil
+			})
+			Expect(err).To(MatchError(bfs.ErrConflict))
+			Expect(read("log.txt")).To(Equal("a\nb\n"))
+		})
+
+		It("should not lose concurrent appends", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(line string) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					for {
+						err := bfs.AppendConditional(ctx, bucket, "log.txt", []byte(line+"\n"))
+						if !errors.Is(err, bfs.ErrConflict) {
+							Expect(err).NotTo(HaveOccurred())
+							return
+						}
+					}
+				}(strconv.Itoa(i))
+			}
+			wg.Wait()
+
+			lines := strings.Fields(read("log.txt"))
+			sort.Strings(lines)
+			Expect(lines).To(Equal([]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}))
+		})
+
+		It("should fail if not supported", func() {
+			Expect(bfs.AppendConditional(ctx, struct{ bfs.Bucket }{bucket}, "log.txt", nil)).To(MatchError(bfs.ErrNotSupported))
+		})
+	})
+})
@@ -4,7 +4,6 @@ package bfs
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net/textproto"
@@ -12,17 +11,17 @@ import (
 	"strings"
 	"sync"
 	"time"
-)
 
-// ErrNotFound must be returned by all implementations
-// when a requested object cannot be found.
-var ErrNotFound = errors.New("bfs: object not found")
+	"github.com/bsm/bfs/internal"
+)
 
 // Bucket is an abstract storage bucket.
 type Bucket interface {
 	// Glob lists the files matching a glob pattern. It supports
 	// `*`, `**`, `?` wildcards, character classes and alternative sequences.
 	// Please see https://github.com/bmatcuk/doublestar#patterns for more details.
+	// Use `**` to match all files, empty patterns must be rejected with
+	// ErrEmptyPattern.
 	Glob(ctx context.Context, pattern string) (Iterator, error)
 
 	// Head returns an object's meta info.
@@ -46,6 +45,20 @@ type Reader interface {
 	io.ReadCloser
 }
 
+// ReadCloserInfo is an optional interface, implemented by readers returned
+// from bucket.Open of most implementations. It exposes the object's meta
+// information without the need for an additional Head call.
+type ReadCloserInfo interface {
+	io.ReadCloser
+
+	// Size returns the length of the content in bytes.
+	Size() int64
+	// ModTime returns the modification time.
+	ModTime() time.Time
+	// ContentType returns the content type, if known.
+	ContentType() string
+}
+
 // Writer is the interface that is returned by bucket.Create.
 type Writer interface {
 	io.Writer
@@ -59,15 +72,25 @@ type Writer interface {
 }
 
 // Metadata contains metadata values.
+//
+// Keys are case insensitive and stored in canonical form, i.e. underscores
+// are replaced by hyphens and the result is canonicalized by
+// textproto.CanonicalMIMEHeaderKey, e.g. "foo_bar" becomes "Foo-Bar". Most
+// backends do not preserve the exact spelling of keys (S3 and GCS lowercase
+// them, Azure disallows hyphens), so keys are canonicalized identically on
+// write (see WriteOptions.GetMetadata) and read (see NormMetadata).
 type Metadata map[string]string
 
 // NormMetadata canonicalizes kv pairs (inline) and
-// returns the result.
+// returns the result. If multiple keys map to the same canonical key, an
+// existing value under the canonical key takes precedence.
 func NormMetadata(kv map[string]string) Metadata {
 	for k, v := range kv {
 		if l := canonicalize(k); l != k {
 			delete(kv, k)
-			kv[l] = v
+			if _, ok := kv[l]; !ok {
+				kv[l] = v
+			}
 		}
 	}
 	return kv
@@ -105,6 +128,50 @@ func canonicalize(key string) string {
 type WriteOptions struct {
 	ContentType string
 	Metadata    Metadata
+
+	// CacheControl, ContentEncoding, ContentDisposition and ContentLanguage
+	// set the respective HTTP headers of the object, if supported by the
+	// backend.
+	CacheControl       string
+	ContentEncoding    string
+	ContentDisposition string
+	ContentLanguage    string
+
+	// ACL is an optional, backend-specific access control setting. When blank,
+	// the bucket's defaults are applied.
+	ACL string
+
+	// RetainUntil and LockMode (e.g. GOVERNANCE or COMPLIANCE) apply a
+	// write-once-read-many retention lock to the object. Backends which
+	// cannot honor retention return ErrNotSupported on Create.
+	RetainUntil time.Time
+	LockMode    string
+
+	// VerifyAfterWrite checks objects after a successful commit, returning
+	// ErrVerifyFailed if the stored size differs from the written one. With
+	// VerifyContent, objects are also read back in full and checksummed.
+	// Verification is applied by CreateObject and the helpers built on it.
+	VerifyAfterWrite bool
+	VerifyContent    bool
+
+	// Size is an optional hint of the total number of bytes which will be
+	// written. Backends may use it to optimize uploads, e.g. to avoid
+	// buffering or to choose between single and multipart uploads. It is
+	// purely advisory, writing more or fewer bytes is handled gracefully.
+	Size int64
+
+	// ChecksumAlgorithm requests an additional integrity checksum, e.g.
+	// CRC32C or SHA256, which is verified by the backend on upload and
+	// stored with the object. Backends which do not support additional
+	// checksums ignore it.
+	ChecksumAlgorithm string
+
+	// ExpiresIn records an expiry for ephemeral objects, relative to the time
+	// of the write, in the MetaExpiresAt metadata entry. Object stores do not
+	// delete expired objects by themselves, see Expirer. Backends may
+	// additionally apply native expiry hints. Backends without metadata
+	// support reject writes with ExpiresIn with ErrNotSupported.
+	ExpiresIn time.Duration
 }
 
 // GetContentType returns a content type.
@@ -115,12 +182,95 @@ func (o *WriteOptions) GetContentType() string {
 	return ""
 }
 
-// GetMetadata returns a content type.
+// GetCacheControl returns the Cache-Control header.
+func (o *WriteOptions) GetCacheControl() string {
+	if o != nil {
+		return o.CacheControl
+	}
+	return ""
+}
+
+// GetContentEncoding returns the Content-Encoding header.
+func (o *WriteOptions) GetContentEncoding() string {
+	if o != nil {
+		return o.ContentEncoding
+	}
+	return ""
+}
+
+// GetContentDisposition returns the Content-Disposition header.
+func (o *WriteOptions) GetContentDisposition() string {
+	if o != nil {
+		return o.ContentDisposition
+	}
+	return ""
+}
+
+// GetContentLanguage returns the Content-Language header.
+func (o *WriteOptions) GetContentLanguage() string {
+	if o != nil {
+		return o.ContentLanguage
+	}
+	return ""
+}
+
+// GetACL returns the ACL.
+func (o *WriteOptions) GetACL() string {
+	if o != nil {
+		return o.ACL
+	}
+	return ""
+}
+
+// GetRetention returns the retention lock mode and date.
+func (o *WriteOptions) GetRetention() (mode string, until time.Time) {
+	if o != nil {
+		return o.LockMode, o.RetainUntil
+	}
+	return "", time.Time{}
+}
+
+// GetSize returns the size hint.
+func (o *WriteOptions) GetSize() int64 {
+	if o != nil {
+		return o.Size
+	}
+	return 0
+}
+
+// GetChecksumAlgorithm returns the checksum algorithm.
+func (o *WriteOptions) GetChecksumAlgorithm() string {
+	if o != nil {
+		return o.ChecksumAlgorithm
+	}
+	return ""
+}
+
+// GetExpiresIn returns the expiry duration.
+func (o *WriteOptions) GetExpiresIn() time.Duration {
+	if o != nil {
+		return o.ExpiresIn
+	}
+	return 0
+}
+
+// HasRetention returns true if a retention lock was requested.
+func (o *WriteOptions) HasRetention() bool {
+	mode, until := o.GetRetention()
+	return mode != "" || !until.IsZero()
+}
+
+// GetMetadata returns the metadata. If ExpiresIn is set, the expiry is
+// recorded in MetaExpiresAt, unless present already.
 func (o *WriteOptions) GetMetadata() Metadata {
 	if o != nil {
 		meta := make(Metadata, len(o.Metadata))
 		for k, v := range o.Metadata {
-			meta.Set(k, v)
+			meta[k] = v
+		}
+		meta = NormMetadata(meta)
+		if o.ExpiresIn > 0 && meta.Get(MetaExpiresAt) == "" {
+			meta.Set(MetaExpiresAt, internal.Now().Add(o.ExpiresIn).UTC().Format(time.RFC3339))
 		}
 		return meta
 	}
@@ -136,6 +286,48 @@ type MetaInfo struct {
 	ModTime     time.Time // modification time
 	ContentType string    // content type
 	Metadata    Metadata  // metadata
+
+	CacheControl       string // Cache-Control header, if supported
+	ContentEncoding    string // Content-Encoding header, if supported
+	ContentDisposition string // Content-Disposition header, if supported
+	ContentLanguage    string // Content-Language header, if supported
+
+	Version     string    // opaque version identifier, if supported (e.g. GCS generation, S3 ETag)
+	RetainUntil time.Time // retention lock date, if supported
+	LockMode    string    // retention lock mode, if supported
+
+	TemporaryHold  bool // true if a temporary hold prevents deletion, if supported
+	EventBasedHold bool // true if an event-based hold prevents deletion, if supported
+
+	StorageClass  string    // storage class, if supported
+	Restoring     bool      // true while an archived object is being restored
+	RestoredUntil time.Time // expiry of the restored copy of an archived object
+
+	// Extra contains additional backend-specific attributes, if supported.
+	// Keys and values are not portable across backends, e.g. bfss3 reports
+	// raw response headers such as "x-amz-restore".
+	Extra map[string]string
+}
+
+// BucketInfo describes the location of a bucket, e.g. for logging.
+type BucketInfo struct {
+	Scheme string // URL scheme, e.g. "s3"
+	Bucket string // bucket or container name, host or root directory
+	Prefix string // optional path prefix, with trailing slash
+}
+
+// String returns a URL-like representation, e.g. "s3://bucket/prefix/".
+func (i BucketInfo) String() string {
+	if i.Prefix != "" {
+		return i.Scheme + "://" + i.Bucket + "/" + i.Prefix
+	}
+	return i.Scheme + "://" + i.Bucket
+}
+
+// Grant is a backend-neutral access control entry of an object.
+type Grant struct {
+	Grantee    string // grantee, e.g. a canonical user ID, email address, group URI or GCS entity
+	Permission string // granted permission, e.g. "READ" (S3) or "READER" (GCS)
 }
 
 // Iterator iterates over objects
@@ -158,16 +350,105 @@ type supportsCopying interface {
 	Copy(context.Context, string, string) error
 }
 
-// --------------------------------------------------------------------
+type supportsSortedGlob interface {
+	SortedGlob(context.Context, string) (Iterator, error)
+}
 
-var (
-	registry     = map[string]Resolver{}
-	registryLock sync.Mutex
-)
+type supportsGlobAfter interface {
+	GlobAfter(context.Context, string, string) (Iterator, error)
+}
+
+type supportsConditionalUpdate interface {
+	ConditionalUpdate(context.Context, string, func([]byte) ([]byte, error)) error
+}
+
+type supportsDescribe interface {
+	Describe() BucketInfo
+}
+
+type supportsRename interface {
+	Rename(context.Context, string, string) error
+}
+
+type supportsPing interface {
+	Ping(context.Context) error
+}
+
+type supportsGrants interface {
+	Grants(context.Context, string) ([]Grant, error)
+}
+
+type supportsRemoveIfMatch interface {
+	RemoveIfMatch(context.Context, string, string) error
+}
+
+type supportsMkdir interface {
+	Mkdir(context.Context, string) error
+}
+
+// readerWithContentEncoding is implemented by readers which know the
+// encoding of the body as served, i.e. after any decoding in transit.
+type readerWithContentEncoding interface {
+	ContentEncoding() string
+}
+
+type supportsOpenRange interface {
+	OpenRange(context.Context, string, int64, int64) (Reader, error)
+}
+
+type supportsReset interface {
+	Reset() error
+}
+
+// --------------------------------------------------------------------
 
 // Resolver constructs a bucket from a URL.
 type Resolver func(context.Context, *url.URL) (Bucket, error)
 
+// Registry maps URL schemes to resolvers. The package-level Register,
+// Resolve, Connect and ConnectWith functions use a global default registry,
+// which is populated by the backend packages on import. Separate registries
+// allow to resolve the same scheme differently, without modifying global
+// state. The zero value is an empty registry, ready to use.
+type Registry struct {
+	resolvers map[string]Resolver
+	mu        sync.Mutex
+}
+
+var defaultRegistry Registry
+
+// Register registers a new protocol with a scheme and a corresponding
+// resolver. It panics if the scheme is already registered.
+func (r *Registry) Register(scheme string, resv Resolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.resolvers[scheme]; exists {
+		panic("protocol " + scheme + " already registered")
+	}
+	if r.resolvers == nil {
+		r.resolvers = make(map[string]Resolver)
+	}
+	r.resolvers[scheme] = resv
+}
+
+// Resolve opens a bucket from a URL.
+func (r *Registry) Resolve(ctx context.Context, u *url.URL) (Bucket, error) {
+	r.mu.Lock()
+	resv, ok := r.resolvers[u.Scheme]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("bfs: unknown URL scheme %q", u.Scheme)
+	}
+
+	return resv(ctx, u)
+}
+
+// Connect connects to a bucket via URL.
+func (r *Registry) Connect(ctx context.Context, urlStr string) (Bucket, error) {
+	return r.ConnectWith(ctx, urlStr)
+}
+
 // Resolve opens a bucket from a URL. Example (from bfs/bfsfs):
 //
 //   bfs.Register("file", func(_ context.Context, u *url.URL) (bfs.Bucket, error) {
@@ -179,14 +460,7 @@ type Resolver func(context.Context, *url.URL) (Bucket, error)
 //   bucket, err := bfs.Resolve(context.TODO(), u)
 //   ...
 func Resolve(ctx context.Context, u *url.URL) (Bucket, error) {
-	registryLock.Lock()
-	resv, ok := registry[u.Scheme]
-	registryLock.Unlock()
-	if !ok {
-		return nil, fmt.Errorf("bfs: unknown URL scheme %q", u.Scheme)
-	}
-
-	return resv(ctx, u)
+	return defaultRegistry.Resolve(ctx, u)
 }
 
 // Connect connects to a bucket via URL. Example (from bfs/bfsfs):
@@ -197,11 +471,7 @@ func Resolve(ctx context.Context, u *url.URL) (Bucket, error) {
 //
 //   bucket, err := bfs.Connect(context.TODO(), "file:///home/user/Documents")
 func Connect(ctx context.Context, urlStr string) (Bucket, error) {
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return nil, err
-	}
-	return Resolve(ctx, u)
+	return ConnectWith(ctx, urlStr)
 }
 
 // Register registers a new protocol with a scheme and a corresponding resolver.
@@ -214,11 +484,5 @@ func Connect(ctx context.Context, urlStr string) (Bucket, error) {
 //   bucket, err := bfs.Connect(context.TODO(), "file:///home/user/Documents")
 //   ...
 func Register(scheme string, resv Resolver) {
-	registryLock.Lock()
-	defer registryLock.Unlock()
-
-	if _, exists := registry[scheme]; exists {
-		panic("protocol " + scheme + " already registered")
-	}
-	registry[scheme] = resv
+	defaultRegistry.Register(scheme, resv)
 }
@@ -24,6 +24,7 @@ package bfsaz
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
@@ -88,6 +89,9 @@ type Config struct {
 	// AZURE_STORAGE_ACCESS_KEY env variable and fallback on anonymous access
 	// if not found.
 	Credential azblob.Credential
+
+	// SanitizeNames validates blob names with bfs.SanitizeName before use.
+	SanitizeNames bool
 }
 
 func (c *Config) norm() error {
@@ -156,17 +160,25 @@ func (b *bucket) stripPrefix(name string) string {
 	return name
 }
 
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) withPrefix(name string) string {
 	if b.config.Prefix == "" {
 		return name
 	}
-	return internal.WithinNamespace(b.config.Prefix, name)
+	return internal.WithinNamespaceKey(b.config.Prefix, name)
+}
+
+// SortedGlob implements Glob, Azure lists names in lexicographic order.
+func (b *bucket) SortedGlob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	return b.Glob(ctx, pattern)
 }
 
 // Glob implements bfs.Bucket.
 func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
-	// quick sanity check
-	if _, err := doublestar.Match(pattern, ""); err != nil {
+	if err := bfs.ValidatePattern(pattern); err != nil {
 		return nil, err
 	}
 
@@ -179,6 +191,11 @@ func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error)
 
 // Head implements bfs.Bucket.
 func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := b.NewBlockBlobURL(b.withPrefix(name)).
 		GetProperties(ctx, azblob.BlobAccessConditions{})
 	if err != nil {
@@ -196,6 +213,11 @@ func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
 
 // Open implements bfs.Bucket.
 func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := b.NewBlockBlobURL(b.withPrefix(name)).
 		Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
 	if err != nil {
@@ -210,6 +232,15 @@ func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
 
 // Create implements bfs.Bucket.
 func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.HasRetention() {
+		return nil, bfs.ErrNotSupported
+	}
+
 	f, err := ioutil.TempFile("", "bfs-az")
 	if err != nil {
 		return nil, err
@@ -225,7 +256,12 @@ func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions
 
 // Remove implements bfs.Bucket.
 func (b *bucket) Remove(ctx context.Context, name string) error {
-	_, err := b.NewBlockBlobURL(b.withPrefix(name)).
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.NewBlockBlobURL(b.withPrefix(name)).
 		Delete(ctx, "", azblob.BlobAccessConditions{})
 	if ne := normError(err); ne != nil && ne != bfs.ErrNotFound {
 		return ne
@@ -233,6 +269,22 @@ func (b *bucket) Remove(ctx context.Context, name string) error {
 	return nil
 }
 
+// Ping checks that the container exists and is accessible by retrieving its
+// properties.
+func (b *bucket) Ping(ctx context.Context) error {
+	if _, err := b.GetProperties(ctx, azblob.LeaseAccessConditions{}); err != nil {
+		return fmt.Errorf("bfsaz: unable to reach container %q: %w", b.URL().Path, normError(err))
+	}
+	return nil
+}
+
+// Describe returns information about the container, the Bucket field
+// contains the storage account host and the container name.
+func (b *bucket) Describe() bfs.BucketInfo {
+	u := b.URL()
+	return bfs.BucketInfo{Scheme: "az", Bucket: u.Host + u.Path, Prefix: b.config.Prefix}
+}
+
 // Close implements bfs.Bucket.
 func (*bucket) Close() error { return nil }
 
@@ -399,6 +451,16 @@ func (i *iterator) Next() bool {
 
 func (i *iterator) Error() error { return i.err }
 
+// Reset restarts the listing from the first page.
+func (i *iterator) Reset() error {
+	i.marker = azblob.Marker{}
+	i.err = nil
+	i.last = false
+	i.page = i.page[:0]
+	i.pos = -1
+	return nil
+}
+
 func (i *iterator) fetchNextPage() error {
 	i.page = i.page[:0]
 	i.pos = -1
@@ -29,9 +29,13 @@ var _ = Describe("Bucket", func() {
 		readonly, err := bfsaz.New(containerURL, &bfsaz.Config{Prefix: "m/"})
 		Expect(err).NotTo(HaveOccurred())
 
+		sanitized, err := bfsaz.New(containerURL, &bfsaz.Config{Prefix: prefix, SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
 		opts = lint.Options{
-			Subject:  subject,
-			Readonly: readonly,
+			Subject:   subject,
+			Readonly:  readonly,
+			Sanitized: sanitized,
 
 			Metadata:    true,
 			ContentType: true,
@@ -39,6 +43,15 @@ var _ = Describe("Bucket", func() {
 	})
 
 	Context("defaults", lint.Lint(&opts))
+
+	It("should describe containers", func() {
+		subject, err := bfsaz.New(containerURL, &bfsaz.Config{Prefix: "a/b"})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "az", Bucket: "blacksquaremedia.blob.core.windows.net/bfs-unittest", Prefix: "a/b/"}))
+	})
 })
 
 // ------------------------------------------------------------------------
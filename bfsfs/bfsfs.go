@@ -17,17 +17,23 @@
 //
 // bfs.Connect supports the following query parameters:
 //
-//   tmpdir - custom temp dir
+//   tmpdir          - custom temp dir
+//   followsymlinks  - follow symbolic links in Glob (true/false, default: true)
+//   caseinsensitive - normalize names to lower case (true/false)
 //
 package bfsfs
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/bsm/bfs"
 )
@@ -36,7 +42,28 @@ func init() {
 	bfs.Register("file", func(_ context.Context, u *url.URL) (bfs.Bucket, error) {
 		root := path.Join(u.Host, u.Path) // to handle special relative cases like: "file://this-works-like-a-host/path..."
 		q := u.Query()
-		return New(root, q.Get("tmpdir"))
+
+		followSymlinks := true
+		if s := q.Get("followsymlinks"); s != "" {
+			var err error
+			if followSymlinks, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("bfsfs: invalid followsymlinks value %q", s)
+			}
+		}
+
+		caseInsensitive := false
+		if s := q.Get("caseinsensitive"); s != "" {
+			var err error
+			if caseInsensitive, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("bfsfs: invalid caseinsensitive value %q", s)
+			}
+		}
+
+		return NewWithConfig(root, &Config{
+			TempDir:         q.Get("tmpdir"),
+			FollowSymlinks:  followSymlinks,
+			CaseInsensitive: caseInsensitive,
+		})
 	})
 }
 
@@ -54,6 +81,31 @@ func normError(err error) error {
 
 // --------------------------------------------------------------------
 
+// reader wraps an opened file and exposes file info.
+type reader struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (r *reader) Size() int64         { return r.info.Size() }
+func (r *reader) ModTime() time.Time  { return r.info.ModTime() }
+func (r *reader) ContentType() string { return "" }
+
+// rangeReader reads a section of a file. It must not embed the file, promoted
+// methods like WriteTo would bypass the section.
+type rangeReader struct {
+	*io.SectionReader
+	file *os.File
+	info os.FileInfo
+}
+
+func (r *rangeReader) Close() error        { return r.file.Close() }
+func (r *rangeReader) Size() int64         { return r.info.Size() }
+func (r *rangeReader) ModTime() time.Time  { return r.info.ModTime() }
+func (r *rangeReader) ContentType() string { return "" }
+
+// --------------------------------------------------------------------
+
 // atomicFile represents a file, that's written only on Close.
 type atomicFile struct {
 	*os.File
@@ -2,11 +2,12 @@ package bfsfs
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/bmatcuk/doublestar"
 	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/internal"
 )
@@ -15,60 +16,135 @@ import (
 type bucket struct {
 	fsRoot string
 	root   string
-	tmpDir string
+	config *Config
+}
+
+// Config is passed to NewWithConfig to configure the bucket.
+type Config struct {
+	// TempDir is used for file atomicity, defaults to standard tmp dir if blank.
+	TempDir string
+	// FollowSymlinks controls how Glob treats symbolic links. When enabled,
+	// symlinks to files are listed under the name of the link and symlinks
+	// to directories are traversed. Links which point to one of their own
+	// parent directories are not traversed to prevent infinite loops, broken
+	// links are skipped. When disabled, symlinks are skipped entirely.
+	// Buckets created via New or bfs.Connect follow symlinks by default.
+	FollowSymlinks bool
+	// CaseInsensitive normalizes all names and patterns with
+	// bfs.NormalizeName, i.e. objects are stored and looked up in lower
+	// case and Glob yields lower case names. This ensures consistent
+	// behaviour on case-sensitive and case-insensitive file systems (e.g.
+	// macOS HFS+/APFS). Existing files with upper case names are not
+	// accessible.
+	CaseInsensitive bool
+	// SanitizeNames rejects names which would resolve outside of the root
+	// directory, see bfs.SanitizeName.
+	SanitizeNames bool
 }
 
 // New initiates an bfs.Bucket backed by local file system.
 // tmpDir is used for file atomicity, defaults to standard tmp dir if blank.
 func New(root, tmpDir string) (bfs.Bucket, error) {
+	return NewWithConfig(root, &Config{TempDir: tmpDir, FollowSymlinks: true})
+}
+
+// NewWithConfig initiates an bfs.Bucket backed by local file system.
+func NewWithConfig(root string, cfg *Config) (bfs.Bucket, error) {
 	if root == "" {
 		root = "."
 	}
 	root = filepath.Clean(root)
 
+	config := new(Config)
+	if cfg != nil {
+		*config = *cfg
+	}
+
 	return &bucket{
 		fsRoot: root + string(filepath.Separator), // root should always have trailing slash to trim file names properly
 		root:   filepath.ToSlash(root),
-		tmpDir: tmpDir,
+		config: config,
 	}, nil
 }
 
 // Glob lists the files mathing a glob pattern.
-func (b *bucket) Glob(_ context.Context, pattern string) (bfs.Iterator, error) {
-	if pattern == "" { // would return just current dir
-		return newIterator(nil), nil
+func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
+		return nil, err
 	}
 
-	matches, err := doublestar.Glob(b.fullPath(pattern))
+	// patterns are scoped within root, like names
+	pattern = strings.TrimPrefix(internal.WithinNamespace("/", b.normName(pattern)), "/")
+
+	files, err := b.glob(ctx, pattern)
+	if err != nil && err != ctx.Err() {
+		return nil, err
+	}
+
+	// like with remote backends, context errors are reported by the iterator
+	iter := newIterator(files)
+	iter.err = err
+	iter.relist = func() ([]file, error) { return b.glob(ctx, pattern) }
+	return iter, nil
+}
+
+// SortedGlob implements Glob with lexicographic ordering of names. All
+// matching files are collected in memory before iteration, just like with
+// Glob.
+func (b *bucket) SortedGlob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	iter, err := b.Glob(ctx, pattern)
 	if err != nil {
+		return nil, err
+	}
+
+	sorted := iter.(*iterator)
+	sortFiles(sorted.files)
+	relist := sorted.relist
+	sorted.relist = func() ([]file, error) {
+		files, err := relist()
+		sortFiles(files)
+		return files, err
+	}
+	return sorted, nil
+}
+
+func (b *bucket) glob(ctx context.Context, pattern string) ([]file, error) {
+	w := &walker{
+		ctx:            ctx,
+		pattern:        pattern,
+		followSymlinks: b.config.FollowSymlinks,
+	}
+	if err := w.Walk(b.fsRoot, staticPrefix(pattern)); err != nil {
 		return nil, normError(err)
 	}
+	return w.files, nil
+}
 
-	files := make([]file, 0, len(matches))
-	for _, match := range matches {
-		if fi, err := os.Stat(match); err != nil {
-			return nil, normError(err)
-		} else if fi.Mode().IsRegular() {
-			fsPath := strings.TrimPrefix(match, b.fsRoot) // filesystem path (with OS-specific separators)
-			name := filepath.ToSlash(fsPath)
-			files = append(files, file{
-				name:    name,
-				size:    fi.Size(),
-				modTime: fi.ModTime(),
-			})
-		}
+// Ping checks that the root directory exists.
+func (b *bucket) Ping(_ context.Context) error {
+	fi, err := os.Stat(filepath.FromSlash(b.root))
+	if err != nil {
+		return fmt.Errorf("bfsfs: unable to access root %q: %w", b.root, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("bfsfs: root %q is not a directory", b.root)
 	}
-	return newIterator(files), nil
+	return nil
 }
 
 // Head implements bfs.Bucket
 func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	fi, err := os.Stat(b.fullPath(name))
 	if err != nil {
 		return nil, normError(err)
 	}
 	return &bfs.MetaInfo{
-		Name:    name,
+		Name:    b.normName(name),
 		Size:    fi.Size(),
 		ModTime: fi.ModTime(),
 	}, nil
@@ -76,16 +152,67 @@ func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
 
 // Open implements bfs.Bucket
 func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	f, err := os.Open(b.fullPath(name))
 	if err != nil {
 		return nil, normError(err)
 	}
-	return f, nil
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, normError(err)
+	}
+	return &reader{File: f, info: fi}, nil
+}
+
+// OpenRange opens a file for reading, like Open, but only reads up to length
+// bytes, starting at offset.
+func (b *bucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := bfs.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(b.fullPath(name))
+	if err != nil {
+		return nil, normError(err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, normError(err)
+	}
+	return &rangeReader{
+		SectionReader: io.NewSectionReader(f, offset, length),
+		file:          f,
+		info:          fi,
+	}, nil
 }
 
 // Create implements bfs.Bucket
-func (b *bucket) Create(ctx context.Context, name string, _ *bfs.WriteOptions) (bfs.Writer, error) {
-	f, err := openAtomicFile(ctx, b.fullPath(name), b.tmpDir)
+func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	if opts.HasRetention() || opts.GetExpiresIn() > 0 {
+		return nil, bfs.ErrNotSupported
+	}
+
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(name, "/") {
+		return nil, fmt.Errorf("%w: %q: trailing slash, use bfs.Mkdir to create directories", bfs.ErrInvalidName, name)
+	}
+
+	f, err := openAtomicFile(ctx, b.fullPath(name), b.config.TempDir)
 	if err != nil {
 		return nil, normError(err)
 	}
@@ -94,18 +221,70 @@ func (b *bucket) Create(ctx context.Context, name string, _ *bfs.WriteOptions) (
 
 // Remove implements bfs.Bucket
 func (b *bucket) Remove(ctx context.Context, name string) error {
-	err := os.Remove(b.fullPath(name))
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(b.fullPath(name))
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
+// Mkdir creates a directory, including missing parents.
+func (b *bucket) Mkdir(_ context.Context, prefix string) error {
+	prefix, err := b.checkName(prefix)
+	if err != nil {
+		return err
+	}
+	return normError(os.MkdirAll(b.fullPath(prefix), 0777))
+}
+
+// Rename moves a file with os.Rename, which is atomic. Missing parent
+// directories of dst are created. If dst is on a different file system, the
+// file is copied and removed instead.
+func (b *bucket) Rename(ctx context.Context, src, dst string) error {
+	src, err := b.checkName(src)
+	if err != nil {
+		return err
+	}
+	if dst, err = b.checkName(dst); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(b.fullPath(src))
+	if err != nil {
+		return normError(err)
+	} else if b.fullPath(src) == b.fullPath(dst) {
+		return nil
+	}
+	return normError(b.moveFile(ctx, file{name: src, modTime: fi.ModTime()}, dst))
+}
+
+// Describe returns information about the bucket, the Bucket field contains
+// the root directory.
+func (b *bucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "file", Bucket: b.root}
+}
+
 // Close implements bfs.Bucket
 func (b *bucket) Close() error {
 	return nil // noop
 }
 
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) fullPath(name string) string {
-	return filepath.FromSlash(internal.WithinNamespace(b.root, filepath.ToSlash(name)))
+	return filepath.FromSlash(internal.WithinNamespace(b.root, filepath.ToSlash(b.normName(name))))
+}
+
+func (b *bucket) normName(name string) string {
+	if b.config.CaseInsensitive {
+		return bfs.NormalizeName(name)
+	}
+	return name
 }
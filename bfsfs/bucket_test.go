@@ -1,9 +1,17 @@
 package bfsfs_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/bfsfs"
 	"github.com/bsm/bfs/testdata/lint"
 
@@ -24,8 +32,12 @@ var _ = Describe("Bucket", func() {
 		subject, err := bfsfs.New(dir, "")
 		Expect(err).NotTo(HaveOccurred())
 
+		sanitized, err := bfsfs.NewWithConfig(dir, &bfsfs.Config{SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
 		opts = lint.Options{
-			Subject: subject,
+			Subject:   subject,
+			Sanitized: sanitized,
 		}
 	})
 
@@ -36,4 +48,369 @@ var _ = Describe("Bucket", func() {
 	})
 
 	Context("defaults", lint.Lint(&opts))
+
+	It("should describe buckets", func() {
+		info, ok := bfs.Describe(opts.Subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "file", Bucket: filepath.ToSlash(dir)}))
+	})
+
+	It("should ping buckets", func() {
+		ctx := context.Background()
+		Expect(bfs.Ping(ctx, opts.Subject)).To(Succeed())
+
+		missing, err := bfsfs.New(filepath.Join(dir, "missing"), "")
+		Expect(err).NotTo(HaveOccurred())
+		err = bfs.Ping(ctx, missing)
+		Expect(err).To(HaveOccurred())
+		Expect(os.IsNotExist(errors.Unwrap(err))).To(BeTrue())
+
+		Expect(bfs.WriteObject(ctx, opts.Subject, "file.txt", []byte("testdata"), nil)).To(Succeed())
+		file, err := bfsfs.New(filepath.Join(dir, "file.txt"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfs.Ping(ctx, file)).To(MatchError(ContainSubstring("is not a directory")))
+	})
+
+	It("should glob missing directories", func() {
+		ctx := context.Background()
+		Expect(bfs.WriteObject(ctx, opts.Subject, "a.txt", []byte("testdata"), nil)).To(Succeed())
+
+		for _, pattern := range []string{"missing/**", "missing/*/*.txt", "a.txt/**", "a.txt/b/*"} {
+			iter, err := opts.Subject.Glob(ctx, pattern)
+			Expect(err).NotTo(HaveOccurred(), "for %s", pattern)
+			Expect(iter.Next()).To(BeFalse(), "for %s", pattern)
+			Expect(iter.Error()).NotTo(HaveOccurred(), "for %s", pattern)
+			Expect(iter.Close()).To(Succeed())
+		}
+
+		missing, err := bfsfs.New(filepath.Join(dir, "missing"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list(ctx, missing, "**")).To(BeEmpty())
+	})
+
+	It("should rename files", func() {
+		ctx := context.Background()
+		Expect(bfs.WriteObject(ctx, opts.Subject, "a.txt", []byte("testdata"), nil)).To(Succeed())
+
+		Expect(bfs.Rename(ctx, opts.Subject, "a.txt", "b/c.txt")).To(Succeed())
+		Expect(filepath.Join(dir, "a.txt")).NotTo(BeAnExistingFile())
+		Expect(ioutil.ReadFile(filepath.Join(dir, "b", "c.txt"))).To(Equal([]byte("testdata")))
+
+		Expect(bfs.Rename(ctx, opts.Subject, "a.txt", "d.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should not remove files renamed onto themselves", func() {
+		ctx := context.Background()
+		Expect(bfs.WriteObject(ctx, opts.Subject, "a.txt", []byte("testdata"), nil)).To(Succeed())
+
+		renamer := opts.Subject.(interface {
+			Rename(context.Context, string, string) error
+		})
+		Expect(renamer.Rename(ctx, "a.txt", "a.txt")).To(Succeed())
+		Expect(renamer.Rename(ctx, "/a.txt", "a.txt")).To(Succeed())
+		Expect(ioutil.ReadFile(filepath.Join(dir, "a.txt"))).To(Equal([]byte("testdata")))
+
+		Expect(renamer.Rename(ctx, "b.txt", "b.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should make directories", func() {
+		ctx := context.Background()
+		Expect(bfs.Mkdir(ctx, opts.Subject, "a/b/")).To(Succeed())
+		Expect(filepath.Join(dir, "a", "b")).To(BeADirectory())
+		Expect(list(ctx, opts.Subject, "**")).To(BeEmpty())
+
+		_, err := opts.Subject.Create(ctx, "c/", nil)
+		Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue())
+		Expect(filepath.Join(dir, "c")).NotTo(BeAnExistingFile())
+	})
+
+	It("should read heads", func() {
+		ctx := context.Background()
+		Expect(bfs.WriteObject(ctx, opts.Subject, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.ReadHead(ctx, opts.Subject, "a.txt", 4)).To(Equal([]byte("test")))
+		Expect(bfs.ReadHead(ctx, opts.Subject, "a.txt", 100)).To(Equal([]byte("testdata")))
+
+		r, err := opts.Subject.(interface {
+			OpenRange(context.Context, string, int64, int64) (bfs.Reader, error)
+		}).OpenRange(ctx, "a.txt", 2, 4)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(r.(bfs.ReadCloserInfo).Size()).To(Equal(int64(8)))
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("stda")))
+
+		// io.Copy must not bypass the section via io.WriterTo
+		r, err = opts.Subject.(interface {
+			OpenRange(context.Context, string, int64, int64) (bfs.Reader, error)
+		}).OpenRange(ctx, "a.txt", 2, 4)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		var buf bytes.Buffer
+		Expect(io.Copy(&buf, r)).To(Equal(int64(4)))
+		Expect(buf.String()).To(Equal("stda"))
+
+		for _, rng := range [][2]int64{{-2, 4}, {2, 0}, {2, -1}} {
+			_, err = opts.Subject.(interface {
+				OpenRange(context.Context, string, int64, int64) (bfs.Reader, error)
+			}).OpenRange(ctx, "a.txt", rng[0], rng[1])
+			Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue(), "%v", rng)
+		}
+	})
+
+	It("should reject retention locks and expiry", func() {
+		_, err := opts.Subject.Create(context.Background(), "locked.txt", &bfs.WriteOptions{
+			RetainUntil: time.Now().Add(time.Hour),
+		})
+		Expect(err).To(Equal(bfs.ErrNotSupported))
+
+		_, err = opts.Subject.Create(context.Background(), "ephemeral.txt", &bfs.WriteOptions{
+			ExpiresIn: time.Hour,
+		})
+		Expect(err).To(Equal(bfs.ErrNotSupported))
+	})
+
+	Describe("case insensitive", func() {
+		var subject bfs.Bucket
+		var ctx = context.Background()
+
+		BeforeEach(func() {
+			var err error
+			subject, err = bfsfs.NewWithConfig(dir, &bfsfs.Config{CaseInsensitive: true})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should normalize names", func() {
+			Expect(bfs.WriteObject(ctx, subject, "Path/To/File.TXT", []byte("v1"), nil)).To(Succeed())
+			Expect(filepath.Join(dir, "path", "to", "file.txt")).To(BeARegularFile())
+
+			info, err := subject.Head(ctx, "PATH/to/file.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Name).To(Equal("path/to/file.txt"))
+
+			r, err := subject.Open(ctx, "path/TO/FILE.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadAll(r)).To(Equal([]byte("v1")))
+			Expect(r.Close()).To(Succeed())
+		})
+
+		It("should treat case-colliding names as the same object", func() {
+			Expect(bfs.WriteObject(ctx, subject, "README.md", []byte("v1"), nil)).To(Succeed())
+			Expect(bfs.WriteObject(ctx, subject, "readme.MD", []byte("v2"), nil)).To(Succeed())
+
+			iter, err := subject.Glob(ctx, "README.*")
+			Expect(err).NotTo(HaveOccurred())
+			defer iter.Close()
+
+			Expect(iter.Next()).To(BeTrue())
+			Expect(iter.Name()).To(Equal("readme.md"))
+			Expect(iter.Size()).To(Equal(int64(2)))
+			Expect(iter.Next()).To(BeFalse())
+
+			Expect(subject.Remove(ctx, "ReadMe.md")).To(Succeed())
+			_, err = subject.Head(ctx, "readme.md")
+			Expect(err).To(Equal(bfs.ErrNotFound))
+		})
+
+		It("should keep names by default", func() {
+			Expect(bfs.WriteObject(ctx, opts.Subject, "README.md", []byte("v1"), nil)).To(Succeed())
+			Expect(filepath.Join(dir, "README.md")).To(BeARegularFile())
+		})
+	})
+
+	Describe("symlinks", func() {
+		var ctx = context.Background()
+
+		glob := func(subject bfs.Bucket, pattern string) []string {
+			iter, err := subject.Glob(ctx, pattern)
+			Expect(err).NotTo(HaveOccurred())
+			defer iter.Close()
+
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			return names
+		}
+
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(dir, "a", "b"), 0777)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "a", "b", "file.txt"), []byte("TESTDATA"), 0666)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(dir, "a", "b", "file.txt"), filepath.Join(dir, "a", "link.txt"))).To(Succeed())
+			Expect(os.Symlink(filepath.Join(dir, "a", "b"), filepath.Join(dir, "c"))).To(Succeed())
+			Expect(os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "a", "b", "cycle"))).To(Succeed())
+			Expect(os.Symlink(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "broken.txt"))).To(Succeed())
+		})
+
+		It("should follow symlinks by default", func() {
+			Expect(glob(opts.Subject, "**")).To(ConsistOf(
+				"a/b/file.txt",
+				"a/link.txt",
+				"c/file.txt",
+				"c/cycle/link.txt",
+			))
+			Expect(glob(opts.Subject, "c/*")).To(ConsistOf("c/file.txt"))
+		})
+
+		It("should skip symlinks if disabled", func() {
+			subject, err := bfsfs.NewWithConfig(dir, &bfsfs.Config{FollowSymlinks: false})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(glob(subject, "**")).To(ConsistOf("a/b/file.txt"))
+			Expect(glob(subject, "c/*")).To(BeEmpty())
+		})
+
+		It("should only descend into matching directories", func() {
+			Expect(glob(opts.Subject, "*/*.txt")).To(ConsistOf("a/link.txt", "c/file.txt"))
+			Expect(glob(opts.Subject, "a/*/*.txt")).To(ConsistOf("a/b/file.txt"))
+			Expect(glob(opts.Subject, "?/cycle/*")).To(ConsistOf("c/cycle/link.txt"))
+			Expect(glob(opts.Subject, "**/file.txt")).To(ConsistOf("a/b/file.txt", "c/file.txt"))
+			Expect(glob(opts.Subject, "{a,c}/*")).To(ConsistOf("a/link.txt", "c/file.txt"))
+			Expect(glob(opts.Subject, "*")).To(BeEmpty())
+		})
+	})
+
+	Describe("trees", func() {
+		var ctx = context.Background()
+		var modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		type treeCopier interface {
+			CopyTree(context.Context, string, string) error
+			MoveTree(context.Context, string, string) error
+		}
+
+		BeforeEach(func() {
+			for _, name := range []string{"src/a.txt", "src/b/c.txt", "src/b/d/e.txt", "srcx/f.txt"} {
+				Expect(bfs.WriteObject(ctx, opts.Subject, name, []byte(name), nil)).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), modTime, modTime)).To(Succeed())
+			}
+		})
+
+		readTree := func(prefix string) map[string]string {
+			files := make(map[string]string)
+			for _, info := range list(ctx, opts.Subject, prefix+"/**") {
+				data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(info.Name)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.ModTime).To(BeTemporally("==", modTime), "for %s", info.Name)
+				files[info.Name] = string(data)
+			}
+			return files
+		}
+
+		It("should copy nested trees", func() {
+			Expect(opts.Subject.(treeCopier).CopyTree(ctx, "src", "/dst/x/")).To(Succeed())
+			Expect(readTree("dst")).To(Equal(map[string]string{
+				"dst/x/a.txt":     "src/a.txt",
+				"dst/x/b/c.txt":   "src/b/c.txt",
+				"dst/x/b/d/e.txt": "src/b/d/e.txt",
+			}))
+			Expect(readTree("src")).To(HaveLen(3))
+		})
+
+		It("should copy into the source tree", func() {
+			Expect(opts.Subject.(treeCopier).CopyTree(ctx, "src/b", "src/b/backup")).To(Succeed())
+			Expect(readTree("src")).To(Equal(map[string]string{
+				"src/a.txt":            "src/a.txt",
+				"src/b/c.txt":          "src/b/c.txt",
+				"src/b/d/e.txt":        "src/b/d/e.txt",
+				"src/b/backup/c.txt":   "src/b/c.txt",
+				"src/b/backup/d/e.txt": "src/b/d/e.txt",
+			}))
+		})
+
+		It("should abort copies of large files", func() {
+			tmpDir, err := ioutil.TempDir("", "bfsfs-tmp")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+
+			subject, err := bfsfs.NewWithConfig(dir, &bfsfs.Config{TempDir: tmpDir})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bfs.WriteObject(ctx, subject, "big/data.bin", make([]byte, 1<<20), nil)).To(Succeed())
+
+			err = subject.(treeCopier).CopyTree(&partialWriteContext{Context: ctx, dir: tmpDir}, "big", "dst")
+			Expect(err).To(Equal(bfs.BatchError{"big/data.bin": context.Canceled}))
+			Expect(filepath.Join(dir, "dst", "data.bin")).NotTo(BeAnExistingFile())
+
+			entries, err := ioutil.ReadDir(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("should move nested trees", func() {
+			Expect(opts.Subject.(treeCopier).MoveTree(ctx, "src", "dst")).To(Succeed())
+			Expect(readTree("dst")).To(Equal(map[string]string{
+				"dst/a.txt":     "src/a.txt",
+				"dst/b/c.txt":   "src/b/c.txt",
+				"dst/b/d/e.txt": "src/b/d/e.txt",
+			}))
+			Expect(readTree("src")).To(BeEmpty())
+			Expect(filepath.Join(dir, "src")).NotTo(BeADirectory())
+			Expect(readTree("srcx")).To(HaveLen(1))
+		})
+
+		It("should abort when the context is cancelled", func() {
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+
+			Expect(opts.Subject.(treeCopier).CopyTree(cancelled, "src", "dst")).To(Equal(context.Canceled))
+			Expect(readTree("dst")).To(BeEmpty())
+		})
+	})
+
+	It("should abort glob when context is cancelled", func() {
+		for i := 0; i < 100; i++ {
+			Expect(ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(i)+".txt"), []byte("TESTDATA"), 0666)).To(Succeed())
+		}
+
+		ctx := &cancelAfterContext{Context: context.Background(), n: 10}
+		iter, err := opts.Subject.Glob(ctx, "**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ctx.n).To(Equal(0))
+		Expect(iter.Next()).To(BeFalse())
+		Expect(iter.Error()).To(Equal(context.Canceled))
+
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		iter, err = opts.Subject.Glob(cancelled, "**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iter.Next()).To(BeFalse())
+		Expect(iter.Error()).To(Equal(context.Canceled))
+	})
 })
+
+// cancelAfterContext reports cancellation after n calls to Err.
+type cancelAfterContext struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.n > 0 {
+		c.n--
+		return nil
+	}
+	return context.Canceled
+}
+
+// partialWriteContext reports cancellation as soon as data was written to a
+// file in dir.
+type partialWriteContext struct {
+	context.Context
+	dir string
+}
+
+func (c *partialWriteContext) Err() error {
+	entries, _ := ioutil.ReadDir(c.dir)
+	for _, fi := range entries {
+		if fi.Size() > 0 {
+			return context.Canceled
+		}
+	}
+	return nil
+}
+
+func list(ctx context.Context, bucket bfs.Bucket, pattern string) []bfs.MetaInfo {
+	infos, err := bfs.List(ctx, bucket, pattern)
+	Expect(err).NotTo(HaveOccurred())
+	return infos
+}
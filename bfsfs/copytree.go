@@ -0,0 +1,140 @@
+package bfsfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+)
+
+// CopyTree copies all files below srcPrefix to dstPrefix, recreating the
+// directory structure. Modification times are preserved. An empty srcPrefix
+// copies the whole bucket.
+//
+// A bfs.BatchError is returned if one or more files failed to copy.
+func (b *bucket) CopyTree(ctx context.Context, srcPrefix, dstPrefix string) error {
+	return b.transferTree(ctx, srcPrefix, dstPrefix, b.copyFile)
+}
+
+// MoveTree moves all files below srcPrefix to dstPrefix, like CopyTree. Files
+// are renamed, which is cheap and atomic for each file. If the destination is
+// on a different file system, files are copied and removed instead. Source
+// directories which are empty after the move are removed.
+//
+// A bfs.BatchError is returned if one or more files failed to move.
+func (b *bucket) MoveTree(ctx context.Context, srcPrefix, dstPrefix string) error {
+	if err := b.transferTree(ctx, srcPrefix, dstPrefix, b.moveFile); err != nil {
+		return err
+	}
+
+	if src := b.treePrefix(srcPrefix); src != "" {
+		removeEmptyDirs(b.fullPath(src))
+	}
+	return nil
+}
+
+func (b *bucket) transferTree(ctx context.Context, srcPrefix, dstPrefix string, transfer func(context.Context, file, string) error) error {
+	srcPrefix, dstPrefix = b.treePrefix(srcPrefix), b.treePrefix(dstPrefix)
+
+	pattern := "**"
+	if srcPrefix != "" {
+		pattern = srcPrefix + "/**"
+	}
+
+	// collect all files up front, the destination may be below the source
+	files, err := b.glob(ctx, pattern)
+	if err != nil {
+		return err
+	}
+
+	failed := make(bfs.BatchError)
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(strings.TrimPrefix(f.name, srcPrefix), "/")
+		if err := transfer(ctx, f, path.Join(dstPrefix, name)); err != nil {
+			failed[f.name] = normError(err)
+		}
+	}
+
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+// treePrefix normalizes a prefix, scoped within root.
+func (b *bucket) treePrefix(prefix string) string {
+	return strings.Trim(internal.WithinNamespace("/", b.normName(prefix)), "/")
+}
+
+func (b *bucket) copyFile(ctx context.Context, src file, dst string) error {
+	in, err := os.Open(b.fullPath(src.name))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := openAtomicFile(ctx, b.fullPath(dst), b.config.TempDir)
+	if err != nil {
+		return err
+	}
+	if _, err := internal.Copy(ctx, out, in); err != nil {
+		_ = out.Discard()
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(b.fullPath(dst), internal.Now(), src.modTime)
+}
+
+func (b *bucket) moveFile(ctx context.Context, src file, dst string) error {
+	dstPath := b.fullPath(dst)
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0777); err != nil {
+		return err
+	}
+
+	err := os.Rename(b.fullPath(src.name), dstPath)
+	if !isCrossDevice(err) {
+		return err
+	}
+
+	if err := b.copyFile(ctx, src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(b.fullPath(src.name)); err != nil {
+		return bfs.WrapError(bfs.ErrSourceNotRemoved, err)
+	}
+	return nil
+}
+
+func isCrossDevice(err error) bool {
+	var lerr *os.LinkError
+	return errors.As(err, &lerr) && lerr.Err == syscall.EXDEV
+}
+
+// removeEmptyDirs removes dir and all empty directories below it.
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	_ = filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			dirs = append(dirs, name)
+		}
+		return nil
+	})
+
+	// remove bottom-up, non-empty directories are kept
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+}
@@ -1,13 +1,16 @@
 package bfsfs
 
 import (
+	"sort"
 	"time"
 )
 
 // iterator implements an iterator over file list.
 type iterator struct {
-	files []file // hold relative (non-rooted) files
-	index int
+	files  []file // hold relative (non-rooted) files
+	index  int
+	err    error
+	relist func() ([]file, error)
 }
 
 type file struct {
@@ -16,6 +19,11 @@ type file struct {
 	modTime time.Time
 }
 
+// sortFiles sorts files by name.
+func sortFiles(files []file) {
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+}
+
 // newIterator constructs new iterator.
 //
 // WARNING! Iterator uses provided names slice, so it shouldn't be mutated after being passed here.
@@ -28,6 +36,9 @@ func newIterator(files []file) *iterator {
 
 // Next advances the cursor to the next position.
 func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
 	it.index++
 	return it.isValid()
 }
@@ -58,6 +69,21 @@ func (it *iterator) ModTime() time.Time {
 
 // Error returns the last iterator error, if any.
 func (it *iterator) Error() error {
+	return it.err
+}
+
+// Reset restarts the listing from scratch.
+func (it *iterator) Reset() error {
+	if it.relist == nil {
+		it.index = -1
+		return nil
+	}
+
+	files, err := it.relist()
+	if err != nil {
+		return err
+	}
+	it.files, it.index, it.err = files, -1, nil
 	return nil
 }
 
@@ -0,0 +1,152 @@
+package bfsfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// walker collects regular files matching a glob pattern.
+type walker struct {
+	ctx            context.Context
+	pattern        string
+	followSymlinks bool
+
+	parents []os.FileInfo // directories on the current path, used to detect cycles
+	files   []file
+}
+
+// Walk walks the tree below fsRoot, starting at the slash-separated dir.
+func (w *walker) Walk(fsRoot, dir string) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	if !w.followSymlinks {
+		// skip if any component of the start dir is a symlink
+		for sub := dir; sub != "." && sub != "/" && sub != ""; sub = path.Dir(sub) {
+			if fi, err := os.Lstat(filepath.Join(fsRoot, filepath.FromSlash(sub))); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+				return nil
+			}
+		}
+	}
+
+	// like with remote backends, missing prefixes yield no results
+	fi, err := os.Stat(filepath.Join(fsRoot, filepath.FromSlash(dir)))
+	if isMissing(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return nil
+	}
+	return w.walkDir(fsRoot, dir, fi)
+}
+
+func (w *walker) walkDir(fsRoot, dir string, dirInfo os.FileInfo) error {
+	for _, parent := range w.parents {
+		if os.SameFile(parent, dirInfo) {
+			return nil // cycle
+		}
+	}
+	w.parents = append(w.parents, dirInfo)
+	defer func() { w.parents = w.parents[:len(w.parents)-1] }()
+
+	f, err := os.Open(filepath.Join(fsRoot, filepath.FromSlash(dir)))
+	if isMissing(err) {
+		return nil // removed while walking
+	} else if err != nil {
+		return err
+	}
+	entries, err := f.Readdir(-1)
+	_ = f.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range entries {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+
+		name := path.Join(dir, fi.Name())
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if !w.followSymlinks {
+				continue
+			}
+			if fi, err = os.Stat(filepath.Join(fsRoot, filepath.FromSlash(name))); err != nil {
+				continue // broken link
+			}
+		}
+
+		switch {
+		case fi.IsDir():
+			if ok, err := matchDir(w.pattern, name); err != nil {
+				return err
+			} else if !ok {
+				continue
+			}
+			if err := w.walkDir(fsRoot, name, fi); err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if ok, err := doublestar.Match(w.pattern, name); err != nil {
+				return err
+			} else if ok {
+				w.files = append(w.files, file{
+					name:    name,
+					size:    fi.Size(),
+					modTime: fi.ModTime(),
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// isMissing returns true if err indicates that a path does not exist, either
+// because it is missing or because one of its parents is a regular file.
+func isMissing(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
+
+// matchDir returns true if files below the slash-separated dir may match
+// pattern. Alternatives cannot span path segments, see bfs.ValidatePattern.
+func matchDir(pattern, dir string) (bool, error) {
+	parts := strings.Split(pattern, "/")
+	for i, seg := range strings.Split(dir, "/") {
+		if i < len(parts) && strings.Contains(parts[i], "**") {
+			return true, nil
+		}
+		if i >= len(parts)-1 {
+			return false, nil // pattern ends above the files in dir
+		}
+		if ok, err := doublestar.Match(parts[i], seg); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// staticPrefix returns the leading directory of a glob pattern
+// which does not contain any meta characters.
+func staticPrefix(pattern string) string {
+	var parts []string
+	for _, part := range strings.Split(pattern, "/") {
+		if strings.ContainsAny(part, `*?[{\`) {
+			break
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) != 0 && len(parts) == strings.Count(pattern, "/")+1 {
+		parts = parts[:len(parts)-1] // pattern without meta characters
+	}
+	return path.Join(parts...)
+}
@@ -69,6 +69,9 @@ type Config struct {
 	Prefix string
 	// A custom temp dir.
 	TempDir string
+	// SanitizeNames rejects names which would resolve outside of Prefix on the
+	// server, see bfs.SanitizeName.
+	SanitizeNames bool
 }
 
 func (c *Config) norm() error {
@@ -80,8 +83,9 @@ func (c *Config) norm() error {
 }
 
 type bucket struct {
-	conn   *ftp.ServerConn
-	config *Config
+	address string
+	conn    *ftp.ServerConn
+	config  *Config
 }
 
 // New initiates an bfs.Bucket backed by FTP.
@@ -107,8 +111,9 @@ func New(address string, cfg *Config) (bfs.Bucket, error) {
 	}
 
 	return &bucket{
-		conn:   conn,
-		config: config,
+		address: address,
+		conn:    conn,
+		config:  config,
 	}, nil
 }
 
@@ -121,6 +126,10 @@ func (b *bucket) stripPrefix(name string) string {
 	return name
 }
 
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) withPrefix(name string) string {
 	if b.config.Prefix == "" {
 		return name
@@ -130,8 +139,7 @@ func (b *bucket) withPrefix(name string) string {
 
 // Glob implements bfs.Bucket.
 func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
-	// quick sanity check
-	if _, err := doublestar.Match(pattern, ""); err != nil {
+	if err := bfs.ValidatePattern(pattern); err != nil {
 		return nil, err
 	}
 
@@ -151,6 +159,11 @@ func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error)
 
 // Head implements bfs.Bucket.
 func (b *bucket) Head(_ context.Context, name string) (*bfs.MetaInfo, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	dir, base := path.Split(name)
 	entries, err := b.conn.List(b.withPrefix(dir))
 	if err != nil {
@@ -172,6 +185,11 @@ func (b *bucket) Head(_ context.Context, name string) (*bfs.MetaInfo, error) {
 
 // Open implements bfs.Bucket.
 func (b *bucket) Open(_ context.Context, name string) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	rc, err := b.conn.Retr(b.withPrefix(name))
 	if err != nil {
 		return nil, normError(err)
@@ -181,6 +199,15 @@ func (b *bucket) Open(_ context.Context, name string) (bfs.Reader, error) {
 
 // Create implements bfs.Bucket.
 func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.HasRetention() || opts.GetExpiresIn() > 0 {
+		return nil, bfs.ErrNotSupported
+	}
+
 	f, err := ioutil.TempFile("", "bfs-ftp")
 	if err != nil {
 		return nil, err
@@ -197,13 +224,28 @@ func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions
 
 // Remove implements bfs.Bucket.
 func (b *bucket) Remove(_ context.Context, name string) error {
-	err := normError(b.conn.Delete(b.withPrefix(name)))
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	err = normError(b.conn.Delete(b.withPrefix(name)))
 	if err != nil && err != bfs.ErrNotFound {
 		return err
 	}
 	return nil
 }
 
+// Mkdir creates a directory, including missing parents.
+func (b *bucket) Mkdir(_ context.Context, prefix string) error {
+	return b.mkdirAll(b.withPrefix(prefix))
+}
+
+// Describe returns information about the bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "ftp", Bucket: b.address, Prefix: b.config.Prefix}
+}
+
 // Close implements bfs.Bucket.
 func (b *bucket) Close() error {
 	return b.conn.Quit()
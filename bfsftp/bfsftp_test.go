@@ -25,12 +25,26 @@ var _ = Describe("Bucket", func() {
 		subject, err := bfsftp.New(serverAddr, &bfsftp.Config{Prefix: prefix, Username: "ftpuser", Password: "ftppass"})
 		Expect(err).NotTo(HaveOccurred())
 
+		sanitized, err := bfsftp.New(serverAddr, &bfsftp.Config{Prefix: prefix, Username: "ftpuser", Password: "ftppass", SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
 		opts = lint.Options{
-			Subject: subject,
+			Subject:   subject,
+			Sanitized: sanitized,
 		}
 	})
 
 	Context("defaults", lint.Lint(&opts))
+
+	It("should describe buckets", func() {
+		subject, err := bfsftp.New(serverAddr, &bfsftp.Config{Prefix: "a/b", Username: "ftpuser", Password: "ftppass"})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "ftp", Bucket: serverAddr, Prefix: "a/b/"}))
+	})
 })
 
 // ------------------------------------------------------------------------
@@ -0,0 +1,40 @@
+package bfsgs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"google.golang.org/api/googleapi"
+)
+
+// Grants returns the ACL entries of an object. Grantees are reported as
+// GCS entities, e.g. "user-jane@example.com" or "allUsers", permissions as
+// roles, e.g. "READER" or "OWNER". Objects in buckets with uniform
+// bucket-level access have no ACLs and return an error.
+func (b *bucket) Grants(ctx context.Context, name string) ([]bfs.Grant, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := b.bucket.Object(b.withPrefix(name)).ACL().List(ctx)
+	if err != nil {
+		// ACL requests report missing objects as plain API errors
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			return nil, bfs.ErrNotFound
+		}
+		return nil, normError(err)
+	}
+
+	grants := make([]bfs.Grant, 0, len(rules))
+	for _, rule := range rules {
+		grants = append(grants, bfs.Grant{
+			Grantee:    string(rule.Entity),
+			Permission: string(rule.Role),
+		})
+	}
+	return grants, nil
+}
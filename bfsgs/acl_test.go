@@ -0,0 +1,50 @@
+package bfsgs_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Grants", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should list object ACLs", func() {
+		grants, err := bfs.Grants(ctx, subject, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grants).To(Equal([]bfs.Grant{
+			{Grantee: "project-owners-123456", Permission: "OWNER"},
+			{Grantee: "allUsers", Permission: "READER"},
+		}))
+
+		_, err = bfs.Grants(ctx, subject, "missing.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+})
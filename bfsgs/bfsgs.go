@@ -17,15 +17,21 @@
 //
 // bfs.Connect supports the following query parameters:
 //
-//   scopes      - custom scopes
-//   credentials - path to custom credentials file
+//   scopes       - custom scopes
+//   credentials  - path to custom credentials file
+//   user_agent   - custom User-Agent header
+//   user_project - billing project for requester-pays buckets
 //
 package bfsgs
 
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +39,7 @@ import (
 	"github.com/bmatcuk/doublestar"
 	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/internal"
+	"google.golang.org/api/googleapi"
 	giterator "google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -56,19 +63,105 @@ func init() {
 		if s := query.Get("acl"); s != "" {
 			conf.PredefinedACL = s
 		}
+		conf.UserAgent = query.Get("user_agent")
+		conf.BillingProject = query.Get("user_project")
+		if opts := bfs.ConnectOptionsFromContext(ctx); opts != nil && opts.HTTPClient != nil {
+			conf.Options = append(conf.Options, option.WithHTTPClient(opts.HTTPClient))
+		}
 
 		return New(ctx, u.Host, conf)
 	})
 }
 
+// MaxPageSize is the maximum number of objects returned per list request.
+const MaxPageSize = 1000
+
+// MaxMetadataSize is the maximum size of custom metadata
+// (keys and values) supported by Google Cloud Storage.
+const MaxMetadataSize = 8 * 1024
+
+// PredefinedACLs lists the valid predefined ACL values.
+var PredefinedACLs = []string{
+	"authenticatedRead",
+	"bucketOwnerFullControl",
+	"bucketOwnerRead",
+	"private",
+	"projectPrivate",
+	"publicRead",
+}
+
 // Config is passed to New to configure the Google Cloud Storage connection.
 type Config struct {
-	Options       []option.ClientOption // options for Google API client
-	Prefix        string                // an optional path prefix
-	PredefinedACL string                // an optional predefined ACL string, e.g. "publicRead"
+	Options []option.ClientOption // options for Google API client
+	Prefix  string                // an optional path prefix
+
+	// An optional predefined ACL string, e.g. "publicRead", applied to all
+	// writes. When blank, objects inherit the bucket's default object ACL.
+	// Individual writes may override it via bfs.WriteOptions.ACL.
+	PredefinedACL string
+
+	// SanitizeNames validates object names with bfs.SanitizeName before use.
+	SanitizeNames bool
+
+	// BillingProject is the project which is billed for all requests. It is
+	// required to access requester-pays buckets, requests fail otherwise.
+	BillingProject string
+
+	// UserAgent sets a custom User-Agent header for all requests, e.g. to
+	// identify the application in server access logs. It replaces the
+	// default identifier of the storage client and has no effect if a custom
+	// HTTP client is passed via Options.
+	UserAgent string
+
+	// ChunkSize controls resumable uploads. Objects are uploaded in chunks of
+	// (at least, rounded up to a multiple of 256KiB) ChunkSize bytes and
+	// transient failures only retry the failed chunk rather than restarting
+	// the whole upload. Please note that each open writer buffers a full
+	// chunk in memory.
+	//
+	// Default: 0 (use googleapi.DefaultUploadChunkSize, 16MiB). A negative
+	// value disables chunking, objects are then uploaded in a single request.
+	ChunkSize int
+
+	// PageSize is the maximum number of objects requested per list request,
+	// defaults to 0 (use the GCS default of 1000). Smaller pages reduce the
+	// latency to the first result, larger pages reduce the number of
+	// requests for full scans.
+	PageSize int
+
+	// NameTransform optionally maps object names to physical object names,
+	// e.g. to shard objects across hashed prefixes. NameInverse must be set
+	// too and restore the original name, i.e. NameInverse(NameTransform(name))
+	// must return name for all names. Both funcs are applied to names without
+	// Prefix, listed objects are transformed back before they are matched.
+	//
+	// Transformed names are no longer listed in lexicographic order, so
+	// SortedGlob buffers and sorts the full listing and GlobAfter scans all
+	// objects below Prefix.
+	NameTransform func(name string) string
+	// NameInverse is the inverse of NameTransform.
+	NameInverse func(name string) string
+
+	// ContentTypeByExt maps file extensions, including the leading dot, to
+	// content types, e.g. {".md": "text/markdown"}. It is consulted by writes
+	// without an explicit bfs.WriteOptions.ContentType. Extensions are
+	// matched case-insensitively.
+	ContentTypeByExt map[string]string
 }
 
 func (c *Config) norm() error {
+	if err := validateACL(c.PredefinedACL); err != nil {
+		return err
+	}
+
+	if c.PageSize < 0 || c.PageSize > MaxPageSize {
+		return fmt.Errorf("bfsgs: page size must be between 0 and %d", MaxPageSize)
+	}
+
+	if (c.NameTransform == nil) != (c.NameInverse == nil) {
+		return fmt.Errorf("bfsgs: NameTransform and NameInverse must be set together")
+	}
+
 	c.Prefix = strings.TrimPrefix(c.Prefix, "/")
 	if c.Prefix != "" && !strings.HasSuffix(c.Prefix, "/") {
 		c.Prefix = c.Prefix + "/"
@@ -78,7 +171,9 @@ func (c *Config) norm() error {
 }
 
 type bucket struct {
+	client *storage.Client
 	bucket *storage.BucketHandle
+	name   string
 	config *Config
 }
 
@@ -92,52 +187,108 @@ func New(ctx context.Context, name string, cfg *Config) (bfs.Bucket, error) {
 		return nil, err
 	}
 
-	client, err := storage.NewClient(ctx, config.Options...)
+	opts := config.Options
+	if config.UserAgent != "" {
+		opts = append(opts[:len(opts):len(opts)], option.WithUserAgent(config.UserAgent))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	handle := client.Bucket(name)
+	if config.BillingProject != "" {
+		handle = handle.UserProject(config.BillingProject)
+	}
+
 	return &bucket{
-		bucket: client.Bucket(name),
+		client: client,
+		bucket: handle,
+		name:   name,
 		config: config,
 	}, nil
 }
 
 func (b *bucket) stripPrefix(name string) string {
-	if b.config.Prefix == "" {
-		return name
+	if b.config.Prefix != "" {
+		name = strings.TrimPrefix(name, b.config.Prefix)
+		name = strings.TrimPrefix(name, "/")
+	}
+	if b.config.NameInverse != nil {
+		name = b.config.NameInverse(name)
 	}
-	name = strings.TrimPrefix(name, b.config.Prefix)
-	name = strings.TrimPrefix(name, "/")
 	return name
 }
 
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) withPrefix(name string) string {
+	if b.config.NameTransform != nil {
+		name = b.config.NameTransform(name)
+	}
 	if b.config.Prefix == "" {
 		return name
 	}
-	return internal.WithinNamespace(b.config.Prefix, name)
+	return internal.WithinNamespaceKey(b.config.Prefix, name)
+}
+
+// SortedGlob implements Glob, GCS lists names in lexicographic order.
+func (b *bucket) SortedGlob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	if b.config.NameTransform != nil {
+		return bfs.SortedGlob(ctx, unorderedBucket{b}, pattern)
+	}
+	return b.Glob(ctx, pattern)
 }
 
+// unorderedBucket hides native support for ordered listings, so that bfs
+// helpers fall back to ordering on the client.
+type unorderedBucket struct{ bfs.Bucket }
+
 // Glob implements bfs.Bucket.
 func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
-	// quick sanity check
-	if _, err := doublestar.Match(pattern, ""); err != nil {
+	return b.GlobAfter(ctx, pattern, "")
+}
+
+// GlobAfter lists the files matching a glob pattern, starting lexicographically
+// after the given name.
+func (b *bucket) GlobAfter(ctx context.Context, pattern, after string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
 		return nil, err
 	}
 
-	iter := b.bucket.Objects(ctx, &storage.Query{
-		Prefix: b.config.Prefix,
-	})
+	query := &storage.Query{Prefix: b.config.Prefix}
+	if after != "" && b.config.NameTransform == nil {
+		query.StartOffset = b.withPrefix(after)
+	}
+
 	return &iterator{
 		parent:  b,
-		iter:    iter,
+		ctx:     ctx,
+		query:   query,
+		iter:    b.objects(ctx, query),
 		pattern: pattern,
+		after:   after,
 	}, nil
 }
 
+func (b *bucket) objects(ctx context.Context, query *storage.Query) *storage.ObjectIterator {
+	iter := b.bucket.Objects(ctx, query)
+	if n := b.config.PageSize; n > 0 {
+		iter.PageInfo().MaxSize = n
+	}
+	return iter
+}
+
 // Head implements bfs.Bucket.
 func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	obj := b.bucket.Object(b.withPrefix(name))
 	attrs, err := obj.Attrs(ctx)
 	if err != nil {
@@ -150,58 +301,239 @@ func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
 		ModTime:     attrs.Updated,
 		ContentType: attrs.ContentType,
 		Metadata:    bfs.NormMetadata(attrs.Metadata),
+		Version:     strconv.FormatInt(attrs.Generation, 10),
+
+		CacheControl:       attrs.CacheControl,
+		ContentEncoding:    attrs.ContentEncoding,
+		ContentDisposition: attrs.ContentDisposition,
+		ContentLanguage:    attrs.ContentLanguage,
+
+		TemporaryHold:  attrs.TemporaryHold,
+		EventBasedHold: attrs.EventBasedHold,
 	}, nil
 }
 
 // Open implements bfs.Bucket.
 func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	obj := b.bucket.Object(b.withPrefix(name))
 	ord, err := obj.NewReader(ctx)
-	return ord, normError(err)
+	if err != nil {
+		return nil, normError(err)
+	}
+	return &reader{Reader: ord}, nil
+}
+
+// OpenRange opens an object for reading, like Open, but only fetches up to
+// length bytes, starting at offset.
+func (b *bucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := bfs.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	ord, err := b.bucket.Object(b.withPrefix(name)).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, normError(err)
+	}
+	return &reader{Reader: ord}, nil
 }
 
 // Create implements bfs.Bucket.
 func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.HasRetention() {
+		return nil, bfs.ErrNotSupported
+	}
+
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 
+	acl := b.config.PredefinedACL
+	if s := opts.GetACL(); s != "" {
+		if err := validateACL(s); err != nil {
+			cancel()
+			return nil, err
+		}
+		acl = s
+	}
+
 	obj := b.bucket.Object(b.withPrefix(name))
 	wrt := obj.NewWriter(ctx)
-	wrt.PredefinedACL = b.config.PredefinedACL
+	wrt.PredefinedACL = acl
+	if n := b.config.ChunkSize; n > 0 {
+		wrt.ChunkSize = n
+	} else if n < 0 {
+		wrt.ChunkSize = 0
+	}
+	if n := opts.GetSize(); n > 0 && n <= int64(wrt.ChunkSize) {
+		// small objects are uploaded in a single request, skip chunk buffering
+		wrt.ChunkSize = 0
+	}
 	wrt.ContentType = opts.GetContentType()
+	if wrt.ContentType == "" {
+		wrt.ContentType = internal.ContentTypeByExt(name, b.config.ContentTypeByExt)
+	}
 	wrt.Metadata = opts.GetMetadata()
+	if expiresAt, ok := bfs.ExpiresAt(wrt.Metadata); ok && opts.GetExpiresIn() > 0 {
+		// a lifecycle rule with daysSinceCustomTime: 0 deletes expired objects
+		wrt.CustomTime = expiresAt
+	}
+	wrt.CacheControl = opts.GetCacheControl()
+	wrt.ContentEncoding = opts.GetContentEncoding()
+	wrt.ContentDisposition = opts.GetContentDisposition()
+	wrt.ContentLanguage = opts.GetContentLanguage()
 	return &writer{Writer: wrt, ctx: ctx, cancel: cancel}, nil
 }
 
-// Remove implements bfs.Bucket.
+// Remove implements bfs.Bucket. It returns an error which satisfies
+// errors.Is(err, ErrHeld) if the object is under a hold.
 func (b *bucket) Remove(ctx context.Context, name string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
 	obj := b.bucket.Object(b.withPrefix(name))
-	err := obj.Delete(ctx)
+	err = obj.Delete(ctx)
 	if err == storage.ErrObjectNotExist {
 		return nil
 	}
-	return err
+	return normRemoveError(err)
 }
 
 // Copy supports copying of objects within the bucket.
 func (b *bucket) Copy(ctx context.Context, src, dst string) error {
-	_, err := b.bucket.Object(b.withPrefix(dst)).CopierFrom(
+	src, err := b.checkName(src)
+	if err != nil {
+		return err
+	}
+	dst, err = b.checkName(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.bucket.Object(b.withPrefix(dst)).CopierFrom(
 		b.bucket.Object(b.withPrefix(src)),
 	).Run(ctx)
 	return err
 }
 
+// Rename moves an object within the bucket. GCS cannot rename objects, the
+// object is copied and the source is removed. If the removal fails, an error
+// is returned which satisfies errors.Is(err, bfs.ErrSourceNotRemoved).
+func (b *bucket) Rename(ctx context.Context, src, dst string) error {
+	if b.withPrefix(src) == b.withPrefix(dst) {
+		_, err := b.Head(ctx, src) // the copy would be removed
+		return err
+	}
+
+	if err := b.Copy(ctx, src, dst); err != nil {
+		// copies report missing sources as plain API errors
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			return bfs.ErrNotFound
+		}
+		return normError(err)
+	}
+	if err := b.Remove(ctx, src); err != nil {
+		return bfs.WrapError(bfs.ErrSourceNotRemoved, err)
+	}
+	return nil
+}
+
+// Describe returns information about the bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "gs", Bucket: b.name, Prefix: b.config.Prefix}
+}
+
+// Client returns the native storage client, for features which are not
+// covered by bfs. Please note that requests issued via the client bypass
+// the bucket's prefix, name sanitization and billing project.
+func (b *bucket) Client() *storage.Client {
+	return b.client
+}
+
+// Handle returns the native handle of the bucket, like Client. The billing
+// project is applied, but the prefix is not.
+func (b *bucket) Handle() *storage.BucketHandle {
+	return b.bucket
+}
+
 // Close implements bfs.Bucket.
 func (*bucket) Close() error { return nil }
 
 // --------------------------------------------------------------------
 
+// Ping checks that the bucket exists and is accessible by retrieving its
+// attributes.
+func (b *bucket) Ping(ctx context.Context) error {
+	if _, err := b.bucket.Attrs(ctx); err != nil {
+		return fmt.Errorf("bfsgs: unable to reach bucket %q: %w", b.name, normError(err))
+	}
+	return nil
+}
+
 func normError(err error) error {
 	if err == storage.ErrObjectNotExist {
 		return bfs.ErrNotFound
 	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusForbidden {
+		return bfs.WrapError(bfs.ErrAccessDenied, err)
+	}
 	return err
 }
 
+func validateACL(acl string) error {
+	if acl == "" {
+		return nil
+	}
+	for _, s := range PredefinedACLs {
+		if s == acl {
+			return nil
+		}
+	}
+	return fmt.Errorf("bfsgs: invalid predefined ACL %q, must be one of %s", acl, strings.Join(PredefinedACLs, ", "))
+}
+
+// --------------------------------------------------------------------
+
+type reader struct {
+	*storage.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if (err == io.EOF || err == io.ErrUnexpectedEOF) && r.Remain() > 0 {
+		err = bfs.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *reader) Size() int64         { return r.Attrs.Size }
+func (r *reader) ModTime() time.Time  { return r.Attrs.LastModified }
+func (r *reader) ContentType() string { return r.Attrs.ContentType }
+
+// ContentEncoding returns the encoding of the served content, which is empty
+// if GCS or the HTTP transport have already decompressed it.
+func (r *reader) ContentEncoding() string { return r.Attrs.ContentEncoding }
+
 // --------------------------------------------------------------------
 
 type writer struct {
@@ -221,37 +553,70 @@ func (w *writer) Discard() error {
 	return err
 }
 
+// Abort aborts the upload, no object is created. It is equivalent to
+// Discard.
+func (w *writer) Abort() error {
+	return w.Discard()
+}
+
+// CloseWithError aborts the upload, like Abort. It shadows the deprecated
+// storage.Writer.CloseWithError and cancels the upload context instead. The
+// error is informational only and not returned.
+func (w *writer) CloseWithError(_ error) error {
+	return w.Discard()
+}
+
 func (w *writer) Commit() error {
 	err := w.ctx.Err()
 
-	if ezz := w.Close(); ezz != nil {
+	if ezz := w.Close(); ezz != nil && err == nil {
 		err = ezz
 	}
 	w.cancel() // cancel AFTER close
 
-	return err
+	return normError(err)
 }
 
 // --------------------------------------------------------------------
 
+// GenerationIterator is implemented by iterators returned by Glob and
+// GlobAfter. It exposes the generation and metageneration of the current
+// object, e.g. to build consistent snapshots of a bucket in a single listing.
+type GenerationIterator interface {
+	bfs.Iterator
+
+	// Generation returns the generation of the current object's content.
+	Generation() int64
+	// Metageneration returns the metadata version of the current object's
+	// generation.
+	Metageneration() int64
+}
+
 type iterator struct {
 	parent  *bucket
+	ctx     context.Context
+	query   *storage.Query
 	iter    *storage.ObjectIterator
 	pattern string
+	after   string // StartOffset is inclusive, skip names <= after
 	current object
 	err     error
 }
 
 type object struct {
-	name    string
-	size    int64
-	modTime time.Time
+	name           string
+	size           int64
+	modTime        time.Time
+	generation     int64
+	metageneration int64
 }
 
-func (*iterator) Close() error         { return nil }
-func (i *iterator) Name() string       { return i.current.name }
-func (i *iterator) Size() int64        { return i.current.size }
-func (i *iterator) ModTime() time.Time { return i.current.modTime }
+func (*iterator) Close() error            { return nil }
+func (i *iterator) Name() string          { return i.current.name }
+func (i *iterator) Size() int64           { return i.current.size }
+func (i *iterator) ModTime() time.Time    { return i.current.modTime }
+func (i *iterator) Generation() int64     { return i.current.generation }
+func (i *iterator) Metageneration() int64 { return i.current.metageneration }
 
 func (i *iterator) Next() bool {
 	if i.err != nil {
@@ -266,20 +631,34 @@ func (i *iterator) Next() bool {
 		}
 
 		name := i.parent.stripPrefix(obj.Name)
+		if i.after != "" && name <= i.after {
+			continue
+		}
+
 		if ok, err := doublestar.Match(i.pattern, name); err != nil {
 			i.err = err
 			return false
 		} else if ok {
 			i.current = object{
-				name:    name,
-				size:    obj.Size,
-				modTime: obj.Updated,
+				name:           name,
+				size:           obj.Size,
+				modTime:        obj.Updated,
+				generation:     obj.Generation,
+				metageneration: obj.Metageneration,
 			}
 			return true
 		}
 	}
 }
 
+// Reset restarts the listing from scratch.
+func (i *iterator) Reset() error {
+	i.iter = i.parent.objects(i.ctx, i.query)
+	i.current = object{}
+	i.err = nil
+	return nil
+}
+
 func (i *iterator) Error() error {
 	if i.err != giterator.Done {
 		return i.err
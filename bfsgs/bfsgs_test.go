@@ -1,14 +1,27 @@
 package bfsgs_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/storage"
+	"github.com/bmatcuk/doublestar"
 	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/bfsgs"
+	"github.com/bsm/bfs/internal"
 	"github.com/bsm/bfs/testdata/lint"
+	"google.golang.org/api/option"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -20,6 +33,10 @@ var _ = Describe("Bucket", func() {
 	var opts lint.Options
 
 	BeforeEach(func() {
+		if sandboxErr != nil {
+			Skip("skipping test, no sandbox access: " + sandboxErr.Error())
+		}
+
 		ctx := context.Background()
 
 		prefix := "x/" + strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -29,9 +46,13 @@ var _ = Describe("Bucket", func() {
 		readonly, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{Prefix: "m/"})
 		Expect(err).NotTo(HaveOccurred())
 
+		sanitized, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{Prefix: prefix, SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
 		opts = lint.Options{
-			Subject:  subject,
-			Readonly: readonly,
+			Subject:   subject,
+			Readonly:  readonly,
+			Sanitized: sanitized,
 
 			Metadata:    true,
 			ContentType: true,
@@ -41,13 +62,444 @@ var _ = Describe("Bucket", func() {
 	Context("defaults", lint.Lint(&opts))
 })
 
+var _ = Describe("Reader", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+
+		// serve downloads from the mock via plain HTTP
+		os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+		defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should read", func() {
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+	})
+
+	It("should detect truncated reads", func() {
+		server.truncate = true
+
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		data, err := ioutil.ReadAll(r)
+		Expect(err).To(MatchError(bfs.ErrUnexpectedEOF))
+		Expect(errors.Is(err, io.ErrUnexpectedEOF)).To(BeTrue())
+		Expect(string(data)).To(Equal("TEST"))
+	})
+
+	It("should open decoded", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("plain content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+
+		server.Put("x/a.txt.gz", buf.String())
+		server.objects["x/a.txt.gz"]["contentEncoding"] = "gzip"
+
+		rc, err := bfs.OpenDecoded(ctx, subject, "a.txt.gz")
+		Expect(err).NotTo(HaveOccurred())
+		defer rc.Close()
+
+		Expect(ioutil.ReadAll(rc)).To(Equal([]byte("plain content")))
+	})
+
+	It("should read heads with ranges", func() {
+		Expect(bfs.ReadHead(ctx, subject, "a.txt", 4)).To(Equal([]byte("TEST")))
+		Expect(bfs.ReadHead(ctx, subject, "a.txt", 100)).To(Equal([]byte("TESTDATA")))
+		Expect(server.Ranges()).To(Equal([]string{"bytes=0-3", "bytes=0-99"}))
+	})
+
+	Describe("OpenParallel", func() {
+		type parallelOpener interface {
+			OpenParallel(context.Context, string, int64, int) (bfs.Reader, error)
+		}
+
+		var data []byte
+
+		BeforeEach(func() {
+			data = make([]byte, 1024*1024+123)
+			_, err := rand.Read(data)
+			Expect(err).NotTo(HaveOccurred())
+			server.Put("x/large.bin", string(data))
+		})
+
+		It("should reassemble concurrent ranges", func() {
+			r, err := subject.(parallelOpener).OpenParallel(ctx, "large.bin", 64*1024, 4)
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+
+			Expect(r.(bfs.ReadCloserInfo).Size()).To(Equal(int64(len(data))))
+			Expect(ioutil.ReadAll(r)).To(Equal(data))
+			Expect(r.Close()).To(Succeed())
+
+			ranges := server.Ranges()
+			Expect(ranges).To(HaveLen(17))
+			Expect(ranges).To(ContainElement("bytes=0-65535"))
+			Expect(ranges).To(ContainElement("bytes=1048576-1048698"))
+		})
+
+		It("should read small objects at once", func() {
+			r, err := subject.(parallelOpener).OpenParallel(ctx, "a.txt", 0, 0)
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+
+			Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+			Expect(server.Ranges()).To(BeEmpty())
+		})
+
+		It("should fail on missing objects", func() {
+			_, err := subject.(parallelOpener).OpenParallel(ctx, "missing.bin", 0, 0)
+			Expect(err).To(MatchError(bfs.ErrNotFound))
+		})
+
+		It("should detect truncated parts", func() {
+			server.truncate = true
+
+			r, err := subject.(parallelOpener).OpenParallel(ctx, "large.bin", 64*1024, 4)
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+
+			_, err = ioutil.ReadAll(r)
+			Expect(errors.Is(err, io.ErrUnexpectedEOF)).To(BeTrue())
+		})
+
+		It("should respect context cancellation and close early", func() {
+			cctx, cancel := context.WithCancel(ctx)
+			r, err := subject.(parallelOpener).OpenParallel(cctx, "large.bin", 64*1024, 4)
+			Expect(err).NotTo(HaveOccurred())
+			defer r.Close()
+
+			buf := make([]byte, 100)
+			Expect(io.ReadFull(r, buf)).To(Equal(100))
+			Expect(buf).To(Equal(data[:100]))
+
+			cancel()
+			_, err = ioutil.ReadAll(r)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(r.Close()).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("Config", func() {
+	var ctx = context.Background()
+
+	It("should reject invalid predefined ACLs", func() {
+		_, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{PredefinedACL: "public-read"})
+		Expect(err).To(MatchError(`bfsgs: invalid predefined ACL "public-read", must be one of authenticatedRead, bucketOwnerFullControl, bucketOwnerRead, private, projectPrivate, publicRead`))
+	})
+
+	It("should describe buckets", func() {
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:  "a/b",
+			Options: []option.ClientOption{option.WithoutAuthentication()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "gs", Bucket: bucketName, Prefix: "a/b/"}))
+	})
+
+	It("should apply page sizes", func() {
+		server := newMockObjectServer("x/a.txt", "x/b.txt", "x/c/d.txt", "x/e.txt")
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:   "x/",
+			PageSize: 3,
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		iter, err := subject.Glob(ctx, "**")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"a.txt", "b.txt", "c/d.txt", "e.txt"}))
+
+		Expect(server.lists).To(HaveLen(2))
+		Expect(server.lists[0].Get("maxResults")).To(Equal("3"))
+		Expect(server.lists[1].Get("maxResults")).To(Equal("3"))
+
+		_, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{PageSize: 1001})
+		Expect(err).To(MatchError("bfsgs: page size must be between 0 and 1000"))
+	})
+
+	It("should map forbidden errors", func() {
+		server := newMockObjectServer("x/a.txt")
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		server.mu.Lock()
+		server.forbidden = true
+		server.mu.Unlock()
+
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("Forbidden"))
+		Expect(errors.Is(subject.Remove(ctx, "a.txt"), bfs.ErrAccessDenied)).To(BeTrue())
+	})
+
+	It("should reject bad patterns before listing", func() {
+		server := newMockObjectServer("x/a.txt", "x/c/d.txt")
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		_, err = subject.Glob(ctx, "c/[d")
+		Expect(errors.Is(err, doublestar.ErrBadPattern)).To(BeTrue())
+		_, err = subject.Glob(ctx, "c/{d,e")
+		Expect(errors.Is(err, doublestar.ErrBadPattern)).To(BeTrue())
+		Expect(server.lists).To(BeEmpty())
+	})
+
+	It("should send custom user agents", func() {
+		server := newMockObjectServer("x/a.txt")
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:    "x/",
+			UserAgent: "partner-sync/1.2",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithoutAuthentication(),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.agents).To(Equal([]string{"partner-sync/1.2"}))
+	})
+
+	It("should bill requests to a custom project", func() {
+		server := newMockObjectServer("x/a.txt")
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:         "x/",
+			BillingProject: "my-billing-project",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		iter, err := subject.Glob(ctx, "**")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Name()).To(Equal("a.txt"))
+		Expect(server.lists).To(HaveLen(1))
+		Expect(server.lists[0].Get("userProject")).To(Equal("my-billing-project"))
+	})
+
+	It("should store HTTP headers", func() {
+		server := newMockObjectServer()
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		Expect(bfs.WriteObject(ctx, subject, "headers.txt", []byte("TESTDATA"), &bfs.WriteOptions{
+			Size:               8,
+			CacheControl:       "max-age=60",
+			ContentEncoding:    "gzip",
+			ContentDisposition: "attachment",
+			ContentLanguage:    "de-DE",
+		})).To(Succeed())
+
+		info, err := subject.Head(ctx, "headers.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+		Expect(info.CacheControl).To(Equal("max-age=60"))
+		Expect(info.ContentEncoding).To(Equal("gzip"))
+		Expect(info.ContentDisposition).To(Equal("attachment"))
+		Expect(info.ContentLanguage).To(Equal("de-DE"))
+	})
+
+	It("should apply expiry", func() {
+		defer internal.SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })()
+
+		server := newMockObjectServer()
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		Expect(bfs.WriteObject(ctx, subject, "ephemeral.txt", []byte("TESTDATA"), &bfs.WriteOptions{ExpiresIn: time.Hour})).To(Succeed())
+		Expect(server.Attr("x/ephemeral.txt", "customTime")).To(Equal("2020-01-02T04:04:05Z"))
+
+		info, err := subject.Head(ctx, "ephemeral.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(Equal(bfs.Metadata{bfs.MetaExpiresAt: "2020-01-02T04:04:05Z"}))
+	})
+
+	It("should write directory markers within the prefix", func() {
+		server := newMockObjectServer()
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		Expect(bfs.Mkdir(ctx, subject, "path/to/dir")).To(Succeed())
+		Expect(server.Attr("x/path/to/dir/", "size")).NotTo(BeNil())
+		Expect(server.Attr("x/path/to/dir", "size")).To(BeNil())
+	})
+
+	It("should map content types by extension", func() {
+		server := newMockObjectServer()
+		defer server.Close()
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:           "x/",
+			ContentTypeByExt: map[string]string{".md": "text/markdown"},
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		Expect(bfs.WriteObject(ctx, subject, "README.md", []byte("# TESTDATA"), &bfs.WriteOptions{Size: 10})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, subject, "doc.md", []byte("# TESTDATA"), &bfs.WriteOptions{Size: 10, ContentType: "text/plain"})).To(Succeed())
+
+		info, err := subject.Head(ctx, "README.md")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/markdown"))
+
+		info, err = subject.Head(ctx, "doc.md")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/plain"))
+	})
+
+	It("should ping buckets", func() {
+		server := newMockObjectServer()
+		defer server.Close()
+
+		opts := []option.ClientOption{
+			option.WithEndpoint(server.URL + "/storage/v1/"),
+			option.WithHTTPClient(http.DefaultClient),
+		}
+
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{Options: opts})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+		Expect(bfs.Ping(ctx, subject)).To(Succeed())
+
+		missing, err := bfsgs.New(ctx, "missing", &bfsgs.Config{Options: opts})
+		Expect(err).NotTo(HaveOccurred())
+		defer missing.Close()
+
+		err = bfs.Ping(ctx, missing)
+		Expect(err).To(MatchError(ContainSubstring(`bfsgs: unable to reach bucket "missing"`)))
+		Expect(errors.Is(err, storage.ErrBucketNotExist)).To(BeTrue())
+	})
+
+	It("should validate metadata before writing", func() {
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Options: []option.ClientOption{option.WithHTTPClient(http.DefaultClient)},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		_, err = subject.Create(ctx, "meta.txt", &bfs.WriteOptions{
+			Metadata: bfs.Metadata{"Large": strings.Repeat("x", bfsgs.MaxMetadataSize)},
+		})
+		Expect(errors.Is(err, bfs.ErrMetadataTooLarge)).To(BeTrue())
+
+		_, err = subject.Create(ctx, "meta.txt", &bfs.WriteOptions{
+			Metadata: bfs.Metadata{"Bad Key": "value"},
+		})
+		Expect(errors.Is(err, bfs.ErrInvalidMetadata)).To(BeTrue())
+	})
+})
+
 // ------------------------------------------------------------------------
 
+var sandboxErr error
+
 func TestSuite(t *testing.T) {
-	if err := sandboxCheck(); err != nil {
-		t.Skipf("skipping test, no sandbox access: %v", err)
-		return
-	}
+	sandboxErr = sandboxCheck()
 
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "bfs/bfsgs")
@@ -68,6 +520,10 @@ func sandboxCheck() error {
 }
 
 var _ = AfterSuite(func() {
+	if sandboxErr != nil {
+		return
+	}
+
 	ctx := context.Background()
 	b, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{Prefix: "x/"})
 	Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,163 @@
+package bfsgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+	"google.golang.org/api/googleapi"
+)
+
+// ConditionalUpdate reads an object (nil if it does not exist), passes its
+// content to fn and replaces the object with the result. The write is
+// guarded by a generation precondition, an error which satisfies
+// errors.Is(err, bfs.ErrConflict) is returned if the object was modified or
+// created concurrently. Content type and metadata of existing objects are
+// preserved.
+func (b *bucket) ConditionalUpdate(ctx context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	obj := b.bucket.Object(b.withPrefix(name))
+	cond := storage.Conditions{DoesNotExist: true}
+
+	var data []byte
+	var attrs *storage.ObjectAttrs
+	if attrs, err = obj.Attrs(ctx); err == nil {
+		cond = storage.Conditions{GenerationMatch: attrs.Generation}
+		if data, err = readGeneration(ctx, obj, attrs.Generation); err == storage.ErrObjectNotExist {
+			return bfs.ErrConflict
+		} else if err != nil {
+			return normError(err)
+		}
+	} else if err != storage.ErrObjectNotExist {
+		return normError(err)
+	}
+
+	update, err := fn(data)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wrt := obj.If(cond).NewWriter(ctx)
+	wrt.PredefinedACL = b.config.PredefinedACL
+	if attrs != nil {
+		wrt.ContentType = attrs.ContentType
+		wrt.Metadata = attrs.Metadata
+		wrt.CacheControl = attrs.CacheControl
+		wrt.ContentEncoding = attrs.ContentEncoding
+		wrt.ContentDisposition = attrs.ContentDisposition
+		wrt.ContentLanguage = attrs.ContentLanguage
+	} else {
+		wrt.ContentType = internal.ContentTypeByExt(name, b.config.ContentTypeByExt)
+	}
+	if _, err := wrt.Write(update); err != nil {
+		return normConditionalError(err)
+	}
+	return normConditionalError(wrt.Close())
+}
+
+// RemoveIfMatch removes an object only if its generation matches version,
+// as reported by MetaInfo.Version. It returns an error which satisfies
+// errors.Is(err, bfs.ErrConflict) if the object was modified, i.e. its
+// generation has changed.
+func (b *bucket) RemoveIfMatch(ctx context.Context, name, version string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	gen, err := strconv.ParseInt(version, 10, 64)
+	if err != nil || gen <= 0 {
+		return fmt.Errorf("bfsgs: invalid generation %q", version)
+	}
+
+	err = b.bucket.Object(b.withPrefix(name)).If(storage.Conditions{GenerationMatch: gen}).Delete(ctx)
+	if isPreconditionFailed(err) {
+		return bfs.WrapError(bfs.ErrConflict, err)
+	}
+	return normRemoveError(err)
+}
+
+// CopyOptions configure conditional copies, see CopyWithOptions.
+type CopyOptions struct {
+	// OverwriteExisting allows copies to replace existing destinations,
+	// otherwise they fail with bfs.ErrExists.
+	OverwriteExisting bool
+	// SourceETag fails copies with bfs.ErrConflict unless the source version
+	// matches, as reported by bfs.MetaInfo.Version. GCS preconditions match
+	// generations rather than ETags, so this must be a generation number.
+	SourceETag string
+}
+
+// CopyWithOptions copies an object within the bucket, like Copy, but only
+// if the preconditions of opts are met. Both conditions are checked
+// atomically by GCS. A nil opts copies unconditionally, like Copy.
+func (b *bucket) CopyWithOptions(ctx context.Context, src, dst string, opts *CopyOptions) error {
+	src, err := b.checkName(src)
+	if err != nil {
+		return err
+	}
+	dst, err = b.checkName(dst)
+	if err != nil {
+		return err
+	}
+
+	srcObj := b.bucket.Object(b.withPrefix(src))
+	dstObj := b.bucket.Object(b.withPrefix(dst))
+	if opts != nil && opts.SourceETag != "" {
+		gen, err := strconv.ParseInt(opts.SourceETag, 10, 64)
+		if err != nil || gen <= 0 {
+			return fmt.Errorf("bfsgs: invalid generation %q", opts.SourceETag)
+		}
+		srcObj = srcObj.If(storage.Conditions{GenerationMatch: gen})
+	}
+	if opts != nil && !opts.OverwriteExisting {
+		dstObj = dstObj.If(storage.Conditions{DoesNotExist: true})
+	}
+
+	_, err = dstObj.CopierFrom(srcObj).Run(ctx)
+	if isPreconditionFailed(err) {
+		// find out which condition failed
+		if opts != nil && !opts.OverwriteExisting {
+			if _, aerr := b.bucket.Object(b.withPrefix(dst)).Attrs(ctx); aerr == nil {
+				return bfs.WrapError(bfs.ErrExists, err)
+			}
+		}
+		return bfs.WrapError(bfs.ErrConflict, err)
+	}
+
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return bfs.ErrNotFound
+	}
+	return normError(err)
+}
+
+func readGeneration(ctx context.Context, obj *storage.ObjectHandle, gen int64) ([]byte, error) {
+	r, err := obj.Generation(gen).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+func normConditionalError(err error) error {
+	if isPreconditionFailed(err) {
+		return bfs.WrapError(bfs.ErrConflict, err)
+	}
+	return normError(err)
+}
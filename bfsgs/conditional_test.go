@@ -0,0 +1,216 @@
+package bfsgs_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemoveIfMatch", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should remove objects with matching generations", func() {
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Version).To(Equal("1"))
+
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", info.Version)).To(Succeed())
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should keep modified objects", func() {
+		err := bfs.RemoveIfMatch(ctx, subject, "a.txt", "2")
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fail on missing objects", func() {
+		Expect(bfs.RemoveIfMatch(ctx, subject, "b.txt", "1")).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should reject invalid generations", func() {
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", "abc")).To(MatchError(`bfsgs: invalid generation "abc"`))
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", "")).To(MatchError(`bfsgs: invalid generation ""`))
+	})
+})
+
+var _ = Describe("CopyWithOptions", func() {
+	type optionsCopier interface {
+		CopyWithOptions(context.Context, string, string, *bfsgs.CopyOptions) error
+	}
+
+	var server *mockObjectServer
+	var subject optionsCopier
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt", "x/b.txt")
+
+		b, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		subject = b.(optionsCopier)
+	})
+
+	AfterEach(func() {
+		_ = subject.(bfs.Bucket).Close()
+		server.Close()
+	})
+
+	It("should not overwrite existing objects", func() {
+		err := subject.CopyWithOptions(ctx, "a.txt", "b.txt", &bfsgs.CopyOptions{})
+		Expect(errors.Is(err, bfs.ErrExists)).To(BeTrue())
+		Expect(server.rewrites).To(BeZero())
+
+		Expect(subject.CopyWithOptions(ctx, "a.txt", "c.txt", &bfsgs.CopyOptions{})).To(Succeed())
+		Expect(server.rewrites).To(Equal(1))
+		_, err = subject.(bfs.Bucket).Head(ctx, "c.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(subject.CopyWithOptions(ctx, "a.txt", "b.txt", &bfsgs.CopyOptions{OverwriteExisting: true})).To(Succeed())
+		Expect(server.rewrites).To(Equal(2))
+
+		// overwrites without options
+		Expect(subject.CopyWithOptions(ctx, "a.txt", "b.txt", nil)).To(Succeed())
+		Expect(server.rewrites).To(Equal(3))
+	})
+
+	It("should require matching source generations", func() {
+		err := subject.CopyWithOptions(ctx, "a.txt", "c.txt", &bfsgs.CopyOptions{SourceETag: "2"})
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+
+		Expect(subject.CopyWithOptions(ctx, "a.txt", "c.txt", &bfsgs.CopyOptions{SourceETag: "1"})).To(Succeed())
+		Expect(subject.CopyWithOptions(ctx, "a.txt", "c.txt", &bfsgs.CopyOptions{SourceETag: "x"})).To(MatchError(`bfsgs: invalid generation "x"`))
+	})
+
+	It("should fail on missing sources", func() {
+		err := subject.CopyWithOptions(ctx, "missing.txt", "c.txt", &bfsgs.CopyOptions{})
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+})
+
+var _ = Describe("ConditionalUpdate", func() {
+	var server *mockObjectServer
+	var subject interface {
+		bfs.Bucket
+		ConditionalUpdate(context.Context, string, func([]byte) ([]byte, error)) error
+	}
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+		server.objects["x/a.txt"]["contentType"] = "text/csv"
+		server.objects["x/a.txt"]["metadata"] = map[string]interface{}{"Owner": "alice"}
+
+		// serve downloads from the mock via plain HTTP
+		os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+		defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+		bucket, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		subject = bucket.(interface {
+			bfs.Bucket
+			ConditionalUpdate(context.Context, string, func([]byte) ([]byte, error)) error
+		})
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should update objects with generation preconditions", func() {
+		Expect(subject.ConditionalUpdate(ctx, "a.txt", func(data []byte) ([]byte, error) {
+			Expect(string(data)).To(Equal("TESTDATA"))
+			return []byte("UPDATED"), nil
+		})).To(Succeed())
+
+		Expect(server.uploads).To(HaveLen(1))
+		Expect(server.uploads[0].Get("ifGenerationMatch")).To(Equal("1"))
+		Expect(server.media["x/a.txt"]).To(Equal("UPDATED"))
+		Expect(server.Attr("x/a.txt", "contentType")).To(Equal("text/csv"))
+		Expect(server.Metadata("x/a.txt")).To(Equal(map[string]interface{}{"Owner": "alice"}))
+	})
+
+	It("should create missing objects", func() {
+		Expect(subject.ConditionalUpdate(ctx, "b.txt", func(data []byte) ([]byte, error) {
+			Expect(data).To(BeNil())
+			return []byte("CREATED"), nil
+		})).To(Succeed())
+
+		Expect(server.uploads).To(HaveLen(1))
+		Expect(server.uploads[0].Get("ifGenerationMatch")).To(Equal("0"))
+		Expect(server.media["x/b.txt"]).To(Equal("CREATED"))
+	})
+
+	It("should fail on concurrent modifications", func() {
+		err := subject.ConditionalUpdate(ctx, "a.txt", func(data []byte) ([]byte, error) {
+			Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("CONCURRENT"), nil)).To(Succeed())
+			return []byte("UPDATED"), nil
+		})
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+		Expect(server.media["x/a.txt"]).To(Equal("CONCURRENT"))
+	})
+
+	It("should fail on concurrent creation", func() {
+		err := subject.ConditionalUpdate(ctx, "b.txt", func(data []byte) ([]byte, error) {
+			Expect(bfs.WriteObject(ctx, subject, "b.txt", []byte("CONCURRENT"), nil)).To(Succeed())
+			return []byte("CREATED"), nil
+		})
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+		Expect(server.media["x/b.txt"]).To(Equal("CONCURRENT"))
+	})
+
+	It("should abort on callback errors", func() {
+		err := subject.ConditionalUpdate(ctx, "a.txt", func(data []byte) ([]byte, error) {
+			return nil, errors.New("failed")
+		})
+		Expect(err).To(MatchError("failed"))
+		Expect(server.uploads).To(BeEmpty())
+	})
+})
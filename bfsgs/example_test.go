@@ -0,0 +1,50 @@
+package bfsgs_test
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+)
+
+func Example_nativeClient() {
+	ctx := context.Background()
+	bucket, err := bfsgs.New(ctx, "my-bucket", &bfsgs.Config{Prefix: "reports/"})
+	if err != nil {
+		panic(err)
+	}
+	defer bucket.Close()
+
+	// access the native handles via type assertion
+	native := bucket.(interface {
+		Client() *storage.Client
+		Handle() *storage.BucketHandle
+	})
+
+	// fetch the lifecycle configuration
+	attrs, err := native.Handle().Attrs(ctx)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("RULES:", len(attrs.Lifecycle.Rules))
+
+	// the prefix must be applied manually
+	info, _ := bfs.Describe(bucket)
+	objAttrs, err := native.Handle().Object(info.Prefix + "2020/summary.pdf").Attrs(ctx)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("CRC32C:", objAttrs.CRC32C)
+
+	// list all buckets of a project
+	it := native.Client().Buckets(ctx, "my-project")
+	for {
+		b, err := it.Next()
+		if err != nil {
+			break
+		}
+		fmt.Println("BUCKET:", b.Name)
+	}
+}
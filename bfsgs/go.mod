@@ -3,17 +3,12 @@ module github.com/bsm/bfs/bfsgs
 go 1.14
 
 require (
-	cloud.google.com/go v0.55.0 // indirect
-	cloud.google.com/go/storage v1.6.0
+	cloud.google.com/go/storage v1.13.0
 	github.com/bmatcuk/doublestar v1.2.2
 	github.com/bsm/bfs v0.9.0
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
-	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e // indirect
-	golang.org/x/sys v0.0.0-20200327173247-9dae0f8f5775 // indirect
-	golang.org/x/tools v0.0.0-20200330040139-fa3cc9eebcfe // indirect
-	google.golang.org/api v0.20.0
-	google.golang.org/genproto v0.0.0-20200330113809-af700f360a68 // indirect
+	google.golang.org/api v0.38.0
 )
 
 replace github.com/bsm/bfs => ../
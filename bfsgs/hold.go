@@ -0,0 +1,61 @@
+package bfsgs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+	"google.golang.org/api/googleapi"
+)
+
+// ErrHeld is returned by Remove when an object cannot be deleted because
+// it is under a temporary or event-based hold. It wraps the original
+// error, which also satisfies errors.Is(err, bfs.ErrAccessDenied).
+var ErrHeld = errors.New("bfsgs: object is under hold")
+
+// SetHold places a hold on an object, which prevents it from being
+// deleted or overwritten until the hold is released. A temporary hold is
+// placed if temporary is true, an event-based hold otherwise.
+func (b *bucket) SetHold(ctx context.Context, name string, temporary bool) error {
+	return b.updateHold(ctx, name, temporary, true)
+}
+
+// ReleaseHold releases a hold previously placed by SetHold.
+func (b *bucket) ReleaseHold(ctx context.Context, name string, temporary bool) error {
+	return b.updateHold(ctx, name, temporary, false)
+}
+
+func (b *bucket) updateHold(ctx context.Context, name string, temporary, hold bool) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	var attrs storage.ObjectAttrsToUpdate
+	if temporary {
+		attrs.TemporaryHold = hold
+	} else {
+		attrs.EventBasedHold = hold
+	}
+
+	_, err = b.bucket.Object(b.withPrefix(name)).Update(ctx, attrs)
+	return normError(err)
+}
+
+// isHoldError returns true if err was caused by an active hold.
+func isHoldError(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) &&
+		gerr.Code == http.StatusForbidden &&
+		strings.Contains(strings.ToLower(gerr.Message), " hold")
+}
+
+func normRemoveError(err error) error {
+	if isHoldError(err) {
+		return bfs.WrapError(ErrHeld, normError(err))
+	}
+	return normError(err)
+}
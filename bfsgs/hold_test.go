@@ -0,0 +1,83 @@
+package bfsgs_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Holds", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	type holder interface {
+		SetHold(context.Context, string, bool) error
+		ReleaseHold(context.Context, string, bool) error
+	}
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should set, read and release temporary holds", func() {
+		Expect(subject.(holder).SetHold(ctx, "a.txt", true)).To(Succeed())
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.TemporaryHold).To(BeTrue())
+		Expect(info.EventBasedHold).To(BeFalse())
+
+		err = subject.Remove(ctx, "a.txt")
+		Expect(errors.Is(err, bfsgs.ErrHeld)).To(BeTrue())
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+
+		Expect(subject.(holder).ReleaseHold(ctx, "a.txt", true)).To(Succeed())
+		info, err = subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.TemporaryHold).To(BeFalse())
+
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should set and release event-based holds", func() {
+		Expect(subject.(holder).SetHold(ctx, "a.txt", false)).To(Succeed())
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.TemporaryHold).To(BeFalse())
+		Expect(info.EventBasedHold).To(BeTrue())
+		Expect(errors.Is(subject.Remove(ctx, "a.txt"), bfsgs.ErrHeld)).To(BeTrue())
+
+		Expect(subject.(holder).ReleaseHold(ctx, "a.txt", false)).To(Succeed())
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+	})
+
+	It("should fail on missing objects", func() {
+		Expect(subject.(holder).SetHold(ctx, "missing.txt", true)).To(Equal(bfs.ErrNotFound))
+	})
+})
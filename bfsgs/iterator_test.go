@@ -0,0 +1,75 @@
+package bfsgs_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GenerationIterator", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt", "x/b.txt")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	generations := func() map[string][2]int64 {
+		iter, err := subject.Glob(ctx, "*")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		gens := make(map[string][2]int64)
+		for iter.Next() {
+			gi := iter.(bfsgs.GenerationIterator)
+			gens[gi.Name()] = [2]int64{gi.Generation(), gi.Metageneration()}
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		return gens
+	}
+
+	It("should expose generations", func() {
+		Expect(generations()).To(Equal(map[string][2]int64{
+			"a.txt": {1, 1},
+			"b.txt": {1, 1},
+		}))
+
+		w, err := subject.Create(ctx, "a.txt", &bfs.WriteOptions{Size: 7})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("NEWDATA"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Commit()).To(Succeed())
+
+		type patcher interface {
+			PatchMetadata(context.Context, string, map[string]string, []string) error
+		}
+		Expect(subject.(patcher).PatchMetadata(ctx, "b.txt", map[string]string{"status": "done"}, nil)).To(Succeed())
+
+		Expect(generations()).To(Equal(map[string][2]int64{
+			"a.txt": {2, 1},
+			"b.txt": {1, 2},
+		}))
+	})
+})
@@ -0,0 +1,79 @@
+package bfsgs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+	"google.golang.org/api/googleapi"
+)
+
+// maxPatchAttempts limits retries of PatchMetadata on concurrent modifications.
+const maxPatchAttempts = 3
+
+// PatchMetadata updates individual metadata keys of an object, without
+// rewriting its content. Keys in set are added or replaced, keys listed in
+// remove are deleted, all other keys are preserved.
+//
+// Updates are guarded by metageneration preconditions and retried when the
+// object's metadata was concurrently modified, so no updates are lost.
+func (b *bucket) PatchMetadata(ctx context.Context, name string, set map[string]string, remove []string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	if err := bfs.ValidateMetadata(set, MaxMetadataSize); err != nil {
+		return err
+	}
+
+	obj := b.bucket.Object(b.withPrefix(name))
+	for attempt := 1; ; attempt++ {
+		err = b.patchMetadata(ctx, obj, set, remove)
+		if !isPreconditionFailed(err) || attempt == maxPatchAttempts {
+			return normError(err)
+		}
+	}
+}
+
+func (b *bucket) patchMetadata(ctx context.Context, obj *storage.ObjectHandle, set map[string]string, remove []string) error {
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return err
+	}
+
+	merged := make(bfs.Metadata, len(attrs.Metadata)+len(set))
+	for k, v := range attrs.Metadata {
+		merged.Set(k, v)
+	}
+	for k, v := range set {
+		merged.Set(k, v)
+	}
+	for _, key := range remove {
+		merged.Del(key)
+	}
+	if err := bfs.ValidateMetadata(merged, MaxMetadataSize); err != nil {
+		return err
+	}
+
+	// GCS merges metadata updates, stored keys are deleted by empty values;
+	// this includes keys which are replaced by their canonical spelling
+	update := make(map[string]string, len(attrs.Metadata)+len(merged))
+	for k := range attrs.Metadata {
+		update[k] = ""
+	}
+	for k, v := range merged {
+		update[k] = v
+	}
+
+	cond := storage.Conditions{MetagenerationMatch: attrs.Metageneration}
+	_, err = obj.If(cond).Update(ctx, storage.ObjectAttrsToUpdate{Metadata: update})
+	return err
+}
+
+func isPreconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed
+}
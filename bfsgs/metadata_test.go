@@ -0,0 +1,83 @@
+package bfsgs_test
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PatchMetadata", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	type patcher interface {
+		PatchMetadata(context.Context, string, map[string]string, []string) error
+	}
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+		server.objects["x/a.txt"]["metadata"] = map[string]interface{}{"Status": "new", "Owner": "alice"}
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should patch keys and preserve others", func() {
+		Expect(subject.(patcher).PatchMetadata(ctx, "a.txt", map[string]string{"status": "done", "x_step": "3"}, nil)).To(Succeed())
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Status": "done", "Owner": "alice", "X-Step": "3"}))
+		Expect(server.rewrites).To(Equal(0))
+	})
+
+	It("should remove keys", func() {
+		Expect(subject.(patcher).PatchMetadata(ctx, "a.txt", map[string]string{"Status": "done"}, []string{"owner"})).To(Succeed())
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Status": "done"}))
+		Expect(server.rewrites).To(Equal(0))
+	})
+
+	It("should replace keys in canonical spelling", func() {
+		server.objects["x/a.txt"]["metadata"] = map[string]interface{}{"x_step": "2", "Owner": "alice"}
+		Expect(subject.(patcher).PatchMetadata(ctx, "a.txt", map[string]string{"X-Step": "3"}, nil)).To(Succeed())
+		Expect(server.Metadata("x/a.txt")).To(Equal(map[string]interface{}{"X-Step": "3", "Owner": "alice"}))
+		Expect(server.rewrites).To(Equal(0))
+	})
+
+	It("should retry on concurrent modifications", func() {
+		server.conflicts = 2
+		Expect(subject.(patcher).PatchMetadata(ctx, "a.txt", map[string]string{"Status": "done"}, nil)).To(Succeed())
+		Expect(server.Metadata("x/a.txt")).To(HaveKeyWithValue("Status", "done"))
+
+		server.conflicts = 3
+		err := subject.(patcher).PatchMetadata(ctx, "a.txt", map[string]string{"Status": "failed"}, nil)
+		Expect(err).To(MatchError(ContainSubstring("Precondition Failed")))
+		Expect(server.Metadata("x/a.txt")).To(HaveKeyWithValue("Status", "done"))
+	})
+
+	It("should fail on missing objects", func() {
+		Expect(subject.(patcher).PatchMetadata(ctx, "missing.txt", map[string]string{"Status": "done"}, nil)).To(Equal(bfs.ErrNotFound))
+	})
+})
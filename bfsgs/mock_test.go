@@ -0,0 +1,526 @@
+package bfsgs_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mockObjectServer emulates object metadata operations of the GCS JSON API.
+type mockObjectServer struct {
+	*httptest.Server
+
+	conflicts int               // fail the next n updates with precondition errors
+	media     map[string]string // object content, served by downloads
+	truncate  bool              // end downloads after half of the content
+	forbidden bool              // fail all requests with 403 Forbidden
+	ranges    []string          // requested download ranges
+
+	mu       sync.Mutex
+	objects  map[string]map[string]interface{}
+	rewrites int
+	lists    []url.Values // list request queries
+	uploads  []url.Values // upload request queries
+	agents   []string     // User-Agent headers
+	sessions map[string]*mockSession
+}
+
+// mockSession is a resumable upload session.
+type mockSession struct {
+	attrs map[string]interface{}
+	data  []byte
+	done  bool
+}
+
+func newMockObjectServer(names ...string) *mockObjectServer {
+	s := &mockObjectServer{
+		objects:  make(map[string]map[string]interface{}),
+		media:    make(map[string]string),
+		sessions: make(map[string]*mockSession),
+	}
+	for _, name := range names {
+		s.Put(name, "TESTDATA")
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Put stores an object.
+func (s *mockObjectServer) Put(name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.media[name] = data
+	s.objects[name] = map[string]interface{}{
+		"bucket":         bucketName,
+		"name":           name,
+		"size":           strconv.Itoa(len(data)),
+		"updated":        "2020-01-01T00:00:00.000Z",
+		"generation":     "1",
+		"metageneration": "1",
+		"acl": []interface{}{
+			map[string]interface{}{"entity": "project-owners-123456", "role": "OWNER"},
+			map[string]interface{}{"entity": "allUsers", "role": "READER"},
+		},
+	}
+}
+
+// Ranges returns the requested download ranges.
+func (s *mockObjectServer) Ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.ranges...)
+}
+
+// Metadata returns the custom metadata of an object.
+func (s *mockObjectServer) Metadata(name string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meta, _ := s.objects[name]["metadata"].(map[string]interface{})
+	return meta
+}
+
+// Attr returns a stored attribute of an object.
+func (s *mockObjectServer) Attr(name, key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.objects[name][key]
+}
+
+func (s *mockObjectServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.agents = append(s.agents, r.Header.Get("User-Agent"))
+
+	if s.forbidden {
+		s.fail(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "multipart" {
+		s.upload(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable" {
+		s.initiateUpload(w, r)
+		return
+	}
+	if r.Method == http.MethodPut && r.URL.Query().Get("upload_id") != "" {
+		s.resumeUpload(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/b/"+bucketName) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": bucketName})
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/o") {
+		s.list(w, r)
+		return
+	}
+	if prefix := "/" + bucketName + "/"; r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, prefix) {
+		s.download(w, r, strings.TrimPrefix(r.URL.Path, prefix))
+		return
+	}
+
+	parts := strings.SplitN(r.URL.Path, "/o/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	name := parts[1]
+	if i := strings.Index(name, "/rewriteTo/"); i > -1 {
+		name = name[:i]
+	}
+	acl := strings.HasSuffix(name, "/acl")
+	name = strings.TrimSuffix(name, "/acl")
+
+	obj, ok := s.objects[name]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "No such object")
+		return
+	}
+
+	if acl && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": obj["acl"]})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		if !s.checkPreconditions(w, r, obj) {
+			return
+		}
+
+		var update map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			s.fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for key, val := range update {
+			if key == "metadata" {
+				val = mergeMetadata(obj[key], val)
+			}
+			obj[key] = val
+		}
+		s.bump(obj, "metageneration")
+	case http.MethodPost:
+		if !strings.Contains(parts[1], "/rewriteTo/") {
+			return
+		}
+		dst := parts[1][strings.LastIndex(parts[1], "/o/")+3:]
+		if dst == name && !s.checkPreconditions(w, r, obj) {
+			return
+		} else if dst != name && !s.checkCopyPreconditions(w, r, obj, dst) {
+			return
+		}
+
+		var attrs map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+			s.fail(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// copy to a different destination
+		if dst != name {
+			cpy := make(map[string]interface{}, len(obj))
+			for key, val := range obj {
+				cpy[key] = val
+			}
+			cpy["name"] = dst
+			s.objects[dst], s.media[dst] = cpy, s.media[name]
+			obj = cpy
+		} else if _, ok := attrs["metadata"]; !ok {
+			delete(obj, "metadata")
+		}
+		for key, val := range attrs {
+			obj[key] = val
+		}
+		s.bump(obj, "generation")
+		obj["metageneration"] = "1"
+		s.rewrites++
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"kind":     "storage#rewriteResponse",
+			"done":     true,
+			"resource": obj,
+		})
+		return
+	case http.MethodDelete:
+		if !s.checkPreconditions(w, r, obj) {
+			return
+		}
+		for _, hold := range []string{"temporaryHold", "eventBasedHold"} {
+			if obj[hold] == true {
+				s.fail(w, http.StatusForbidden, fmt.Sprintf("Object '%s/%s' is under active %s hold and cannot be deleted, overwritten or archived until hold is removed.", bucketName, name, hold))
+				return
+			}
+		}
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func (s *mockObjectServer) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	s.lists = append(s.lists, query)
+
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		if strings.HasPrefix(name, query.Get("prefix")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	offset, _ := strconv.Atoi(query.Get("pageToken"))
+	names = names[offset:]
+
+	res := map[string]interface{}{"kind": "storage#objects"}
+	if n, _ := strconv.Atoi(query.Get("maxResults")); n > 0 && n < len(names) {
+		names = names[:n]
+		res["nextPageToken"] = strconv.Itoa(offset + n)
+	}
+
+	items := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		items = append(items, s.objects[name])
+	}
+	res["items"] = items
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// upload handles single-request (multipart) uploads.
+func (s *mockObjectServer) upload(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var attrs map[string]interface{}
+	if err := json.NewDecoder(part).Decode(&attrs); err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.checkUploadPreconditions(w, r, attrs) {
+		return
+	}
+
+	if part, err = mr.NextPart(); err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.store(w, attrs, data)
+}
+
+// store stores an uploaded object and responds with its attributes.
+func (s *mockObjectServer) store(w http.ResponseWriter, attrs map[string]interface{}, data []byte) {
+	name, _ := attrs["name"].(string)
+	attrs["bucket"] = bucketName
+	attrs["size"] = strconv.Itoa(len(data))
+	attrs["updated"] = "2020-01-01T00:00:00.000Z"
+	attrs["generation"] = "1"
+	attrs["metageneration"] = "1"
+	if obj, ok := s.objects[name]; ok {
+		s.bump(obj, "generation")
+		attrs["generation"] = obj["generation"]
+	}
+	s.objects[name] = attrs
+	s.media[name] = string(data)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(attrs)
+}
+
+func (s *mockObjectServer) initiateUpload(w http.ResponseWriter, r *http.Request) {
+	var attrs map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&attrs); err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.checkUploadPreconditions(w, r, attrs) {
+		return
+	}
+
+	id := strconv.Itoa(len(s.sessions) + 1)
+	s.sessions[id] = &mockSession{attrs: attrs}
+	w.Header().Set("Location", "http://"+r.Host+r.URL.Path+"?uploadType=resumable&upload_id="+id)
+}
+
+func (s *mockObjectServer) resumeUpload(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.sessions[r.URL.Query().Get("upload_id")]
+	if !ok {
+		s.fail(w, http.StatusNotFound, "No such upload")
+		return
+	}
+	if sess.done {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sess.attrs)
+		return
+	}
+
+	// parse Content-Range, e.g. "bytes 0-99/*", "bytes */100" or "bytes */*"
+	var start, total int64 = -1, -1
+	rng := strings.SplitN(strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes "), "/", 2)
+	if len(rng) != 2 {
+		s.fail(w, http.StatusBadRequest, "invalid Content-Range")
+		return
+	}
+	if rng[0] != "*" {
+		start, _ = strconv.ParseInt(strings.SplitN(rng[0], "-", 2)[0], 10, 64)
+	}
+	if rng[1] != "*" {
+		total, _ = strconv.ParseInt(rng[1], 10, 64)
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if start > -1 {
+		if start != int64(len(sess.data)) {
+			s.fail(w, http.StatusBadRequest, "unexpected offset")
+			return
+		}
+		sess.data = append(sess.data, data...)
+	}
+
+	if total > -1 && total == int64(len(sess.data)) {
+		sess.done = true
+		s.store(w, sess.attrs, sess.data)
+		return
+	}
+	if len(sess.data) != 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(sess.data)-1))
+	}
+	w.WriteHeader(308)
+}
+
+func (s *mockObjectServer) download(w http.ResponseWriter, r *http.Request, name string) {
+	data, ok := s.media[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || start >= len(data) {
+			s.fail(w, http.StatusRequestedRangeNotSatisfiable, "invalid range")
+			return
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		s.ranges = append(s.ranges, rng)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data, status = data[start:end+1], http.StatusPartialContent
+	}
+
+	// emulate decompressive transcoding of gzip encoded objects
+	if s.objects[name]["contentEncoding"] == "gzip" {
+		w.Header().Set("X-Goog-Stored-Content-Encoding", "gzip")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+		} else if zr, err := gzip.NewReader(strings.NewReader(data)); err == nil {
+			plain, _ := ioutil.ReadAll(zr)
+			data = string(plain)
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Goog-Generation", "1")
+	w.WriteHeader(status)
+	if s.truncate {
+		data = data[:len(data)/2]
+	}
+	_, _ = w.Write([]byte(data))
+}
+
+func (s *mockObjectServer) checkPreconditions(w http.ResponseWriter, r *http.Request, obj map[string]interface{}) bool {
+	if s.conflicts > 0 {
+		s.conflicts--
+		s.bump(obj, "metageneration")
+	}
+
+	query := r.URL.Query()
+	for param, field := range map[string]string{
+		"ifGenerationMatch":     "generation",
+		"ifMetagenerationMatch": "metageneration",
+	} {
+		if v := query.Get(param); v != "" && v != obj[field] {
+			s.fail(w, http.StatusPreconditionFailed, "Precondition Failed")
+			return false
+		}
+	}
+	return true
+}
+
+// checkCopyPreconditions checks the source and destination preconditions of
+// copies, generation 0 requires the destination to be missing.
+func (s *mockObjectServer) checkCopyPreconditions(w http.ResponseWriter, r *http.Request, src map[string]interface{}, dst string) bool {
+	query := r.URL.Query()
+	if v := query.Get("ifSourceGenerationMatch"); v != "" && v != src["generation"] {
+		s.fail(w, http.StatusPreconditionFailed, "Precondition Failed")
+		return false
+	}
+	return s.checkGeneration(w, query.Get("ifGenerationMatch"), dst)
+}
+
+// checkUploadPreconditions records the query of an upload and checks its
+// generation precondition.
+func (s *mockObjectServer) checkUploadPreconditions(w http.ResponseWriter, r *http.Request, attrs map[string]interface{}) bool {
+	query := r.URL.Query()
+	s.uploads = append(s.uploads, query)
+
+	name, _ := attrs["name"].(string)
+	return s.checkGeneration(w, query.Get("ifGenerationMatch"), name)
+}
+
+// checkGeneration checks a generation precondition of a write to name,
+// generation 0 requires the object to be missing.
+func (s *mockObjectServer) checkGeneration(w http.ResponseWriter, gen, name string) bool {
+	if gen == "" {
+		return true
+	}
+
+	existing, ok := s.objects[name]
+	if (gen == "0" && ok) || (gen != "0" && (!ok || gen != existing["generation"])) {
+		s.fail(w, http.StatusPreconditionFailed, "Precondition Failed")
+		return false
+	}
+	return true
+}
+
+func (s *mockObjectServer) bump(obj map[string]interface{}, field string) {
+	n, _ := strconv.Atoi(obj[field].(string))
+	obj[field] = strconv.Itoa(n + 1)
+}
+
+func (s *mockObjectServer) fail(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, code, msg)
+}
+
+// mergeMetadata applies PATCH semantics, null or empty values delete keys.
+func mergeMetadata(current, update interface{}) interface{} {
+	merged := make(map[string]interface{})
+	if m, ok := current.(map[string]interface{}); ok {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	if update == nil {
+		return nil
+	}
+	for k, v := range update.(map[string]interface{}) {
+		if v == nil || v == "" {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
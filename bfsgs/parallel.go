@@ -0,0 +1,178 @@
+package bfsgs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+)
+
+// Defaults for OpenParallel.
+const (
+	DefaultDownloadPartSize    = 8 * 1024 * 1024
+	DefaultDownloadConcurrency = 4
+)
+
+var errReaderClosed = errors.New("bfsgs: reader is closed")
+
+// OpenParallel opens an object for reading, like Open, but fetches byte ranges
+// of partSize bytes using up to concurrency parallel requests. Parts are
+// reassembled in order and presented as a single sequential reader. This
+// improves the throughput for large objects considerably.
+//
+// Up to concurrency+1 parts are buffered in memory. All ranges are read from
+// the same generation of the object, even if it is overwritten concurrently.
+// Zero or negative values fall back on DefaultDownloadPartSize and
+// DefaultDownloadConcurrency respectively.
+func (b *bucket) OpenParallel(ctx context.Context, name string, partSize int64, concurrency int) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if partSize <= 0 {
+		partSize = DefaultDownloadPartSize
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+
+	obj := b.bucket.Object(b.withPrefix(name))
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, normError(err)
+	}
+	obj = obj.Generation(attrs.Generation)
+
+	if attrs.Size <= partSize || concurrency == 1 {
+		ord, err := obj.NewReader(ctx)
+		if err != nil {
+			return nil, normError(err)
+		}
+		return &reader{Reader: ord}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		ctx:     ctx,
+		attrs:   attrs,
+		cancel:  cancel,
+		results: make(chan chan partResult, concurrency),
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(r.results)
+		r.dispatch(ctx, obj, partSize)
+	}()
+	return r, nil
+}
+
+type partResult struct {
+	data []byte
+	err  error
+}
+
+// parallelReader reads parts from an ordered queue of results.
+type parallelReader struct {
+	ctx     context.Context
+	attrs   *storage.ObjectAttrs
+	cancel  context.CancelFunc
+	results chan chan partResult // ordered, bounded by concurrency
+	wg      sync.WaitGroup
+
+	buf       []byte
+	pos       int64 // bytes read
+	err       error
+	closeOnce sync.Once
+}
+
+func (r *parallelReader) dispatch(ctx context.Context, obj *storage.ObjectHandle, partSize int64) {
+	for offset := int64(0); offset < r.attrs.Size; offset += partSize {
+		length := partSize
+		if n := r.attrs.Size - offset; n < length {
+			length = n
+		}
+
+		res := make(chan partResult, 1)
+		select {
+		case r.results <- res:
+		case <-ctx.Done():
+			return
+		}
+
+		r.wg.Add(1)
+		go func(offset, length int64) {
+			defer r.wg.Done()
+
+			data, err := fetchRange(ctx, obj, offset, length)
+			if err != nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			res <- partResult{data: data, err: err}
+		}(offset, length)
+	}
+}
+
+func fetchRange(ctx context.Context, obj *storage.ObjectHandle, offset, length int64) ([]byte, error) {
+	rr, err := obj.NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, normError(err)
+	}
+	defer rr.Close()
+
+	data, err := ioutil.ReadAll(&reader{Reader: rr})
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != length {
+		return nil, bfs.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		res, ok := <-r.results
+		if !ok {
+			r.err = io.EOF
+			if r.pos < r.attrs.Size { // dispatch was aborted
+				r.err = r.ctx.Err()
+			}
+			continue
+		}
+
+		part := <-res
+		r.buf, r.err = part.data, part.err
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *parallelReader) Size() int64         { return r.attrs.Size }
+func (r *parallelReader) ModTime() time.Time  { return r.attrs.Updated }
+func (r *parallelReader) ContentType() string { return r.attrs.ContentType }
+
+func (r *parallelReader) Close() error {
+	r.closeOnce.Do(func() {
+		r.cancel()
+		for range r.results { // unblock the dispatcher
+		}
+		r.wg.Wait()
+		r.buf, r.err = nil, errReaderClosed
+	})
+	return nil
+}
@@ -0,0 +1,69 @@
+package bfsgs_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rename", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockObjectServer("x/a.txt")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix: "x/",
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should rename objects", func() {
+		Expect(bfs.Rename(ctx, subject, "a.txt", "b/c.txt")).To(Succeed())
+		Expect(server.objects).To(HaveKey("x/b/c.txt"))
+		Expect(server.objects).NotTo(HaveKey("x/a.txt"))
+
+		Expect(bfs.Rename(ctx, subject, "a.txt", "d.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should not remove objects renamed onto themselves", func() {
+		renamer := subject.(interface {
+			Rename(context.Context, string, string) error
+		})
+		Expect(renamer.Rename(ctx, "a.txt", "a.txt")).To(Succeed())
+		Expect(renamer.Rename(ctx, "/a.txt", "a.txt")).To(Succeed())
+		Expect(server.objects).To(HaveKey("x/a.txt"))
+		Expect(server.rewrites).To(BeZero())
+
+		Expect(renamer.Rename(ctx, "b.txt", "b.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should report sources which could not be removed", func() {
+		server.objects["x/a.txt"]["temporaryHold"] = true
+
+		err := bfs.Rename(ctx, subject, "a.txt", "b.txt")
+		Expect(errors.Is(err, bfs.ErrSourceNotRemoved)).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("under active temporaryHold hold")))
+		Expect(server.objects).To(HaveKey("x/a.txt"))
+		Expect(server.objects).To(HaveKey("x/b.txt"))
+	})
+})
@@ -0,0 +1,320 @@
+package bfsgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	raw "google.golang.org/api/storage/v1"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// ErrSessionExpired is returned when a resumable upload session is no longer
+// valid, e.g. because it has expired, was completed or cancelled.
+var ErrSessionExpired = errors.New("bfsgs: upload session expired")
+
+var errWriterClosed = errors.New("bfsgs: writer is closed")
+
+// resumableChunkAlign is the granularity of resumable upload chunks.
+const resumableChunkAlign = 256 * 1024
+
+// statusResumeIncomplete is returned for incomplete resumable uploads.
+const statusResumeIncomplete = 308
+
+// CreateResumable initiates a resumable upload and returns its session URL
+// together with a writer for the content. The session URL can be persisted
+// and passed to ResumeUpload, e.g. to continue an upload after a process
+// restart. Content is uploaded in chunks of Config.ChunkSize bytes (rounded up
+// to a multiple of 256KiB, default 16MiB), only whole chunks are persisted
+// before the writer is closed. Close completes the upload.
+//
+// Please note that GCS expires upload sessions one week after they were
+// initiated, uploads must be completed within that time. The session URL
+// authorizes uploads on its own and should be stored securely.
+func (b *bucket) CreateResumable(ctx context.Context, name string, opts *bfs.WriteOptions) (string, io.WriteCloser, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if opts.HasRetention() {
+		return "", nil, bfs.ErrNotSupported
+	}
+
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return "", nil, err
+	}
+
+	acl := b.config.PredefinedACL
+	if s := opts.GetACL(); s != "" {
+		if err := validateACL(s); err != nil {
+			return "", nil, err
+		}
+		acl = s
+	}
+
+	client, endpoint, err := b.uploadClient(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", nil, err
+	}
+	u.Path = "/upload/storage/v1/b/" + b.name + "/o"
+	query := url.Values{"uploadType": {"resumable"}}
+	if acl != "" {
+		query.Set("predefinedAcl", acl)
+	}
+	if b.config.BillingProject != "" {
+		query.Set("userProject", b.config.BillingProject)
+	}
+	u.RawQuery = query.Encode()
+
+	contentType := opts.GetContentType()
+	if contentType == "" {
+		contentType = internal.ContentTypeByExt(name, b.config.ContentTypeByExt)
+	}
+	attrs, err := json.Marshal(&raw.Object{
+		Name:               b.withPrefix(name),
+		ContentType:        contentType,
+		Metadata:           opts.GetMetadata(),
+		CacheControl:       opts.GetCacheControl(),
+		ContentEncoding:    opts.GetContentEncoding(),
+		ContentDisposition: opts.GetContentDisposition(),
+		ContentLanguage:    opts.GetContentLanguage(),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(attrs))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return "", nil, normError(err)
+	}
+	sessionURL := resp.Header.Get("Location")
+	if sessionURL == "" {
+		return "", nil, fmt.Errorf("bfsgs: no upload session returned")
+	}
+
+	return sessionURL, b.newResumableWriter(ctx, client, sessionURL, 0, 0), nil
+}
+
+// ResumeUpload resumes a resumable upload, initiated by CreateResumable. The
+// returned writer expects the content starting at offset, e.g. the last
+// checkpoint of the caller. Content which was persisted by GCS already is
+// skipped, it is not uploaded twice. An error is returned if the offset is
+// beyond the persisted content, and one which satisfies
+// errors.Is(err, ErrSessionExpired) if the session is no longer valid.
+func (b *bucket) ResumeUpload(ctx context.Context, sessionURL string, offset int64) (io.WriteCloser, error) {
+	client, _, err := b.uploadClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	persisted, err := queryUpload(ctx, client, sessionURL)
+	if err != nil {
+		return nil, err
+	}
+	if offset > persisted {
+		return nil, fmt.Errorf("bfsgs: cannot resume upload at offset %d, only %d bytes were persisted", offset, persisted)
+	}
+	return b.newResumableWriter(ctx, client, sessionURL, persisted, persisted-offset), nil
+}
+
+// uploadClient returns an HTTP client and the API endpoint for uploads,
+// configured like the storage client.
+func (b *bucket) uploadClient(ctx context.Context) (*http.Client, string, error) {
+	opts := []option.ClientOption{option.WithScopes(storage.ScopeFullControl)}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		opts = []option.ClientOption{
+			option.WithoutAuthentication(),
+			internaloption.WithDefaultEndpoint("http://" + host + "/storage/v1/"),
+		}
+	} else {
+		opts = append(opts, internaloption.WithDefaultEndpoint("https://storage.googleapis.com/storage/v1/"))
+	}
+	opts = append(opts, b.config.Options...)
+	if b.config.UserAgent != "" {
+		opts = append(opts, option.WithUserAgent(b.config.UserAgent))
+	}
+	return htransport.NewClient(ctx, opts...)
+}
+
+// queryUpload returns the number of bytes persisted by an upload session.
+func queryUpload(ctx context.Context, client *http.Client, sessionURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Range", "bytes */*")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case statusResumeIncomplete:
+		return persistedBytes(resp), nil
+	case http.StatusOK, http.StatusCreated:
+		return 0, fmt.Errorf("%w: upload is complete", ErrSessionExpired)
+	case http.StatusNotFound, http.StatusGone:
+		return 0, bfs.WrapError(ErrSessionExpired, googleapi.CheckResponse(resp))
+	}
+	return 0, normError(googleapi.CheckResponse(resp))
+}
+
+// persistedBytes parses the Range header of an incomplete upload response,
+// e.g. "bytes=0-1023".
+func persistedBytes(resp *http.Response) int64 {
+	rng := resp.Header.Get("Range")
+	if i := strings.LastIndexByte(rng, '-'); i > -1 {
+		if n, err := strconv.ParseInt(rng[i+1:], 10, 64); err == nil {
+			return n + 1
+		}
+	}
+	return 0
+}
+
+// --------------------------------------------------------------------
+
+type resumableWriter struct {
+	ctx        context.Context
+	client     *http.Client
+	sessionURL string
+	chunkSize  int
+
+	offset int64 // number of persisted bytes
+	skip   int64 // number of bytes to skip, which were persisted before
+	buf    []byte
+	closed bool
+}
+
+func (b *bucket) newResumableWriter(ctx context.Context, client *http.Client, sessionURL string, offset, skip int64) *resumableWriter {
+	chunkSize := b.config.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = googleapi.DefaultUploadChunkSize
+	}
+	if rem := chunkSize % resumableChunkAlign; rem != 0 {
+		chunkSize += resumableChunkAlign - rem
+	}
+
+	return &resumableWriter{
+		ctx:        ctx,
+		client:     client,
+		sessionURL: sessionURL,
+		chunkSize:  chunkSize,
+		offset:     offset,
+		skip:       skip,
+	}
+}
+
+func (w *resumableWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+
+	n := len(p)
+	if w.skip > 0 {
+		m := int64(len(p))
+		if m > w.skip {
+			m = w.skip
+		}
+		p, w.skip = p[m:], w.skip-m
+	}
+
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= w.chunkSize {
+		if err := w.upload(w.buf[:w.chunkSize], false); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[w.chunkSize:]
+	}
+	return n, nil
+}
+
+// Close uploads the remaining content and completes the upload.
+func (w *resumableWriter) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+
+	if w.skip > 0 {
+		return fmt.Errorf("bfsgs: upload ended %d bytes before the persisted content", w.skip)
+	}
+	return w.upload(w.buf, true)
+}
+
+// upload uploads a chunk, the final chunk completes the upload.
+func (w *resumableWriter) upload(chunk []byte, final bool) error {
+	total := "*"
+	if final {
+		total = strconv.FormatInt(w.offset+int64(len(chunk)), 10)
+	}
+
+	rng := "*"
+	if len(chunk) != 0 {
+		rng = fmt.Sprintf("%d-%d", w.offset, w.offset+int64(len(chunk))-1)
+	}
+
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPut, w.sessionURL, bytes.NewReader(chunk))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Range", "bytes "+rng+"/"+total)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case statusResumeIncomplete:
+		if final {
+			return fmt.Errorf("bfsgs: upload is incomplete")
+		}
+		if persisted := persistedBytes(resp); persisted != w.offset+int64(len(chunk)) {
+			return fmt.Errorf("bfsgs: upload persisted %d bytes, expected %d", persisted, w.offset+int64(len(chunk)))
+		}
+		w.offset += int64(len(chunk))
+		return nil
+	case http.StatusOK, http.StatusCreated:
+		w.offset += int64(len(chunk))
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return bfs.WrapError(ErrSessionExpired, googleapi.CheckResponse(resp))
+	}
+	return normError(googleapi.CheckResponse(resp))
+}
@@ -0,0 +1,99 @@
+package bfsgs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResumeUpload", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	type resumer interface {
+		CreateResumable(context.Context, string, *bfs.WriteOptions) (string, io.WriteCloser, error)
+		ResumeUpload(context.Context, string, int64) (io.WriteCloser, error)
+	}
+
+	BeforeEach(func() {
+		server = newMockObjectServer()
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:    "x/",
+			ChunkSize: 256 * 1024,
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	It("should upload", func() {
+		sessionURL, w, err := subject.(resumer).CreateResumable(ctx, "a.txt", &bfs.WriteOptions{
+			ContentType: "text/plain",
+			Metadata:    bfs.Metadata{"Status": "new"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessionURL).To(ContainSubstring("upload_id="))
+
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.Close()).To(Succeed())
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+		Expect(info.ContentType).To(Equal("text/plain"))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Status": "new"}))
+		Expect(server.media["x/a.txt"]).To(Equal("TESTDATA"))
+	})
+
+	It("should resume from partial offsets", func() {
+		data := make([]byte, 600*1024)
+		_, _ = rand.New(rand.NewSource(1)).Read(data)
+
+		sessionURL, w, err := subject.(resumer).CreateResumable(ctx, "large.bin", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// only the first chunk is persisted, the writer is abandoned
+		Expect(w.Write(data[:400*1024])).To(Equal(400 * 1024))
+
+		// resuming beyond the persisted content fails
+		_, err = subject.(resumer).ResumeUpload(ctx, sessionURL, 300*1024)
+		Expect(err).To(MatchError("bfsgs: cannot resume upload at offset 307200, only 262144 bytes were persisted"))
+
+		// resume from an earlier checkpoint
+		w, err = subject.(resumer).ResumeUpload(ctx, sessionURL, 100*1024)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write(data[100*1024:])).To(Equal(500 * 1024))
+		Expect(w.Close()).To(Succeed())
+
+		Expect(bytes.Equal([]byte(server.media["x/large.bin"]), data)).To(BeTrue())
+
+		// completed sessions can't be resumed
+		_, err = subject.(resumer).ResumeUpload(ctx, sessionURL, 0)
+		Expect(errors.Is(err, bfsgs.ErrSessionExpired)).To(BeTrue())
+	})
+
+	It("should reject unknown sessions", func() {
+		_, err := subject.(resumer).ResumeUpload(ctx, server.URL+"/upload/storage/v1/b/"+bucketName+"/o?uploadType=resumable&upload_id=missing", 0)
+		Expect(errors.Is(err, bfsgs.ErrSessionExpired)).To(BeTrue())
+	})
+})
@@ -0,0 +1,98 @@
+package bfsgs_test
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NameTransform", func() {
+	var server *mockObjectServer
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	// shard prepends a hash-based shard to names
+	shard := func(name string) string {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(name))
+		return fmt.Sprintf("%02x/%s", h.Sum32()%16, name)
+	}
+	unshard := func(key string) string {
+		return key[strings.IndexByte(key, '/')+1:]
+	}
+
+	BeforeEach(func() {
+		server = newMockObjectServer()
+
+		// serve downloads from the mock via plain HTTP
+		os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+		defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+		var err error
+		subject, err = bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Prefix:        "x/",
+			NameTransform: shard,
+			NameInverse:   unshard,
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"a.txt", "b/c.txt", "b/d.txt"} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte("DATA:"+name), &bfs.WriteOptions{
+				Size: int64(len("DATA:" + name)),
+			})).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		_ = subject.Close()
+		server.Close()
+	})
+
+	collect := func(iter bfs.Iterator, err error) []string {
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		return names
+	}
+
+	It("should round-trip names", func() {
+		Expect(server.objects).To(HaveLen(3))
+		Expect(server.objects).To(HaveKey("x/" + shard("a.txt")))
+		Expect(server.objects).To(HaveKey("x/" + shard("b/c.txt")))
+		Expect(server.objects).To(HaveKey("x/" + shard("b/d.txt")))
+
+		r, err := subject.Open(ctx, "b/c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("DATA:b/c.txt")))
+
+		Expect(collect(subject.Glob(ctx, "b/*"))).To(ConsistOf("b/c.txt", "b/d.txt"))
+		Expect(collect(bfs.SortedGlob(ctx, subject, "**"))).To(Equal([]string{"a.txt", "b/c.txt", "b/d.txt"}))
+		Expect(collect(bfs.GlobAfter(ctx, subject, "**", "a.txt"))).To(ConsistOf("b/c.txt", "b/d.txt"))
+	})
+
+	It("should require both funcs", func() {
+		_, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{NameInverse: unshard})
+		Expect(err).To(MatchError("bfsgs: NameTransform and NameInverse must be set together"))
+	})
+})
@@ -0,0 +1,170 @@
+package bfsgs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgs"
+	"google.golang.org/api/option"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resumable uploads", func() {
+	var server *mockUploadServer
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		server = newMockUploadServer()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should retry failed chunks", func() {
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			ChunkSize: 256 * 1024,
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		server.failChunk = 2
+		data := bytes.Repeat([]byte("x"), 600*1024)
+		Expect(bfs.WriteObject(ctx, subject, "large.txt", data, nil)).To(Succeed())
+
+		Expect(server.sessions).To(Equal(1))
+		Expect(server.chunks).To(Equal([]string{
+			"bytes 0-262143/*",
+			"bytes 262144-524287/*", // failed
+			"bytes 262144-524287/*", // retried
+			"bytes 524288-614399/614400",
+		}))
+		Expect(server.data.Len()).To(Equal(len(data)))
+	})
+
+	It("should abort uploads", func() {
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		type aborter interface {
+			bfs.Writer
+			Abort() error
+			CloseWithError(error) error
+		}
+
+		w, err := subject.Create(ctx, "aborted.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.(aborter).Abort()).To(Succeed())
+		Expect(w.Commit()).To(MatchError(context.Canceled))
+
+		w, err = subject.Create(ctx, "aborted.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.(aborter).CloseWithError(errors.New("producer failed"))).To(Succeed())
+
+		Expect(server.sessions).To(BeZero())
+		Expect(server.singles).To(BeZero())
+		Expect(server.data.Len()).To(BeZero())
+	})
+
+	It("should skip chunking with a small size hint", func() {
+		subject, err := bfsgs.New(ctx, bucketName, &bfsgs.Config{
+			ChunkSize: 256 * 1024,
+			Options: []option.ClientOption{
+				option.WithEndpoint(server.URL + "/storage/v1/"),
+				option.WithHTTPClient(http.DefaultClient),
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		// the hint is too small, which is handled gracefully
+		data := bytes.Repeat([]byte("x"), 600*1024)
+		Expect(bfs.WriteObject(ctx, subject, "large.txt", data, &bfs.WriteOptions{Size: 1024})).To(Succeed())
+		Expect(server.sessions).To(Equal(0))
+		Expect(server.chunks).To(BeEmpty())
+		Expect(server.singles).To(Equal(1))
+		Expect(server.data.Len()).To(BeNumerically(">", len(data)))
+	})
+})
+
+// mockUploadServer emulates the resumable upload protocol of the GCS JSON API.
+type mockUploadServer struct {
+	*httptest.Server
+
+	failChunk int // fail the n-th chunk request once
+
+	mu       sync.Mutex
+	sessions int
+	singles  int // single-request uploads
+	chunks   []string
+	data     bytes.Buffer
+}
+
+func newMockUploadServer() *mockUploadServer {
+	s := new(mockUploadServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *mockUploadServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+		s.sessions++
+		w.Header().Set("Location", s.URL+"/upload/session")
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "multipart":
+		s.singles++
+		s.data.Write(body) // includes the multipart envelope
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"bucket":%q,"name":"large.txt","size":"%d"}`, bucketName, s.data.Len())
+
+	case r.URL.Path == "/upload/session":
+		rng := r.Header.Get("Content-Range")
+		s.chunks = append(s.chunks, rng)
+		if len(s.chunks) == s.failChunk {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.data.Write(body)
+
+		if strings.HasSuffix(rng, "/*") {
+			w.Header().Set("Range", "bytes=0-"+strconv.Itoa(s.data.Len()-1))
+			w.Header().Set("X-Http-Status-Code-Override", "308") // as requested by X-GUploader-No-308
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"bucket":%q,"name":"large.txt","size":"%d"}`, bucketName, s.data.Len())
+
+	default:
+		http.NotFound(w, r)
+	}
+}
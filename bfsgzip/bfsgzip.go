@@ -0,0 +1,271 @@
+// Package bfsgzip wraps a bfs.Bucket and transparently compresses objects at rest.
+//
+// Objects are stored gzip compressed with a `.gz` suffix appended to their
+// names. The suffix is hidden from callers, i.e. Glob yields logical names and
+// Open returns uncompressed content:
+//
+//   remote, _ := bfs.Connect(ctx, "s3://bucket/logs")
+//   b := bfsgzip.New(remote)
+//   w, _ := b.Create(ctx, "events.json", nil) // creates s3://bucket/logs/events.json.gz
+//   ...
+//
+// The uncompressed size is recorded in metadata at write time and reported by
+// Head, if the wrapped bucket supports metadata. Please note that iterators
+// report the compressed, physical size of each object.
+package bfsgzip
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+)
+
+// Suffix is appended to all stored object names.
+const Suffix = ".gz"
+
+// metaSize is the metadata key for the uncompressed content size.
+const metaSize = "Bfs-Uncompressed-Size"
+
+type bucket struct {
+	remote bfs.Bucket
+}
+
+// New wraps a bucket and returns a bucket which compresses
+// objects on Create and decompresses them on Open.
+func New(remote bfs.Bucket) bfs.Bucket {
+	return &bucket{remote: remote}
+}
+
+// Glob implements bfs.Bucket.
+func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	// a trailing `**` must remain a separate path segment to match across
+	// directories
+	remotePattern := pattern + Suffix
+	if strings.HasSuffix(pattern, "**") {
+		remotePattern = pattern + "/*" + Suffix
+	}
+
+	iter, err := b.remote.Glob(ctx, remotePattern)
+	if err != nil {
+		return nil, err
+	}
+	return &iterator{Iterator: iter, pattern: pattern}, nil
+}
+
+// Head implements bfs.Bucket.
+func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	info, err := b.remote.Head(ctx, name+Suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	res := *info
+	res.Name = name
+	if res.Metadata != nil {
+		if n, err := strconv.ParseInt(res.Metadata.Get(metaSize), 10, 64); err == nil {
+			res.Size = n
+		}
+
+		res.Metadata = make(bfs.Metadata, len(info.Metadata))
+		for k, v := range info.Metadata {
+			res.Metadata[k] = v
+		}
+		res.Metadata.Del(metaSize)
+	}
+	return &res, nil
+}
+
+// Open implements bfs.Bucket.
+func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	rc, err := b.remote.Open(ctx, name+Suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &reader{Reader: zr, remote: rc}, nil
+}
+
+// Create implements bfs.Bucket.
+func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	f, err := ioutil.TempFile("", "bfs-gzip")
+	if err != nil {
+		return nil, err
+	}
+
+	return &writer{
+		Writer: gzip.NewWriter(f),
+		file:   f,
+		ctx:    ctx,
+		bucket: b,
+		name:   name,
+		opts:   opts,
+	}, nil
+}
+
+// Remove implements bfs.Bucket.
+func (b *bucket) Remove(ctx context.Context, name string) error {
+	return b.remote.Remove(ctx, name+Suffix)
+}
+
+// Describe returns information about the remote bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	info, _ := bfs.Describe(b.remote)
+	return info
+}
+
+// Close implements bfs.Bucket.
+func (b *bucket) Close() error {
+	return b.remote.Close()
+}
+
+// --------------------------------------------------------------------
+
+type reader struct {
+	*gzip.Reader
+	remote bfs.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF && n > 0 {
+		err = nil // return EOF with the next call
+	}
+	return n, err
+}
+
+func (r *reader) Close() error {
+	err := r.Reader.Close()
+	if ezz := r.remote.Close(); ezz != nil {
+		err = ezz
+	}
+	return err
+}
+
+// --------------------------------------------------------------------
+
+type writer struct {
+	*gzip.Writer
+
+	file   *os.File
+	ctx    context.Context
+	bucket *bucket
+	name   string
+	opts   *bfs.WriteOptions
+	size   int64
+
+	closeOnce sync.Once
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *writer) Discard() error {
+	err := context.Canceled
+	w.closeOnce.Do(func() {
+		defer os.Remove(w.file.Name())
+
+		err = w.file.Close()
+	})
+	return err
+}
+
+func (w *writer) Commit() error {
+	err := context.Canceled
+	w.closeOnce.Do(func() {
+		defer os.Remove(w.file.Name())
+		defer w.file.Close()
+
+		if err = w.Writer.Close(); err != nil {
+			return
+		}
+		if _, err = w.file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+
+		opts := new(bfs.WriteOptions)
+		if w.opts != nil {
+			*opts = *w.opts
+		}
+		opts.Metadata = w.opts.GetMetadata()
+		if opts.Metadata == nil {
+			opts.Metadata = make(bfs.Metadata, 1)
+		}
+		opts.Metadata.Set(metaSize, strconv.FormatInt(w.size, 10))
+
+		var remote bfs.Writer
+		if remote, err = w.bucket.remote.Create(w.ctx, w.name+Suffix, opts); err != nil {
+			return
+		}
+		defer remote.Discard()
+
+		if _, err = internal.CopyBuffered(remote, w.file); err != nil {
+			return
+		}
+		err = remote.Commit()
+	})
+	return err
+}
+
+// --------------------------------------------------------------------
+
+type iterator struct {
+	bfs.Iterator
+	pattern string
+	err     error
+}
+
+func (i *iterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	for i.Iterator.Next() {
+		if ok, err := doublestar.Match(i.pattern, i.Name()); err != nil {
+			i.err = err
+			return false
+		} else if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *iterator) Name() string {
+	return strings.TrimSuffix(i.Iterator.Name(), Suffix)
+}
+
+func (i *iterator) Error() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.Iterator.Error()
+}
+
+func (i *iterator) Reset() error {
+	if err := bfs.ResetIterator(i.Iterator); err != nil {
+		return err
+	}
+	i.err = nil
+	return nil
+}
@@ -0,0 +1,97 @@
+package bfsgzip_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsgzip"
+	"github.com/bsm/bfs/bfsnull"
+	"github.com/bsm/bfs/testdata/lint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bucket", func() {
+	var remote *bfs.InMem
+	var subject bfs.Bucket
+	var opts lint.Options
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		remote = bfs.NewInMem()
+		subject = bfsgzip.New(remote)
+		opts = lint.Options{
+			Subject:  subject,
+			Metadata: true,
+		}
+	})
+
+	Context("defaults", lint.Lint(&opts))
+
+	It("should describe the remote bucket", func() {
+		_, ok := bfs.Describe(subject)
+		Expect(ok).To(BeFalse())
+
+		info, ok := bfs.Describe(bfsgzip.New(bfsnull.New()))
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "null"}))
+	})
+
+	roundTrip := func(data []byte) {
+		Expect(bfs.WriteObject(ctx, subject, "path/to/file.json", data, &bfs.WriteOptions{
+			Metadata: bfs.Metadata{"Foo": "bar"},
+		})).To(Succeed())
+		Expect(remote.ObjectSizes()).To(HaveKey("path/to/file.json.gz"))
+
+		info, err := subject.Head(ctx, "path/to/file.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("path/to/file.json"))
+		Expect(info.Size).To(Equal(int64(len(data))))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Foo": "bar"}))
+
+		r, err := subject.Open(ctx, "path/to/file.json")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		Expect(ioutil.ReadAll(r)).To(Equal(data))
+		Expect(r.Close()).To(Succeed())
+	}
+
+	It("should round-trip compressible data", func() {
+		data := bytes.Repeat([]byte(`{"event":"click","count":1}`+"\n"), 10000)
+		roundTrip(data)
+		Expect(remote.ObjectSizes()["path/to/file.json.gz"]).To(BeNumerically("<", len(data)/10))
+	})
+
+	It("should round-trip incompressible data", func() {
+		data := make([]byte, 64*1024)
+		_, err := rand.Read(data)
+		Expect(err).NotTo(HaveOccurred())
+		roundTrip(data)
+	})
+
+	It("should hide suffixes when globbing", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a/b.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, remote, "a/c.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		iter, err := subject.Glob(ctx, "a/*")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Name()).To(Equal("a/b.txt"))
+		Expect(iter.Next()).To(BeFalse())
+	})
+})
+
+// ------------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "bfs/bfsgzip")
+}
@@ -0,0 +1,564 @@
+// Package bfsipfs abstracts the InterPlanetary File System (IPFS).
+//
+// Objects are stored in the Mutable File System (MFS) of an IPFS node, below
+// a root directory, using the node's HTTP RPC API. Please note that content
+// in IPFS is immutable and addressed by its CID. Writing an object adds new
+// content and links it to the object's name, the CID of the content is
+// exposed as MetaCID metadata in Head and via the writer's CID method.
+// Removing an object merely unlinks the name, the content itself is retained
+// until it is garbage collected by the node and may still be fetched by its
+// CID until then (or forever, if it was pinned or replicated by other nodes).
+//
+// When imported, it registers a global `ipfs://` scheme resolver and can be used like:
+//
+//   import (
+//     "github.com/bsm/bfs"
+//
+//     _ "github.com/bsm/bfs/bfsipfs"
+//   )
+//
+//   func main() {
+//     ctx := context.Background()
+//     b, _ := bfs.Connect(ctx, "ipfs://localhost:5001/path/to/root?tmpdir=%2Fcustom%2Ftmp")
+//     f, _ := b.Open(ctx, "file/within/root.txt")
+//     ...
+//   }
+//
+// bfs.Connect supports the following query parameters:
+//
+//   tmpdir - custom temp dir
+//   pin    - pin added content (true/false)
+//
+package bfsipfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+)
+
+// MetaCID is the metadata key which holds an object's CID.
+const MetaCID = "Ipfs-Cid"
+
+func init() {
+	bfs.Register("ipfs", func(ctx context.Context, u *url.URL) (bfs.Bucket, error) {
+		query := u.Query()
+
+		pin := false
+		if s := query.Get("pin"); s != "" {
+			var err error
+			if pin, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("bfsipfs: invalid pin value %q", s)
+			}
+		}
+
+		cfg := &Config{
+			Root:    u.Path,
+			TempDir: query.Get("tmpdir"),
+			Pin:     pin,
+		}
+		if opts := bfs.ConnectOptionsFromContext(ctx); opts != nil {
+			cfg.HTTPClient = opts.HTTPClient
+		}
+		return New("http://"+u.Host, cfg)
+	})
+}
+
+// Config is passed to New to configure the IPFS connection.
+type Config struct {
+	// Root is the MFS root directory, defaults to "/".
+	Root string
+	// Pin added content.
+	Pin bool
+	// A custom temp dir.
+	TempDir string
+	// A custom HTTP client, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+func (c *Config) norm() error {
+	c.Root = path.Clean("/" + c.Root)
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	return nil
+}
+
+type bucket struct {
+	api    string
+	config *Config
+}
+
+// New initiates an bfs.Bucket backed by IPFS. The api argument is the base
+// URL of the node's HTTP RPC API, e.g. "http://localhost:5001".
+func New(api string, cfg *Config) (bfs.Bucket, error) {
+	config := new(Config)
+	if cfg != nil {
+		*config = *cfg
+	}
+	if err := config.norm(); err != nil {
+		return nil, err
+	}
+
+	return &bucket{
+		api:    strings.TrimSuffix(api, "/"),
+		config: config,
+	}, nil
+}
+
+func (b *bucket) fullPath(name string) string {
+	return internal.WithinNamespace(b.config.Root, name)
+}
+
+func (b *bucket) stripRoot(fullPath string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fullPath, b.config.Root), "/")
+}
+
+// Glob implements bfs.Bucket.
+func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	return &iterator{
+		ctx:     ctx,
+		bucket:  b,
+		pattern: pattern,
+		pos:     -1,
+	}, nil
+}
+
+// Head implements bfs.Bucket.
+func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	stat, err := b.stat(ctx, b.fullPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &bfs.MetaInfo{
+		Name:     name,
+		Size:     stat.Size,
+		ModTime:  stat.modTime(),
+		Metadata: bfs.Metadata{MetaCID: stat.Hash},
+	}, nil
+}
+
+// Open implements bfs.Bucket. It resolves the object's CID and
+// fetches the content by its CID.
+func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	stat, err := b.stat(ctx, b.fullPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.call(ctx, "cat", url.Values{"arg": {"/ipfs/" + stat.Hash}}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return &reader{ReadCloser: resp.Body, stat: stat}, nil
+}
+
+// Create implements bfs.Bucket.
+func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	if opts.HasRetention() || opts.GetExpiresIn() > 0 {
+		return nil, bfs.ErrNotSupported
+	}
+
+	f, err := ioutil.TempFile(b.config.TempDir, "bfsipfs")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		File:   f,
+		ctx:    ctx,
+		bucket: b,
+		name:   name,
+	}, nil
+}
+
+// Remove implements bfs.Bucket. It unlinks the object from MFS, but does
+// not delete the content, which may still be retrieved by its CID.
+func (b *bucket) Remove(ctx context.Context, name string) error {
+	err := b.unlink(ctx, b.fullPath(name))
+	if err != nil && err != bfs.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Mkdir creates an MFS directory, including missing parents.
+func (b *bucket) Mkdir(ctx context.Context, prefix string) error {
+	return b.callJSON(ctx, "files/mkdir", url.Values{"arg": {b.fullPath(prefix)}, "parents": {"true"}}, nil)
+}
+
+// Copy supports copying of objects within the bucket. Since content is
+// addressed by CID, copies are cheap and do not duplicate any data.
+func (b *bucket) Copy(ctx context.Context, src, dst string) error {
+	stat, err := b.stat(ctx, b.fullPath(src))
+	if err != nil {
+		return err
+	}
+	return b.link(ctx, stat.Hash, b.fullPath(dst))
+}
+
+// Describe returns information about the bucket, the Bucket field contains
+// the API host and Prefix the MFS root directory.
+func (b *bucket) Describe() bfs.BucketInfo {
+	info := bfs.BucketInfo{Scheme: "ipfs", Bucket: b.api}
+	if u, err := url.Parse(b.api); err == nil {
+		info.Bucket = u.Host
+	}
+	if root := strings.TrimPrefix(b.config.Root, "/"); root != "" {
+		info.Prefix = root + "/"
+	}
+	return info
+}
+
+// Close implements bfs.Bucket.
+func (*bucket) Close() error { return nil }
+
+// --------------------------------------------------------------------
+
+type apiError struct {
+	Message string
+	Code    int
+}
+
+func (e *apiError) Error() string { return "bfsipfs: " + e.Message }
+
+type fileStat struct {
+	Hash  string
+	Size  int64
+	Type  string
+	Mtime int64
+}
+
+func (s *fileStat) modTime() time.Time {
+	if s.Mtime > 0 {
+		return time.Unix(s.Mtime, 0)
+	}
+	return time.Time{}
+}
+
+type lsEntry struct {
+	Name string
+	Type int // 0 = file, 1 = directory
+	Size int64
+	Hash string
+}
+
+// call invokes an RPC API command.
+func (b *bucket) call(ctx context.Context, cmd string, args url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, b.api+"/api/v0/"+cmd+"?"+args.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := b.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := new(apiError)
+	if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Message == "" {
+		return nil, fmt.Errorf("bfsipfs: %s failed with status %d", cmd, resp.StatusCode)
+	}
+	return nil, normError(apiErr)
+}
+
+// callJSON invokes an RPC API command and decodes the response.
+func (b *bucket) callJSON(ctx context.Context, cmd string, args url.Values, v interface{}) error {
+	resp, err := b.call(ctx, cmd, args, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (b *bucket) stat(ctx context.Context, fullPath string) (*fileStat, error) {
+	stat := new(fileStat)
+	if err := b.callJSON(ctx, "files/stat", url.Values{"arg": {fullPath}}, stat); err != nil {
+		return nil, err
+	}
+	if stat.Type != "file" {
+		return nil, bfs.ErrNotFound
+	}
+	return stat, nil
+}
+
+func (b *bucket) ls(ctx context.Context, fullPath string) ([]lsEntry, error) {
+	var res struct{ Entries []lsEntry }
+	if err := b.callJSON(ctx, "files/ls", url.Values{"arg": {fullPath}, "long": {"true"}}, &res); err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+// add adds content and returns its CID.
+func (b *bucket) add(ctx context.Context, r io.Reader) (string, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", "file")
+		if err == nil {
+			_, err = internal.CopyBuffered(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	resp, err := b.call(ctx, "add", url.Values{
+		"pin":         {strconv.FormatBool(b.config.Pin)},
+		"cid-version": {"1"},
+		"mtime":       {strconv.FormatInt(internal.Now().Unix(), 10)},
+	}, pr, mw.FormDataContentType())
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var res struct{ Hash string }
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", err
+	}
+	return res.Hash, nil
+}
+
+// link links a CID to fullPath, replacing existing objects.
+func (b *bucket) link(ctx context.Context, cid, fullPath string) error {
+	if dir := path.Dir(fullPath); dir != "/" {
+		if err := b.callJSON(ctx, "files/mkdir", url.Values{"arg": {dir}, "parents": {"true"}}, nil); err != nil {
+			return err
+		}
+	}
+	if err := b.unlink(ctx, fullPath); err != nil && err != bfs.ErrNotFound {
+		return err
+	}
+	return b.callJSON(ctx, "files/cp", url.Values{"arg": {"/ipfs/" + cid, fullPath}}, nil)
+}
+
+func (b *bucket) unlink(ctx context.Context, fullPath string) error {
+	if _, err := b.stat(ctx, fullPath); err != nil {
+		return err
+	}
+	return b.callJSON(ctx, "files/rm", url.Values{"arg": {fullPath}}, nil)
+}
+
+func normError(err error) error {
+	if e, ok := err.(*apiError); ok && strings.Contains(e.Message, "does not exist") {
+		return bfs.ErrNotFound
+	}
+	return err
+}
+
+// --------------------------------------------------------------------
+
+type reader struct {
+	io.ReadCloser
+	stat *fileStat
+}
+
+// Read implements io.Reader, deferring io.EOF to the next call.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *reader) Size() int64         { return r.stat.Size }
+func (r *reader) ModTime() time.Time  { return r.stat.modTime() }
+func (r *reader) ContentType() string { return "" }
+
+// --------------------------------------------------------------------
+
+// Writer is returned by Create.
+type Writer struct {
+	*os.File
+
+	ctx    context.Context
+	bucket *bucket
+	name   string
+	cid    string
+
+	closeOnce sync.Once
+}
+
+// CID returns the CID of the written content after a successful Commit.
+func (w *Writer) CID() string {
+	return w.cid
+}
+
+// Discard implements bfs.Writer.
+func (w *Writer) Discard() error {
+	err := os.ErrClosed
+	w.closeOnce.Do(func() {
+		// delete tempfile in the end
+		fname := w.Name()
+		defer os.Remove(fname)
+
+		// close tempfile
+		err = w.File.Close()
+	})
+	return err
+}
+
+// Commit implements bfs.Writer.
+func (w *Writer) Commit() error {
+	err := os.ErrClosed
+	w.closeOnce.Do(func() {
+		// delete tempfile in the end
+		fname := w.Name()
+		defer os.Remove(fname)
+
+		// close tempfile, check context
+		if err = w.File.Close(); err != nil {
+			return
+		} else if err = w.ctx.Err(); err != nil {
+			return
+		}
+
+		// reopen for reading
+		var file *os.File
+		if file, err = os.Open(fname); err != nil {
+			return
+		}
+		defer file.Close()
+
+		var cid string
+		if cid, err = w.bucket.add(w.ctx, file); err != nil {
+			return
+		}
+		if err = w.bucket.link(w.ctx, cid, w.bucket.fullPath(w.name)); err != nil {
+			return
+		}
+		w.cid = cid
+	})
+	return err
+}
+
+// --------------------------------------------------------------------
+
+type iterator struct {
+	ctx     context.Context
+	bucket  *bucket
+	pattern string
+
+	listed bool
+	files  []lsEntry // with names relative to root
+	pos    int
+	err    error
+}
+
+// walk lists all files below dir recursively.
+func (i *iterator) walk(dir string) error {
+	if err := i.ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := i.bucket.ls(i.ctx, dir)
+	if err == bfs.ErrNotFound && dir == i.bucket.config.Root {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fullPath := path.Join(dir, entry.Name)
+		if entry.Type == 1 {
+			if err := i.walk(fullPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := i.bucket.stripRoot(fullPath)
+		if ok, err := doublestar.Match(i.pattern, name); err != nil {
+			return err
+		} else if ok {
+			entry.Name = name
+			i.files = append(i.files, entry)
+		}
+	}
+	return nil
+}
+
+func (i *iterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+	if !i.listed {
+		i.listed = true
+		if i.err = i.walk(i.bucket.config.Root); i.err != nil {
+			return false
+		}
+	}
+
+	i.pos++
+	return i.pos < len(i.files)
+}
+
+func (i *iterator) Name() string {
+	if i.pos > -1 && i.pos < len(i.files) {
+		return i.files[i.pos].Name
+	}
+	return ""
+}
+
+func (i *iterator) Size() int64 {
+	if i.pos > -1 && i.pos < len(i.files) {
+		return i.files[i.pos].Size
+	}
+	return 0
+}
+
+// ModTime is not available for IPFS listings and always returns
+// a zero time. Please use Head instead.
+func (*iterator) ModTime() time.Time { return time.Time{} }
+
+func (i *iterator) Error() error { return i.err }
+
+// Reset restarts the listing from scratch.
+func (i *iterator) Reset() error {
+	i.listed, i.files, i.pos, i.err = false, nil, -1, nil
+	return nil
+}
+
+func (i *iterator) Close() error {
+	i.pos = len(i.files)
+	return nil
+}
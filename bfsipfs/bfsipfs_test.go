@@ -0,0 +1,117 @@
+package bfsipfs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsipfs"
+	"github.com/bsm/bfs/testdata/lint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bucket", func() {
+	var opts lint.Options
+	var mock *mockIPFS
+
+	BeforeEach(func() {
+		mock = newMockIPFS()
+		root := "/x/" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		subject, err := bfsipfs.New(mock.URL, &bfsipfs.Config{Root: root})
+		Expect(err).NotTo(HaveOccurred())
+
+		opts = lint.Options{
+			Subject: subject,
+		}
+	})
+
+	AfterEach(func() {
+		mock.Close()
+	})
+
+	Context("defaults", lint.Lint(&opts))
+
+	It("should describe buckets", func() {
+		subject, err := bfsipfs.New(mock.URL, &bfsipfs.Config{Root: "/a/b"})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "ipfs", Bucket: mock.Listener.Addr().String(), Prefix: "a/b/"}))
+	})
+
+	It("should expose CIDs", func() {
+		ctx := context.Background()
+		subject := opts.Subject
+
+		w, err := subject.Create(ctx, "a/b.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("TESTDATA"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Commit()).To(Succeed())
+
+		cid := w.(*bfsipfs.Writer).CID()
+		Expect(cid).NotTo(BeEmpty())
+
+		info, err := subject.Head(ctx, "a/b.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(HaveKeyWithValue(bfsipfs.MetaCID, cid))
+
+		// same content, same CID
+		Expect(bfs.CopyObject(ctx, subject, "a/b.txt", "c.txt", nil)).To(Succeed())
+		info, err = subject.Head(ctx, "c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(HaveKeyWithValue(bfsipfs.MetaCID, cid))
+
+		// content remains addressable after removal
+		Expect(subject.Remove(ctx, "a/b.txt")).To(Succeed())
+		_, err = subject.Head(ctx, "a/b.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+		Expect(mock.blocks).To(HaveKey(cid))
+	})
+
+	It("should not treat directories as objects", func() {
+		ctx := context.Background()
+		subject := opts.Subject
+		Expect(bfs.WriteObject(ctx, subject, "a/b.txt", []byte("x"), nil)).To(Succeed())
+
+		_, err := subject.Head(ctx, "a")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+		_, err = subject.Open(ctx, "a")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+})
+
+var _ = Describe("Connect", func() {
+	It("should resolve URLs", func() {
+		mock := newMockIPFS()
+		defer mock.Close()
+
+		ctx := context.Background()
+		b, err := bfs.Connect(ctx, "ipfs://"+mock.Listener.Addr().String()+"/root?pin=true")
+		Expect(err).NotTo(HaveOccurred())
+		defer b.Close()
+
+		Expect(bfs.WriteObject(ctx, b, "a.txt", []byte("data"), nil)).To(Succeed())
+		Expect(mock.files).To(HaveKey("/root/a.txt"))
+
+		r, err := b.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("data")))
+
+		_, err = bfs.Connect(ctx, "ipfs://"+mock.Listener.Addr().String()+"/root?pin=maybe")
+		Expect(err).To(MatchError(`bfsipfs: invalid pin value "maybe"`))
+	})
+})
+
+// ------------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "bfs/bfsipfs")
+}
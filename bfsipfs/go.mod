@@ -0,0 +1,12 @@
+module github.com/bsm/bfs/bfsipfs
+
+go 1.14
+
+require (
+	github.com/bmatcuk/doublestar v1.2.2
+	github.com/bsm/bfs v0.9.0
+	github.com/onsi/ginkgo v1.8.0
+	github.com/onsi/gomega v1.5.0
+)
+
+replace github.com/bsm/bfs => ../
@@ -0,0 +1,164 @@
+package bfsipfs_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// mockIPFS is a minimal in-memory emulation of the IPFS RPC API.
+type mockIPFS struct {
+	*httptest.Server
+
+	blocks map[string]*mockBlock // by CID
+	files  map[string]string     // MFS path -> CID
+	dirs   map[string]bool       // MFS directories
+	mu     sync.Mutex
+}
+
+type mockBlock struct {
+	data  []byte
+	mtime int64
+}
+
+func newMockIPFS() *mockIPFS {
+	m := &mockIPFS{
+		blocks: make(map[string]*mockBlock),
+		files:  make(map[string]string),
+		dirs:   map[string]bool{"/": true},
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	return m
+}
+
+func (m *mockIPFS) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	args := r.URL.Query()["arg"]
+	switch strings.TrimPrefix(r.URL.Path, "/api/v0/") {
+	case "add":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			m.fail(w, err.Error())
+			return
+		}
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			m.fail(w, err.Error())
+			return
+		}
+		sum := sha256.Sum256(data)
+		cid := "bafk" + hex.EncodeToString(sum[:16])
+		mtime, _ := strconv.ParseInt(r.URL.Query().Get("mtime"), 10, 64)
+		m.blocks[cid] = &mockBlock{data: data, mtime: mtime}
+		m.json(w, map[string]interface{}{"Name": "file", "Hash": cid, "Size": strconv.Itoa(len(data))})
+
+	case "cat":
+		block, ok := m.blocks[strings.TrimPrefix(args[0], "/ipfs/")]
+		if !ok {
+			m.fail(w, "block was not found locally (offline)")
+			return
+		}
+		_, _ = w.Write(block.data)
+
+	case "files/stat":
+		if cid, ok := m.files[args[0]]; ok {
+			block := m.blocks[cid]
+			m.json(w, map[string]interface{}{"Hash": cid, "Size": len(block.data), "Type": "file", "Mtime": block.mtime})
+		} else if m.dirs[args[0]] {
+			m.json(w, map[string]interface{}{"Hash": "bafydir", "Size": 0, "Type": "directory"})
+		} else {
+			m.fail(w, "file does not exist")
+		}
+
+	case "files/ls":
+		if !m.dirs[args[0]] {
+			m.fail(w, "file does not exist")
+			return
+		}
+		type entry struct {
+			Name string
+			Type int
+			Size int
+			Hash string
+		}
+		var entries []entry
+		for dir := range m.dirs {
+			if dir != "/" && path.Dir(dir) == args[0] {
+				entries = append(entries, entry{Name: path.Base(dir), Type: 1, Hash: "bafydir"})
+			}
+		}
+		for name, cid := range m.files {
+			if path.Dir(name) == args[0] {
+				entries = append(entries, entry{Name: path.Base(name), Size: len(m.blocks[cid].data), Hash: cid})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		m.json(w, map[string]interface{}{"Entries": entries})
+
+	case "files/mkdir":
+		for dir := args[0]; dir != "/"; dir = path.Dir(dir) {
+			if _, ok := m.files[dir]; ok {
+				m.fail(w, "file already exists")
+				return
+			}
+			m.dirs[dir] = true
+		}
+		m.json(w, nil)
+
+	case "files/cp":
+		cid := strings.TrimPrefix(args[0], "/ipfs/")
+		if _, ok := m.blocks[cid]; !ok {
+			m.fail(w, "block was not found locally (offline)")
+			return
+		} else if _, ok := m.files[args[1]]; ok {
+			m.fail(w, "directory already has entry by that name")
+			return
+		} else if !m.dirs[path.Dir(args[1])] {
+			m.fail(w, "file does not exist")
+			return
+		}
+		m.files[args[1]] = cid
+		m.json(w, nil)
+
+	case "files/rm":
+		if _, ok := m.files[args[0]]; !ok {
+			m.fail(w, "file does not exist")
+			return
+		}
+		delete(m.files, args[0])
+		m.json(w, nil)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *mockIPFS) json(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if v != nil {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func (m *mockIPFS) fail(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"Message": msg, "Code": 0, "Type": "error"})
+}
@@ -0,0 +1,273 @@
+// Package bfslru wraps a bfs.Bucket and caches object contents in memory.
+//
+// Objects are cached on Open and evicted in least-recently-used order once
+// the total size of all cached objects exceeds a configured limit. It is
+// best suited for small, frequently read objects such as configs or assets:
+//
+//   remote, _ := bfs.Connect(ctx, "s3://bucket/assets")
+//   b := bfslru.New(remote, 64*1024*1024) // cache up to 64MiB
+//   r, _ := b.Open(ctx, "logo.svg")       // fetched from S3
+//   r, _ = b.Open(ctx, "logo.svg")        // served from memory
+//   ...
+//
+// Cached entries are invalidated when objects are created or removed
+// through the wrapper. Please note that changes made directly to the remote
+// bucket (or by other processes) are not detected. Concurrent Opens of the
+// same uncached object are coalesced into a single fetch. Objects larger
+// than the limit are never cached and streamed from the remote bucket.
+package bfslru
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bsm/bfs"
+)
+
+// errTooLarge is returned by fetches of objects which exceed the limit.
+var errTooLarge = errors.New("bfslru: object too large")
+
+type bucket struct {
+	remote   bfs.Bucket
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List               // of *entry, most recently used first
+	entries map[string]*list.Element // by name
+	size    int64
+	calls   map[string]*call // in-flight fetches
+}
+
+type entry struct {
+	name        string
+	data        []byte
+	modTime     time.Time
+	contentType string
+}
+
+type call struct {
+	done  chan struct{}
+	entry *entry
+	err   error
+	stale bool // invalidated while in flight
+}
+
+// New wraps a remote bucket and caches up to maxBytes of object contents.
+func New(remote bfs.Bucket, maxBytes int64) bfs.Bucket {
+	return &bucket{
+		remote:   remote,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		calls:    make(map[string]*call),
+	}
+}
+
+// Glob implements bfs.Bucket.
+func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	return b.remote.Glob(ctx, pattern)
+}
+
+// Head implements bfs.Bucket.
+func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	return b.remote.Head(ctx, name)
+}
+
+// Open implements bfs.Bucket.
+func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	b.mu.Lock()
+	if el, ok := b.entries[name]; ok {
+		b.lru.MoveToFront(el)
+		b.mu.Unlock()
+		return newReader(el.Value.(*entry)), nil
+	}
+
+	c, ok := b.calls[name]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		b.calls[name] = c
+		b.mu.Unlock()
+		return b.fetch(ctx, name, c)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	switch {
+	case c.err == nil:
+		return newReader(c.entry), nil
+	case c.err == errTooLarge, errors.Is(c.err, context.Canceled), errors.Is(c.err, context.DeadlineExceeded):
+		return b.remote.Open(ctx, name)
+	}
+	return nil, c.err
+}
+
+// fetch opens the remote object and caches its contents. Objects which
+// exceed the limit are passed through.
+func (b *bucket) fetch(ctx context.Context, name string, c *call) (bfs.Reader, error) {
+	rc, e, err := b.read(ctx, name)
+
+	b.mu.Lock()
+	if b.calls[name] == c {
+		delete(b.calls, name)
+	}
+	if e != nil && !c.stale {
+		b.add(e)
+	}
+	c.entry, c.err = e, err
+	if rc != nil {
+		c.err = errTooLarge
+	}
+	b.mu.Unlock()
+	close(c.done)
+
+	if rc != nil {
+		return rc, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return newReader(e), nil
+}
+
+// read reads the remote object into an entry. If it exceeds the limit, the
+// remote reader is returned instead.
+func (b *bucket) read(ctx context.Context, name string) (bfs.Reader, *entry, error) {
+	rc, err := b.remote.Open(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e := &entry{name: name}
+	if info, ok := rc.(bfs.ReadCloserInfo); ok {
+		if info.Size() > b.maxBytes {
+			return rc, nil, nil
+		}
+		e.modTime = info.ModTime()
+		e.contentType = info.ContentType()
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, io.LimitReader(rc, b.maxBytes+1)); err != nil {
+		_ = rc.Close()
+		return nil, nil, err
+	}
+	if int64(buf.Len()) > b.maxBytes {
+		return &passthroughReader{Reader: io.MultiReader(buf, rc), Closer: rc}, nil, nil
+	}
+	if err := rc.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	e.data = buf.Bytes()
+	return nil, e, nil
+}
+
+// add adds an entry and evicts the least recently used entries
+// until the total size is within the limit. Must be called with lock held.
+func (b *bucket) add(e *entry) {
+	b.remove(e.name)
+
+	b.entries[e.name] = b.lru.PushFront(e)
+	b.size += int64(len(e.data))
+
+	for b.size > b.maxBytes {
+		b.remove(b.lru.Back().Value.(*entry).name)
+	}
+}
+
+// remove removes an entry. Must be called with lock held.
+func (b *bucket) remove(name string) {
+	if el, ok := b.entries[name]; ok {
+		b.lru.Remove(el)
+		delete(b.entries, name)
+		b.size -= int64(len(el.Value.(*entry).data))
+	}
+}
+
+// invalidate removes a cached entry and marks in-flight fetches as stale.
+func (b *bucket) invalidate(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(name)
+	if c, ok := b.calls[name]; ok {
+		c.stale = true
+		delete(b.calls, name)
+	}
+}
+
+// Create implements bfs.Bucket.
+func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	w, err := b.remote.Create(ctx, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	b.invalidate(name)
+	return &writer{Writer: w, bucket: b, name: name}, nil
+}
+
+// Remove implements bfs.Bucket.
+func (b *bucket) Remove(ctx context.Context, name string) error {
+	defer b.invalidate(name)
+	return b.remote.Remove(ctx, name)
+}
+
+// Describe returns information about the remote bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	info, _ := bfs.Describe(b.remote)
+	return info
+}
+
+// Close implements bfs.Bucket.
+func (b *bucket) Close() error {
+	b.mu.Lock()
+	b.lru.Init()
+	b.entries = make(map[string]*list.Element)
+	b.size = 0
+	b.mu.Unlock()
+
+	return b.remote.Close()
+}
+
+// --------------------------------------------------------------------
+
+type reader struct {
+	*bytes.Reader
+	entry *entry
+}
+
+func newReader(e *entry) *reader {
+	return &reader{Reader: bytes.NewReader(e.data), entry: e}
+}
+
+func (*reader) Close() error          { return nil }
+func (r *reader) Size() int64         { return int64(len(r.entry.data)) }
+func (r *reader) ModTime() time.Time  { return r.entry.modTime }
+func (r *reader) ContentType() string { return r.entry.contentType }
+
+type passthroughReader struct {
+	io.Reader
+	io.Closer
+}
+
+// --------------------------------------------------------------------
+
+type writer struct {
+	bfs.Writer
+	bucket *bucket
+	name   string
+}
+
+func (w *writer) Commit() error {
+	defer w.bucket.invalidate(w.name)
+	return w.Writer.Commit()
+}
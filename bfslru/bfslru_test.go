@@ -0,0 +1,163 @@
+package bfslru_test
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfslru"
+	"github.com/bsm/bfs/bfsnull"
+	"github.com/bsm/bfs/testdata/lint"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bucket", func() {
+	var remote *countingBucket
+	var subject bfs.Bucket
+	var opts lint.Options
+	var ctx = context.Background()
+
+	read := func(name string) string {
+		r, err := subject.Open(ctx, name)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		data, err := ioutil.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		remote = &countingBucket{InMem: bfs.NewInMem()}
+		subject = bfslru.New(remote, 20)
+		opts = lint.Options{
+			Subject:     subject,
+			Metadata:    true,
+			ContentType: true,
+		}
+	})
+
+	Context("defaults", lint.Lint(&opts))
+
+	It("should describe the remote bucket", func() {
+		_, ok := bfs.Describe(subject)
+		Expect(ok).To(BeFalse())
+
+		info, ok := bfs.Describe(bfslru.New(bfsnull.New(), 20))
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "null"}))
+	})
+
+	It("should serve cached objects", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("aaaaaaaa"), &bfs.WriteOptions{ContentType: "text/plain"})).To(Succeed())
+
+		Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+		Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+		Expect(remote.Opens()).To(Equal(int32(1)))
+
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		info := r.(bfs.ReadCloserInfo)
+		Expect(info.Size()).To(Equal(int64(8)))
+		Expect(info.ContentType()).To(Equal("text/plain"))
+		Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("should evict least recently used objects", func() {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte(strings.Repeat(name[:1], 8)), nil)).To(Succeed())
+		}
+
+		Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+		Expect(read("b.txt")).To(Equal("bbbbbbbb"))
+		Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+		Expect(remote.Opens()).To(Equal(int32(2)))
+
+		// exceeds 20 bytes, evicts b.txt
+		Expect(read("c.txt")).To(Equal("cccccccc"))
+		Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+		Expect(remote.Opens()).To(Equal(int32(3)))
+		Expect(read("b.txt")).To(Equal("bbbbbbbb"))
+		Expect(remote.Opens()).To(Equal(int32(4)))
+	})
+
+	It("should not cache objects exceeding the limit", func() {
+		Expect(bfs.WriteObject(ctx, subject, "large.txt", []byte(strings.Repeat("x", 21)), nil)).To(Succeed())
+
+		Expect(read("large.txt")).To(Equal(strings.Repeat("x", 21)))
+		Expect(read("large.txt")).To(Equal(strings.Repeat("x", 21)))
+		Expect(remote.Opens()).To(Equal(int32(2)))
+	})
+
+	It("should invalidate on write and remove", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("v1"), nil)).To(Succeed())
+		Expect(read("a.txt")).To(Equal("v1"))
+
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("v2"), nil)).To(Succeed())
+		Expect(read("a.txt")).To(Equal("v2"))
+		Expect(remote.Opens()).To(Equal(int32(2)))
+
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+		_, err := subject.Open(ctx, "a.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should coalesce concurrent fetches", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("aaaaaaaa"), nil)).To(Succeed())
+
+		remote.block = make(chan struct{})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				Expect(read("a.txt")).To(Equal("aaaaaaaa"))
+			}()
+		}
+
+		Eventually(remote.Opens).Should(Equal(int32(1)))
+		time.Sleep(10 * time.Millisecond)
+		close(remote.block)
+		wg.Wait()
+
+		Expect(remote.Opens()).To(Equal(int32(1)))
+	})
+})
+
+// countingBucket counts and optionally blocks remote opens.
+type countingBucket struct {
+	*bfs.InMem
+	opens int32
+	block chan struct{}
+}
+
+func (b *countingBucket) Opens() int32 {
+	return atomic.LoadInt32(&b.opens)
+}
+
+func (b *countingBucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	atomic.AddInt32(&b.opens, 1)
+	if b.block != nil {
+		<-b.block
+	}
+	return b.InMem.Open(ctx, name)
+}
+
+// ------------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "bfs/bfslru")
+}
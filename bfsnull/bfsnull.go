@@ -0,0 +1,153 @@
+// Package bfsnull implements a bucket which discards all writes.
+//
+// It is useful for benchmarks, to measure pipeline throughput independent
+// of real storage, and for dry runs which exercise the write path without
+// producing any output. Writes are counted, but never stored, so objects
+// cannot be read back, i.e. Open and Head always return bfs.ErrNotFound and
+// Glob never yields any results.
+//
+// When imported, it registers a global `null://` scheme resolver and can be used like:
+//
+//   import (
+//     "github.com/bsm/bfs"
+//
+//     _ "github.com/bsm/bfs/bfsnull"
+//   )
+//
+//   func main() {
+//     ctx := context.Background()
+//     b, _ := bfs.Connect(ctx, "null://")
+//     w, _ := b.Create(ctx, "file.txt", nil) // discards all content
+//     ...
+//   }
+//
+package bfsnull
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsm/bfs"
+)
+
+func init() {
+	bfs.Register("null", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) {
+		return New(), nil
+	})
+}
+
+var errClosed = errors.New("bfsnull: writer is closed")
+
+// Bucket discards all writes.
+type Bucket struct {
+	bytes, objects int64
+}
+
+// New returns a new bucket.
+func New() *Bucket {
+	return new(Bucket)
+}
+
+// BytesWritten returns the total number of bytes of all committed objects.
+func (b *Bucket) BytesWritten() int64 {
+	return atomic.LoadInt64(&b.bytes)
+}
+
+// ObjectsWritten returns the number of committed objects.
+func (b *Bucket) ObjectsWritten() int64 {
+	return atomic.LoadInt64(&b.objects)
+}
+
+// Glob implements bfs.Bucket.
+func (*Bucket) Glob(_ context.Context, pattern string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	return iterator{}, nil
+}
+
+// Head implements bfs.Bucket.
+func (*Bucket) Head(_ context.Context, _ string) (*bfs.MetaInfo, error) {
+	return nil, bfs.ErrNotFound
+}
+
+// Open implements bfs.Bucket.
+func (*Bucket) Open(_ context.Context, _ string) (bfs.Reader, error) {
+	return nil, bfs.ErrNotFound
+}
+
+// Create implements bfs.Bucket.
+func (b *Bucket) Create(ctx context.Context, _ string, _ *bfs.WriteOptions) (bfs.Writer, error) {
+	return &Writer{ctx: ctx, bucket: b}, nil
+}
+
+// Remove implements bfs.Bucket.
+func (*Bucket) Remove(_ context.Context, _ string) error { return nil }
+
+// Describe returns information about the bucket.
+func (*Bucket) Describe() bfs.BucketInfo { return bfs.BucketInfo{Scheme: "null"} }
+
+// Close implements bfs.Bucket.
+func (*Bucket) Close() error { return nil }
+
+// --------------------------------------------------------------------
+
+// Writer is returned by Create, it counts and discards all content.
+type Writer struct {
+	ctx    context.Context
+	bucket *Bucket
+	n      int64
+	closed bool
+}
+
+// N returns the number of bytes written.
+func (w *Writer) N() int64 {
+	return w.n
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errClosed
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Discard implements bfs.Writer.
+func (w *Writer) Discard() error {
+	if w.closed {
+		return errClosed
+	}
+	w.closed = true
+	return nil
+}
+
+// Commit implements bfs.Writer.
+func (w *Writer) Commit() error {
+	if w.closed {
+		return errClosed
+	}
+	w.closed = true
+
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	atomic.AddInt64(&w.bucket.bytes, w.n)
+	atomic.AddInt64(&w.bucket.objects, 1)
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type iterator struct{}
+
+func (iterator) Next() bool         { return false }
+func (iterator) Name() string       { return "" }
+func (iterator) Size() int64        { return 0 }
+func (iterator) ModTime() time.Time { return time.Time{} }
+func (iterator) Error() error       { return nil }
+func (iterator) Close() error       { return nil }
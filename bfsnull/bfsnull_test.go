@@ -0,0 +1,103 @@
+package bfsnull_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfsnull"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bucket", func() {
+	var subject *bfsnull.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		subject = bfsnull.New()
+	})
+
+	It("should discard large writes", func() {
+		w, err := subject.Create(ctx, "large.bin", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), 1024*1024)
+		for i := 0; i < 256; i++ {
+			Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		}
+		Expect(w.(*bfsnull.Writer).N()).To(Equal(int64(256 * 1024 * 1024)))
+		Expect(subject.BytesWritten()).To(BeZero())
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(subject.BytesWritten()).To(Equal(int64(256 * 1024 * 1024)))
+		Expect(subject.ObjectsWritten()).To(Equal(int64(1)))
+
+		Expect(w.Commit()).NotTo(Succeed())
+		Expect(w.Discard()).NotTo(Succeed())
+		_, err = w.Write(chunk)
+		Expect(err).To(MatchError("bfsnull: writer is closed"))
+	})
+
+	It("should not count discarded or cancelled writes", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("data"), nil)).To(Succeed())
+
+		w, err := subject.Create(ctx, "b.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write([]byte("data"))).To(Equal(4))
+		Expect(w.Discard()).To(Succeed())
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(bfs.WriteObject(cctx, subject, "c.txt", []byte("data"), nil)).To(MatchError(context.Canceled))
+
+		Expect(subject.BytesWritten()).To(Equal(int64(4)))
+		Expect(subject.ObjectsWritten()).To(Equal(int64(1)))
+	})
+
+	It("should not store objects", func() {
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("data"), nil)).To(Succeed())
+
+		_, err := subject.Head(ctx, "a.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+		_, err = subject.Open(ctx, "a.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+
+		iter, err := subject.Glob(ctx, "**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iter.Next()).To(BeFalse())
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		Expect(iter.Close()).To(Succeed())
+
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+	})
+
+	It("should describe buckets", func() {
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info.String()).To(Equal("null://"))
+	})
+
+	It("should resolve URLs", func() {
+		b, err := bfs.Connect(ctx, "null://")
+		Expect(err).NotTo(HaveOccurred())
+		defer b.Close()
+
+		w, err := b.Create(ctx, "a.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.Copy(w, bytes.NewReader(make([]byte, 1000)))).To(Equal(int64(1000)))
+		Expect(w.Commit()).To(Succeed())
+		Expect(b.(*bfsnull.Bucket).BytesWritten()).To(Equal(int64(1000)))
+	})
+})
+
+// ------------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "bfs/bfsnull")
+}
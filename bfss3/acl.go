@@ -0,0 +1,51 @@
+package bfss3
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bsm/bfs"
+)
+
+// Grants returns the ACL grants of an object. Grantees are reported by
+// canonical user ID, email address or group URI, depending on the grantee
+// type, permissions as e.g. "READ" or "FULL_CONTROL". Buckets with ACLs
+// disabled report a single FULL_CONTROL grant for the bucket owner.
+func (b *bucket) Grants(ctx context.Context, name string) ([]bfs.Grant, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.withPrefix(name)),
+	})
+	if err != nil {
+		return nil, normError(err)
+	}
+
+	grants := make([]bfs.Grant, 0, len(resp.Grants))
+	for _, grant := range resp.Grants {
+		if grant == nil || grant.Grantee == nil {
+			continue
+		}
+
+		grants = append(grants, bfs.Grant{
+			Grantee:    granteeName(grant.Grantee),
+			Permission: aws.StringValue(grant.Permission),
+		})
+	}
+	return grants, nil
+}
+
+func granteeName(g *s3.Grantee) string {
+	switch aws.StringValue(g.Type) {
+	case s3.TypeAmazonCustomerByEmail:
+		return aws.StringValue(g.EmailAddress)
+	case s3.TypeGroup:
+		return aws.StringValue(g.URI)
+	}
+	return aws.StringValue(g.ID)
+}
@@ -21,14 +21,25 @@
 //   aws_secret_access_key  - custom AWS credentials
 //   aws_session_token      - custom AWS credentials
 //   region                 - specify an AWS region
+//   endpoint               - custom S3 endpoint, e.g. for S3-compatible services
+//   cdn_endpoint           - custom CDN endpoint for signed GET URLs, see Config.CDNEndpoint
+//   auto_region            - detect the bucket's region if none is configured (true/false)
+//   accelerate             - use the S3 Transfer Acceleration endpoint (true/false)
 //   max_retries            - specify maximum number of retries
-//   acl                    - custom ACL, defaults to DefaultACL
+//   acl                    - custom ACL, defaults to DefaultACL, use "-" to omit ACLs
 //   sse                    - server-side-encryption algorithm
+//   tmpdir                 - custom temp dir
+//   user_agent             - custom suffix for the User-Agent header
 //
 package bfss3
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -56,6 +67,15 @@ import (
 // DefaultACL is the default ACL setting.
 const DefaultACL = "bucket-owner-full-control"
 
+var errRegionNotSet = errors.New("bfss3: region not set, please configure AWS.Region, AWS_REGION or enable AutoRegion")
+
+// MaxPageSize is the maximum number of keys returned per list request.
+const MaxPageSize = 1000
+
+// MaxMetadataSize is the maximum size of user-defined metadata
+// (keys and values) supported by S3.
+const MaxMetadataSize = 2 * 1024
+
 func init() {
 	bfs.Register("s3", func(ctx context.Context, u *url.URL) (bfs.Bucket, error) {
 		query := u.Query()
@@ -71,23 +91,61 @@ func init() {
 		if s := query.Get("region"); s != "" {
 			awscfg.Region = aws.String(s)
 		}
+		if s := query.Get("endpoint"); s != "" {
+			awscfg.Endpoint = aws.String(s)
+		}
 		if s := query.Get("max_retries"); s != "" {
 			if n, err := strconv.Atoi(s); err == nil {
 				awscfg.MaxRetries = aws.Int(n)
 			}
 		}
+		if opts := bfs.ConnectOptionsFromContext(ctx); opts != nil {
+			awscfg.HTTPClient = opts.HTTPClient
+			if logger := opts.Logger; logger != nil {
+				awscfg.Logger = aws.LoggerFunc(func(args ...interface{}) {
+					logger.Printf("%s", fmt.Sprint(args...))
+				})
+			}
+		}
 
 		prefix := u.Path
 		if prefix == "" {
 			prefix = query.Get("prefix")
 		}
 
-		return New(u.Host, &Config{
-			Prefix:           prefix,
-			ACL:              query.Get("acl"),
-			SSE:              query.Get("sse"),
-			GrantFullControl: query.Get("grant-full-control"),
-			AWS:              awscfg,
+		acl, noACL := query.Get("acl"), false
+		if acl == "-" {
+			acl, noACL = "", true
+		}
+
+		autoRegion := false
+		if s := query.Get("auto_region"); s != "" {
+			var err error
+			if autoRegion, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("bfss3: invalid auto_region value %q", s)
+			}
+		}
+
+		accelerate := false
+		if s := query.Get("accelerate"); s != "" {
+			var err error
+			if accelerate, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("bfss3: invalid accelerate value %q", s)
+			}
+		}
+
+		return newBucket(ctx, u.Host, &Config{
+			Prefix:                prefix,
+			ACL:                   acl,
+			NoACL:                 noACL,
+			SSE:                   query.Get("sse"),
+			GrantFullControl:      query.Get("grant-full-control"),
+			TempDir:               query.Get("tmpdir"),
+			AutoRegion:            autoRegion,
+			UseAccelerateEndpoint: accelerate,
+			UserAgent:             query.Get("user_agent"),
+			CDNEndpoint:           query.Get("cdn_endpoint"),
+			AWS:                   awscfg,
 		})
 	})
 }
@@ -99,26 +157,186 @@ type Config struct {
 	AWS aws.Config
 	// Custom ACL, defaults to DefaultACL.
 	ACL string
+	// NoACL omits the ACL from all requests, unless overridden by
+	// bfs.WriteOptions.ACL. This is required for buckets with ACLs disabled,
+	// i.e. when S3 Object Ownership is set to "Bucket owner enforced".
+	NoACL bool
 	// GrantFullControl setting.
 	GrantFullControl string
 	// The Server-side encryption algorithm used when storing this object in S3.
 	SSE string
+	// SSEKMSEncryptionContext is an optional KMS encryption context, applied
+	// to all uploads and copies. It requires SSE to be set to
+	// s3.ServerSideEncryptionAwsKms.
+	SSEKMSEncryptionContext map[string]string
 	// An optional path prefix
 	Prefix string
 	// An optional custom session.
 	// If nil, a new session will be created using the AWS config.
 	Session *session.Session
+	// AutoRegion detects the region of the bucket, if no region is configured
+	// via AWS.Region or the environment. Otherwise, New fails with an error.
+	AutoRegion bool
+	// UseAccelerateEndpoint routes all requests through the S3 Transfer
+	// Acceleration endpoint of the bucket, which must have acceleration
+	// enabled. It cannot be combined with a custom AWS.Endpoint.
+	UseAccelerateEndpoint bool
+	// UserAgent is appended to the User-Agent header of all requests, e.g.
+	// to identify the application in server access logs.
+	UserAgent string
+	// CDNEndpoint is an optional CDN endpoint which replaces the origin in
+	// signed GET URLs, e.g. "https://bucket.nyc3.cdn.digitaloceanspaces.com"
+	// for DigitalOcean Spaces. Signed PUT URLs always point to the origin. An
+	// https:// scheme is assumed if none is given.
+	CDNEndpoint string
+	// DisableCompression disables transparent GZIP compression of HTTP
+	// responses, defaults to true. With compression enabled, Go's HTTP
+	// transport decompresses gzip encoded objects on the fly and drops their
+	// Content-Length, so readers returned by Open report a zero Size and read
+	// until EOF. It is a pointer, rather than a plain bool, so that an unset
+	// value can default to true, while an explicit false still enables
+	// compression. Only applies when neither Session nor AWS.HTTPClient are
+	// set.
+	DisableCompression *bool
+	// A custom temp dir, defaults to the system temp dir.
+	TempDir string
+	// Writes are buffered in memory until they exceed this number of bytes
+	// and only then spill to a tempfile. Default: 0 (always use a tempfile).
+	// Writes with a bfs.WriteOptions.Size hint of up to PartSize bytes are
+	// buffered in memory up to the hinted size.
+	SpillThreshold int64
+	// Streaming enables streaming writes. Instead of buffering the full content
+	// locally, streaming writers upload the content in parts while it is being
+	// written. See StreamWriter for details.
+	Streaming bool
+	// PartSize of multipart uploads and streaming writes, defaults to
+	// s3manager.DefaultUploadPartSize.
+	PartSize int64
+	// MultipartThreshold is the minimum size of uploads in bytes which are
+	// uploaded in parts, smaller bodies are stored with a single PutObject
+	// request. It must be at least PartSize, as bodies which fit into a single
+	// part are never split, and at most 5GiB, the limit of PutObject.
+	// Defaults to PartSize. Streaming writes are not affected.
+	MultipartThreshold int64
+	// PageSize is the maximum number of keys requested per list request
+	// (MaxKeys), defaults to 0 (use the S3 default of 1000). Smaller pages
+	// reduce the latency to the first result, larger pages reduce the number
+	// of requests for full scans.
+	PageSize int
+	// SanitizeNames strips leading slashes from keys and rejects unsafe names,
+	// see bfs.SanitizeName. S3 itself stores keys like "a/../b" verbatim.
+	SanitizeNames bool
+	// ChecksumMode requests the additional checksums of objects, which were
+	// uploaded with a bfs.WriteOptions.ChecksumAlgorithm, on Head. They are
+	// reported in bfs.MetaInfo.Extra, e.g. as "x-amz-checksum-crc32c". Please
+	// note that checksums of KMS encrypted objects require kms:Decrypt
+	// permissions.
+	ChecksumMode bool
+	// ContentTypeByExt maps file extensions, including the leading dot, to
+	// content types, e.g. {".md": "text/markdown"}. It is consulted by writes
+	// without an explicit bfs.WriteOptions.ContentType. Extensions are
+	// matched case-insensitively.
+	ContentTypeByExt map[string]string
+	// NameTransform optionally maps object names to physical keys, e.g. to
+	// shard keys across hashed prefixes. NameInverse must be set too and
+	// restore the original name, i.e. NameInverse(NameTransform(name)) must
+	// return name for all names. Both funcs are applied to names without
+	// Prefix, listed keys are transformed back before they are matched.
+	//
+	// Transformed keys are no longer listed in the order of their names and
+	// can't be narrowed down by name prefixes: SortedGlob buffers and sorts
+	// the full listing, GlobAfter filters on the client and other prefix
+	// listings scan all keys below Prefix.
+	NameTransform func(name string) string
+	// NameInverse is the inverse of NameTransform.
+	NameInverse func(key string) string
+	// ReadAfterWriteRetries is the number of times Open and Head retry
+	// requests which fail with bfs.ErrNotFound. S3 itself is strongly
+	// consistent, but some S3-compatible stores and cross-region replicas
+	// are not and may briefly report recently written objects as missing.
+	// Default: 0 (no retries).
+	ReadAfterWriteRetries int
+	// ReadAfterWriteDelay is the delay between retries, see
+	// ReadAfterWriteRetries. Default: 100ms.
+	ReadAfterWriteDelay time.Duration
 }
 
 func (c *Config) norm() error {
-	if c.ACL == "" && c.GrantFullControl == "" {
+	if c.NoACL {
+		if c.ACL != "" || c.GrantFullControl != "" {
+			return fmt.Errorf("bfss3: NoACL cannot be combined with ACL or GrantFullControl")
+		}
+	} else if c.ACL == "" && c.GrantFullControl == "" {
 		c.ACL = DefaultACL
 	}
 
+	if c.PartSize == 0 {
+		c.PartSize = s3manager.DefaultUploadPartSize
+	} else if c.PartSize < s3manager.MinUploadPartSize {
+		return fmt.Errorf("bfss3: part size must be at least %d bytes", s3manager.MinUploadPartSize)
+	}
+
+	if c.MultipartThreshold == 0 {
+		c.MultipartThreshold = c.PartSize
+	} else if c.MultipartThreshold < c.PartSize || c.MultipartThreshold > maxPutObjectSize {
+		return fmt.Errorf("bfss3: multipart threshold must be between %d and %d bytes", c.PartSize, maxPutObjectSize)
+	}
+
+	if c.DisableCompression == nil {
+		c.DisableCompression = aws.Bool(true)
+	}
+
+	if len(c.SSEKMSEncryptionContext) != 0 && c.SSE != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("bfss3: SSEKMSEncryptionContext requires SSE to be %q", s3.ServerSideEncryptionAwsKms)
+	}
+
+	if c.CDNEndpoint != "" {
+		if !strings.Contains(c.CDNEndpoint, "://") {
+			c.CDNEndpoint = "https://" + c.CDNEndpoint
+		}
+		if u, err := url.Parse(c.CDNEndpoint); err != nil || u.Host == "" {
+			return fmt.Errorf("bfss3: invalid CDN endpoint %q", c.CDNEndpoint)
+		}
+	}
+
+	if c.PageSize < 0 || c.PageSize > MaxPageSize {
+		return fmt.Errorf("bfss3: page size must be between 0 and %d", MaxPageSize)
+	}
+
+	if (c.NameTransform == nil) != (c.NameInverse == nil) {
+		return fmt.Errorf("bfss3: NameTransform and NameInverse must be set together")
+	}
+
+	if c.ReadAfterWriteRetries < 0 {
+		return fmt.Errorf("bfss3: read-after-write retries must not be negative")
+	}
+	if c.ReadAfterWriteDelay == 0 {
+		c.ReadAfterWriteDelay = 100 * time.Millisecond
+	}
+
+	if c.UseAccelerateEndpoint {
+		endpoint := c.AWS.Endpoint
+		if c.Session != nil {
+			endpoint = c.Session.Config.Endpoint
+		}
+		if aws.StringValue(endpoint) != "" {
+			return fmt.Errorf("bfss3: UseAccelerateEndpoint cannot be combined with a custom endpoint")
+		}
+		if c.Session != nil {
+			c.Session = c.Session.Copy(&aws.Config{S3UseAccelerate: aws.Bool(true)})
+		}
+	}
+
 	if c.Session == nil {
-		sess, err := session.NewSession(&c.AWS, &aws.Config{
-			HTTPClient: newHTTPClientWithoutCompression(),
-		})
+		awscfg := c.AWS
+		if c.UseAccelerateEndpoint {
+			awscfg.S3UseAccelerate = aws.Bool(true)
+		}
+		if awscfg.HTTPClient == nil && aws.BoolValue(c.DisableCompression) {
+			awscfg.HTTPClient = newHTTPClientWithoutCompression()
+		}
+
+		sess, err := session.NewSession(&awscfg)
 		if err != nil {
 			return err
 		}
@@ -135,13 +353,18 @@ func (c *Config) norm() error {
 
 type bucket struct {
 	s3iface.S3API
-	bucket   string
-	config   *Config
-	uploader *s3manager.Uploader
+	bucket     string
+	config     *Config
+	uploader   *s3manager.Uploader
+	sseContext *string // base64-encoded JSON
 }
 
 // New initiates an bfs.Bucket backed by S3.
 func New(name string, cfg *Config) (bfs.Bucket, error) {
+	return newBucket(aws.BackgroundContext(), name, cfg)
+}
+
+func newBucket(ctx context.Context, name string, cfg *Config) (bfs.Bucket, error) {
 	config := new(Config)
 	if cfg != nil {
 		*config = *cfg
@@ -150,99 +373,362 @@ func New(name string, cfg *Config) (bfs.Bucket, error) {
 		return nil, err
 	}
 
+	if aws.StringValue(config.Session.Config.Region) == "" {
+		if !config.AutoRegion {
+			return nil, errRegionNotSet
+		}
+
+		region, err := s3manager.GetBucketRegion(ctx, config.Session, name, "us-east-1")
+		if err != nil {
+			return nil, fmt.Errorf("bfss3: unable to detect region of bucket %q: %w", name, err)
+		}
+		config.Session = config.Session.Copy(&aws.Config{Region: aws.String(region)})
+	}
+
 	client := s3.New(config.Session)
+	if config.UserAgent != "" {
+		client.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(config.UserAgent))
+	}
 
 	return &bucket{
-		S3API:    client,
-		bucket:   name,
-		config:   config,
-		uploader: s3manager.NewUploaderWithClient(client),
+		S3API:  client,
+		bucket: name,
+		config: config,
+		uploader: s3manager.NewUploaderWithClient(client, func(u *s3manager.Uploader) {
+			u.PartSize = config.PartSize
+		}),
+		sseContext: encodeEncryptionContext(config.SSEKMSEncryptionContext),
 	}, nil
 }
 
+// encodeEncryptionContext encodes an encryption context as base64 JSON, as
+// expected by the S3 API.
+func encodeEncryptionContext(ec map[string]string) *string {
+	if len(ec) == 0 {
+		return nil
+	}
+
+	data, _ := json.Marshal(ec)
+	return aws.String(base64.StdEncoding.EncodeToString(data))
+}
+
+func (b *bucket) acl(opts *bfs.WriteOptions) *string {
+	if s := opts.GetACL(); s != "" {
+		return aws.String(s)
+	}
+	return strPresence(b.config.ACL)
+}
+
+func (b *bucket) retention(opts *bfs.WriteOptions) (*string, *time.Time) {
+	mode, until := opts.GetRetention()
+	if until.IsZero() {
+		return strPresence(mode), nil
+	}
+	return strPresence(mode), aws.Time(until)
+}
+
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) stripPrefix(name string) string {
-	if b.config.Prefix == "" {
-		return name
+	if b.config.Prefix != "" {
+		name = strings.TrimPrefix(name, b.config.Prefix)
+		name = strings.TrimPrefix(name, "/")
+	}
+	if b.config.NameInverse != nil {
+		name = b.config.NameInverse(name)
 	}
-	name = strings.TrimPrefix(name, b.config.Prefix)
-	name = strings.TrimPrefix(name, "/")
 	return name
 }
 
 func (b *bucket) withPrefix(name string) string {
+	if b.config.NameTransform != nil {
+		name = b.config.NameTransform(name)
+	}
 	if b.config.Prefix == "" {
 		return name
 	}
-	return internal.WithinNamespace(b.config.Prefix, name)
+	return internal.WithinNamespaceKey(b.config.Prefix, name)
+}
+
+// SortedGlob implements Glob, S3 lists names in lexicographic order.
+func (b *bucket) SortedGlob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	if b.config.NameTransform != nil {
+		return bfs.SortedGlob(ctx, unorderedBucket{b}, pattern)
+	}
+	return b.Glob(ctx, pattern)
 }
 
+// unorderedBucket hides native support for ordered listings, so that bfs
+// helpers fall back to ordering on the client.
+type unorderedBucket struct{ bfs.Bucket }
+
 // Glob implements bfs.Bucket.
 func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
-	// quick sanity check
-	if _, err := doublestar.Match(pattern, ""); err != nil {
+	return b.GlobAfter(ctx, pattern, "")
+}
+
+// GlobAfter lists the files matching a glob pattern, starting lexicographically
+// after the given name.
+func (b *bucket) GlobAfter(ctx context.Context, pattern, after string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
 		return nil, err
 	}
+	if after != "" && b.config.NameTransform != nil {
+		return bfs.GlobAfter(ctx, unorderedBucket{b}, pattern, after)
+	}
 
-	return &iterator{
+	iter := &iterator{
 		parent:  b,
 		ctx:     ctx,
 		pattern: pattern,
-	}, nil
+	}
+	if after != "" {
+		iter.startAfter = aws.String(b.withPrefix(after))
+	}
+	return iter, nil
 }
 
 // Head implements bfs.Bucket.
 func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
-	resp, err := b.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.HeadObjectInput{
 		Bucket: aws.String(b.bucket),
 		Key:    aws.String(b.withPrefix(name)),
-	})
-	if err != nil {
-		return nil, normError(err)
+	}
+	if b.config.ChecksumMode {
+		input.ChecksumMode = aws.String(s3.ChecksumModeEnabled)
+	}
+
+	var resp *s3.HeadObjectOutput
+	if err := b.retryNotFound(ctx, func() (err error) {
+		resp, err = b.HeadObjectWithContext(ctx, input)
+		return normError(err)
+	}); err != nil {
+		return nil, err
 	}
 
+	restoring, restoredUntil := parseRestore(aws.StringValue(resp.Restore))
 	return &bfs.MetaInfo{
 		Name:        name,
 		Size:        aws.Int64Value(resp.ContentLength),
 		ModTime:     aws.TimeValue(resp.LastModified),
 		ContentType: aws.StringValue(resp.ContentType),
 		Metadata:    bfs.NormMetadata(aws.StringValueMap(resp.Metadata)),
+		Version:     aws.StringValue(resp.ETag),
+
+		CacheControl:       aws.StringValue(resp.CacheControl),
+		ContentEncoding:    aws.StringValue(resp.ContentEncoding),
+		ContentDisposition: aws.StringValue(resp.ContentDisposition),
+		ContentLanguage:    aws.StringValue(resp.ContentLanguage),
+
+		RetainUntil: aws.TimeValue(resp.ObjectLockRetainUntilDate),
+		LockMode:    aws.StringValue(resp.ObjectLockMode),
+
+		StorageClass:  aws.StringValue(resp.StorageClass),
+		Restoring:     restoring,
+		RestoredUntil: restoredUntil,
+
+		Extra: headExtra(resp),
 	}, nil
 }
 
+// headExtra extracts archive, restore and replication states as well as
+// additional checksums from a HeadObject response.
+func headExtra(resp *s3.HeadObjectOutput) map[string]string {
+	extra := make(map[string]string)
+	if s := aws.StringValue(resp.Restore); s != "" {
+		extra["x-amz-restore"] = s
+	}
+	if s := aws.StringValue(resp.ArchiveStatus); s != "" {
+		extra["x-amz-archive-status"] = s
+	}
+	if s := aws.StringValue(resp.ReplicationStatus); s != "" {
+		extra["x-amz-replication-status"] = s
+	}
+	headChecksums(resp, extra)
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+// retryNotFound calls fn until it returns an error other than
+// bfs.ErrNotFound or ReadAfterWriteRetries are exhausted.
+func (b *bucket) retryNotFound(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err != bfs.ErrNotFound || attempt >= b.config.ReadAfterWriteRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.config.ReadAfterWriteDelay):
+		}
+	}
+}
+
+func isRangeNotSatisfiable(err error) bool {
+	e, ok := err.(awserr.RequestFailure)
+	return ok && e.StatusCode() == http.StatusRequestedRangeNotSatisfiable
+}
+
 // Open implements bfs.Bucket.
 func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
-	resp, err := b.GetObjectWithContext(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(b.bucket),
-		Key:    aws.String(b.withPrefix(name)),
-	})
+	name, err := b.checkName(name)
 	if err != nil {
-		return nil, normError(err)
+		return nil, err
+	}
+
+	var resp *s3.GetObjectOutput
+	if err := b.retryNotFound(ctx, func() (err error) {
+		resp, err = b.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.withPrefix(name)),
+		})
+		return normError(err)
+	}); err != nil {
+		return nil, err
+	}
+	return &response{
+		ReadCloser:      resp.Body,
+		ContentLength:   contentLength(resp.ContentLength),
+		size:            aws.Int64Value(resp.ContentLength),
+		modTime:         aws.TimeValue(resp.LastModified),
+		contentType:     aws.StringValue(resp.ContentType),
+		contentEncoding: aws.StringValue(resp.ContentEncoding),
+	}, nil
+}
+
+// OpenRange opens an object for reading, like Open, but only fetches up to
+// length bytes, starting at offset.
+func (b *bucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := bfs.ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+
+	var resp *s3.GetObjectOutput
+	err = b.retryNotFound(ctx, func() (err error) {
+		resp, err = b.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.withPrefix(name)),
+			Range:  aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)),
+		})
+		if isRangeNotSatisfiable(err) {
+			return err
+		}
+		return normError(err)
+	})
+	if isRangeNotSatisfiable(err) {
+		// the range starts beyond the end of the object
+		return &response{ReadCloser: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	size := aws.Int64Value(resp.ContentLength)
+	if rng := aws.StringValue(resp.ContentRange); strings.Contains(rng, "/") {
+		if n, err := strconv.ParseInt(rng[strings.LastIndexByte(rng, '/')+1:], 10, 64); err == nil {
+			size = n
+		}
 	}
 	return &response{
 		ReadCloser:    resp.Body,
-		ContentLength: aws.Int64Value(resp.ContentLength),
+		ContentLength: contentLength(resp.ContentLength),
+		size:          size,
+		modTime:       aws.TimeValue(resp.LastModified),
+		contentType:   aws.StringValue(resp.ContentType),
 	}, nil
 }
 
 // Create implements bfs.Bucket.
 func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
-	f, err := ioutil.TempFile("", "bfs-s3")
+	name, err := b.checkName(name)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return nil, err
+	}
+	if _, err := checksumAlgorithm(opts.GetChecksumAlgorithm()); err != nil {
+		return nil, err
+	}
+
+	if b.config.Streaming {
+		return newStreamWriter(ctx, b, name, opts), nil
+	}
+
 	return &writer{
-		File:   f,
-		ctx:    ctx,
-		bucket: b,
-		name:   name,
-		opts:   opts,
+		ctx:       ctx,
+		bucket:    b,
+		name:      name,
+		opts:      opts,
+		threshold: b.spillThreshold(opts),
 	}, nil
 }
 
+// spillThreshold returns the number of bytes a writer buffers in memory. If
+// the size hint is small enough for a single-part upload, writes are kept in
+// memory and uploaded directly, without a tempfile.
+func (b *bucket) spillThreshold(opts *bfs.WriteOptions) int64 {
+	threshold := b.config.SpillThreshold
+	if n := opts.GetSize(); n > threshold && n <= b.config.PartSize {
+		threshold = n
+	}
+	return threshold
+}
+
 // Remove implements bfs.Bucket.
 func (b *bucket) Remove(ctx context.Context, name string) error {
-	_, err := b.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.withPrefix(name)),
+	})
+	return normError(err)
+}
+
+// RemoveIfMatch removes an object only if its ETag matches version, as
+// reported by MetaInfo.Version. It returns an error which satisfies
+// errors.Is(err, bfs.ErrConflict) if the object was modified.
+//
+// Please note that S3 does not support conditional deletes. The ETag is
+// checked by a separate request, writes which happen between the check and
+// the removal are not detected.
+func (b *bucket) RemoveIfMatch(ctx context.Context, name, version string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.withPrefix(name)),
+	})
+	if err != nil {
+		return normError(err)
+	}
+	if etag := aws.StringValue(resp.ETag); etag != version {
+		return bfs.WrapError(bfs.ErrConflict, fmt.Errorf("bfss3: ETag %s does not match %s", etag, version))
+	}
+
+	_, err = b.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(b.bucket),
 		Key:    aws.String(b.withPrefix(name)),
 	})
@@ -251,43 +737,411 @@ func (b *bucket) Remove(ctx context.Context, name string) error {
 
 // Copy supports copying of objects within the bucket.
 func (b *bucket) Copy(ctx context.Context, src, dst string) error {
-	source := path.Join("/", b.bucket, b.withPrefix(src))
-	_, err := b.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
-		Bucket:               aws.String(b.bucket),
-		CopySource:           aws.String(source),
-		Key:                  aws.String(b.withPrefix(dst)),
-		ACL:                  strPresence(b.config.ACL),
-		GrantFullControl:     strPresence(b.config.GrantFullControl),
-		ServerSideEncryption: strPresence(b.config.SSE),
+	src, err := b.checkName(src)
+	if err != nil {
+		return err
+	}
+	dst, err = b.checkName(dst)
+	if err != nil {
+		return err
+	}
+
+	return b.copyObject(ctx, b.withPrefix(src), b.withPrefix(dst))
+}
+
+// Rename moves an object within the bucket. S3 cannot rename objects, the
+// object is copied and the source is removed. If the removal fails, an error
+// is returned which satisfies errors.Is(err, bfs.ErrSourceNotRemoved).
+func (b *bucket) Rename(ctx context.Context, src, dst string) error {
+	if b.withPrefix(src) == b.withPrefix(dst) {
+		_, err := b.Head(ctx, src) // the copy would be removed
+		return err
+	}
+
+	if err := b.Copy(ctx, src, dst); err != nil {
+		return normError(err)
+	}
+	if err := b.Remove(ctx, src); err != nil {
+		return bfs.WrapError(bfs.ErrSourceNotRemoved, err)
+	}
+	return nil
+}
+
+// CopyOptions override bucket-level settings when copying objects with
+// CopyWithOptions. Blank fields fall back to the bucket configuration, with
+// the exception of OverwriteExisting.
+type CopyOptions struct {
+	// ACL overrides Config.ACL.
+	ACL string
+	// SSE overrides Config.SSE, e.g. s3.ServerSideEncryptionAwsKms.
+	SSE string
+	// SSEKMSKeyID is the KMS key to encrypt the copy with. SSE defaults to
+	// s3.ServerSideEncryptionAwsKms when set.
+	SSEKMSKeyID string
+	// StorageClass of the copy, e.g. s3.StorageClassStandardIa. S3 applies
+	// STANDARD by default.
+	StorageClass string
+	// MetadataDirective is either s3.MetadataDirectiveCopy (default) or
+	// s3.MetadataDirectiveReplace. When replacing, ContentType and Metadata
+	// are stored instead of the source object's values.
+	MetadataDirective string
+	ContentType       string
+	Metadata          bfs.Metadata
+	// OverwriteExisting allows copies to replace existing destinations,
+	// otherwise they fail with bfs.ErrExists. It must be set for in-place
+	// copies of an object onto itself.
+	OverwriteExisting bool
+	// SourceETag fails copies with bfs.ErrConflict unless the source ETag
+	// matches, as reported by bfs.MetaInfo.Version.
+	SourceETag string
+}
+
+// CopyWithOptions copies an object within the bucket, like Copy, but allows
+// to override ACL, encryption, storage class and metadata of the copy.
+//
+// Please note that the check for existing destinations is racy. S3 cannot
+// copy conditionally on the destination, it is checked with a separate Head
+// request and objects which are created between the check and the copy are
+// still overwritten.
+//
+// This can be used to e.g. re-encrypt objects in place with a new KMS key by
+// copying them onto themselves with OverwriteExisting. A nil opts copies
+// unconditionally, like Copy. Objects larger than 5GB are not supported.
+func (b *bucket) CopyWithOptions(ctx context.Context, src, dst string, opts *CopyOptions) error {
+	src, err := b.checkName(src)
+	if err != nil {
+		return err
+	}
+	dst, err = b.checkName(dst)
+	if err != nil {
+		return err
+	}
+
+	input := b.copyInput(b.withPrefix(src), b.withPrefix(dst))
+	if opts != nil {
+		if opts.ACL != "" {
+			input.ACL = aws.String(opts.ACL)
+		}
+		if opts.SSE != "" {
+			input.ServerSideEncryption = aws.String(opts.SSE)
+			if opts.SSE != s3.ServerSideEncryptionAwsKms {
+				input.SSEKMSEncryptionContext = nil
+			}
+		}
+		if opts.SSEKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+			if opts.SSE == "" {
+				input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			}
+		}
+		input.StorageClass = strPresence(opts.StorageClass)
+		input.MetadataDirective = strPresence(opts.MetadataDirective)
+		if opts.MetadataDirective == s3.MetadataDirectiveReplace {
+			meta := make(bfs.Metadata, len(opts.Metadata))
+			for k, v := range opts.Metadata {
+				meta.Set(k, v)
+			}
+			if err := bfs.ValidateMetadata(meta, MaxMetadataSize); err != nil {
+				return err
+			}
+			input.ContentType = strPresence(opts.ContentType)
+			input.Metadata = aws.StringMap(meta)
+		}
+		input.CopySourceIfMatch = strPresence(opts.SourceETag)
+
+		if !opts.OverwriteExisting {
+			_, err := b.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+				Bucket: aws.String(b.bucket),
+				Key:    input.Key,
+			})
+			if err == nil {
+				return bfs.ErrExists
+			} else if err := normError(err); err != bfs.ErrNotFound {
+				return err
+			}
+		}
+	}
+
+	_, err = b.CopyObjectWithContext(ctx, input)
+	return normCopyError(err)
+}
+
+// normCopyError normalizes errors of conditional copies, failed
+// preconditions are reported as bfs.ErrConflict.
+func normCopyError(err error) error {
+	if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() == http.StatusPreconditionFailed {
+		return bfs.WrapError(bfs.ErrConflict, err)
+	}
+	return normError(err)
+}
+
+// ReplaceMetadata replaces content type, metadata and HTTP headers of an
+// object with the values of opts, without uploading its content again. The
+// object is copied onto itself with s3.MetadataDirectiveReplace, its storage
+// class and server-side encryption are preserved. Objects larger than 5GB
+// are not supported.
+func (b *bucket) ReplaceMetadata(ctx context.Context, name string, opts *bfs.WriteOptions) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return err
+	}
+
+	key := b.withPrefix(name)
+	head, err := b.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
 	})
+	if err != nil {
+		return normError(err)
+	}
+
+	input := b.copyInput(key, key)
+	input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	input.ContentType = strPresence(b.contentType(name, opts))
+	input.Metadata = aws.StringMap(opts.GetMetadata())
+	input.CacheControl = strPresence(opts.GetCacheControl())
+	input.ContentEncoding = strPresence(opts.GetContentEncoding())
+	input.ContentDisposition = strPresence(opts.GetContentDisposition())
+	input.ContentLanguage = strPresence(opts.GetContentLanguage())
+	input.ACL = b.acl(opts)
+	input.StorageClass = head.StorageClass
+	if head.ServerSideEncryption != nil {
+		input.ServerSideEncryption = head.ServerSideEncryption
+		input.SSEKMSKeyId = head.SSEKMSKeyId
+		if aws.StringValue(head.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms {
+			input.SSEKMSEncryptionContext = nil
+		}
+	}
+
+	_, err = b.CopyObjectWithContext(ctx, input)
+	return normError(err)
+}
+
+func (b *bucket) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	_, err := b.CopyObjectWithContext(ctx, b.copyInput(srcKey, dstKey))
 	return err
 }
 
+func (b *bucket) copyInput(srcKey, dstKey string) *s3.CopyObjectInput {
+	return &s3.CopyObjectInput{
+		Bucket:                  aws.String(b.bucket),
+		CopySource:              aws.String(path.Join("/", b.bucket, srcKey)),
+		Key:                     aws.String(dstKey),
+		ACL:                     strPresence(b.config.ACL),
+		GrantFullControl:        strPresence(b.config.GrantFullControl),
+		ServerSideEncryption:    strPresence(b.config.SSE),
+		SSEKMSEncryptionContext: b.sseContext,
+	}
+}
+
+// UploadFile uploads a local file directly, without buffering its content
+// in a tempfile first. This is considerably faster than copying the file
+// into a writer returned by Create, especially for large files.
+func (b *bucket) UploadFile(ctx context.Context, name, localPath string, opts *bfs.WriteOptions) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return normError(b.upload(ctx, name, file, opts))
+}
+
+// upload uploads body. Bodies of known size below Config.MultipartThreshold
+// are stored with a single request, others are uploaded in parts.
+func (b *bucket) upload(ctx context.Context, name string, body io.Reader, opts *bfs.WriteOptions) error {
+	opts = fixExpiry(opts)
+	lockMode, retainUntil := b.retention(opts)
+	expires, tagging := expiry(opts)
+	algorithm, err := checksumAlgorithm(opts.GetChecksumAlgorithm())
+	if err != nil {
+		return err
+	}
+
+	if rs, ok := body.(io.ReadSeeker); ok {
+		if size, err := remainingSize(rs); err != nil {
+			return err
+		} else if size < b.config.MultipartThreshold {
+			sums, err := computeChecksums(algorithm, rs)
+			if err != nil {
+				return err
+			}
+
+			_, err = b.PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket:                    aws.String(b.bucket),
+				Key:                       aws.String(b.withPrefix(name)),
+				Body:                      rs,
+				ContentType:               aws.String(b.contentType(name, opts)),
+				Metadata:                  aws.StringMap(opts.GetMetadata()),
+				CacheControl:              strPresence(opts.GetCacheControl()),
+				ContentEncoding:           strPresence(opts.GetContentEncoding()),
+				ContentDisposition:        strPresence(opts.GetContentDisposition()),
+				ContentLanguage:           strPresence(opts.GetContentLanguage()),
+				ACL:                       b.acl(opts),
+				GrantFullControl:          strPresence(b.config.GrantFullControl),
+				ServerSideEncryption:      strPresence(b.config.SSE),
+				SSEKMSEncryptionContext:   b.sseContext,
+				ObjectLockMode:            lockMode,
+				ObjectLockRetainUntilDate: retainUntil,
+				Expires:                   expires,
+				Tagging:                   tagging,
+				ChecksumAlgorithm:         algorithm,
+				ChecksumCRC32:             sums.CRC32,
+				ChecksumCRC32C:            sums.CRC32C,
+				ChecksumSHA1:              sums.SHA1,
+				ChecksumSHA256:            sums.SHA256,
+			})
+			return err
+		}
+	}
+
+	// the uploader does not pass part checksums on to CompleteMultipartUpload,
+	// so checksummed uploads are sent in parts by a StreamWriter instead
+	if algorithm != nil {
+		w := newStreamWriter(ctx, b, name, opts)
+		if _, err := io.Copy(w, body); err != nil {
+			_ = w.Discard()
+			return err
+		}
+		return w.Commit()
+	}
+
+	_, err = b.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:                    aws.String(b.bucket),
+		Key:                       aws.String(b.withPrefix(name)),
+		Body:                      body,
+		ContentType:               aws.String(b.contentType(name, opts)),
+		Metadata:                  aws.StringMap(opts.GetMetadata()),
+		CacheControl:              strPresence(opts.GetCacheControl()),
+		ContentEncoding:           strPresence(opts.GetContentEncoding()),
+		ContentDisposition:        strPresence(opts.GetContentDisposition()),
+		ContentLanguage:           strPresence(opts.GetContentLanguage()),
+		ACL:                       b.acl(opts),
+		GrantFullControl:          strPresence(b.config.GrantFullControl),
+		ServerSideEncryption:      strPresence(b.config.SSE),
+		SSEKMSEncryptionContext:   b.sseContext,
+		ObjectLockMode:            lockMode,
+		ObjectLockRetainUntilDate: retainUntil,
+		Expires:                   expires,
+		Tagging:                   tagging,
+	})
+	return err
+}
+
+// contentType returns the content type of an upload, it falls back to
+// Config.ContentTypeByExt if none is set.
+func (b *bucket) contentType(name string, opts *bfs.WriteOptions) string {
+	if ct := opts.GetContentType(); ct != "" {
+		return ct
+	}
+	return internal.ContentTypeByExt(name, b.config.ContentTypeByExt)
+}
+
+// remainingSize returns the number of bytes between the current offset of rs
+// and its end.
+func remainingSize(rs io.Seeker) (int64, error) {
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - pos, nil
+}
+
+// Describe returns information about the bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "s3", Bucket: b.bucket, Prefix: b.config.Prefix}
+}
+
+// S3 returns the native S3 client, for features which are not covered by
+// bfs. Please note that requests issued via the client bypass the bucket's
+// prefix, name sanitization and default ACL/SSE settings.
+func (b *bucket) S3() s3iface.S3API {
+	return b.S3API
+}
+
 // Close implements bfs.Bucket.
 func (*bucket) Close() error { return nil }
 
 // --------------------------------------------------------
 
 type writer struct {
-	*os.File
-
 	ctx    context.Context
 	bucket *bucket
 	name   string
 	opts   *bfs.WriteOptions
 
+	buf       bytes.Buffer
+	file      *os.File
+	threshold int64 // spill to a tempfile when exceeded
+
 	closeOnce sync.Once
 }
 
+func (w *writer) Write(p []byte) (int, error) {
+	if w.file == nil && int64(w.buf.Len()+len(p)) > w.threshold {
+		if err := w.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.file != nil {
+		return w.file.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// spill moves the buffered content into a tempfile.
+func (w *writer) spill() error {
+	f, err := createTempFile(w.bucket.config.TempDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.buf.WriteTo(f); err != nil {
+		_ = f.Close()
+		_ = removeTempFile(f.Name())
+		return err
+	}
+
+	w.file = f
+	return nil
+}
+
 func (w *writer) Discard() error {
 	err := context.Canceled
 	w.closeOnce.Do(func() {
+		w.buf.Reset()
+		if w.file == nil {
+			err = nil
+			return
+		}
+
 		// Delete tempfile in the end
-		fname := w.Name()
-		defer os.Remove(fname)
+		fname := w.file.Name()
+		defer removeTempFile(fname)
 
 		// Close tempfile
-		err = w.File.Close()
+		err = w.file.Close()
 	})
 
 	return err
@@ -296,33 +1150,29 @@ func (w *writer) Discard() error {
 func (w *writer) Commit() error {
 	err := context.Canceled
 	w.closeOnce.Do(func() {
-		// Delete tempfile in the end
-		fname := w.Name()
-		defer os.Remove(fname)
+		var body io.ReadSeeker = bytes.NewReader(w.buf.Bytes())
+		if w.file != nil {
+			// Delete tempfile in the end
+			fname := w.file.Name()
+			defer removeTempFile(fname)
+
+			// Close tempfile
+			if err = w.file.Close(); err != nil {
+				return
+			}
 
-		// Close tempfile
-		if err = w.File.Close(); err != nil {
-			return
-		}
+			// Re-open tempfile for reading
+			var file *os.File
+			if file, err = os.Open(fname); err != nil {
+				return
+			}
+			defer file.Close()
 
-		// Re-open tempfile for reading
-		var file *os.File
-		if file, err = os.Open(fname); err != nil {
-			return
+			body = file
 		}
-		defer file.Close()
 
 		// Upload file
-		_, err = w.bucket.uploader.UploadWithContext(w.ctx, &s3manager.UploadInput{
-			Bucket:               aws.String(w.bucket.bucket),
-			Key:                  aws.String(w.bucket.withPrefix(w.name)),
-			Body:                 file,
-			ContentType:          aws.String(w.opts.GetContentType()),
-			Metadata:             aws.StringMap(w.opts.GetMetadata()),
-			ACL:                  strPresence(w.bucket.config.ACL),
-			GrantFullControl:     strPresence(w.bucket.config.GrantFullControl),
-			ServerSideEncryption: strPresence(w.bucket.config.SSE),
-		})
+		err = w.bucket.upload(w.ctx, w.name, body, w.opts)
 	})
 
 	return normError(err)
@@ -330,25 +1180,48 @@ func (w *writer) Commit() error {
 
 // -----------------------------------------------------------------------------
 
+// Ping checks that the bucket exists and is accessible with a HeadBucket
+// request.
+func (b *bucket) Ping(ctx context.Context) error {
+	_, err := b.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(b.bucket),
+	})
+	if err == nil {
+		return nil
+	}
+
+	// report the original error for missing buckets, not bfs.ErrNotFound
+	if ne := normError(err); ne != bfs.ErrNotFound {
+		err = ne
+	}
+	return fmt.Errorf("bfss3: unable to reach bucket %q: %w", b.bucket, err)
+}
+
 func normError(err error) error {
 	if err == nil {
 		return nil
 	}
 
-	switch e := err.(type) {
-	case awserr.RequestFailure:
-		switch e.StatusCode() {
-		case http.StatusNotFound:
-			return bfs.ErrNotFound
-		}
-	case awserr.Error:
+	if e, ok := err.(awserr.Error); ok {
 		switch e.Code() {
 		case s3.ErrCodeNoSuchKey:
 			return bfs.ErrNotFound
+		case "InvalidObjectState":
+			return bfs.WrapError(bfs.ErrNotReady, err)
+		case "AccessDenied":
+			return bfs.WrapError(bfs.ErrAccessDenied, err)
 		case request.CanceledErrorCode:
 			return context.Canceled
 		}
 	}
+	if e, ok := err.(awserr.RequestFailure); ok {
+		switch e.StatusCode() {
+		case http.StatusNotFound:
+			return bfs.ErrNotFound
+		case http.StatusForbidden:
+			return bfs.WrapError(bfs.ErrAccessDenied, err)
+		}
+	}
 	return err
 }
 
@@ -359,13 +1232,44 @@ func strPresence(s string) *string {
 	return nil
 }
 
+// maxDrainSize is the maximum number of unread bytes which are drained when a
+// reader is closed. Draining the body allows the HTTP connection to be reused,
+// larger remainders are discarded together with the connection.
+const maxDrainSize = 256 * 1024
+
 type response struct {
 	io.ReadCloser
-	ContentLength int64
+	ContentLength int64 // remaining bytes, -1 if unknown
+
+	size            int64
+	modTime         time.Time
+	contentType     string
+	contentEncoding string
+}
+
+func (r *response) Size() int64         { return r.size }
+func (r *response) ModTime() time.Time  { return r.modTime }
+func (r *response) ContentType() string { return r.contentType }
+
+// ContentEncoding returns the encoding of the served content, which is empty
+// if the HTTP transport has already decompressed it.
+func (r *response) ContentEncoding() string { return r.contentEncoding }
+
+// contentLength returns the reported length, or -1 if the response did not
+// include one, e.g. when the HTTP transport has decompressed the body.
+func contentLength(n *int64) int64 {
+	if n == nil || *n < 0 {
+		return -1
+	}
+	return *n
 }
 
 func (r *response) Read(p []byte) (n int, err error) {
-	if r.ContentLength <= 0 {
+	if r.ContentLength < 0 {
+		// unknown length, read until EOF
+		return r.ReadCloser.Read(p)
+	}
+	if r.ContentLength == 0 {
 		return 0, io.EOF
 	}
 
@@ -373,20 +1277,37 @@ func (r *response) Read(p []byte) (n int, err error) {
 		p = p[:r.ContentLength]
 	}
 	n, err = r.ReadCloser.Read(p)
-	if err == io.EOF && n > 0 && int64(n) == r.ContentLength {
-		err = nil
-	}
 	r.ContentLength -= int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if r.ContentLength > 0 {
+			err = bfs.ErrUnexpectedEOF
+		} else if n > 0 {
+			err = nil
+		}
+	}
 	return
 }
 
+// Close drains the remaining body, if it is small enough, and closes it.
+// Read stops at the expected content length, so the final EOF of the body
+// must be consumed here, even after complete reads. Bodies of unknown length
+// are drained up to maxDrainSize.
+func (r *response) Close() error {
+	if r.ContentLength <= maxDrainSize {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(r.ReadCloser, maxDrainSize+1))
+	}
+	return r.ReadCloser.Close()
+}
+
 // --------------------------------------------------------------------
 
 type iterator struct {
-	parent  *bucket
-	ctx     context.Context
-	pattern string
-	token   *string
+	parent     *bucket
+	ctx        context.Context
+	pattern    string
+	prefix     string // optional, scopes the listing within the bucket prefix
+	startAfter *string
+	token      *string
 
 	err  error
 	last bool // indicates last page
@@ -449,15 +1370,36 @@ func (i *iterator) Next() bool {
 
 func (i *iterator) Error() error { return i.err }
 
+// Reset restarts the listing from the first page.
+func (i *iterator) Reset() error {
+	i.token = nil
+	i.err = nil
+	i.last = false
+	i.page = i.page[:0]
+	i.pos = -1
+	return nil
+}
+
 func (i *iterator) fetchNextPage() error {
 	i.page = i.page[:0]
 	i.pos = -1
 
-	res, err := i.parent.ListObjectsV2WithContext(i.ctx, &s3.ListObjectsV2Input{
+	prefix := i.parent.config.Prefix + i.prefix
+	if i.parent.config.NameTransform != nil {
+		prefix = i.parent.config.Prefix // names are not prefixes of keys
+	}
+
+	input := &s3.ListObjectsV2Input{
 		Bucket:            aws.String(i.parent.bucket),
-		Prefix:            aws.String(i.parent.config.Prefix),
+		Prefix:            aws.String(prefix),
+		StartAfter:        i.startAfter,
 		ContinuationToken: i.token,
-	})
+	}
+	if n := i.parent.config.PageSize; n > 0 {
+		input.MaxKeys = aws.Int64(int64(n))
+	}
+
+	res, err := i.parent.ListObjectsV2WithContext(i.ctx, input)
 	if err != nil {
 		return err
 	}
@@ -471,6 +1413,9 @@ func (i *iterator) fetchNextPage() error {
 		}
 
 		name := i.parent.stripPrefix(aws.StringValue(obj.Key))
+		if !strings.HasPrefix(name, i.prefix) {
+			continue
+		}
 		if ok, err := doublestar.Match(i.pattern, name); err != nil {
 			return err
 		} else if ok {
@@ -1,38 +1,112 @@
 package bfss3_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bmatcuk/doublestar"
 	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+	"github.com/bsm/bfs/internal"
 	"github.com/bsm/bfs/testdata/lint"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
-const bucketName = "bsm-bfs-unittest"
+var lintConfig = lint.ConfigFromEnv()
 
-var awsConfig = aws.Config{Region: aws.String("us-east-1")}
+var bucketName = lintConfig.BucketOr("bsm-bfs-unittest")
+
+var awsConfig = aws.Config{
+	Region:           aws.String("us-east-1"),
+	Endpoint:         strPresence(lintConfig.Endpoint),
+	S3ForcePathStyle: aws.Bool(lintConfig.ForcePathStyle),
+}
 
 var _ = Describe("Bucket", func() {
 	var opts lint.Options
 
 	BeforeEach(func() {
+		if sandboxErr != nil {
+			Skip("skipping test, no sandbox access: " + sandboxErr.Error())
+		}
+
 		prefix := "x/" + strconv.FormatInt(time.Now().UnixNano(), 10)
 		subject, err := bfss3.New(bucketName, &bfss3.Config{Prefix: prefix, AWS: awsConfig})
 		Expect(err).NotTo(HaveOccurred())
 
-		readonly, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "m/", AWS: awsConfig})
+		sanitized, err := bfss3.New(bucketName, &bfss3.Config{Prefix: prefix, AWS: awsConfig, SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		opts = lint.Options{
+			Subject:   subject,
+			Sanitized: sanitized,
+
+			Metadata:    true,
+			ContentType: true,
+		}
+
+		if !lintConfig.IsCustom() {
+			readonly, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "m/", AWS: awsConfig})
+			Expect(err).NotTo(HaveOccurred())
+			opts.Readonly = readonly
+		}
+	})
+
+	Context("defaults", lint.Lint(&opts))
+})
+
+var _ = Describe("Bucket (fake)", func() {
+	var opts lint.Options
+	var readonly bfs.Bucket
+
+	BeforeEach(func() {
+		session := faketest.New().Session()
+		subject, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: session})
+		Expect(err).NotTo(HaveOccurred())
+
+		sanitized, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: session, SanitizeNames: true})
 		Expect(err).NotTo(HaveOccurred())
 
+		if readonly == nil {
+			fake := faketest.New()
+			client := fake.Client()
+			for i := 0; i < 2121; i++ {
+				_, err := client.PutObject(&s3.PutObjectInput{
+					Bucket: aws.String(bucketName),
+					Key:    aws.String(fmt.Sprintf("m/%02d/%04d.txt", i%20, i)),
+					Body:   strings.NewReader("TESTDATA"),
+				})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			readonly, err = bfss3.New(bucketName, &bfss3.Config{Prefix: "m/", Session: fake.Session()})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
 		opts = lint.Options{
-			Subject:  subject,
-			Readonly: readonly,
+			Subject:   subject,
+			Readonly:  readonly,
+			Sanitized: sanitized,
 
 			Metadata:    true,
 			ContentType: true,
@@ -42,13 +116,1024 @@ var _ = Describe("Bucket", func() {
 	Context("defaults", lint.Lint(&opts))
 })
 
+var _ = Describe("Bucket (mocked)", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		var err error
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session()})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"a.txt", "b.txt", "c/d.txt", "e.txt"} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte("TESTDATA"), nil)).To(Succeed())
+		}
+	})
+
+	It("should glob after a name", func() {
+		iter, err := bfs.GlobAfter(ctx, subject, "**", "b.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"c/d.txt", "e.txt"}))
+
+		calls := mock.Calls("ListObjectsV2")
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].(*s3.ListObjectsV2Input).StartAfter).To(Equal(aws.String("x/b.txt")))
+	})
+
+	It("should reject bad patterns before listing", func() {
+		_, err := subject.Glob(ctx, "c/[d")
+		Expect(errors.Is(err, doublestar.ErrBadPattern)).To(BeTrue())
+		_, err = subject.Glob(ctx, "c/{d,e")
+		Expect(errors.Is(err, doublestar.ErrBadPattern)).To(BeTrue())
+		Expect(mock.Calls("ListObjectsV2")).To(BeEmpty())
+	})
+
+	It("should apply page sizes", func() {
+		paged, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session(), PageSize: 3})
+		Expect(err).NotTo(HaveOccurred())
+
+		iter, err := paged.Glob(ctx, "**")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		Expect(names).To(Equal([]string{"a.txt", "b.txt", "c/d.txt", "e.txt"}))
+
+		calls := mock.Calls("ListObjectsV2")
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].(*s3.ListObjectsV2Input).MaxKeys).To(Equal(aws.Int64(3)))
+		Expect(calls[1].(*s3.ListObjectsV2Input).MaxKeys).To(Equal(aws.Int64(3)))
+
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), PageSize: 1001})
+		Expect(err).To(MatchError("bfss3: page size must be between 0 and 1000"))
+	})
+
+	It("should reset iterators", func() {
+		iter, err := subject.Glob(ctx, "*.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		for i := 0; i < 2; i++ {
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			Expect(names).To(Equal([]string{"a.txt", "b.txt", "e.txt"}))
+			Expect(bfs.ResetIterator(iter)).To(Succeed())
+		}
+		Expect(mock.Calls("ListObjectsV2")).To(HaveLen(2))
+	})
+
+	It("should expose info on open", func() {
+		Expect(bfs.WriteObject(ctx, subject, "info.txt", []byte("TESTDATA"), &bfs.WriteOptions{ContentType: "text/plain"})).To(Succeed())
+
+		rc, err := subject.Open(ctx, "info.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer rc.Close()
+
+		info, ok := rc.(bfs.ReadCloserInfo)
+		Expect(ok).To(BeTrue())
+		Expect(info.Size()).To(Equal(int64(8)))
+		Expect(info.ModTime()).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(info.ContentType()).To(Equal("text/plain"))
+
+		data, err := ioutil.ReadAll(rc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveLen(8))
+		Expect(info.Size()).To(Equal(int64(8)))
+	})
+
+	It("should store HTTP headers", func() {
+		Expect(bfs.WriteObject(ctx, subject, "headers.txt", []byte("TESTDATA"), &bfs.WriteOptions{
+			CacheControl:       "max-age=60",
+			ContentEncoding:    "gzip",
+			ContentDisposition: "attachment",
+			ContentLanguage:    "de-DE",
+		})).To(Succeed())
+
+		info, err := subject.Head(ctx, "headers.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.CacheControl).To(Equal("max-age=60"))
+		Expect(info.ContentEncoding).To(Equal("gzip"))
+		Expect(info.ContentDisposition).To(Equal("attachment"))
+		Expect(info.ContentLanguage).To(Equal("de-DE"))
+	})
+
+	It("should open decoded", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("plain content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		Expect(bfs.WriteObject(ctx, subject, "a.txt.gz", buf.Bytes(), &bfs.WriteOptions{ContentEncoding: "gzip"})).To(Succeed())
+
+		rc, err := bfs.OpenDecoded(ctx, subject, "a.txt.gz")
+		Expect(err).NotTo(HaveOccurred())
+		defer rc.Close()
+
+		Expect(ioutil.ReadAll(rc)).To(Equal([]byte("plain content")))
+		Expect(mock.Calls("HeadObject")).To(BeEmpty())
+	})
+
+	It("should open transparently decompressed content", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("plain content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		Expect(bfs.WriteObject(ctx, subject, "a.txt.gz", buf.Bytes(), &bfs.WriteOptions{ContentEncoding: "gzip"})).To(Succeed())
+
+		mock.Decompress = true
+		r, err := subject.Open(ctx, "a.txt.gz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("plain content")))
+		Expect(r.Close()).To(Succeed())
+
+		bodies := mock.Bodies()
+		Expect(bodies).To(HaveLen(1))
+		Expect(bodies[0].Drained).To(BeTrue())
+	})
+
+	It("should map content types by extension", func() {
+		mapped, err := bfss3.New(bucketName, &bfss3.Config{
+			Prefix:           "x/",
+			Session:          mock.Session(),
+			ContentTypeByExt: map[string]string{".md": "text/markdown"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bfs.WriteObject(ctx, mapped, "README.MD", []byte("# TESTDATA"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, mapped, "doc.md", []byte("# TESTDATA"), &bfs.WriteOptions{ContentType: "text/plain"})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, mapped, "data.bin", []byte("TESTDATA"), nil)).To(Succeed())
+
+		for name, expected := range map[string]string{
+			"README.MD": "text/markdown",
+			"doc.md":    "text/plain",
+			"data.bin":  "",
+		} {
+			info, err := mapped.Head(ctx, name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.ContentType).To(Equal(expected), name)
+		}
+	})
+
+	It("should drain bodies on close", func() {
+		// partial read
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadFull(r, make([]byte, 4))).To(Equal(4))
+		Expect(r.Close()).To(Succeed())
+
+		// complete read, which stops at the content length
+		r, err = subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+		Expect(r.Close()).To(Succeed())
+
+		// large remainders are not drained
+		Expect(bfs.WriteObject(ctx, subject, "large.bin", make([]byte, 1024*1024), nil)).To(Succeed())
+		r, err = subject.Open(ctx, "large.bin")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadFull(r, make([]byte, 4))).To(Equal(4))
+		Expect(r.Close()).To(Succeed())
+
+		bodies := mock.Bodies()
+		Expect(bodies).To(HaveLen(3))
+		Expect(bodies[0].Drained).To(BeTrue())
+		Expect(bodies[0].Closed).To(BeTrue())
+		Expect(bodies[1].Drained).To(BeTrue())
+		Expect(bodies[1].Closed).To(BeTrue())
+		Expect(bodies[2].Drained).To(BeFalse())
+		Expect(bodies[2].Closed).To(BeTrue())
+	})
+
+	It("should detect truncated reads", func() {
+		mock.Truncate = true
+
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		data, err := ioutil.ReadAll(r)
+		Expect(err).To(MatchError(bfs.ErrUnexpectedEOF))
+		Expect(errors.Is(err, io.ErrUnexpectedEOF)).To(BeTrue())
+		Expect(string(data)).To(Equal("TEST"))
+	})
+
+	It("should apply ACLs", func() {
+		Expect(bfs.WriteObject(ctx, subject, "public.txt", []byte("TESTDATA"), &bfs.WriteOptions{ACL: "public-read"})).To(Succeed())
+
+		calls := mock.Calls("PutObject")
+		Expect(calls[0].(*s3.PutObjectInput).ACL).To(Equal(aws.String(bfss3.DefaultACL)))
+		Expect(calls[len(calls)-1].(*s3.PutObjectInput).ACL).To(Equal(aws.String("public-read")))
+	})
+
+	It("should apply checksum algorithms", func() {
+		Expect(bfs.WriteObject(ctx, subject, "checked.txt", []byte("TESTDATA"), &bfs.WriteOptions{ChecksumAlgorithm: "crc32c"})).To(Succeed())
+
+		puts := mock.Calls("PutObject")
+		input := puts[len(puts)-1].(*s3.PutObjectInput)
+		Expect(input.ChecksumAlgorithm).To(Equal(aws.String(s3.ChecksumAlgorithmCrc32c)))
+		Expect(input.ChecksumCRC32C).To(Equal(aws.String("qX29lQ==")))
+		Expect(input.ChecksumSHA256).To(BeNil())
+
+		info, err := subject.Head(ctx, "checked.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Extra).To(BeEmpty())
+		Expect(mock.Calls("HeadObject")[0].(*s3.HeadObjectInput).ChecksumMode).To(BeNil())
+
+		checked, err := bfss3.New(bucketName, &bfss3.Config{
+			Prefix:       "x/",
+			Session:      mock.Session(),
+			ChecksumMode: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err = checked.Head(ctx, "checked.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Extra).To(Equal(map[string]string{"x-amz-checksum-crc32c": "qX29lQ=="}))
+
+		_, err = subject.Create(ctx, "checked.txt", &bfs.WriteOptions{ChecksumAlgorithm: "md4"})
+		Expect(err).To(MatchError(`bfss3: unsupported checksum algorithm "MD4"`))
+	})
+
+	It("should apply expiry", func() {
+		defer internal.SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })()
+
+		Expect(bfs.WriteObject(ctx, subject, "ephemeral.txt", []byte("TESTDATA"), &bfs.WriteOptions{ExpiresIn: 36 * time.Hour})).To(Succeed())
+
+		puts := mock.Calls("PutObject")
+		input := puts[len(puts)-1].(*s3.PutObjectInput)
+		Expect(input.Expires).To(Equal(aws.Time(time.Date(2020, 1, 3, 15, 4, 5, 0, time.UTC))))
+		Expect(input.Tagging).To(Equal(aws.String("bfs-expire-days=2")))
+		Expect(input.Metadata).To(Equal(map[string]*string{bfs.MetaExpiresAt: aws.String("2020-01-03T15:04:05Z")}))
+	})
+
+	It("should compute expiry once per write", func() {
+		now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		defer internal.SetClock(func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		})()
+
+		Expect(bfs.WriteObject(ctx, subject, "ephemeral.txt", []byte("TESTDATA"), &bfs.WriteOptions{ExpiresIn: time.Hour})).To(Succeed())
+
+		puts := mock.Calls("PutObject")
+		input := puts[len(puts)-1].(*s3.PutObjectInput)
+		Expect(input.Metadata).To(HaveKey(bfs.MetaExpiresAt))
+		Expect(aws.TimeValue(input.Expires).Format(time.RFC3339)).To(Equal(aws.StringValue(input.Metadata[bfs.MetaExpiresAt])))
+	})
+
+	It("should omit ACLs if disabled", func() {
+		noACL, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session(), NoACL: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bfs.WriteObject(ctx, noACL, "private.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(noACL.(interface {
+			Copy(context.Context, string, string) error
+		}).Copy(ctx, "private.txt", "copy.txt")).To(Succeed())
+
+		puts := mock.Calls("PutObject")
+		Expect(puts[len(puts)-1].(*s3.PutObjectInput).ACL).To(BeNil())
+		Expect(puts[len(puts)-1].(*s3.PutObjectInput).GrantFullControl).To(BeNil())
+		Expect(mock.Calls("CopyObject")[0].(*s3.CopyObjectInput).ACL).To(BeNil())
+
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), NoACL: true, ACL: "private"})
+		Expect(err).To(MatchError("bfss3: NoACL cannot be combined with ACL or GrantFullControl"))
+	})
+
+	It("should apply KMS encryption contexts", func() {
+		encrypted, err := bfss3.New(bucketName, &bfss3.Config{
+			Prefix:                  "x/",
+			Session:                 mock.Session(),
+			SSE:                     s3.ServerSideEncryptionAwsKms,
+			SSEKMSEncryptionContext: map[string]string{"team": "data"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bfs.WriteObject(ctx, encrypted, "secret.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(encrypted.(interface {
+			Copy(context.Context, string, string) error
+		}).Copy(ctx, "secret.txt", "copy.txt")).To(Succeed())
+
+		puts := mock.Calls("PutObject")
+		Expect(puts[len(puts)-1].(*s3.PutObjectInput).SSEKMSEncryptionContext).To(Equal(aws.String("eyJ0ZWFtIjoiZGF0YSJ9")))
+		Expect(mock.Calls("CopyObject")[0].(*s3.CopyObjectInput).SSEKMSEncryptionContext).To(Equal(aws.String("eyJ0ZWFtIjoiZGF0YSJ9")))
+
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), SSEKMSEncryptionContext: map[string]string{"team": "data"}})
+		Expect(err).To(MatchError(`bfss3: SSEKMSEncryptionContext requires SSE to be "aws:kms"`))
+	})
+
+	It("should list grants", func() {
+		Expect(bfs.WriteObject(ctx, subject, "public.txt", []byte("TESTDATA"), &bfs.WriteOptions{ACL: s3.ObjectCannedACLPublicRead})).To(Succeed())
+
+		grants, err := bfs.Grants(ctx, subject, "public.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(grants).To(Equal([]bfs.Grant{
+			{Grantee: "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be", Permission: "FULL_CONTROL"},
+			{Grantee: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ"},
+		}))
+
+		_, err = bfs.Grants(ctx, subject, "missing.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should append custom user agents", func() {
+		custom, err := bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), UserAgent: "partner-sync/1.2"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = custom.Head(ctx, "missing.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+
+		agents := mock.UserAgents("HeadObject")
+		Expect(agents).To(HaveLen(1))
+		Expect(agents[0]).To(HavePrefix("aws-sdk-go/"))
+		Expect(agents[0]).To(HaveSuffix(" partner-sync/1.2"))
+	})
+
+	It("should describe buckets", func() {
+		info, ok := bfs.Describe(subject)
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "s3", Bucket: bucketName, Prefix: "x/"}))
+	})
+
+	It("should remove objects conditionally", func() {
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Version).NotTo(BeEmpty())
+
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("MODIFIED"), nil)).To(Succeed())
+		err = bfs.RemoveIfMatch(ctx, subject, "a.txt", info.Version)
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+		Expect(mock.Keys()).To(ContainElement("x/a.txt"))
+
+		info, err = subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", info.Version)).To(Succeed())
+		Expect(mock.Keys()).NotTo(ContainElement("x/a.txt"))
+
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", info.Version)).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should rename objects", func() {
+		Expect(bfs.Rename(ctx, subject, "a.txt", "f/g.txt")).To(Succeed())
+		Expect(mock.Keys()).To(ConsistOf("x/b.txt", "x/c/d.txt", "x/e.txt", "x/f/g.txt"))
+
+		Expect(bfs.Rename(ctx, subject, "a.txt", "h.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should not remove objects renamed onto themselves", func() {
+		renamer := subject.(interface {
+			Rename(context.Context, string, string) error
+		})
+		Expect(renamer.Rename(ctx, "a.txt", "a.txt")).To(Succeed())
+		Expect(renamer.Rename(ctx, "/a.txt", "a.txt")).To(Succeed())
+		Expect(mock.Keys()).To(ContainElement("x/a.txt"))
+		Expect(mock.Calls("CopyObject")).To(BeEmpty())
+
+		Expect(renamer.Rename(ctx, "h.txt", "h.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should report sources which could not be removed on rename", func() {
+		forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "DeleteObject" {
+				return forbidden
+			}
+			return nil
+		}
+
+		err := bfs.Rename(ctx, subject, "a.txt", "f.txt")
+		Expect(errors.Is(err, bfs.ErrSourceNotRemoved)).To(BeTrue())
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+		Expect(mock.Keys()).To(ContainElement("x/a.txt"))
+		Expect(mock.Keys()).To(ContainElement("x/f.txt"))
+	})
+
+	It("should copy with options", func() {
+		type optionsCopier interface {
+			CopyWithOptions(context.Context, string, string, *bfss3.CopyOptions) error
+		}
+
+		Expect(subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "a.txt", &bfss3.CopyOptions{
+			ACL:               "bucket-owner-full-control",
+			SSEKMSKeyID:       "arn:aws:kms:us-east-1:123456789012:key/new",
+			StorageClass:      s3.StorageClassStandardIa,
+			MetadataDirective: s3.MetadataDirectiveReplace,
+			ContentType:       "text/plain",
+			Metadata:          bfs.Metadata{"rotated_at": "2020-01-01"},
+			OverwriteExisting: true,
+		})).To(Succeed())
+
+		calls := mock.Calls("CopyObject")
+		Expect(calls).To(HaveLen(1))
+		input := calls[0].(*s3.CopyObjectInput)
+		Expect(input.CopySource).To(Equal(aws.String("/" + bucketName + "/x/a.txt")))
+		Expect(input.Key).To(Equal(aws.String("x/a.txt")))
+		Expect(input.ACL).To(Equal(aws.String("bucket-owner-full-control")))
+		Expect(input.ServerSideEncryption).To(Equal(aws.String(s3.ServerSideEncryptionAwsKms)))
+		Expect(input.SSEKMSKeyId).To(Equal(aws.String("arn:aws:kms:us-east-1:123456789012:key/new")))
+		Expect(input.StorageClass).To(Equal(aws.String(s3.StorageClassStandardIa)))
+		Expect(input.MetadataDirective).To(Equal(aws.String(s3.MetadataDirectiveReplace)))
+		Expect(input.ContentType).To(Equal(aws.String("text/plain")))
+		Expect(input.Metadata).To(Equal(map[string]*string{"Rotated-At": aws.String("2020-01-01")}))
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/plain"))
+		Expect(info.StorageClass).To(Equal(s3.StorageClassStandardIa))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Rotated-At": "2020-01-01"}))
+
+		// blank options fall back on bucket defaults
+		Expect(subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "b.txt", nil)).To(Succeed())
+		input = mock.Calls("CopyObject")[1].(*s3.CopyObjectInput)
+		Expect(input.ACL).To(Equal(aws.String(bfss3.DefaultACL)))
+		Expect(input.ServerSideEncryption).To(BeNil())
+		Expect(input.StorageClass).To(BeNil())
+		Expect(input.MetadataDirective).To(BeNil())
+
+		err = subject.(optionsCopier).CopyWithOptions(ctx, "missing.txt", "b.txt", nil)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should copy conditionally", func() {
+		type optionsCopier interface {
+			CopyWithOptions(context.Context, string, string, *bfss3.CopyOptions) error
+		}
+
+		err := subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "b.txt", &bfss3.CopyOptions{})
+		Expect(err).To(MatchError(bfs.ErrExists))
+		Expect(mock.Calls("CopyObject")).To(BeEmpty())
+
+		Expect(subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "f.txt", &bfss3.CopyOptions{})).To(Succeed())
+		Expect(mock.Calls("CopyObject")).To(HaveLen(1))
+		Expect(subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "b.txt", &bfss3.CopyOptions{OverwriteExisting: true})).To(Succeed())
+		Expect(mock.Calls("CopyObject")).To(HaveLen(2))
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "g.txt", &bfss3.CopyOptions{SourceETag: info.Version})).To(Succeed())
+		Expect(mock.Calls("CopyObject")[2].(*s3.CopyObjectInput).CopySourceIfMatch).To(Equal(aws.String(info.Version)))
+
+		err = subject.(optionsCopier).CopyWithOptions(ctx, "a.txt", "h.txt", &bfss3.CopyOptions{SourceETag: `"outdated"`})
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeTrue())
+		Expect(mock.Keys()).NotTo(ContainElement("x/h.txt"))
+
+		err = subject.(optionsCopier).CopyWithOptions(ctx, "missing.txt", "h.txt", &bfss3.CopyOptions{})
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+
+		// other operations do not report failed preconditions as conflicts
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "HeadObject" {
+				return awserr.NewRequestFailure(awserr.New("PreconditionFailed", "precondition failed", nil), http.StatusPreconditionFailed, "")
+			}
+			return nil
+		}
+		_, err = subject.Head(ctx, "a.txt")
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, bfs.ErrConflict)).To(BeFalse())
+	})
+
+	It("should replace metadata in place", func() {
+		type metadataReplacer interface {
+			ReplaceMetadata(context.Context, string, *bfs.WriteOptions) error
+		}
+
+		_, err := s3.New(mock.Session()).PutObject(&s3.PutObjectInput{
+			Bucket:               aws.String(bucketName),
+			Key:                  aws.String("x/arch.txt"),
+			Body:                 strings.NewReader("TESTDATA"),
+			StorageClass:         aws.String(s3.StorageClassStandardIa),
+			ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+			SSEKMSKeyId:          aws.String("arn:aws:kms:us-east-1:123456789012:key/old"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(subject.(metadataReplacer).ReplaceMetadata(ctx, "arch.txt", &bfs.WriteOptions{
+			ContentType: "text/plain",
+			Metadata:    bfs.Metadata{"reviewed": "yes"},
+		})).To(Succeed())
+
+		calls := mock.Calls("CopyObject")
+		Expect(calls).To(HaveLen(1))
+		input := calls[0].(*s3.CopyObjectInput)
+		Expect(input.CopySource).To(Equal(aws.String("/" + bucketName + "/x/arch.txt")))
+		Expect(input.Key).To(Equal(aws.String("x/arch.txt")))
+		Expect(input.MetadataDirective).To(Equal(aws.String(s3.MetadataDirectiveReplace)))
+		Expect(input.ContentType).To(Equal(aws.String("text/plain")))
+		Expect(input.Metadata).To(Equal(map[string]*string{"Reviewed": aws.String("yes")}))
+		Expect(input.StorageClass).To(Equal(aws.String(s3.StorageClassStandardIa)))
+		Expect(input.ServerSideEncryption).To(Equal(aws.String(s3.ServerSideEncryptionAwsKms)))
+		Expect(input.SSEKMSKeyId).To(Equal(aws.String("arn:aws:kms:us-east-1:123456789012:key/old")))
+
+		info, err := subject.Head(ctx, "arch.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/plain"))
+		Expect(info.StorageClass).To(Equal(s3.StorageClassStandardIa))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Reviewed": "yes"}))
+
+		r, err := subject.Open(ctx, "arch.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+
+		err = subject.(metadataReplacer).ReplaceMetadata(ctx, "missing.txt", nil)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should read heads with ranges", func() {
+		Expect(bfs.ReadHead(ctx, subject, "a.txt", 4)).To(Equal([]byte("TEST")))
+		Expect(bfs.ReadHead(ctx, subject, "a.txt", 100)).To(Equal([]byte("TESTDATA")))
+
+		calls := mock.Calls("GetObject")
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].(*s3.GetObjectInput).Range).To(Equal(aws.String("bytes=0-3")))
+		Expect(calls[1].(*s3.GetObjectInput).Range).To(Equal(aws.String("bytes=0-99")))
+		Expect(mock.Bodies()[0].Size()).To(Equal(int64(4)))
+
+		r, err := subject.(interface {
+			OpenRange(context.Context, string, int64, int64) (bfs.Reader, error)
+		}).OpenRange(ctx, "a.txt", 2, 4)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(r.(bfs.ReadCloserInfo).Size()).To(Equal(int64(8)))
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("STDA")))
+
+		for _, rng := range [][2]int64{{-2, 4}, {2, 0}, {2, -1}} {
+			_, err = subject.(interface {
+				OpenRange(context.Context, string, int64, int64) (bfs.Reader, error)
+			}).OpenRange(ctx, "a.txt", rng[0], rng[1])
+			Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue(), "%v", rng)
+		}
+		Expect(mock.Calls("GetObject")).To(HaveLen(3))
+
+		Expect(bfs.WriteObject(ctx, subject, "empty.txt", nil, nil)).To(Succeed())
+		Expect(bfs.ReadHead(ctx, subject, "empty.txt", 4)).To(BeEmpty())
+
+		_, err = bfs.ReadHead(ctx, subject, "missing.txt", 4)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should retry reads on not found", func() {
+		retrying, err := bfss3.New(bucketName, &bfss3.Config{
+			Prefix:                "x/",
+			Session:               mock.Session(),
+			ReadAfterWriteRetries: 2,
+			ReadAfterWriteDelay:   time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// fail the first attempt of each operation
+		misses := make(map[string]bool)
+		mock.Intercept = func(op string, _ interface{}) error {
+			if (op == "HeadObject" || op == "GetObject") && !misses[op] {
+				misses[op] = true
+				return awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+			}
+			return nil
+		}
+
+		_, err = retrying.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mock.Calls("HeadObject")).To(HaveLen(2))
+
+		r, err := retrying.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+		Expect(r.Close()).To(Succeed())
+		Expect(mock.Calls("GetObject")).To(HaveLen(2))
+
+		delete(misses, "GetObject")
+		Expect(bfs.ReadHead(ctx, retrying, "a.txt", 4)).To(Equal([]byte("TEST")))
+		Expect(mock.Calls("GetObject")).To(HaveLen(4))
+
+		// retries are bounded
+		_, err = retrying.Head(ctx, "missing.txt")
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+		Expect(mock.Calls("HeadObject")).To(HaveLen(5))
+	})
+
+	It("should restore archived objects", func() {
+		_, err := s3.New(mock.Session()).PutObject(&s3.PutObjectInput{
+			Bucket:       aws.String(bucketName),
+			Key:          aws.String("x/archived.txt"),
+			Body:         strings.NewReader("TESTDATA"),
+			StorageClass: aws.String(s3.StorageClassGlacier),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = subject.Open(ctx, "archived.txt")
+		Expect(errors.Is(err, bfs.ErrNotReady)).To(BeTrue())
+
+		restorer := subject.(interface {
+			Restore(context.Context, string, int, string) error
+		})
+		Expect(restorer.Restore(ctx, "archived.txt", 3, s3.TierBulk)).To(Succeed())
+		Expect(restorer.Restore(ctx, "archived.txt", 3, s3.TierBulk)).To(Succeed())
+		Expect(restorer.Restore(ctx, "missing.txt", 3, "")).To(MatchError(bfs.ErrNotFound))
+
+		calls := mock.Calls("RestoreObject")
+		Expect(calls).To(HaveLen(3))
+		Expect(calls[0].(*s3.RestoreObjectInput).RestoreRequest).To(Equal(&s3.RestoreRequest{
+			Days:                 aws.Int64(3),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String("Bulk")},
+		}))
+
+		info, err := subject.Head(ctx, "archived.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.StorageClass).To(Equal("GLACIER"))
+		Expect(info.Restoring).To(BeTrue())
+		Expect(info.Extra).To(Equal(map[string]string{"x-amz-restore": `ongoing-request="true"`}))
+
+		_, err = subject.Open(ctx, "archived.txt")
+		Expect(errors.Is(err, bfs.ErrNotReady)).To(BeTrue())
+
+		expiry := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+		mock.Restored("x/archived.txt", expiry)
+
+		info, err = subject.Head(ctx, "archived.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Restoring).To(BeFalse())
+		Expect(info.RestoredUntil).To(Equal(expiry))
+		Expect(info.Extra).To(HaveKeyWithValue("x-amz-restore", `ongoing-request="false", expiry-date="Wed, 02 Jan 2030 00:00:00 GMT"`))
+
+		rc, err := subject.Open(ctx, "archived.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rc.Close()).To(Succeed())
+	})
+
+	It("should report archive tiers", func() {
+		_, err := s3.New(mock.Session()).PutObject(&s3.PutObjectInput{
+			Bucket:       aws.String(bucketName),
+			Key:          aws.String("x/tiered.txt"),
+			Body:         strings.NewReader("TESTDATA"),
+			StorageClass: aws.String(s3.StorageClassIntelligentTiering),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := subject.Head(ctx, "tiered.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.StorageClass).To(Equal(s3.StorageClassIntelligentTiering))
+		Expect(info.Extra).To(BeNil())
+
+		mock.ArchiveStatus("x/tiered.txt", "DEEP_ARCHIVE_ACCESS")
+		info, err = subject.Head(ctx, "tiered.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Extra).To(Equal(map[string]string{"x-amz-archive-status": "DEEP_ARCHIVE_ACCESS"}))
+	})
+
+	It("should validate metadata", func() {
+		_, err := subject.Create(ctx, "meta.txt", &bfs.WriteOptions{
+			Metadata: bfs.Metadata{"Large": strings.Repeat("x", bfss3.MaxMetadataSize)},
+		})
+		Expect(errors.Is(err, bfs.ErrMetadataTooLarge)).To(BeTrue())
+
+		_, err = subject.Create(ctx, "meta.txt", &bfs.WriteOptions{
+			Metadata: bfs.Metadata{"Ключ": "value"},
+		})
+		Expect(errors.Is(err, bfs.ErrInvalidMetadata)).To(BeTrue())
+		Expect(mock.Calls("PutObject")).To(HaveLen(4)) // from BeforeEach
+	})
+
+	It("should apply object lock retention", func() {
+		retainUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+		Expect(bfs.WriteObject(ctx, subject, "locked.txt", []byte("TESTDATA"), &bfs.WriteOptions{
+			LockMode:    s3.ObjectLockModeCompliance,
+			RetainUntil: retainUntil,
+		})).To(Succeed())
+
+		calls := mock.Calls("PutObject")
+		input := calls[len(calls)-1].(*s3.PutObjectInput)
+		Expect(input.ObjectLockMode).To(Equal(aws.String("COMPLIANCE")))
+		Expect(input.ObjectLockRetainUntilDate).To(Equal(aws.Time(retainUntil)))
+
+		info, err := subject.Head(ctx, "locked.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.LockMode).To(Equal("COMPLIANCE"))
+		Expect(info.RetainUntil).To(Equal(retainUntil))
+	})
+
+	It("should return access denied errors", func() {
+		forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+		mock.Intercept = func(_ string, _ interface{}) error { return forbidden }
+
+		_, err := subject.Head(ctx, "a.txt")
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+		Expect(errors.Unwrap(err)).To(Equal(forbidden))
+
+		_, err = subject.Open(ctx, "a.txt")
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+
+		err = bfs.WriteObject(ctx, subject, "z.txt", []byte("TESTDATA"), nil)
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+	})
+
+	It("should ping buckets", func() {
+		Expect(bfs.Ping(ctx, subject)).To(Succeed())
+		Expect(mock.Calls("HeadBucket")).To(HaveLen(1))
+		Expect(mock.Calls("HeadBucket")[0].(*s3.HeadBucketInput).Bucket).To(Equal(aws.String(bucketName)))
+
+		notFound := awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+		mock.Intercept = func(_ string, _ interface{}) error { return notFound }
+		err := bfs.Ping(ctx, subject)
+		Expect(err).To(MatchError(ContainSubstring(`bfss3: unable to reach bucket "` + bucketName + `"`)))
+		Expect(errors.Unwrap(err)).To(Equal(notFound))
+
+		forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+		mock.Intercept = func(_ string, _ interface{}) error { return forbidden }
+		Expect(errors.Is(bfs.Ping(ctx, subject), bfs.ErrAccessDenied)).To(BeTrue())
+	})
+
+	It("should sign URLs", func() {
+		type signer interface {
+			SignedURL(string, string, time.Duration) (string, error)
+		}
+
+		defer internal.SetClock(func() time.Time { return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC) })()
+
+		cdn, err := bfss3.New(bucketName, &bfss3.Config{
+			Prefix:      "x/",
+			Session:     mock.Session(),
+			CDNEndpoint: "cdn.example.com",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		get, err := cdn.(signer).SignedURL("a.txt", http.MethodGet, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		u, err := url.Parse(get)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Scheme).To(Equal("https"))
+		Expect(u.Host).To(Equal("cdn.example.com"))
+		Expect(u.Path).To(Equal("/x/a.txt"))
+		Expect(u.Query().Get("X-Amz-Date")).To(Equal("20200102T030405Z"))
+		Expect(u.Query().Get("X-Amz-Expires")).To(Equal("3600"))
+		Expect(u.Query().Get("X-Amz-Signature")).NotTo(BeEmpty())
+
+		put, err := cdn.(signer).SignedURL("a.txt", http.MethodPut, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		u, err = url.Parse(put)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Host).To(Equal(bucketName + ".s3.amazonaws.com"))
+		Expect(u.Path).To(Equal("/x/a.txt"))
+
+		get, err = subject.(signer).SignedURL("a.txt", http.MethodGet, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get).To(HavePrefix("https://" + bucketName + ".s3.amazonaws.com/x/a.txt?"))
+
+		_, err = subject.(signer).SignedURL("a.txt", http.MethodDelete, time.Hour)
+		Expect(err).To(MatchError(`bfss3: unsupported signed URL method "DELETE"`))
+
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), CDNEndpoint: "https://"})
+		Expect(err).To(MatchError(`bfss3: invalid CDN endpoint "https://"`))
+	})
+
+	It("should upload local files", func() {
+		type uploader interface {
+			UploadFile(context.Context, string, string, *bfs.WriteOptions) error
+		}
+
+		dir, err := ioutil.TempDir("", "bfss3")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		data := make([]byte, 6*1024*1024+123) // exceeds the default part size
+		_, err = rand.Read(data)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, size := range []int{123, len(data)} {
+			Expect(ioutil.WriteFile(filepath.Join(dir, "src.bin"), data[:size], 0600)).To(Succeed())
+			Expect(subject.(uploader).UploadFile(ctx, "dst.bin", filepath.Join(dir, "src.bin"), &bfs.WriteOptions{
+				ContentType: "application/octet-stream",
+			})).To(Succeed())
+
+			r, err := subject.Open(ctx, "dst.bin")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadAll(r)).To(Equal(data[:size]))
+			Expect(r.Close()).To(Succeed())
+		}
+		Expect(mock.Calls("PutObject")).To(HaveLen(5)) // 4 seeds + 1 small upload
+		Expect(mock.Calls("CompleteMultipartUpload")).To(HaveLen(1))
+
+		err = subject.(uploader).UploadFile(ctx, "dst.bin", filepath.Join(dir, "missing.bin"), nil)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should assemble out-of-order writes", func() {
+		type atCreator interface {
+			CreateAt(context.Context, string, *bfs.WriteOptions) (bfss3.WriterAt, error)
+		}
+
+		w, err := subject.(atCreator).CreateAt(ctx, "ranges.txt", &bfs.WriteOptions{ContentType: "text/plain"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.WriteAt([]byte("CCC"), 8)).To(Equal(3))
+		Expect(w.WriteAt([]byte("AAAA"), 0)).To(Equal(4))
+		Expect(w.WriteAt([]byte("BBBB"), 4)).To(Equal(4))
+		Expect(w.Commit()).To(Succeed())
+
+		_, err = w.WriteAt([]byte("X"), 0)
+		Expect(err).To(MatchError("bfss3: writer is closed"))
+		Expect(w.Commit()).To(MatchError(context.Canceled))
+
+		r, err := subject.Open(ctx, "ranges.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("AAAABBBBCCC")))
+		Expect(r.Close()).To(Succeed())
+
+		info, err := subject.Head(ctx, "ranges.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("text/plain"))
+
+		w, err = subject.(atCreator).CreateAt(ctx, "discarded.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.WriteAt([]byte("DATA"), 2)).To(Equal(4))
+		Expect(w.Discard()).To(Succeed())
+		Expect(mock.Keys()).NotTo(ContainElement("x/discarded.txt"))
+	})
+
+	It("should sanitize names", func() {
+		sanitized, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session(), SanitizeNames: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(bfs.WriteObject(ctx, sanitized, "/f.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(mock.Keys()).To(ContainElement("x/f.txt"))
+
+		info, err := sanitized.Head(ctx, "/f.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("f.txt"))
+
+		for _, name := range []string{"", "../a.txt", "c/../a.txt", "a\nb.txt"} {
+			_, err := sanitized.Head(ctx, name)
+			Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue(), "for %q", name)
+
+			_, err = sanitized.Create(ctx, name, nil)
+			Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue(), "for %q", name)
+
+			err = sanitized.Remove(ctx, name)
+			Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue(), "for %q", name)
+		}
+		Expect(mock.Calls("HeadObject")).To(HaveLen(1))
+	})
+
+	Describe("CopyTree", func() {
+		type treeCopier interface {
+			CopyTree(ctx context.Context, srcPrefix, dstPrefix string, concurrency int) error
+		}
+
+		BeforeEach(func() {
+			Expect(bfs.WriteObject(ctx, subject, "c/f/g.txt", []byte("TESTDATA"), nil)).To(Succeed())
+			Expect(bfs.WriteObject(ctx, subject, "cc.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		})
+
+		It("should copy all objects below a prefix", func() {
+			Expect(subject.(treeCopier).CopyTree(ctx, "c", "z/y", 4)).To(Succeed())
+			Expect(mock.Keys()).To(Equal([]string{
+				"x/a.txt", "x/b.txt", "x/c/d.txt", "x/c/f/g.txt", "x/cc.txt", "x/e.txt",
+				"x/z/y/d.txt", "x/z/y/f/g.txt",
+			}))
+			Expect(mock.Calls("UploadPartCopy")).To(BeEmpty())
+		})
+
+		It("should fall back on multipart copy for large objects", func() {
+			defer bfss3.SetCopyLimits(4, 3)()
+
+			Expect(subject.(treeCopier).CopyTree(ctx, "c/", "z", 1)).To(Succeed())
+			Expect(mock.Calls("CopyObject")).To(BeEmpty())
+			Expect(mock.Calls("UploadPartCopy")).To(HaveLen(6))
+
+			rc, err := subject.Open(ctx, "z/f/g.txt")
+			Expect(err).NotTo(HaveOccurred())
+			defer rc.Close()
+
+			data, err := ioutil.ReadAll(rc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal("TESTDATA"))
+		})
+
+		It("should aggregate errors", func() {
+			forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+			mock.Intercept = func(op string, input interface{}) error {
+				if op == "CopyObject" && strings.HasSuffix(*input.(*s3.CopyObjectInput).CopySource, "/g.txt") {
+					return forbidden
+				}
+				return nil
+			}
+
+			err := subject.(treeCopier).CopyTree(ctx, "c", "z", 2)
+			Expect(err).To(BeAssignableToTypeOf(bfs.BatchError{}))
+			Expect(err.(bfs.BatchError)).To(HaveLen(1))
+			Expect(errors.Is(err.(bfs.BatchError)["c/f/g.txt"], bfs.ErrAccessDenied)).To(BeTrue())
+			Expect(mock.Keys()).To(ContainElement("x/z/d.txt"))
+		})
+	})
+})
+
+var _ = Describe("Config", func() {
+	transport := func(cfg *bfss3.Config) *http.Transport {
+		b, err := bfss3.New(bucketName, cfg)
+		Expect(err).NotTo(HaveOccurred())
+		return bfss3.SessionOf(b).Config.HTTPClient.Transport.(*http.Transport)
+	}
+
+	It("should disable compression by default", func() {
+		Expect(transport(&bfss3.Config{AWS: awsConfig}).DisableCompression).To(BeTrue())
+		Expect(transport(&bfss3.Config{AWS: awsConfig, DisableCompression: aws.Bool(true)}).DisableCompression).To(BeTrue())
+	})
+
+	It("should allow to enable compression", func() {
+		b, err := bfss3.New(bucketName, &bfss3.Config{AWS: awsConfig, DisableCompression: aws.Bool(false)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b).Config.HTTPClient).To(BeIdenticalTo(http.DefaultClient))
+	})
+
+	It("should require a region", func() {
+		mock := faketest.New()
+		_, err := bfss3.New(bucketName, &bfss3.Config{Session: mock.SessionWithRegion("")})
+		Expect(err).To(MatchError("bfss3: region not set, please configure AWS.Region, AWS_REGION or enable AutoRegion"))
+		Expect(mock.Calls("HeadBucket")).To(BeEmpty())
+	})
+
+	It("should detect regions", func() {
+		mock := faketest.New()
+		mock.BucketRegion = "eu-west-2"
+
+		b, err := bfss3.New(bucketName, &bfss3.Config{Session: mock.SessionWithRegion(""), AutoRegion: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b).Config.Region).To(Equal(aws.String("eu-west-2")))
+		Expect(mock.Calls("HeadBucket")).To(HaveLen(1))
+
+		// configured regions take precedence
+		b, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), AutoRegion: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b).Config.Region).To(Equal(aws.String("us-east-1")))
+		Expect(mock.Calls("HeadBucket")).To(HaveLen(1))
+
+		mock.BucketRegion = ""
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "HeadBucket" {
+				return awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+			}
+			return nil
+		}
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.SessionWithRegion(""), AutoRegion: true})
+		Expect(err).To(MatchError(ContainSubstring("bfss3: unable to detect region of bucket")))
+	})
+
+	It("should support transfer acceleration", func() {
+		b, err := bfss3.New(bucketName, &bfss3.Config{AWS: aws.Config{Region: aws.String("us-east-1")}, UseAccelerateEndpoint: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b).Config.S3UseAccelerate).To(Equal(aws.Bool(true)))
+
+		b, err = bfss3.New(bucketName, &bfss3.Config{AWS: aws.Config{Region: aws.String("us-east-1")}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(aws.BoolValue(bfss3.SessionOf(b).Config.S3UseAccelerate)).To(BeFalse())
+
+		// custom sessions are copied
+		sess := faketest.New().Session()
+		b, err = bfss3.New(bucketName, &bfss3.Config{Session: sess, UseAccelerateEndpoint: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b).Config.S3UseAccelerate).To(Equal(aws.Bool(true)))
+		Expect(sess.Config.S3UseAccelerate).To(BeNil())
+	})
+
+	It("should reject transfer acceleration with custom endpoints", func() {
+		_, err := bfss3.New(bucketName, &bfss3.Config{
+			AWS:                   aws.Config{Region: aws.String("us-east-1"), Endpoint: aws.String("http://localhost:9000")},
+			UseAccelerateEndpoint: true,
+		})
+		Expect(err).To(MatchError("bfss3: UseAccelerateEndpoint cannot be combined with a custom endpoint"))
+	})
+
+	It("should not override custom clients or sessions", func() {
+		client := &http.Client{Transport: &http.Transport{}}
+		Expect(transport(&bfss3.Config{AWS: aws.Config{Region: aws.String("us-east-1"), HTTPClient: client}}).DisableCompression).To(BeFalse())
+
+		sess := faketest.New().Session()
+		b, err := bfss3.New(bucketName, &bfss3.Config{Session: sess})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bfss3.SessionOf(b)).To(BeIdenticalTo(sess))
+	})
+})
+
 // ------------------------------------------------------------------------
 
+var sandboxErr error
+
 func TestSuite(t *testing.T) {
-	if err := sandboxCheck(); err != nil {
-		t.Skipf("skipping test, no sandbox access: %v", err)
-		return
-	}
+	sandboxErr = sandboxCheck()
 
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "bfs/bfss3")
@@ -69,6 +1154,10 @@ func sandboxCheck() error {
 }
 
 var _ = AfterSuite(func() {
+	if sandboxErr != nil {
+		return
+	}
+
 	ctx := context.Background()
 	b, err := bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", AWS: awsConfig})
 	Expect(err).NotTo(HaveOccurred())
@@ -83,3 +1172,10 @@ var _ = AfterSuite(func() {
 	}
 	Expect(it.Error()).NotTo(HaveOccurred())
 })
+
+func strPresence(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
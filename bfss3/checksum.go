@@ -0,0 +1,88 @@
+package bfss3
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// checksums holds the additional checksums of an upload, only the one
+// matching the requested algorithm is set.
+type checksums struct {
+	CRC32, CRC32C, SHA1, SHA256 *string
+}
+
+// checksumAlgorithm returns the normalized checksum algorithm of an upload
+// or nil, if none was requested.
+func checksumAlgorithm(algorithm string) (*string, error) {
+	if algorithm == "" {
+		return nil, nil
+	}
+
+	algorithm = strings.ToUpper(algorithm)
+	for _, s := range s3.ChecksumAlgorithm_Values() {
+		if s == algorithm {
+			return aws.String(algorithm), nil
+		}
+	}
+	return nil, fmt.Errorf("bfss3: unsupported checksum algorithm %q", algorithm)
+}
+
+// computeChecksums calculates the checksum of the remaining data in rs
+// according to algorithm and rewinds it afterwards. S3 verifies the
+// checksum on receipt and stores it with the object.
+func computeChecksums(algorithm *string, rs io.ReadSeeker) (checksums, error) {
+	var sums checksums
+	var h hash.Hash
+	var dst **string
+
+	switch aws.StringValue(algorithm) {
+	case s3.ChecksumAlgorithmCrc32:
+		h, dst = crc32.NewIEEE(), &sums.CRC32
+	case s3.ChecksumAlgorithmCrc32c:
+		h, dst = crc32.New(crc32.MakeTable(crc32.Castagnoli)), &sums.CRC32C
+	case s3.ChecksumAlgorithmSha1:
+		h, dst = sha1.New(), &sums.SHA1
+	case s3.ChecksumAlgorithmSha256:
+		h, dst = sha256.New(), &sums.SHA256
+	default:
+		return sums, nil
+	}
+
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return sums, err
+	}
+	if _, err := io.Copy(h, rs); err != nil {
+		return sums, err
+	}
+	if _, err := rs.Seek(pos, io.SeekStart); err != nil {
+		return sums, err
+	}
+
+	*dst = aws.String(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	return sums, nil
+}
+
+// headChecksums extracts the additional checksums from a HeadObject
+// response into extra.
+func headChecksums(resp *s3.HeadObjectOutput, extra map[string]string) {
+	for key, value := range map[string]*string{
+		"x-amz-checksum-crc32":  resp.ChecksumCRC32,
+		"x-amz-checksum-crc32c": resp.ChecksumCRC32C,
+		"x-amz-checksum-sha1":   resp.ChecksumSHA1,
+		"x-amz-checksum-sha256": resp.ChecksumSHA256,
+	} {
+		if s := aws.StringValue(value); s != "" {
+			extra[key] = s
+		}
+	}
+}
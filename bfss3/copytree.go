@@ -0,0 +1,188 @@
+package bfss3
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/bsm/bfs"
+)
+
+// maxCopyObjectSize is the maximum size of objects which
+// can be copied in a single CopyObject operation.
+var maxCopyObjectSize int64 = 5 * 1024 * 1024 * 1024
+
+// maxPutObjectSize is the maximum size of objects which
+// can be uploaded in a single PutObject operation.
+const maxPutObjectSize int64 = 5 * 1024 * 1024 * 1024
+
+// minCopyPartSize is the minimum part size for multipart copies.
+var minCopyPartSize int64 = 512 * 1024 * 1024
+
+// CopyTree copies all objects below srcPrefix to dstPrefix, using server-side
+// copies. Up to concurrency objects are copied in parallel. Objects which
+// exceed the CopyObject size limit are copied via multipart copy.
+//
+// A bfs.BatchError is returned if one or more objects failed to copy.
+func (b *bucket) CopyTree(ctx context.Context, srcPrefix, dstPrefix string, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	srcPrefix = strings.Trim(srcPrefix, "/")
+	dstPrefix = strings.Trim(dstPrefix, "/")
+
+	listPrefix := b.config.Prefix
+	if srcPrefix != "" && b.config.NameTransform == nil {
+		listPrefix = b.withPrefix(srcPrefix) + "/"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := make(chan *s3.Object)
+	failed := make(bfs.BatchError)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for obj := range objects {
+				srcKey := aws.StringValue(obj.Key)
+				name := b.stripPrefix(srcKey)
+				if srcPrefix != "" {
+					if !strings.HasPrefix(name, srcPrefix+"/") {
+						continue
+					}
+					name = strings.TrimPrefix(name, srcPrefix+"/")
+				}
+				dstKey := b.withPrefix(path.Join(dstPrefix, name))
+
+				if err := b.copyTreeObject(ctx, srcKey, dstKey, aws.Int64Value(obj.Size)); err != nil {
+					mu.Lock()
+					failed[b.stripPrefix(srcKey)] = normError(err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	err := b.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(listPrefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			select {
+			case objects <- obj:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	})
+	close(objects)
+	wg.Wait()
+
+	if err != nil {
+		return normError(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+func (b *bucket) copyTreeObject(ctx context.Context, srcKey, dstKey string, size int64) error {
+	if size <= maxCopyObjectSize {
+		return b.copyObject(ctx, srcKey, dstKey)
+	}
+	return b.copyMultipart(ctx, srcKey, dstKey, size)
+}
+
+// copyMultipart copies large objects using UploadPartCopy.
+func (b *bucket) copyMultipart(ctx context.Context, srcKey, dstKey string, size int64) error {
+	head, err := b.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	upload, err := b.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:                  aws.String(b.bucket),
+		Key:                     aws.String(dstKey),
+		ContentType:             head.ContentType,
+		Metadata:                head.Metadata,
+		CacheControl:            head.CacheControl,
+		ContentEncoding:         head.ContentEncoding,
+		ContentDisposition:      head.ContentDisposition,
+		ContentLanguage:         head.ContentLanguage,
+		ACL:                     strPresence(b.config.ACL),
+		GrantFullControl:        strPresence(b.config.GrantFullControl),
+		ServerSideEncryption:    strPresence(b.config.SSE),
+		SSEKMSEncryptionContext: b.sseContext,
+	})
+	if err != nil {
+		return err
+	}
+
+	parts, err := b.uploadPartCopies(ctx, srcKey, dstKey, upload.UploadId, size)
+	if err == nil {
+		err = b.completeMultipartUpload(ctx, dstKey, upload.UploadId, parts)
+	}
+	if err != nil {
+		_, _ = b.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(b.bucket),
+			Key:      aws.String(dstKey),
+			UploadId: upload.UploadId,
+		})
+		return err
+	}
+	return nil
+}
+
+func (b *bucket) uploadPartCopies(ctx context.Context, srcKey, dstKey string, uploadID *string, size int64) ([]*s3.CompletedPart, error) {
+	partSize := minCopyPartSize
+	if n := (size + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts; n > partSize {
+		partSize = n
+	}
+
+	var parts []*s3.CompletedPart
+	for offset := int64(0); offset < size; offset += partSize {
+		end := offset + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		partNumber := aws.Int64(int64(len(parts) + 1))
+		resp, err := b.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(b.bucket),
+			Key:             aws.String(dstKey),
+			CopySource:      aws.String(path.Join("/", b.bucket, srcKey)),
+			CopySourceRange: aws.String("bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(end, 10)),
+			UploadId:        uploadID,
+			PartNumber:      partNumber,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, &s3.CompletedPart{
+			ETag:       resp.CopyPartResult.ETag,
+			PartNumber: partNumber,
+		})
+	}
+	return parts, nil
+}
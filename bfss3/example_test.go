@@ -0,0 +1,46 @@
+package bfss3_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+)
+
+func Example_nativeClient() {
+	ctx := context.Background()
+	bucket, err := bfss3.New("my-bucket", &bfss3.Config{Prefix: "reports/"})
+	if err != nil {
+		panic(err)
+	}
+	defer bucket.Close()
+
+	// access the native client via type assertion
+	client := bucket.(interface{ S3() s3iface.S3API }).S3()
+
+	// the prefix must be applied manually
+	info, _ := bfs.Describe(bucket)
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(info.Bucket),
+		Key:    aws.String(info.Prefix + "2020/summary.pdf"),
+	})
+	url, err := req.Presign(15 * time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("URL:", url)
+
+	// fetch the lifecycle configuration
+	lifecycle, err := client.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(info.Bucket),
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("RULES:", len(lifecycle.Rules))
+}
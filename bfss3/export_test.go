@@ -0,0 +1,29 @@
+package bfss3
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/bsm/bfs"
+)
+
+// SetCopyLimits overrides multipart copy limits for testing and
+// returns a func to restore the defaults.
+func SetCopyLimits(maxObjectSize, minPartSize int64) func() {
+	prevMax, prevMin := maxCopyObjectSize, minCopyPartSize
+	maxCopyObjectSize, minCopyPartSize = maxObjectSize, minPartSize
+	return func() { maxCopyObjectSize, minCopyPartSize = prevMax, prevMin }
+}
+
+// SetCompleteBackoff overrides the initial backoff of multipart completion
+// retries for testing and returns a func to restore the default.
+func SetCompleteBackoff(d time.Duration) func() {
+	prev := completeBackoff
+	completeBackoff = d
+	return func() { completeBackoff = prev }
+}
+
+// SessionOf returns the session of a bucket.
+func SessionOf(b bfs.Bucket) *session.Session {
+	return b.(*bucket).config.Session
+}
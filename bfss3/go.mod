@@ -3,10 +3,9 @@ module github.com/bsm/bfs/bfss3
 go 1.14
 
 require (
-	github.com/aws/aws-sdk-go v1.29.34
+	github.com/aws/aws-sdk-go v1.44.100
 	github.com/bmatcuk/doublestar v1.2.2
 	github.com/bsm/bfs v0.9.0
-	github.com/jmespath/go-jmespath v0.3.0 // indirect
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
 )
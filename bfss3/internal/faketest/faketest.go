@@ -0,0 +1,614 @@
+// Package faketest provides an in-memory fake of the S3 API for tests. It
+// hooks into the request handlers of an AWS session, so clients created from
+// Session implement the full s3iface.S3API without touching the network.
+package faketest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// S3 is a minimal in-memory S3 emulation. It serves Get/Put/Head/Delete,
+// listing, copy and multipart requests and records all calls.
+type S3 struct {
+	objects map[string]*object
+	uploads map[string]*multipartUpload
+	calls   []Call
+	bodies  []*Body
+	mu      sync.Mutex
+
+	// Intercept is called before each request is served, a non-nil
+	// error is returned to the client instead.
+	Intercept func(op string, input interface{}) error
+
+	// BucketRegion is reported by HeadBucket requests.
+	BucketRegion string
+
+	// Truncate makes GetObject responses end after half of the content,
+	// while reporting the full content length.
+	Truncate bool
+
+	// Decompress emulates an HTTP transport with compression enabled, which
+	// transparently decodes gzip encoded GetObject responses and drops their
+	// Content-Length and Content-Encoding headers.
+	Decompress bool
+}
+
+// Owner and grantee IDs reported by GetObjectAcl.
+const (
+	OwnerID     = "79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be"
+	AllUsersURI = "http://acs.amazonaws.com/groups/global/AllUsers"
+)
+
+// Body is a GetObject response body, which records whether it was read
+// until EOF before it was closed.
+type Body struct {
+	*bytes.Reader
+	Drained, Closed bool
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF && !b.Closed {
+		b.Drained = true
+	}
+	return n, err
+}
+
+func (b *Body) Close() error {
+	b.Closed = true
+	return nil
+}
+
+// Bodies returns all GetObject response bodies.
+func (m *S3) Bodies() []*Body {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*Body(nil), m.bodies...)
+}
+
+// Call is a recorded request.
+type Call struct {
+	Op        string
+	Input     interface{}
+	UserAgent string
+}
+
+type object struct {
+	data         []byte
+	contentType  string
+	metadata     map[string]*string
+	headers      objectHeaders
+	acl          *string
+	lastModified time.Time
+	lockMode     *string
+	retainUntil  *time.Time
+	storageClass *string
+	restore      *string
+	tags         []*s3.Tag
+	sse          *string
+	sseKMSKeyID  *string
+	checksum     s3.Checksum
+
+	archiveStatus string
+}
+
+// Restored marks an archived object as restored until expiry.
+func (m *S3) Restored(key string, expiry time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if obj, ok := m.objects[key]; ok {
+		obj.restore = aws.String(`ongoing-request="false", expiry-date="` + expiry.UTC().Format(http.TimeFormat) + `"`)
+	}
+}
+
+// ArchiveStatus sets the archive access tier of an Intelligent-Tiering
+// object, e.g. "ARCHIVE_ACCESS", which is reported by HeadObject.
+func (m *S3) ArchiveStatus(key, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if obj, ok := m.objects[key]; ok {
+		obj.archiveStatus = status
+	}
+}
+
+func (o *object) archived() bool {
+	switch aws.StringValue(o.storageClass) {
+	case s3.StorageClassGlacier, s3.StorageClassDeepArchive:
+		return o.restore == nil || strings.Contains(*o.restore, `ongoing-request="true"`)
+	}
+	return false
+}
+
+type objectHeaders struct {
+	cacheControl       *string
+	contentEncoding    *string
+	contentDisposition *string
+	contentLanguage    *string
+}
+
+type multipartUpload struct {
+	key   string
+	input *s3.CreateMultipartUploadInput
+	parts map[int64][]byte
+}
+
+// New returns an empty fake.
+func New() *S3 {
+	return &S3{
+		objects: make(map[string]*object),
+		uploads: make(map[string]*multipartUpload),
+	}
+}
+
+// Session returns a session which is served by the fake.
+func (m *S3) Session() *session.Session {
+	return m.SessionWithRegion("us-east-1")
+}
+
+// SessionWithRegion returns a session with a custom region.
+func (m *S3) SessionWithRegion(region string) *session.Session {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	sess.Handlers.Send.Clear()
+	sess.Handlers.Send.PushBack(m.serve)
+	return sess
+}
+
+// Client returns an S3 client which is served by the fake.
+func (m *S3) Client() s3iface.S3API {
+	return s3.New(m.Session())
+}
+
+// Calls returns recorded inputs for an operation.
+func (m *S3) Calls(op string) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var inputs []interface{}
+	for _, c := range m.calls {
+		if c.Op == op {
+			inputs = append(inputs, c.Input)
+		}
+	}
+	return inputs
+}
+
+// UserAgents returns recorded User-Agent headers for an operation.
+func (m *S3) UserAgents(op string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var agents []string
+	for _, c := range m.calls {
+		if c.Op == op {
+			agents = append(agents, c.UserAgent)
+		}
+	}
+	return agents
+}
+
+// Keys returns the stored object keys.
+func (m *S3) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *S3) serve(r *request.Request) {
+	// the fake populates r.Data directly, skip unmarshaling
+	r.Handlers.UnmarshalMeta.Clear()
+	r.Handlers.ValidateResponse.Clear()
+	r.Handlers.Unmarshal.Clear()
+	r.Handlers.UnmarshalError.Clear()
+	r.HTTPResponse = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, Call{Op: r.Operation.Name, Input: r.Params, UserAgent: r.HTTPRequest.Header.Get("User-Agent")})
+	intercept := m.Intercept
+	m.mu.Unlock()
+
+	if err := r.Context().Err(); err != nil {
+		r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+		return
+	}
+
+	if intercept != nil {
+		if err := intercept(r.Operation.Name, r.Params); err != nil {
+			r.Error = err
+			return
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := r.Params.(*s3.HeadBucketInput); ok && m.BucketRegion != "" {
+		r.HTTPResponse.Header.Set("X-Amz-Bucket-Region", m.BucketRegion)
+	}
+
+	if err := m.handle(r.Params, r.Data); err != nil {
+		r.Error = err
+	}
+}
+
+func (m *S3) handle(input, output interface{}) error {
+	switch in := input.(type) {
+	case *s3.PutObjectInput:
+		data, err := readSeeker(in.Body)
+		if err != nil {
+			return err
+		}
+		m.objects[*in.Key] = &object{
+			data:         data,
+			contentType:  aws.StringValue(in.ContentType),
+			metadata:     in.Metadata,
+			headers:      objectHeaders{in.CacheControl, in.ContentEncoding, in.ContentDisposition, in.ContentLanguage},
+			acl:          in.ACL,
+			lastModified: time.Now(),
+			lockMode:     in.ObjectLockMode,
+			retainUntil:  in.ObjectLockRetainUntilDate,
+			storageClass: in.StorageClass,
+			sse:          in.ServerSideEncryption,
+			sseKMSKeyID:  in.SSEKMSKeyId,
+			tags:         parseTagging(in.Tagging),
+			checksum: s3.Checksum{
+				ChecksumCRC32:  in.ChecksumCRC32,
+				ChecksumCRC32C: in.ChecksumCRC32C,
+				ChecksumSHA1:   in.ChecksumSHA1,
+				ChecksumSHA256: in.ChecksumSHA256,
+			},
+		}
+		output.(*s3.PutObjectOutput).ETag = aws.String(etag(data))
+
+	case *s3.HeadObjectInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return notFound()
+		}
+		out := output.(*s3.HeadObjectOutput)
+		out.ContentLength = aws.Int64(int64(len(obj.data)))
+		out.ContentType = aws.String(obj.contentType)
+		out.ETag = aws.String(etag(obj.data))
+		out.LastModified = aws.Time(obj.lastModified)
+		out.Metadata = obj.metadata
+		out.CacheControl = obj.headers.cacheControl
+		out.ContentEncoding = obj.headers.contentEncoding
+		out.ContentDisposition = obj.headers.contentDisposition
+		out.ContentLanguage = obj.headers.contentLanguage
+		out.ObjectLockMode = obj.lockMode
+		out.ObjectLockRetainUntilDate = obj.retainUntil
+		out.StorageClass = obj.storageClass
+		out.Restore = obj.restore
+		if obj.archiveStatus != "" {
+			out.ArchiveStatus = aws.String(obj.archiveStatus)
+		}
+		out.ServerSideEncryption = obj.sse
+		out.SSEKMSKeyId = obj.sseKMSKeyID
+		if aws.StringValue(in.ChecksumMode) == s3.ChecksumModeEnabled {
+			out.ChecksumCRC32 = obj.checksum.ChecksumCRC32
+			out.ChecksumCRC32C = obj.checksum.ChecksumCRC32C
+			out.ChecksumSHA1 = obj.checksum.ChecksumSHA1
+			out.ChecksumSHA256 = obj.checksum.ChecksumSHA256
+		}
+
+	case *s3.GetObjectInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "not found", nil), http.StatusNotFound, "")
+		}
+		if obj.archived() {
+			return awserr.NewRequestFailure(awserr.New("InvalidObjectState", "object is archived", nil), http.StatusForbidden, "")
+		}
+		data := obj.data
+		out := output.(*s3.GetObjectOutput)
+		if rng := aws.StringValue(in.Range); rng != "" {
+			start, end := rangeBounds(data, rng)
+			if start >= int64(len(data)) {
+				return awserr.NewRequestFailure(awserr.New("InvalidRange", "range not satisfiable", nil), http.StatusRequestedRangeNotSatisfiable, "")
+			}
+			data = data[start : end+1]
+			out.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.data)))
+		}
+		out.ContentLength = aws.Int64(int64(len(data)))
+		out.ContentEncoding = obj.headers.contentEncoding
+		if m.Decompress && aws.StringValue(out.ContentEncoding) == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				return err
+			}
+			out.ContentLength = nil
+			out.ContentEncoding = nil
+		}
+		if m.Truncate {
+			data = data[:len(data)/2]
+		}
+		body := &Body{Reader: bytes.NewReader(data)}
+		m.bodies = append(m.bodies, body)
+		out.Body = body
+		out.ContentType = aws.String(obj.contentType)
+		out.ETag = aws.String(etag(obj.data))
+		out.LastModified = aws.Time(obj.lastModified)
+		out.Metadata = obj.metadata
+
+	case *s3.RestoreObjectInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return notFound()
+		}
+		if obj.restore != nil && strings.Contains(*obj.restore, `ongoing-request="true"`) {
+			return awserr.NewRequestFailure(awserr.New("RestoreAlreadyInProgress", "restore in progress", nil), http.StatusConflict, "")
+		}
+		obj.restore = aws.String(`ongoing-request="true"`)
+
+	case *s3.GetObjectAclInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return notFound()
+		}
+		out := output.(*s3.GetObjectAclOutput)
+		out.Owner = &s3.Owner{ID: aws.String(OwnerID)}
+		out.Grants = []*s3.Grant{{
+			Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String(OwnerID)},
+			Permission: aws.String(s3.PermissionFullControl),
+		}}
+		if aws.StringValue(obj.acl) == s3.ObjectCannedACLPublicRead {
+			out.Grants = append(out.Grants, &s3.Grant{
+				Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String(AllUsersURI)},
+				Permission: aws.String(s3.PermissionRead),
+			})
+		}
+
+	case *s3.DeleteObjectInput:
+		delete(m.objects, *in.Key)
+
+	case *s3.PutObjectTaggingInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return notFound()
+		}
+		obj.tags = in.Tagging.TagSet
+
+	case *s3.GetObjectTaggingInput:
+		obj, ok := m.objects[*in.Key]
+		if !ok {
+			return notFound()
+		}
+		output.(*s3.GetObjectTaggingOutput).TagSet = obj.tags
+
+	case *s3.CopyObjectInput:
+		src := strings.SplitN(strings.TrimPrefix(*in.CopySource, "/"), "/", 2)
+		obj, ok := m.objects[src[len(src)-1]]
+		if !ok {
+			return notFound()
+		}
+		if tag := aws.StringValue(in.CopySourceIfMatch); tag != "" && tag != etag(obj.data) {
+			return awserr.NewRequestFailure(awserr.New("PreconditionFailed", "precondition failed", nil), http.StatusPreconditionFailed, "")
+		}
+		cpy := *obj
+		cpy.lastModified = time.Now()
+		cpy.storageClass = in.StorageClass
+		cpy.sse, cpy.sseKMSKeyID = in.ServerSideEncryption, in.SSEKMSKeyId
+		if aws.StringValue(in.MetadataDirective) == s3.MetadataDirectiveReplace {
+			cpy.contentType = aws.StringValue(in.ContentType)
+			cpy.metadata = in.Metadata
+			cpy.headers = objectHeaders{in.CacheControl, in.ContentEncoding, in.ContentDisposition, in.ContentLanguage}
+		}
+		m.objects[*in.Key] = &cpy
+
+	case *s3.ListObjectsV2Input:
+		keys := make([]string, 0, len(m.objects))
+		for key := range m.objects {
+			if strings.HasPrefix(key, aws.StringValue(in.Prefix)) && key > aws.StringValue(in.StartAfter) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		offset, _ := strconv.Atoi(aws.StringValue(in.ContinuationToken))
+		keys = keys[offset:]
+
+		limit := int(aws.Int64Value(in.MaxKeys))
+		if limit <= 0 || limit > 1000 {
+			limit = 1000
+		}
+
+		out := output.(*s3.ListObjectsV2Output)
+		if len(keys) > limit {
+			keys = keys[:limit]
+			out.NextContinuationToken = aws.String(strconv.Itoa(offset + limit))
+		}
+		for _, key := range keys {
+			obj := m.objects[key]
+			out.Contents = append(out.Contents, &s3.Object{
+				Key:          aws.String(key),
+				Size:         aws.Int64(int64(len(obj.data))),
+				LastModified: aws.Time(obj.lastModified),
+				ETag:         aws.String(etag(obj.data)),
+			})
+		}
+		out.KeyCount = aws.Int64(int64(len(out.Contents)))
+
+	case *s3.CreateMultipartUploadInput:
+		id := strconv.Itoa(len(m.uploads) + 1)
+		m.uploads[id] = &multipartUpload{key: *in.Key, input: in, parts: make(map[int64][]byte)}
+		output.(*s3.CreateMultipartUploadOutput).UploadId = aws.String(id)
+
+	case *s3.UploadPartInput:
+		upload, ok := m.uploads[*in.UploadId]
+		if !ok {
+			return noSuchUpload()
+		}
+		data, err := readSeeker(in.Body)
+		if err != nil {
+			return err
+		}
+		upload.parts[*in.PartNumber] = data
+		out := output.(*s3.UploadPartOutput)
+		out.ETag = aws.String(etag(data))
+		out.ChecksumCRC32 = in.ChecksumCRC32
+		out.ChecksumCRC32C = in.ChecksumCRC32C
+		out.ChecksumSHA1 = in.ChecksumSHA1
+		out.ChecksumSHA256 = in.ChecksumSHA256
+
+	case *s3.UploadPartCopyInput:
+		upload, ok := m.uploads[*in.UploadId]
+		if !ok {
+			return noSuchUpload()
+		}
+		src := strings.SplitN(strings.TrimPrefix(*in.CopySource, "/"), "/", 2)
+		obj, ok := m.objects[src[len(src)-1]]
+		if !ok {
+			return notFound()
+		}
+		data := byteRange(obj.data, aws.StringValue(in.CopySourceRange))
+		upload.parts[*in.PartNumber] = data
+		output.(*s3.UploadPartCopyOutput).CopyPartResult = &s3.CopyPartResult{ETag: aws.String(etag(data))}
+
+	case *s3.CompleteMultipartUploadInput:
+		upload, ok := m.uploads[*in.UploadId]
+		if !ok {
+			return noSuchUpload()
+		}
+		var data []byte
+		for _, part := range in.MultipartUpload.Parts {
+			if !hasPartChecksum(upload.input.ChecksumAlgorithm, part) {
+				return awserr.NewRequestFailure(awserr.New("InvalidRequest", "the complete request must include the checksum for each part", nil), http.StatusBadRequest, "")
+			}
+			data = append(data, upload.parts[*part.PartNumber]...)
+		}
+		m.objects[upload.key] = &object{
+			data:         data,
+			contentType:  aws.StringValue(upload.input.ContentType),
+			metadata:     upload.input.Metadata,
+			headers:      objectHeaders{upload.input.CacheControl, upload.input.ContentEncoding, upload.input.ContentDisposition, upload.input.ContentLanguage},
+			lastModified: time.Now(),
+			lockMode:     upload.input.ObjectLockMode,
+			retainUntil:  upload.input.ObjectLockRetainUntilDate,
+			tags:         parseTagging(upload.input.Tagging),
+		}
+		delete(m.uploads, *in.UploadId)
+
+	case *s3.AbortMultipartUploadInput:
+		if _, ok := m.uploads[*in.UploadId]; !ok {
+			return noSuchUpload()
+		}
+		delete(m.uploads, *in.UploadId)
+	}
+	return nil
+}
+
+func readSeeker(rs io.ReadSeeker) ([]byte, error) {
+	if rs == nil {
+		return nil, nil
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(rs)
+}
+
+func byteRange(data []byte, rng string) []byte {
+	start, end := rangeBounds(data, rng)
+	if start > end {
+		return nil
+	}
+	return data[start : end+1]
+}
+
+func rangeBounds(data []byte, rng string) (start, end int64) {
+	parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+	start, _ = strconv.ParseInt(parts[0], 10, 64)
+	end = int64(len(data)) - 1
+	if len(parts) == 2 && parts[1] != "" {
+		end, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+	if end >= int64(len(data)) {
+		end = int64(len(data)) - 1
+	}
+	return start, end
+}
+
+// parseTagging parses the URL-encoded tagging of an upload.
+func parseTagging(tagging *string) []*s3.Tag {
+	values, _ := url.ParseQuery(aws.StringValue(tagging))
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tags []*s3.Tag
+	for _, key := range keys {
+		tags = append(tags, &s3.Tag{Key: aws.String(key), Value: aws.String(values.Get(key))})
+	}
+	return tags
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func notFound() error {
+	return awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+}
+
+// hasPartChecksum returns true if part carries a checksum of the algorithm
+// the upload was created with, as required by S3.
+func hasPartChecksum(algorithm *string, part *s3.CompletedPart) bool {
+	switch aws.StringValue(algorithm) {
+	case s3.ChecksumAlgorithmCrc32:
+		return part.ChecksumCRC32 != nil
+	case s3.ChecksumAlgorithmCrc32c:
+		return part.ChecksumCRC32C != nil
+	case s3.ChecksumAlgorithmSha1:
+		return part.ChecksumSHA1 != nil
+	case s3.ChecksumAlgorithmSha256:
+		return part.ChecksumSHA256 != nil
+	}
+	return true
+}
+
+func noSuchUpload() error {
+	return awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchUpload, "no such upload", nil), http.StatusNotFound, "")
+}
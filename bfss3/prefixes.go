@@ -0,0 +1,172 @@
+package bfss3
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/bfs"
+)
+
+// globPrefixesConcurrency limits the number of concurrent listings of
+// GlobPrefixes.
+const globPrefixesConcurrency = 4
+
+// GlobPrefixes lists the files matching a glob pattern, like Glob, but only
+// scans the given (literal) key prefixes, e.g. []string{"2024/01/",
+// "2024/02/"}. The prefixes are listed concurrently and objects are yielded
+// in lexicographic order. Prefixes which are contained in other prefixes are
+// ignored, so that objects are yielded only once.
+//
+// The pattern is matched against full names, objects below the prefixes
+// which don't match the pattern are skipped. Please always Close the iterator
+// to release resources.
+func (b *bucket) GlobPrefixes(ctx context.Context, prefixes []string, pattern string) (bfs.Iterator, error) {
+	if err := bfs.ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	iter := &prefixIterator{
+		cancel:  cancel,
+		results: make(chan chan prefixResult, globPrefixesConcurrency),
+		pos:     -1,
+	}
+
+	iter.wg.Add(1)
+	go func() {
+		defer iter.wg.Done()
+		defer close(iter.results)
+		iter.aborted = iter.dispatch(ctx, b, distinctPrefixes(prefixes), pattern)
+	}()
+	return iter, nil
+}
+
+// distinctPrefixes sorts prefixes and removes those which are contained in
+// others.
+func distinctPrefixes(prefixes []string) []string {
+	sorted := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		sorted = append(sorted, strings.TrimPrefix(prefix, "/"))
+	}
+	sort.Strings(sorted)
+
+	distinct := sorted[:0]
+	for _, prefix := range sorted {
+		if n := len(distinct); n == 0 || !strings.HasPrefix(prefix, distinct[n-1]) {
+			distinct = append(distinct, prefix)
+		}
+	}
+	return distinct
+}
+
+type prefixResult struct {
+	objects []object
+	err     error
+}
+
+// prefixIterator reads listings from an ordered queue of results.
+type prefixIterator struct {
+	cancel  context.CancelFunc
+	results chan chan prefixResult // ordered, bounded by concurrency
+	aborted error                  // set by the dispatcher before results are closed
+	wg      sync.WaitGroup
+
+	objects   []object
+	pos       int
+	err       error
+	closeOnce sync.Once
+}
+
+func (i *prefixIterator) dispatch(ctx context.Context, b *bucket, prefixes []string, pattern string) error {
+	for _, prefix := range prefixes {
+		res := make(chan prefixResult, 1)
+		select {
+		case i.results <- res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		i.wg.Add(1)
+		go func(prefix string) {
+			defer i.wg.Done()
+
+			objects, err := listPrefix(ctx, b, prefix, pattern)
+			res <- prefixResult{objects: objects, err: err}
+		}(prefix)
+	}
+	return nil
+}
+
+func listPrefix(ctx context.Context, b *bucket, prefix, pattern string) ([]object, error) {
+	iter := &iterator{
+		parent:  b,
+		ctx:     ctx,
+		pattern: pattern,
+		prefix:  prefix,
+	}
+
+	var objects []object
+	for iter.Next() {
+		objects = append(objects, iter.page[iter.pos])
+	}
+	return objects, iter.Error()
+}
+
+func (i *prefixIterator) Next() bool {
+	for i.pos++; i.pos >= len(i.objects); i.pos++ {
+		if i.err != nil {
+			return false
+		}
+
+		res, ok := <-i.results
+		if !ok {
+			i.err = i.aborted
+			return false
+		}
+
+		part := <-res
+		if part.err != nil {
+			i.objects, i.err = nil, part.err
+			return false
+		}
+		i.objects, i.pos = part.objects, -1
+	}
+	return true
+}
+
+func (i *prefixIterator) Name() string {
+	if i.pos >= 0 && i.pos < len(i.objects) {
+		return i.objects[i.pos].key
+	}
+	return ""
+}
+
+func (i *prefixIterator) Size() int64 {
+	if i.pos >= 0 && i.pos < len(i.objects) {
+		return i.objects[i.pos].size
+	}
+	return 0
+}
+
+func (i *prefixIterator) ModTime() time.Time {
+	if i.pos >= 0 && i.pos < len(i.objects) {
+		return i.objects[i.pos].modTime
+	}
+	return time.Time{}
+}
+
+func (i *prefixIterator) Error() error { return i.err }
+
+func (i *prefixIterator) Close() error {
+	i.closeOnce.Do(func() {
+		i.cancel()
+		for range i.results { // unblock the dispatcher
+		}
+		i.wg.Wait()
+		i.objects, i.pos = nil, 0
+	})
+	return nil
+}
@@ -0,0 +1,112 @@
+package bfss3_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GlobPrefixes", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	type prefixGlobber interface {
+		GlobPrefixes(context.Context, []string, string) (bfs.Iterator, error)
+	}
+
+	BeforeEach(func() {
+		var err error
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session(), PageSize: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{
+			"2023/12/a.json",
+			"2024/01/b.json",
+			"2024/01/c.csv",
+			"2024/01/d/e.json",
+			"2024/02/f.json",
+			"2024/03/g.json",
+		} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte("TESTDATA"), nil)).To(Succeed())
+		}
+	})
+
+	globNames := func(prefixes []string, pattern string) ([]string, error) {
+		iter, err := subject.(prefixGlobber).GlobPrefixes(ctx, prefixes, pattern)
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		return names, iter.Error()
+	}
+
+	listedPrefixes := func() []string {
+		var prefixes []string
+		for _, call := range mock.Calls("ListObjectsV2") {
+			prefixes = append(prefixes, aws.StringValue(call.(*s3.ListObjectsV2Input).Prefix))
+		}
+		return prefixes
+	}
+
+	It("should list multiple prefixes", func() {
+		Expect(globNames([]string{"2024/02/", "2024/01/"}, "**")).To(Equal([]string{
+			"2024/01/b.json",
+			"2024/01/c.csv",
+			"2024/01/d/e.json",
+			"2024/02/f.json",
+		}))
+		// 2024/01/ spans two pages
+		Expect(listedPrefixes()).To(ConsistOf("x/2024/01/", "x/2024/01/", "x/2024/02/"))
+	})
+
+	It("should filter by pattern", func() {
+		Expect(globNames([]string{"2024/01/", "2024/03/"}, "*/*/*.json")).To(Equal([]string{
+			"2024/01/b.json",
+			"2024/03/g.json",
+		}))
+	})
+
+	It("should skip nested prefixes", func() {
+		Expect(globNames([]string{"2024/01/d/", "2024/", "2024/01/"}, "**/*.json")).To(Equal([]string{
+			"2024/01/b.json",
+			"2024/01/d/e.json",
+			"2024/02/f.json",
+			"2024/03/g.json",
+		}))
+		Expect(listedPrefixes()).To(ConsistOf("x/2024/", "x/2024/", "x/2024/"))
+	})
+
+	It("should handle empty prefixes", func() {
+		Expect(globNames(nil, "**")).To(BeEmpty())
+		Expect(mock.Calls("ListObjectsV2")).To(BeEmpty())
+	})
+
+	It("should report errors", func() {
+		forbidden := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+		mock.Intercept = func(op string, input interface{}) error {
+			if op == "ListObjectsV2" && aws.StringValue(input.(*s3.ListObjectsV2Input).Prefix) == "x/2024/02/" {
+				return forbidden
+			}
+			return nil
+		}
+
+		names, err := globNames([]string{"2024/01/", "2024/02/", "2024/03/"}, "**")
+		Expect(errors.Is(err, forbidden)).To(BeTrue())
+		Expect(names).To(Equal([]string{"2024/01/b.json", "2024/01/c.csv", "2024/01/d/e.json"}))
+	})
+})
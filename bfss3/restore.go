@@ -0,0 +1,60 @@
+package bfss3
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Restore initiates the restore of an archived object, e.g. from
+// the GLACIER or DEEP_ARCHIVE storage classes. The restored copy is
+// available for the given number of days. The optional tier specifies the
+// retrieval speed, i.e. one of s3.Tier* ("Standard", "Bulk", "Expedited").
+//
+// Restores are asynchronous. Until the restore has completed, Open returns
+// an error which satisfies errors.Is(err, bfs.ErrNotReady) and Head reports
+// MetaInfo.Restoring. Calling Restore while a restore is already in
+// progress is a no-op.
+func (b *bucket) Restore(ctx context.Context, name string, days int, tier string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	req := &s3.RestoreRequest{Days: aws.Int64(int64(days))}
+	if tier != "" {
+		req.GlacierJobParameters = &s3.GlacierJobParameters{Tier: aws.String(tier)}
+	}
+
+	_, err = b.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket:         aws.String(b.bucket),
+		Key:            aws.String(b.withPrefix(name)),
+		RestoreRequest: req,
+	})
+	if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() == http.StatusConflict && e.Code() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	return normError(err)
+}
+
+var (
+	restoreOngoingRx = regexp.MustCompile(`ongoing-request="(true|false)"`)
+	restoreExpiryRx  = regexp.MustCompile(`expiry-date="([^"]+)"`)
+)
+
+// parseRestore parses the x-amz-restore header, e.g.
+// `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`.
+func parseRestore(s string) (ongoing bool, expiry time.Time) {
+	if m := restoreOngoingRx.FindStringSubmatch(s); m != nil {
+		ongoing = m[1] == "true"
+	}
+	if m := restoreExpiryRx.FindStringSubmatch(s); m != nil {
+		expiry, _ = http.ParseTime(m[1])
+	}
+	return
+}
@@ -0,0 +1,69 @@
+package bfss3
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bsm/bfs/internal"
+)
+
+// SignedURL returns a presigned URL which grants temporary access to an
+// object without credentials. Supported methods are http.MethodGet and
+// http.MethodPut, URLs expire after expiry.
+//
+// If Config.CDNEndpoint is set, GET URLs point to the CDN instead of the
+// origin. Please note that the URL is still signed for the origin, the CDN
+// must forward requests to the origin unchanged.
+func (b *bucket) SignedURL(name, method string, expiry time.Duration) (string, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return "", err
+	}
+
+	var req *request.Request
+	switch method {
+	case http.MethodGet:
+		req, _ = b.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.withPrefix(name)),
+		})
+	case http.MethodPut:
+		req, _ = b.PutObjectRequest(&s3.PutObjectInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.withPrefix(name)),
+		})
+	default:
+		return "", fmt.Errorf("bfss3: unsupported signed URL method %q", method)
+	}
+	req.Handlers.Sign.Swap(v4.SignRequestHandler.Name, request.NamedHandler{
+		Name: v4.SignRequestHandler.Name,
+		Fn: func(r *request.Request) {
+			v4.SignSDKRequestWithCurrentTime(r, internal.Now)
+		},
+	})
+
+	signed, err := req.Presign(expiry)
+	if err != nil {
+		return "", err
+	}
+	if method != http.MethodGet || b.config.CDNEndpoint == "" {
+		return signed, nil
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		return "", err
+	}
+	cdn, err := url.Parse(b.config.CDNEndpoint)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme, u.Host = cdn.Scheme, cdn.Host
+	return u.String(), nil
+}
@@ -0,0 +1,323 @@
+package bfss3
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/bsm/bfs"
+)
+
+// StreamWriter is returned by Create when streaming is enabled. Content is
+// buffered in memory and uploaded in parts of Config.PartSize bytes as
+// soon as enough data is available, using S3 multipart upload semantics.
+//
+// Uploaded parts are not visible as an object until Commit is called. Once
+// a part fails to upload, all subsequent calls to Write, Flush and Commit
+// fail with the same error and Commit aborts the upload.
+type StreamWriter struct {
+	ctx    context.Context
+	bucket *bucket
+	name   string
+	opts   *bfs.WriteOptions
+
+	buf      bytes.Buffer
+	uploadID *string
+	parts    []*s3.CompletedPart
+	err      error // sticky upload error
+
+	mu        sync.Mutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+func newStreamWriter(ctx context.Context, b *bucket, name string, opts *bfs.WriteOptions) *StreamWriter {
+	return &StreamWriter{
+		ctx:    ctx,
+		bucket: b,
+		name:   name,
+		opts:   fixExpiry(opts),
+	}
+}
+
+// Write implements io.Writer.
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	_, _ = w.buf.Write(p)
+	for int64(w.buf.Len()) >= w.bucket.config.PartSize {
+		if err := w.flushPart(int(w.bucket.config.PartSize)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush uploads buffered data as a part, so it is stored remotely
+// and does not need to be retained in memory. Since S3 requires all but
+// the last part of an upload to be at least s3manager.MinUploadPartSize
+// bytes, smaller buffers are retained until the next Flush or Commit.
+//
+// Please note that flushed data is not readable until Commit is called.
+func (w *StreamWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if int64(w.buf.Len()) < s3manager.MinUploadPartSize {
+		return nil
+	}
+	return w.flushPart(w.buf.Len())
+}
+
+// Discard implements bfs.Writer. It aborts the multipart upload, if one
+// was initiated, so that already uploaded parts are removed.
+func (w *StreamWriter) Discard() error {
+	err := context.Canceled
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		w.closed = true
+		w.buf.Reset()
+		err = w.abort()
+	})
+	return err
+}
+
+// Commit implements bfs.Writer.
+func (w *StreamWriter) Commit() error {
+	err := context.Canceled
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		w.closed = true
+		defer func() {
+			if err != nil {
+				_ = w.abort()
+			}
+		}()
+
+		if err = w.err; err != nil {
+			return
+		}
+		if err = w.ctx.Err(); err != nil {
+			return
+		}
+
+		// upload as a single object if no parts were uploaded yet
+		if w.uploadID == nil {
+			lockMode, retainUntil := w.bucket.retention(w.opts)
+			expires, tagging := expiry(w.opts)
+			algorithm, _ := checksumAlgorithm(w.opts.GetChecksumAlgorithm())
+			body := bytes.NewReader(w.buf.Bytes())
+
+			var sums checksums
+			if sums, err = computeChecksums(algorithm, body); err != nil {
+				return
+			}
+
+			_, err = w.bucket.uploader.UploadWithContext(w.ctx, &s3manager.UploadInput{
+				Bucket:                    aws.String(w.bucket.bucket),
+				Key:                       aws.String(w.bucket.withPrefix(w.name)),
+				Body:                      body,
+				ContentType:               aws.String(w.bucket.contentType(w.name, w.opts)),
+				Metadata:                  aws.StringMap(w.opts.GetMetadata()),
+				CacheControl:              strPresence(w.opts.GetCacheControl()),
+				ContentEncoding:           strPresence(w.opts.GetContentEncoding()),
+				ContentDisposition:        strPresence(w.opts.GetContentDisposition()),
+				ContentLanguage:           strPresence(w.opts.GetContentLanguage()),
+				ACL:                       w.bucket.acl(w.opts),
+				GrantFullControl:          strPresence(w.bucket.config.GrantFullControl),
+				ServerSideEncryption:      strPresence(w.bucket.config.SSE),
+				SSEKMSEncryptionContext:   w.bucket.sseContext,
+				ObjectLockMode:            lockMode,
+				ObjectLockRetainUntilDate: retainUntil,
+				Expires:                   expires,
+				Tagging:                   tagging,
+				ChecksumAlgorithm:         algorithm,
+				ChecksumCRC32:             sums.CRC32,
+				ChecksumCRC32C:            sums.CRC32C,
+				ChecksumSHA1:              sums.SHA1,
+				ChecksumSHA256:            sums.SHA256,
+			})
+			return
+		}
+
+		// upload the remaining tail as the last part
+		if w.buf.Len() != 0 {
+			if err = w.flushPart(w.buf.Len()); err != nil {
+				return
+			}
+		}
+
+		err = w.bucket.completeMultipartUpload(w.ctx, w.bucket.withPrefix(w.name), w.uploadID, w.parts)
+	})
+	return normError(err)
+}
+
+// abort aborts the multipart upload, if one was initiated. It intentionally
+// ignores w.ctx, which may have been cancelled already.
+func (w *StreamWriter) abort() error {
+	if w.uploadID == nil {
+		return nil
+	}
+
+	_, err := w.bucket.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket.bucket),
+		Key:      aws.String(w.bucket.withPrefix(w.name)),
+		UploadId: w.uploadID,
+	})
+	w.uploadID = nil
+	w.parts = nil
+	return normError(err)
+}
+
+// flushPart uploads the first size bytes of the buffer as the next part.
+// The bytes are only consumed once the part was uploaded successfully.
+// Failures are sticky, as subsequent parts would otherwise leave a gap in
+// the upload.
+func (w *StreamWriter) flushPart(size int) error {
+	if err := w.uploadPart(w.buf.Bytes()[:size]); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf.Next(size)
+	return nil
+}
+
+func (w *StreamWriter) uploadPart(data []byte) error {
+	algorithm, _ := checksumAlgorithm(w.opts.GetChecksumAlgorithm())
+	if w.uploadID == nil {
+		lockMode, retainUntil := w.bucket.retention(w.opts)
+		expires, tagging := expiry(w.opts)
+		resp, err := w.bucket.CreateMultipartUploadWithContext(w.ctx, &s3.CreateMultipartUploadInput{
+			Bucket:                    aws.String(w.bucket.bucket),
+			Key:                       aws.String(w.bucket.withPrefix(w.name)),
+			ContentType:               aws.String(w.bucket.contentType(w.name, w.opts)),
+			Metadata:                  aws.StringMap(w.opts.GetMetadata()),
+			CacheControl:              strPresence(w.opts.GetCacheControl()),
+			ContentEncoding:           strPresence(w.opts.GetContentEncoding()),
+			ContentDisposition:        strPresence(w.opts.GetContentDisposition()),
+			ContentLanguage:           strPresence(w.opts.GetContentLanguage()),
+			ACL:                       w.bucket.acl(w.opts),
+			GrantFullControl:          strPresence(w.bucket.config.GrantFullControl),
+			ServerSideEncryption:      strPresence(w.bucket.config.SSE),
+			SSEKMSEncryptionContext:   w.bucket.sseContext,
+			ObjectLockMode:            lockMode,
+			ObjectLockRetainUntilDate: retainUntil,
+			Expires:                   expires,
+			Tagging:                   tagging,
+			ChecksumAlgorithm:         algorithm,
+		})
+		if err != nil {
+			return normError(err)
+		}
+		w.uploadID = resp.UploadId
+	}
+
+	body := bytes.NewReader(data)
+	sums, err := computeChecksums(algorithm, body)
+	if err != nil {
+		return err
+	}
+
+	partNumber := aws.Int64(int64(len(w.parts) + 1))
+	resp, err := w.bucket.UploadPartWithContext(w.ctx, &s3.UploadPartInput{
+		Bucket:            aws.String(w.bucket.bucket),
+		Key:               aws.String(w.bucket.withPrefix(w.name)),
+		UploadId:          w.uploadID,
+		PartNumber:        partNumber,
+		Body:              body,
+		ChecksumAlgorithm: algorithm,
+		ChecksumCRC32:     sums.CRC32,
+		ChecksumCRC32C:    sums.CRC32C,
+		ChecksumSHA1:      sums.SHA1,
+		ChecksumSHA256:    sums.SHA256,
+	})
+	if err != nil {
+		return normError(err)
+	}
+
+	w.parts = append(w.parts, &s3.CompletedPart{
+		ETag:           resp.ETag,
+		PartNumber:     partNumber,
+		ChecksumCRC32:  resp.ChecksumCRC32,
+		ChecksumCRC32C: resp.ChecksumCRC32C,
+		ChecksumSHA1:   resp.ChecksumSHA1,
+		ChecksumSHA256: resp.ChecksumSHA256,
+	})
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+var (
+	completeMaxRetries = 3
+	completeBackoff    = 200 * time.Millisecond
+)
+
+// completeMultipartUpload completes a multipart upload. S3 occasionally fails
+// completions with internal errors even though all parts were uploaded
+// successfully. Completing the same upload ID with the same parts is
+// idempotent, so transient failures are retried with exponential backoff
+// instead of losing the upload.
+func (b *bucket) completeMultipartUpload(ctx context.Context, key string, uploadID *string, parts []*s3.CompletedPart) error {
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	}
+
+	backoff := completeBackoff
+	for attempt := 0; ; attempt++ {
+		_, err := b.CompleteMultipartUploadWithContext(ctx, input)
+		if err == nil || attempt == completeMaxRetries || !isTransientError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientError returns true for server-side errors which are worth
+// retrying.
+func isTransientError(err error) bool {
+	if e, ok := err.(awserr.RequestFailure); ok && e.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+	if e, ok := err.(awserr.Error); ok {
+		switch e.Code() {
+		case "InternalError", "ServiceUnavailable", "SlowDown":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package bfss3_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StreamWriter", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		var err error
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{
+			Session:   mock.Session(),
+			Streaming: true,
+			PartSize:  2 * s3manager.MinUploadPartSize,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should upload small objects directly", func() {
+		Expect(bfs.WriteObject(ctx, subject, "small.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(mock.Calls("PutObject")).To(HaveLen(1))
+		Expect(mock.Calls("CreateMultipartUpload")).To(BeEmpty())
+		Expect(mock.Keys()).To(ConsistOf("small.txt"))
+	})
+
+	It("should flush multiple times before commit", func() {
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		flusher, ok := w.(*bfss3.StreamWriter)
+		Expect(ok).To(BeTrue())
+
+		chunk := bytes.Repeat([]byte("x"), int(s3manager.MinUploadPartSize)+1)
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(mock.Calls("UploadPart")).To(BeEmpty())
+		Expect(flusher.Flush()).To(Succeed())
+		Expect(mock.Calls("UploadPart")).To(HaveLen(1))
+
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(flusher.Flush()).To(Succeed())
+		Expect(mock.Calls("UploadPart")).To(HaveLen(2))
+
+		// too small to be flushed
+		Expect(w.Write([]byte("TAIL"))).To(Equal(4))
+		Expect(flusher.Flush()).To(Succeed())
+		Expect(mock.Calls("UploadPart")).To(HaveLen(2))
+		Expect(mock.Keys()).To(BeEmpty())
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(mock.Calls("UploadPart")).To(HaveLen(3))
+		Expect(mock.Calls("CompleteMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Keys()).To(ConsistOf("stream.txt"))
+
+		r, err := subject.Open(ctx, "stream.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		data, err := ioutil.ReadAll(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveLen(2*len(chunk) + 4))
+		Expect(data[len(data)-4:]).To(Equal([]byte("TAIL")))
+	})
+
+	It("should upload parts automatically", func() {
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(mock.Calls("UploadPart")).To(HaveLen(1))
+		Expect(w.Commit()).To(Succeed())
+		Expect(mock.Calls("UploadPart")).To(HaveLen(1))
+		Expect(mock.Keys()).To(ConsistOf("stream.txt"))
+	})
+
+	It("should abort multipart uploads on discard", func() {
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(mock.Calls("UploadPart")).To(HaveLen(1))
+
+		Expect(w.Discard()).To(Succeed())
+		Expect(mock.Calls("AbortMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Calls("CompleteMultipartUpload")).To(BeEmpty())
+		Expect(mock.Keys()).To(BeEmpty())
+		Expect(w.Commit()).NotTo(Succeed())
+	})
+
+	It("should not abort when nothing was uploaded", func() {
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.Discard()).To(Succeed())
+		Expect(mock.Calls("AbortMultipartUpload")).To(BeEmpty())
+	})
+
+	It("should retry failed completions", func() {
+		defer bfss3.SetCompleteBackoff(time.Millisecond)()
+
+		failures := 2
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "CompleteMultipartUpload" && failures > 0 {
+				failures--
+				return awserr.New("InternalError", "we encountered an internal error", nil)
+			}
+			return nil
+		}
+
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(w.Commit()).To(Succeed())
+		Expect(mock.Calls("CompleteMultipartUpload")).To(HaveLen(3))
+		Expect(mock.Calls("AbortMultipartUpload")).To(BeEmpty())
+		Expect(mock.Keys()).To(ConsistOf("stream.txt"))
+	})
+
+	It("should not retry permanent completion failures", func() {
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "CompleteMultipartUpload" {
+				return awserr.New("InvalidPart", "one or more parts could not be found", nil)
+			}
+			return nil
+		}
+
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+		Expect(w.Commit()).To(MatchError(ContainSubstring("InvalidPart")))
+		Expect(mock.Calls("CompleteMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Calls("AbortMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Keys()).To(BeEmpty())
+	})
+
+	It("should fail permanently when parts cannot be uploaded", func() {
+		failures := 1
+		mock.Intercept = func(op string, _ interface{}) error {
+			if op == "UploadPart" && failures > 0 {
+				failures--
+				return awserr.New("InternalError", "we encountered an internal error", nil)
+			}
+			return nil
+		}
+
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		n, err := w.Write(chunk)
+		Expect(err).To(MatchError(ContainSubstring("InternalError")))
+		Expect(n).To(BeZero())
+
+		// subsequent parts must not leave a gap in the upload
+		_, err = w.Write(chunk)
+		Expect(err).To(MatchError(ContainSubstring("InternalError")))
+		Expect(w.(*bfss3.StreamWriter).Flush()).To(MatchError(ContainSubstring("InternalError")))
+		Expect(w.Commit()).To(MatchError(ContainSubstring("InternalError")))
+		Expect(mock.Calls("UploadPart")).To(HaveLen(1))
+		Expect(mock.Calls("CompleteMultipartUpload")).To(BeEmpty())
+		Expect(mock.Calls("AbortMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Keys()).To(BeEmpty())
+	})
+
+	It("should abort multipart uploads if context is cancelled", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		w, err := subject.Create(ctx, "stream.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		chunk := bytes.Repeat([]byte("x"), int(2*s3manager.MinUploadPartSize))
+		Expect(w.Write(chunk)).To(Equal(len(chunk)))
+
+		cancel()
+		Expect(w.Commit()).To(Equal(context.Canceled))
+		Expect(mock.Calls("AbortMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Keys()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,149 @@
+package bfss3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+)
+
+// MaxTags is the maximum number of tags per object supported by S3.
+const MaxTags = 10
+
+// ExpiryTag is the tag applied to objects written with
+// bfs.WriteOptions.ExpiresIn. Its value is the expiry rounded up to full
+// days. S3 lifecycle rules can filter by tag, e.g. a rule for objects tagged
+// with "bfs-expire-days=7" and an expiration of 7 days removes objects which
+// were written with an ExpiresIn of up to a week.
+const ExpiryTag = "bfs-expire-days"
+
+// SetTags replaces the tag set of an object. Passing no tags removes all
+// existing tags, except for the ExpiryTag of objects written with
+// bfs.WriteOptions.ExpiresIn, which is preserved unless tags contain it.
+func (b *bucket) SetTags(ctx context.Context, name string, tags map[string]string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := buildTagging(tags); err != nil {
+		return err
+	}
+	return b.putTagging(ctx, name, tags)
+}
+
+// SetTagsMany replaces the tag sets of all objects matching a glob pattern,
+// like SetTags. Up to concurrency objects are tagged in parallel.
+//
+// A bfs.BatchError is returned if one or more objects failed to be tagged.
+func (b *bucket) SetTagsMany(ctx context.Context, pattern string, tags map[string]string, concurrency int) error {
+	if _, err := buildTagging(tags); err != nil {
+		return err
+	}
+
+	iter, err := b.Glob(ctx, pattern)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	failed, err := internal.ForEachName(ctx, iter, concurrency, func(name string) error {
+		return b.putTagging(ctx, name, tags)
+	})
+	if err != nil {
+		return normError(err)
+	}
+	if len(failed) != 0 {
+		return bfs.BatchError(failed)
+	}
+	return nil
+}
+
+// putTagging replaces the tag set of an object, an existing ExpiryTag is
+// carried over unless tags contain one.
+func (b *bucket) putTagging(ctx context.Context, name string, tags map[string]string) error {
+	if _, ok := tags[ExpiryTag]; !ok {
+		resp, err := b.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(b.bucket),
+			Key:    aws.String(b.withPrefix(name)),
+		})
+		if err != nil {
+			return normError(err)
+		}
+		for _, tag := range resp.TagSet {
+			if aws.StringValue(tag.Key) == ExpiryTag {
+				merged := make(map[string]string, len(tags)+1)
+				for k, v := range tags {
+					merged[k] = v
+				}
+				merged[ExpiryTag] = aws.StringValue(tag.Value)
+				tags = merged
+			}
+		}
+	}
+
+	tagging, err := buildTagging(tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(b.bucket),
+		Key:     aws.String(b.withPrefix(name)),
+		Tagging: tagging,
+	})
+	return normError(err)
+}
+
+// fixExpiry returns a copy of opts with the expiry recorded in the metadata,
+// so that all requests of a write agree on the expiry.
+func fixExpiry(opts *bfs.WriteOptions) *bfs.WriteOptions {
+	if opts.GetExpiresIn() <= 0 {
+		return opts
+	}
+
+	fixed := *opts
+	fixed.Metadata = opts.GetMetadata()
+	return &fixed
+}
+
+// expiry returns the Expires header and the ExpiryTag for uploads with
+// bfs.WriteOptions.ExpiresIn, both are nil otherwise.
+func expiry(opts *bfs.WriteOptions) (expires *time.Time, tagging *string) {
+	expiresIn := opts.GetExpiresIn()
+	if expiresIn <= 0 {
+		return nil, nil
+	}
+
+	days := (expiresIn + 24*time.Hour - 1) / (24 * time.Hour)
+	if expiresAt, ok := bfs.ExpiresAt(opts.GetMetadata()); ok {
+		expires = aws.Time(expiresAt)
+	}
+	return expires, aws.String(url.Values{ExpiryTag: {strconv.FormatInt(int64(days), 10)}}.Encode())
+}
+
+// buildTagging converts tags into a tag set, sorted by key.
+func buildTagging(tags map[string]string) (*s3.Tagging, error) {
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("bfss3: too many tags, at most %d are supported", MaxTags)
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tagSet := make([]*s3.Tag, 0, len(keys))
+	for _, key := range keys {
+		tagSet = append(tagSet, &s3.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return &s3.Tagging{TagSet: tagSet}, nil
+}
@@ -0,0 +1,119 @@
+package bfss3_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SetTags", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	type tagger interface {
+		SetTags(context.Context, string, map[string]string) error
+		SetTagsMany(context.Context, string, map[string]string, int) error
+	}
+
+	BeforeEach(func() {
+		var err error
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{Prefix: "x/", Session: mock.Session()})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"a.txt", "b.txt", "c/d.txt", "e.csv"} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte("TESTDATA"), nil)).To(Succeed())
+		}
+	})
+
+	taggedKeys := func() []string {
+		var keys []string
+		for _, call := range mock.Calls("PutObjectTagging") {
+			keys = append(keys, aws.StringValue(call.(*s3.PutObjectTaggingInput).Key))
+		}
+		return keys
+	}
+
+	It("should tag objects", func() {
+		Expect(subject.(tagger).SetTags(ctx, "a.txt", map[string]string{"class": "pii", "age": "30d"})).To(Succeed())
+
+		calls := mock.Calls("PutObjectTagging")
+		Expect(calls).To(HaveLen(1))
+		Expect(calls[0].(*s3.PutObjectTaggingInput).Key).To(Equal(aws.String("x/a.txt")))
+		Expect(calls[0].(*s3.PutObjectTaggingInput).Tagging).To(Equal(&s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String("age"), Value: aws.String("30d")},
+			{Key: aws.String("class"), Value: aws.String("pii")},
+		}}))
+
+		Expect(subject.(tagger).SetTags(ctx, "missing.txt", map[string]string{"class": "pii"})).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should preserve expiry tags", func() {
+		Expect(bfs.WriteObject(ctx, subject, "ephemeral.txt", []byte("TESTDATA"), &bfs.WriteOptions{ExpiresIn: time.Hour})).To(Succeed())
+		Expect(subject.(tagger).SetTags(ctx, "ephemeral.txt", map[string]string{"class": "pii"})).To(Succeed())
+		Expect(subject.(tagger).SetTags(ctx, "a.txt", map[string]string{"class": "pii"})).To(Succeed())
+
+		calls := mock.Calls("PutObjectTagging")
+		Expect(calls).To(HaveLen(2))
+		Expect(calls[0].(*s3.PutObjectTaggingInput).Tagging).To(Equal(&s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String(bfss3.ExpiryTag), Value: aws.String("1")},
+			{Key: aws.String("class"), Value: aws.String("pii")},
+		}}))
+		Expect(calls[1].(*s3.PutObjectTaggingInput).Tagging).To(Equal(&s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String("class"), Value: aws.String("pii")},
+		}}))
+
+		Expect(subject.(tagger).SetTags(ctx, "ephemeral.txt", map[string]string{bfss3.ExpiryTag: "7"})).To(Succeed())
+		Expect(mock.Calls("PutObjectTagging")[2].(*s3.PutObjectTaggingInput).Tagging).To(Equal(&s3.Tagging{TagSet: []*s3.Tag{
+			{Key: aws.String(bfss3.ExpiryTag), Value: aws.String("7")},
+		}}))
+	})
+
+	It("should reject too many tags", func() {
+		tags := make(map[string]string)
+		for _, c := range "abcdefghijk" {
+			tags[string(c)] = "x"
+		}
+		Expect(subject.(tagger).SetTags(ctx, "a.txt", tags)).To(MatchError("bfss3: too many tags, at most 10 are supported"))
+		Expect(mock.Calls("PutObjectTagging")).To(BeEmpty())
+	})
+
+	It("should tag matching objects", func() {
+		Expect(subject.(tagger).SetTagsMany(ctx, "**/*.txt", map[string]string{"class": "pii"}, 2)).To(Succeed())
+		Expect(taggedKeys()).To(ConsistOf("x/a.txt", "x/b.txt", "x/c/d.txt"))
+
+		for _, call := range mock.Calls("PutObjectTagging") {
+			Expect(call.(*s3.PutObjectTaggingInput).Tagging.TagSet).To(Equal([]*s3.Tag{
+				{Key: aws.String("class"), Value: aws.String("pii")},
+			}))
+		}
+	})
+
+	It("should report failed objects", func() {
+		denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+		mock.Intercept = func(op string, input interface{}) error {
+			if op == "PutObjectTagging" && aws.StringValue(input.(*s3.PutObjectTaggingInput).Key) == "x/b.txt" {
+				return denied
+			}
+			return nil
+		}
+
+		err := subject.(tagger).SetTagsMany(ctx, "*", map[string]string{"class": "pii"}, 2)
+		Expect(err).To(BeAssignableToTypeOf(bfs.BatchError{}))
+		Expect(err.(bfs.BatchError)).To(HaveLen(1))
+		Expect(errors.Is(err.(bfs.BatchError)["b.txt"], denied)).To(BeTrue())
+		Expect(taggedKeys()).To(ConsistOf("x/a.txt", "x/b.txt", "x/e.csv"))
+	})
+})
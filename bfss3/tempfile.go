@@ -0,0 +1,91 @@
+package bfss3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// tempPrefix is the name prefix of all tempfiles created by writers.
+const tempPrefix = "bfs-s3"
+
+// tempFiles tracks the tempfiles which are in use by this process.
+var tempFiles = struct {
+	sync.Mutex
+	names map[string]struct{}
+}{names: make(map[string]struct{})}
+
+func createTempFile(dir string) (*os.File, error) {
+	f, err := ioutil.TempFile(dir, tempPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	tempFiles.Lock()
+	tempFiles.names[f.Name()] = struct{}{}
+	tempFiles.Unlock()
+	return f, nil
+}
+
+func removeTempFile(name string) error {
+	tempFiles.Lock()
+	delete(tempFiles.names, name)
+	tempFiles.Unlock()
+
+	return os.Remove(name)
+}
+
+func isTempFileInUse(name string) bool {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+
+	_, ok := tempFiles.names[name]
+	return ok
+}
+
+// CleanupOrphans removes tempfiles of writers from dir, which were last
+// modified more than olderThan ago. Tempfiles are normally removed on Commit
+// or Discard, but leak when a process crashes before. Services should call
+// CleanupOrphans on startup, with the Config.TempDir of their buckets (an
+// empty dir defaults to the system temp dir) and a threshold well above the
+// expected duration of writes, as tempfiles of other running processes
+// cannot be told apart from orphans. Tempfiles of the current process are
+// never removed.
+//
+// It returns the number of removed files and the first error encountered.
+func CleanupOrphans(dir string, olderThan time.Duration) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := internal.Now().Add(-olderThan)
+	removed := 0
+	for _, fi := range entries {
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(fi.Name(), tempPrefix) || fi.ModTime().After(cutoff) {
+			continue
+		}
+
+		name := filepath.Join(dir, fi.Name())
+		if isTempFileInUse(name) {
+			continue
+		}
+		if e := os.Remove(name); e != nil && !os.IsNotExist(e) {
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, err
+}
@@ -0,0 +1,103 @@
+package bfss3_test
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NameTransform", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	// shard prepends a hash-based shard to names
+	shard := func(name string) string {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(name))
+		return fmt.Sprintf("%02x/%s", h.Sum32()%16, name)
+	}
+	unshard := func(key string) string {
+		return key[strings.IndexByte(key, '/')+1:]
+	}
+
+	BeforeEach(func() {
+		var err error
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{
+			Prefix:        "x/",
+			Session:       mock.Session(),
+			NameTransform: shard,
+			NameInverse:   unshard,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"a.txt", "b/c.txt", "b/d.txt", "e.txt"} {
+			Expect(bfs.WriteObject(ctx, subject, name, []byte("DATA:"+name), nil)).To(Succeed())
+		}
+	})
+
+	collect := func(iter bfs.Iterator, err error) []string {
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		return names
+	}
+
+	It("should write and read transformed keys", func() {
+		Expect(mock.Keys()).To(ConsistOf(
+			"x/"+shard("a.txt"),
+			"x/"+shard("b/c.txt"),
+			"x/"+shard("b/d.txt"),
+			"x/"+shard("e.txt"),
+		))
+
+		r, err := subject.Open(ctx, "b/c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("DATA:b/c.txt")))
+
+		info, err := subject.Head(ctx, "b/c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Name).To(Equal("b/c.txt"))
+	})
+
+	It("should list logical names", func() {
+		Expect(collect(subject.Glob(ctx, "b/*"))).To(ConsistOf("b/c.txt", "b/d.txt"))
+		Expect(collect(bfs.SortedGlob(ctx, subject, "**"))).To(Equal([]string{"a.txt", "b/c.txt", "b/d.txt", "e.txt"}))
+		Expect(collect(bfs.GlobAfter(ctx, subject, "**", "b/c.txt"))).To(ConsistOf("b/d.txt", "e.txt"))
+
+		type prefixGlobber interface {
+			GlobPrefixes(context.Context, []string, string) (bfs.Iterator, error)
+		}
+		Expect(collect(subject.(prefixGlobber).GlobPrefixes(ctx, []string{"b/"}, "**"))).To(ConsistOf("b/c.txt", "b/d.txt"))
+	})
+
+	It("should copy trees", func() {
+		type treeCopier interface {
+			CopyTree(context.Context, string, string, int) error
+		}
+		Expect(subject.(treeCopier).CopyTree(ctx, "b", "z", 2)).To(Succeed())
+		Expect(collect(subject.Glob(ctx, "z/*"))).To(ConsistOf("z/c.txt", "z/d.txt"))
+		Expect(mock.Keys()).To(ContainElement("x/" + shard("z/c.txt")))
+	})
+
+	It("should require both funcs", func() {
+		_, err := bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), NameTransform: shard})
+		Expect(err).To(MatchError("bfss3: NameTransform and NameInverse must be set together"))
+	})
+})
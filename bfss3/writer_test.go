@@ -0,0 +1,198 @@
+package bfss3_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfss3"
+	"github.com/bsm/bfs/bfss3/internal/faketest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("writer", func() {
+	var mock *faketest.S3
+	var subject bfs.Bucket
+	var tempDir string
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "bfss3-test")
+		Expect(err).NotTo(HaveOccurred())
+
+		mock = faketest.New()
+		subject, err = bfss3.New(bucketName, &bfss3.Config{
+			Session:        mock.Session(),
+			TempDir:        tempDir,
+			SpillThreshold: 16,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	tempFiles := func() []string {
+		entries, err := ioutil.ReadDir(tempDir)
+		Expect(err).NotTo(HaveOccurred())
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	It("should keep small writes in memory", func() {
+		w, err := subject.Create(ctx, "small.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(tempFiles()).To(BeEmpty())
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(mock.Keys()).To(ConsistOf("small.txt"))
+	})
+
+	It("should spill large writes to the temp dir", func() {
+		w, err := subject.Create(ctx, "large.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.Write([]byte(strings.Repeat("x", 100)))).To(Equal(100))
+		Expect(tempFiles()).To(ConsistOf(HavePrefix("bfs-s3")))
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(tempFiles()).To(BeEmpty())
+
+		r, err := subject.Open(ctx, "large.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(HaveLen(108))
+	})
+
+	It("should keep writes in memory with a small size hint", func() {
+		data := strings.Repeat("x", 100)
+		w, err := subject.Create(ctx, "hinted.txt", &bfs.WriteOptions{Size: int64(len(data))})
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		Expect(w.Write([]byte(data))).To(Equal(100))
+		Expect(tempFiles()).To(BeEmpty())
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(mock.Calls("PutObject")).To(HaveLen(1))
+		Expect(mock.Calls("CreateMultipartUpload")).To(BeEmpty())
+		Expect(mock.Keys()).To(ConsistOf("hinted.txt"))
+	})
+
+	It("should handle size hint mismatches", func() {
+		w, err := subject.Create(ctx, "hinted.txt", &bfs.WriteOptions{Size: 50})
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		Expect(w.Write([]byte(strings.Repeat("x", 40)))).To(Equal(40))
+		Expect(tempFiles()).To(BeEmpty())
+		Expect(w.Write([]byte(strings.Repeat("x", 60)))).To(Equal(60))
+		Expect(tempFiles()).To(HaveLen(1))
+
+		Expect(w.Commit()).To(Succeed())
+		r, err := subject.Open(ctx, "hinted.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(HaveLen(100))
+	})
+
+	It("should upload bodies below the multipart threshold in a single part", func() {
+		data := strings.Repeat("x", 6*1024*1024) // exceeds the default part size
+		for _, threshold := range []int64{0, 8 * 1024 * 1024} {
+			bucket, err := bfss3.New(bucketName, &bfss3.Config{
+				Session:            mock.Session(),
+				TempDir:            tempDir,
+				MultipartThreshold: threshold,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			w, err := bucket.Create(ctx, "large.txt", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Write([]byte(data))).To(Equal(len(data)))
+			Expect(w.Commit()).To(Succeed())
+		}
+		Expect(mock.Calls("CreateMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Calls("PutObject")).To(HaveLen(1))
+
+		r, err := subject.Open(ctx, "large.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(HaveLen(len(data)))
+
+		_, err = bfss3.New(bucketName, &bfss3.Config{Session: mock.Session(), MultipartThreshold: 1024})
+		Expect(err).To(MatchError("bfss3: multipart threshold must be between 5242880 and 5368709120 bytes"))
+	})
+
+	It("should apply checksum algorithms to multipart uploads", func() {
+		data := strings.Repeat("x", 12*1024*1024)
+		Expect(bfs.WriteObject(ctx, subject, "checked.txt", []byte(data), &bfs.WriteOptions{ChecksumAlgorithm: "crc32c"})).To(Succeed())
+		Expect(mock.Calls("CreateMultipartUpload")).To(HaveLen(1))
+		Expect(mock.Calls("UploadPart")).To(HaveLen(3))
+		Expect(mock.Calls("CompleteMultipartUpload")).To(HaveLen(1))
+
+		r, err := subject.Open(ctx, "checked.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(HaveLen(len(data)))
+	})
+
+	It("should remove spilled files on discard", func() {
+		w, err := subject.Create(ctx, "large.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(w.Write([]byte(strings.Repeat("x", 100)))).To(Equal(100))
+		Expect(tempFiles()).To(HaveLen(1))
+		Expect(w.Discard()).To(Succeed())
+		Expect(tempFiles()).To(BeEmpty())
+		Expect(mock.Keys()).To(BeEmpty())
+	})
+
+	It("should clean up orphaned tempfiles", func() {
+		past := time.Now().Add(-2 * time.Hour)
+		for _, name := range []string{"bfs-s3123", "bfs-s3456", "other"} {
+			path := filepath.Join(tempDir, name)
+			Expect(ioutil.WriteFile(path, []byte("orphan"), 0600)).To(Succeed())
+			Expect(os.Chtimes(path, past, past)).To(Succeed())
+		}
+
+		// tempfiles in use are kept, regardless of their age
+		w, err := subject.Create(ctx, "large.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+		Expect(w.Write([]byte(strings.Repeat("x", 100)))).To(Equal(100))
+		for _, name := range tempFiles() {
+			Expect(os.Chtimes(filepath.Join(tempDir, name), past, past)).To(Succeed())
+		}
+		Expect(ioutil.WriteFile(filepath.Join(tempDir, "bfs-s3789"), []byte("recent"), 0600)).To(Succeed())
+		Expect(tempFiles()).To(HaveLen(5))
+
+		Expect(bfss3.CleanupOrphans(tempDir, time.Hour)).To(Equal(2))
+		Expect(tempFiles()).To(HaveLen(3))
+		Expect(tempFiles()).To(ContainElement("other"))
+		Expect(tempFiles()).To(ContainElement("bfs-s3789"))
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(tempFiles()).To(ConsistOf("other", "bfs-s3789"))
+		Expect(mock.Keys()).To(ConsistOf("large.txt"))
+
+		_, err = bfss3.CleanupOrphans(filepath.Join(tempDir, "missing"), time.Hour)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,107 @@
+package bfss3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bsm/bfs"
+)
+
+var errWriterClosed = errors.New("bfss3: writer is closed")
+
+// WriterAt is a writer which accepts content at arbitrary offsets.
+type WriterAt interface {
+	io.WriterAt
+
+	// Discard closes and releases the writer without writing a file.
+	Discard() error
+
+	// Commit closes the writer and uploads the assembled content.
+	Commit() error
+}
+
+// CreateAt creates a writer which allows content to be written out of order,
+// e.g. by parallel producers which fill different byte ranges. WriteAt is
+// safe for concurrent use. Gaps which are not written are filled with zeros.
+//
+// The content is always buffered in a tempfile within Config.TempDir, which
+// must provide enough disk space for the full object. It is uploaded with a
+// single (multipart) upload on Commit.
+func (b *bucket) CreateAt(ctx context.Context, name string, opts *bfs.WriteOptions) (WriterAt, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bfs.ValidateMetadata(opts.GetMetadata(), MaxMetadataSize); err != nil {
+		return nil, err
+	}
+
+	f, err := createTempFile(b.config.TempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writerAt{
+		ctx:    ctx,
+		bucket: b,
+		name:   name,
+		opts:   opts,
+		file:   f,
+	}, nil
+}
+
+type writerAt struct {
+	ctx    context.Context
+	bucket *bucket
+	name   string
+	opts   *bfs.WriteOptions
+
+	file   *os.File
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	return w.file.WriteAt(p, off)
+}
+
+func (w *writerAt) Discard() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return context.Canceled
+	}
+	w.closed = true
+
+	defer removeTempFile(w.file.Name())
+	return w.file.Close()
+}
+
+func (w *writerAt) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return context.Canceled
+	}
+	w.closed = true
+
+	defer removeTempFile(w.file.Name())
+	defer w.file.Close()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return normError(w.bucket.upload(w.ctx, w.name, w.file, w.opts))
+}
@@ -33,7 +33,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/bmatcuk/doublestar"
 	"github.com/bsm/bfs"
 	"github.com/bsm/bfs/internal"
 	"github.com/kr/fs"
@@ -72,6 +71,9 @@ type Config struct {
 	Prefix string
 	// A custom temp dir.
 	TempDir string
+	// SanitizeNames rejects names which would resolve outside of Prefix on the
+	// remote host, see bfs.SanitizeName.
+	SanitizeNames bool
 }
 
 func (c *Config) norm() error {
@@ -87,10 +89,11 @@ func (c *Config) norm() error {
 }
 
 type bucket struct {
-	ctx    context.Context
-	conn   *ssh.Client
-	client *sftp.Client
-	config *Config
+	address string
+	ctx     context.Context
+	conn    *ssh.Client
+	client  *sftp.Client
+	config  *Config
 }
 
 // New initiates an bfs.Bucket backed by ssh.
@@ -122,12 +125,17 @@ func New(address string, cfg *Config) (bfs.Bucket, error) {
 	}
 
 	return &bucket{
-		conn:   conn,
-		client: client,
-		config: config,
+		address: address,
+		conn:    conn,
+		client:  client,
+		config:  config,
 	}, nil
 }
 
+func (b *bucket) checkName(name string) (string, error) {
+	return internal.CheckName(name, b.config.SanitizeNames)
+}
+
 func (b *bucket) withPrefix(name string) string {
 	if b.config.Prefix == "" {
 		return name
@@ -137,8 +145,7 @@ func (b *bucket) withPrefix(name string) string {
 
 // Glob implements bfs.Bucket.
 func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
-	// quick sanity check
-	if _, err := doublestar.Match(pattern, ""); err != nil {
+	if err := bfs.ValidatePattern(pattern); err != nil {
 		return nil, err
 	}
 
@@ -156,6 +163,11 @@ func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error)
 
 // Head implements bfs.Bucket.
 func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
@@ -174,6 +186,11 @@ func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
 
 // Open implements bfs.Bucket.
 func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	file, err := b.client.Open(b.withPrefix(name))
 	if err != nil {
 		return nil, normError(err)
@@ -191,6 +208,15 @@ func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
 
 // Create implements bfs.Bucket.
 func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	name, err := b.checkName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.HasRetention() || opts.GetExpiresIn() > 0 {
+		return nil, bfs.ErrNotSupported
+	}
+
 	f, err := ioutil.TempFile(b.config.TempDir, "bfs-scp")
 	if err != nil {
 		return nil, err
@@ -207,17 +233,35 @@ func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions
 
 // Remove implements bfs.Bucket.
 func (b *bucket) Remove(ctx context.Context, name string) error {
+	name, err := b.checkName(name)
+	if err != nil {
+		return err
+	}
+
 	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	err := normError(b.client.Remove(b.withPrefix(name)))
+	err = normError(b.client.Remove(b.withPrefix(name)))
 	if err != nil && err != bfs.ErrNotFound {
 		return err
 	}
 	return nil
 }
 
+// Mkdir creates a directory, including missing parents.
+func (b *bucket) Mkdir(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return normError(b.client.MkdirAll(b.withPrefix(prefix)))
+}
+
+// Describe returns information about the bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "scp", Bucket: b.address, Prefix: b.config.Prefix}
+}
+
 // Close implements bfs.Bucket.
 func (b *bucket) Close() error {
 	return multierr.Combine(b.client.Close(), b.conn.Close())
@@ -282,7 +326,7 @@ func (w *writer) Commit() error {
 		if sf, err = w.bucket.client.Create(fullName); err != nil {
 			return
 		}
-		_, err = io.Copy(sf, file)
+		_, err = internal.CopyBuffered(sf, file)
 		return
 	})
 	return err
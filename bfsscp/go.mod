@@ -12,3 +12,5 @@ require (
 	go.uber.org/multierr v1.5.0
 	golang.org/x/crypto v0.0.0-20200510223506-06a226fb4e37
 )
+
+replace github.com/bsm/bfs => ../
@@ -0,0 +1,432 @@
+// Package bfstest implements a conformance test suite for bfs.Bucket
+// implementations. It only depends on the standard testing package and can
+// be used by third-party backends to validate compatibility:
+//
+//   func TestConformance(t *testing.T) {
+//     bfstest.Conformance(t, func() bfs.Bucket {
+//       return mybackend.New(...)
+//     })
+//   }
+//
+package bfstest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bsm/bfs"
+)
+
+// Conformance runs the conformance test suite. The newBucket func is called
+// once for every test case and must return a new, empty bucket. Buckets are
+// closed at the end of each test case.
+//
+// Optional features, such as content types, metadata and iterator resets, are
+// only verified if supported by the bucket.
+func Conformance(t *testing.T, newBucket func() bfs.Bucket) {
+	tests := []struct {
+		name string
+		test func(*testing.T, bfs.Bucket)
+	}{
+		{"Write", testWrite},
+		{"DiscardWrite", testDiscardWrite},
+		{"CancelWrite", testCancelWrite},
+		{"EmptyObject", testEmptyObject},
+		{"Glob", testGlob},
+		{"GlobEmptyPattern", testGlobEmptyPattern},
+		{"GlobAfter", testGlobAfter},
+		{"SortedGlob", testSortedGlob},
+		{"ResetIterator", testResetIterator},
+		{"NestedNames", testNestedNames},
+		{"Open", testOpen},
+		{"OpenMissing", testOpenMissing},
+		{"Head", testHead},
+		{"HeadMissing", testHeadMissing},
+		{"Remove", testRemove},
+		{"Copy", testCopy},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			bucket := newBucket()
+			defer bucket.Close()
+
+			tc.test(t, bucket)
+		})
+	}
+}
+
+func testWrite(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	w, err := bucket.Create(ctx, "blank.txt", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer w.Discard()
+
+	expectNames(t, glob(t, bucket, "*"), nil)
+	if err := w.Commit(); err != nil {
+		t.Fatalf("expected commit to succeed, got %v", err)
+	}
+	expectNames(t, glob(t, bucket, "*"), []string{"blank.txt"})
+
+	if err := w.Discard(); err == nil {
+		t.Error("expected discard after commit to fail")
+	}
+}
+
+func testDiscardWrite(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	w, err := bucket.Create(ctx, "blank.txt", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer w.Discard()
+
+	if err := w.Discard(); err != nil {
+		t.Fatalf("expected discard to succeed, got %v", err)
+	}
+	if err := w.Commit(); err == nil {
+		t.Error("expected commit after discard to fail")
+	}
+	expectNames(t, glob(t, bucket, "*"), nil)
+}
+
+func testCancelWrite(t *testing.T, bucket bfs.Bucket) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w, err := bucket.Create(ctx, "blank.txt", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer w.Discard()
+
+	cancel()
+	if err := w.Commit(); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	expectNames(t, glob(t, bucket, "*"), nil)
+}
+
+func testEmptyObject(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	if err := bfs.WriteObject(ctx, bucket, "empty.txt", nil, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	info, err := bucket.Head(ctx, "empty.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Size != 0 {
+		t.Errorf("expected size 0, got %d", info.Size)
+	}
+
+	if data := readObject(t, bucket, "empty.txt"); len(data) != 0 {
+		t.Errorf("expected no data, got %q", data)
+	}
+}
+
+func testGlob(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "path/a/first.txt")
+	writeTestData(t, bucket, "path/b/second.txt")
+	writeTestData(t, bucket, "path/a/third.json")
+
+	for _, tc := range []struct {
+		pattern string
+		count   int
+	}{
+		{"path/*", 0},
+		{"path/*/*", 3},
+		{"*/*/*", 3},
+		{"*/a/*", 2},
+		{"*/b/*", 1},
+		{"path/*/*.txt", 2},
+		{"path/*/[ft]*", 2},
+		{"path/*/[ft]*.json", 1},
+		{"**", 3},
+	} {
+		if names := glob(t, bucket, tc.pattern); len(names) != tc.count {
+			t.Errorf("expected %d matches for %q, got %v", tc.count, tc.pattern, names)
+		}
+	}
+}
+
+func testGlobEmptyPattern(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "path/a/first.txt")
+
+	if _, err := bucket.Glob(context.Background(), ""); !errors.Is(err, bfs.ErrEmptyPattern) {
+		t.Errorf("expected %v, got %v", bfs.ErrEmptyPattern, err)
+	}
+}
+
+func testGlobAfter(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	writeTestData(t, bucket, "path/a/first.txt")
+	writeTestData(t, bucket, "path/b/second.txt")
+	writeTestData(t, bucket, "path/c/third.txt")
+
+	for _, tc := range []struct {
+		pattern, after string
+		expected       []string
+	}{
+		{"**", "", []string{"path/a/first.txt", "path/b/second.txt", "path/c/third.txt"}},
+		{"**", "path/a/first.txt", []string{"path/b/second.txt", "path/c/third.txt"}},
+		{"**", "path/b", []string{"path/b/second.txt", "path/c/third.txt"}},
+		{"**/*.txt", "path/c/third.txt", nil},
+	} {
+		iter, err := bfs.GlobAfter(ctx, bucket, tc.pattern, tc.after)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expectNames(t, drain(t, iter), tc.expected)
+	}
+}
+
+func testSortedGlob(t *testing.T, bucket bfs.Bucket) {
+	for _, name := range []string{"path/ab.txt", "path/a/b.txt", "path/a.txt", "path/0.txt", "path/a-c.txt"} {
+		writeTestData(t, bucket, name)
+	}
+
+	iter, err := bfs.SortedGlob(context.Background(), bucket, "**")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []string{"path/0.txt", "path/a-c.txt", "path/a.txt", "path/a/b.txt", "path/ab.txt"}
+	if names := drain(t, iter); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func testResetIterator(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "path/a/first.txt")
+	writeTestData(t, bucket, "path/b/second.txt")
+
+	iter, err := bucket.Glob(context.Background(), "path/**")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer iter.Close()
+
+	names := iterate(t, iter)
+	expectNames(t, names, []string{"path/a/first.txt", "path/b/second.txt"})
+
+	if err := bfs.ResetIterator(iter); err == bfs.ErrNotSupported {
+		t.Skip("reset is not supported")
+	} else if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectNames(t, iterate(t, iter), names)
+}
+
+func testNestedNames(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "a/b/c/d/e.txt")
+	writeTestData(t, bucket, "a/b/f.txt")
+	writeTestData(t, bucket, "g.txt")
+
+	expectNames(t, glob(t, bucket, "**"), []string{"a/b/c/d/e.txt", "a/b/f.txt", "g.txt"})
+	expectNames(t, glob(t, bucket, "a/**"), []string{"a/b/c/d/e.txt", "a/b/f.txt"})
+	expectNames(t, glob(t, bucket, "a/b/*"), []string{"a/b/f.txt"})
+	expectNames(t, glob(t, bucket, "*"), []string{"g.txt"})
+
+	if data := readObject(t, bucket, "a/b/c/d/e.txt"); string(data) != "TESTDATA" {
+		t.Errorf("expected %q, got %q", "TESTDATA", data)
+	}
+}
+
+func testOpen(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "path/to/first.txt")
+
+	r, err := bucket.Open(context.Background(), "path/to/first.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(data) != "TESTDATA" {
+		t.Errorf("expected %q, got %q", "TESTDATA", data)
+	}
+
+	info, ok := r.(bfs.ReadCloserInfo)
+	if !ok {
+		return
+	}
+	if n := info.Size(); n != 8 {
+		t.Errorf("expected size 8, got %d", n)
+	}
+	expectRecent(t, info.ModTime())
+	if ct := info.ContentType(); ct != "" && ct != "text/plain" {
+		t.Errorf("expected content type %q, got %q", "text/plain", ct)
+	}
+}
+
+func testOpenMissing(t *testing.T, bucket bfs.Bucket) {
+	if _, err := bucket.Open(context.Background(), "path/to/missing"); err != bfs.ErrNotFound {
+		t.Errorf("expected %v, got %v", bfs.ErrNotFound, err)
+	}
+}
+
+func testHead(t *testing.T, bucket bfs.Bucket) {
+	writeTestData(t, bucket, "path/to/first.txt")
+
+	info, err := bucket.Head(context.Background(), "path/to/first.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Name != "path/to/first.txt" {
+		t.Errorf("expected name %q, got %q", "path/to/first.txt", info.Name)
+	}
+	if info.Size != 8 {
+		t.Errorf("expected size 8, got %d", info.Size)
+	}
+	expectRecent(t, info.ModTime)
+
+	if ct := info.ContentType; ct != "" && ct != "text/plain" {
+		t.Errorf("expected content type %q, got %q", "text/plain", ct)
+	}
+	if len(info.Metadata) != 0 && !reflect.DeepEqual(info.Metadata, bfs.Metadata{"Cust0m-Key": "VaLu3"}) {
+		t.Errorf("expected normalized metadata, got %v", info.Metadata)
+	}
+}
+
+func testHeadMissing(t *testing.T, bucket bfs.Bucket) {
+	if _, err := bucket.Head(context.Background(), "path/to/missing"); err != bfs.ErrNotFound {
+		t.Errorf("expected %v, got %v", bfs.ErrNotFound, err)
+	}
+}
+
+func testRemove(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	writeTestData(t, bucket, "path/to/first.txt")
+	expectNames(t, glob(t, bucket, "**"), []string{"path/to/first.txt"})
+
+	if err := bucket.Remove(ctx, "path/to/first.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectNames(t, glob(t, bucket, "**"), nil)
+
+	if err := bucket.Remove(ctx, "missing"); err != nil {
+		t.Errorf("expected removal of missing objects to succeed, got %v", err)
+	}
+}
+
+func testCopy(t *testing.T, bucket bfs.Bucket) {
+	ctx := context.Background()
+
+	writeTestData(t, bucket, "path/to/src.txt")
+
+	if err := bfs.CopyObject(ctx, bucket, "path/to/src.txt", "path/to/dst.txt", nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectNames(t, glob(t, bucket, "**"), []string{"path/to/dst.txt", "path/to/src.txt"})
+
+	info, err := bucket.Head(ctx, "path/to/dst.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if info.Size != 8 {
+		t.Errorf("expected size 8, got %d", info.Size)
+	}
+	if data := readObject(t, bucket, "path/to/dst.txt"); string(data) != "TESTDATA" {
+		t.Errorf("expected %q, got %q", "TESTDATA", data)
+	}
+}
+
+// --------------------------------------------------------------------
+
+func writeTestData(t *testing.T, bucket bfs.Bucket, name string) {
+	t.Helper()
+
+	if err := bfs.WriteObject(context.Background(), bucket, name, []byte("TESTDATA"), &bfs.WriteOptions{
+		Metadata:    bfs.Metadata{"CuSt0m_key": "VaLu3"},
+		ContentType: "text/plain",
+	}); err != nil {
+		t.Fatalf("failed to write %q: %v", name, err)
+	}
+}
+
+func readObject(t *testing.T, bucket bfs.Bucket, name string) []byte {
+	t.Helper()
+
+	r, err := bucket.Open(context.Background(), name)
+	if err != nil {
+		t.Fatalf("failed to open %q: %v", name, err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", name, err)
+	}
+	return data
+}
+
+func glob(t *testing.T, bucket bfs.Bucket, pattern string) []string {
+	t.Helper()
+
+	iter, err := bucket.Glob(context.Background(), pattern)
+	if err != nil {
+		t.Fatalf("failed to glob %q: %v", pattern, err)
+	}
+	return drain(t, iter)
+}
+
+// drain iterates and closes the iterator.
+func drain(t *testing.T, iter bfs.Iterator) []string {
+	t.Helper()
+
+	defer iter.Close()
+	return iterate(t, iter)
+}
+
+func iterate(t *testing.T, iter bfs.Iterator) []string {
+	t.Helper()
+
+	var names []string
+	for iter.Next() {
+		names = append(names, iter.Name())
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatalf("iterator failed: %v", err)
+	}
+	return names
+}
+
+// expectNames compares names, regardless of their order.
+func expectNames(t *testing.T, actual, expected []string) {
+	t.Helper()
+
+	actual = append([]string(nil), actual...)
+	expected = append([]string(nil), expected...)
+	sort.Strings(actual)
+	sort.Strings(expected)
+
+	if len(actual) != len(expected) || (len(actual) != 0 && !reflect.DeepEqual(actual, expected)) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func expectRecent(t *testing.T, modTime time.Time) {
+	t.Helper()
+
+	if d := time.Since(modTime); d < -time.Minute || d > time.Minute {
+		t.Errorf("expected a recent modification time, got %v", modTime)
+	}
+}
@@ -0,0 +1,67 @@
+package bfstest_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfstest"
+)
+
+func TestConformance(t *testing.T) {
+	bfstest.Conformance(t, func() bfs.Bucket {
+		return bfs.NewInMem()
+	})
+}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+	bucket, rec := bfstest.Recorder(bfs.NewInMem())
+
+	opts := &bfs.WriteOptions{ContentType: "text/plain", Metadata: bfs.Metadata{"Author": "alice"}}
+	if err := bfs.WriteObject(ctx, bucket, "a.txt", []byte("TESTDATA"), opts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	opts.Metadata["Author"] = "bob"
+
+	if err := bucket.Remove(ctx, "a.txt"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := bucket.Head(ctx, "a.txt"); err != bfs.ErrNotFound {
+		t.Fatalf("expected %v, got %v", bfs.ErrNotFound, err)
+	}
+	if err := bfs.Mkdir(ctx, bucket, "dir"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	calls := rec.All()
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 calls, got %v", calls)
+	}
+	if c := calls[3]; c.Op != bfs.OpCreate || c.Name != "dir" {
+		t.Errorf("unexpected call %+v", c)
+	}
+	if exp := []bfs.Operation{bfs.OpCreate, bfs.OpRemove, bfs.OpHead}; calls[0].Op != exp[0] || calls[1].Op != exp[1] || calls[2].Op != exp[2] {
+		t.Errorf("expected %v, got %v", exp, calls)
+	}
+
+	creates := rec.Calls("Create")
+	if len(creates) != 2 {
+		t.Fatalf("expected 2 calls to Create, got %v", creates)
+	}
+	if c := creates[0]; c.Name != "a.txt" || c.Options.ContentType != "text/plain" || c.Options.Metadata.Get("Author") != "alice" || c.Err != nil {
+		t.Errorf("unexpected call %+v", c)
+	}
+	if names := rec.Names(bfs.OpRemove); !reflect.DeepEqual(names, []string{"a.txt"}) {
+		t.Errorf("expected [a.txt], got %v", names)
+	}
+	if c := rec.Calls(bfs.OpHead)[0]; c.Err != bfs.ErrNotFound {
+		t.Errorf("expected %v, got %v", bfs.ErrNotFound, c.Err)
+	}
+
+	rec.Reset()
+	if calls := rec.All(); len(calls) != 0 {
+		t.Errorf("expected no calls, got %v", calls)
+	}
+}
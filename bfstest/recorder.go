@@ -0,0 +1,166 @@
+package bfstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bsm/bfs"
+)
+
+// Call is a recorded bucket operation.
+type Call struct {
+	Op      bfs.Operation
+	Name    string            // object name, the glob pattern or the copy source
+	Dst     string            // copy destination
+	Options *bfs.WriteOptions // options passed to Create
+	Err     error             // error returned by the operation
+}
+
+// Recording is a log of the operations of a bucket returned by Recorder. It
+// is safe for concurrent use.
+type Recording struct {
+	calls []Call
+	mu    sync.Mutex
+}
+
+// All returns all recorded calls, in order.
+func (r *Recording) All() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Call(nil), r.calls...)
+}
+
+// Calls returns the recorded calls of a single operation, in order.
+func (r *Recording) Calls(op bfs.Operation) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []Call
+	for _, c := range r.calls {
+		if c.Op == op {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Names returns the object names of the recorded calls of an operation.
+func (r *Recording) Names(op bfs.Operation) []string {
+	var names []string
+	for _, c := range r.Calls(op) {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Reset clears the recording.
+func (r *Recording) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+}
+
+func (r *Recording) record(c Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, c)
+}
+
+// Recorder wraps a bucket, typically a bfs.InMem, and records all operations
+// for assertions in tests of code which uses bfs:
+//
+//   bucket, rec := bfstest.Recorder(bfs.NewInMem())
+//   ...
+//   if calls := rec.Calls(bfs.OpCreate); len(calls) != 1 {
+//     t.Errorf("expected one call to Create, got %v", calls)
+//   }
+//
+// Operations are recorded when they are called, i.e. Create is recorded
+// even if the returned writer is never committed. All operations are
+// delegated to the wrapped bucket.
+func Recorder(bucket bfs.Bucket) (bfs.Bucket, *Recording) {
+	rec := new(Recording)
+	return &recorder{Bucket: bucket, rec: rec}, rec
+}
+
+type recorder struct {
+	bfs.Bucket
+	rec *Recording
+}
+
+// Glob implements bfs.Bucket.
+func (b *recorder) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	iter, err := b.Bucket.Glob(ctx, pattern)
+	b.rec.record(Call{Op: bfs.OpGlob, Name: pattern, Err: err})
+	return iter, err
+}
+
+// Head implements bfs.Bucket.
+func (b *recorder) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	info, err := b.Bucket.Head(ctx, name)
+	b.rec.record(Call{Op: bfs.OpHead, Name: name, Err: err})
+	return info, err
+}
+
+// Open implements bfs.Bucket.
+func (b *recorder) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	r, err := b.Bucket.Open(ctx, name)
+	b.rec.record(Call{Op: bfs.OpOpen, Name: name, Err: err})
+	return r, err
+}
+
+// Create implements bfs.Bucket.
+func (b *recorder) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	var copied *bfs.WriteOptions
+	if opts != nil {
+		o := *opts
+		if opts.Metadata != nil {
+			o.Metadata = make(bfs.Metadata, len(opts.Metadata))
+			for k, v := range opts.Metadata {
+				o.Metadata[k] = v
+			}
+		}
+		copied = &o
+	}
+
+	w, err := b.Bucket.Create(ctx, name, opts)
+	b.rec.record(Call{Op: bfs.OpCreate, Name: name, Options: copied, Err: err})
+	return w, err
+}
+
+// Remove implements bfs.Bucket.
+func (b *recorder) Remove(ctx context.Context, name string) error {
+	err := b.Bucket.Remove(ctx, name)
+	b.rec.record(Call{Op: bfs.OpRemove, Name: name, Err: err})
+	return err
+}
+
+// Mkdir supports Mkdir. It is recorded as OpCreate with the prefix as name.
+func (b *recorder) Mkdir(ctx context.Context, prefix string) error {
+	err := bfs.Mkdir(ctx, b.Bucket, prefix)
+	b.rec.record(Call{Op: bfs.OpCreate, Name: prefix, Err: err})
+	return err
+}
+
+// Copy supports copying of objects within the bucket.
+func (b *recorder) Copy(ctx context.Context, src, dst string) error {
+	err := bfs.CopyObject(ctx, b.Bucket, src, dst, nil)
+	b.rec.record(Call{Op: bfs.OpCopy, Name: src, Dst: dst, Err: err})
+	return err
+}
+
+// Ping supports Ping.
+func (b *recorder) Ping(ctx context.Context) error {
+	err := bfs.Ping(ctx, b.Bucket)
+	b.rec.record(Call{Op: bfs.OpPing, Err: err})
+	return err
+}
+
+// Describe returns information about the wrapped bucket.
+func (b *recorder) Describe() bfs.BucketInfo {
+	info, _ := bfs.Describe(b.Bucket)
+	return info
+}
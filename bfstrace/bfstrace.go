@@ -0,0 +1,251 @@
+// Package bfstrace wraps buckets and traces their operations with
+// OpenTelemetry.
+//
+//   tracer := otel.Tracer("github.com/bsm/bfs")
+//   bucket = bfstrace.New(bucket, tracer)
+//
+// Each operation starts a span, named after the operation, e.g. "bfs.Open",
+// which carries the object name or glob pattern as an attribute. The span
+// context is passed on to the wrapped bucket. Spans of Glob, Open, OpenRange
+// and Create cover the whole lifetime of the returned iterator, reader or
+// writer. Errors are recorded on the spans.
+package bfstrace
+
+import (
+	"context"
+
+	"github.com/bsm/bfs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attribute keys.
+const (
+	SchemeKey  = attribute.Key("bfs.scheme")
+	NameKey    = attribute.Key("bfs.name")
+	PatternKey = attribute.Key("bfs.pattern")
+	SrcKey     = attribute.Key("bfs.src")
+	DstKey     = attribute.Key("bfs.dst")
+)
+
+// New wraps a bucket and traces all operations with tracer.
+func New(b bfs.Bucket, tracer trace.Tracer) bfs.Bucket {
+	var attrs []attribute.KeyValue
+	if info, ok := bfs.Describe(b); ok && info.Scheme != "" {
+		attrs = append(attrs, SchemeKey.String(info.Scheme))
+	}
+	return &bucket{Bucket: b, tracer: tracer, attrs: attrs}
+}
+
+type bucket struct {
+	bfs.Bucket
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue // common attributes
+}
+
+func (b *bucket) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return b.tracer.Start(ctx, "bfs."+op, trace.WithAttributes(append(attrs, b.attrs...)...))
+}
+
+// Glob implements bfs.Bucket.
+func (b *bucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	ctx, span := b.start(ctx, "Glob", PatternKey.String(pattern))
+	iter, err := b.Bucket.Glob(ctx, pattern)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &iterator{Iterator: iter, span: span}, nil
+}
+
+// GlobAfter supports bfs.GlobAfter.
+func (b *bucket) GlobAfter(ctx context.Context, pattern, after string) (bfs.Iterator, error) {
+	ctx, span := b.start(ctx, "GlobAfter", PatternKey.String(pattern))
+	iter, err := bfs.GlobAfter(ctx, b.Bucket, pattern, after)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &iterator{Iterator: iter, span: span}, nil
+}
+
+// SortedGlob supports bfs.SortedGlob.
+func (b *bucket) SortedGlob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	ctx, span := b.start(ctx, "SortedGlob", PatternKey.String(pattern))
+	iter, err := bfs.SortedGlob(ctx, b.Bucket, pattern)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &iterator{Iterator: iter, span: span}, nil
+}
+
+// Head implements bfs.Bucket.
+func (b *bucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	ctx, span := b.start(ctx, "Head", NameKey.String(name))
+	info, err := b.Bucket.Head(ctx, name)
+	end(span, err)
+	return info, err
+}
+
+// Open implements bfs.Bucket.
+func (b *bucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	ctx, span := b.start(ctx, "Open", NameKey.String(name))
+	rc, err := b.Bucket.Open(ctx, name)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &reader{Reader: rc, span: span}, nil
+}
+
+// OpenRange supports bfs.OpenRange.
+func (b *bucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	ctx, span := b.start(ctx, "OpenRange", NameKey.String(name))
+	rc, err := bfs.OpenRange(ctx, b.Bucket, name, offset, length)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &reader{Reader: rc, span: span}, nil
+}
+
+// Grants supports bfs.Grants.
+func (b *bucket) Grants(ctx context.Context, name string) ([]bfs.Grant, error) {
+	ctx, span := b.start(ctx, "Grants", NameKey.String(name))
+	grants, err := bfs.Grants(ctx, b.Bucket, name)
+	end(span, err)
+	return grants, err
+}
+
+// Create implements bfs.Bucket.
+func (b *bucket) Create(ctx context.Context, name string, opts *bfs.WriteOptions) (bfs.Writer, error) {
+	ctx, span := b.start(ctx, "Create", NameKey.String(name))
+	w, err := b.Bucket.Create(ctx, name, opts)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	return &writer{Writer: w, span: span}, nil
+}
+
+// Remove implements bfs.Bucket.
+func (b *bucket) Remove(ctx context.Context, name string) error {
+	ctx, span := b.start(ctx, "Remove", NameKey.String(name))
+	err := b.Bucket.Remove(ctx, name)
+	end(span, err)
+	return err
+}
+
+// ConditionalUpdate supports bfs.ConditionalUpdate.
+func (b *bucket) ConditionalUpdate(ctx context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	ctx, span := b.start(ctx, "ConditionalUpdate", NameKey.String(name))
+	err := bfs.ConditionalUpdate(ctx, b.Bucket, name, fn)
+	end(span, err)
+	return err
+}
+
+// RemoveIfMatch supports bfs.RemoveIfMatch.
+func (b *bucket) RemoveIfMatch(ctx context.Context, name, version string) error {
+	ctx, span := b.start(ctx, "RemoveIfMatch", NameKey.String(name))
+	err := bfs.RemoveIfMatch(ctx, b.Bucket, name, version)
+	end(span, err)
+	return err
+}
+
+// Mkdir supports bfs.Mkdir.
+func (b *bucket) Mkdir(ctx context.Context, prefix string) error {
+	ctx, span := b.start(ctx, "Mkdir", NameKey.String(prefix))
+	err := bfs.Mkdir(ctx, b.Bucket, prefix)
+	end(span, err)
+	return err
+}
+
+// Copy supports copying of objects within the bucket.
+func (b *bucket) Copy(ctx context.Context, src, dst string) error {
+	ctx, span := b.start(ctx, "Copy", SrcKey.String(src), DstKey.String(dst))
+	err := bfs.CopyObject(ctx, b.Bucket, src, dst, nil)
+	end(span, err)
+	return err
+}
+
+// Rename supports bfs.Rename.
+func (b *bucket) Rename(ctx context.Context, src, dst string) error {
+	ctx, span := b.start(ctx, "Rename", SrcKey.String(src), DstKey.String(dst))
+	err := bfs.Rename(ctx, b.Bucket, src, dst)
+	end(span, err)
+	return err
+}
+
+// Ping supports bfs.Ping.
+func (b *bucket) Ping(ctx context.Context) error {
+	ctx, span := b.start(ctx, "Ping")
+	err := bfs.Ping(ctx, b.Bucket)
+	end(span, err)
+	return err
+}
+
+// Describe returns information about the wrapped bucket.
+func (b *bucket) Describe() bfs.BucketInfo {
+	info, _ := bfs.Describe(b.Bucket)
+	return info
+}
+
+// end records err, if any, and ends the span.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// --------------------------------------------------------------------
+
+type iterator struct {
+	bfs.Iterator
+	span trace.Span
+}
+
+func (i *iterator) Reset() error {
+	return bfs.ResetIterator(i.Iterator)
+}
+
+func (i *iterator) Close() error {
+	err := i.Iterator.Close()
+	if ierr := i.Iterator.Error(); ierr != nil {
+		end(i.span, ierr)
+	} else {
+		end(i.span, err)
+	}
+	return err
+}
+
+type reader struct {
+	bfs.Reader
+	span trace.Span
+}
+
+func (r *reader) Close() error {
+	err := r.Reader.Close()
+	end(r.span, err)
+	return err
+}
+
+type writer struct {
+	bfs.Writer
+	span trace.Span
+}
+
+func (w *writer) Discard() error {
+	err := w.Writer.Discard()
+	end(w.span, err)
+	return err
+}
+
+func (w *writer) Commit() error {
+	err := w.Writer.Commit()
+	end(w.span, err)
+	return err
+}
@@ -0,0 +1,127 @@
+package bfstrace_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/bfstrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bucket", func() {
+	var recorder *tracetest.SpanRecorder
+	var provider *sdktrace.TracerProvider
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+		subject = bfstrace.New(bfs.NewInMem(), provider.Tracer("bfstrace_test"))
+		Expect(bfs.WriteObject(ctx, subject, "a.txt", []byte("TESTDATA"), nil)).To(Succeed())
+	})
+
+	type span struct {
+		Name   string
+		Attrs  []attribute.KeyValue
+		Status codes.Code
+	}
+
+	spans := func() []span {
+		var res []span
+		for _, s := range recorder.Ended() {
+			res = append(res, span{Name: s.Name(), Attrs: s.Attributes(), Status: s.Status().Code})
+		}
+		return res
+	}
+
+	It("should trace operations", func() {
+		_, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := subject.Open(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+		Expect(r.Close()).To(Succeed())
+
+		iter, err := subject.Glob(ctx, "*.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Close()).To(Succeed())
+
+		Expect(bfs.CopyObject(ctx, subject, "a.txt", "b.txt", nil)).To(Succeed())
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+		Expect(bfs.Mkdir(ctx, subject, "dir")).To(Succeed())
+
+		Expect(spans()).To(Equal([]span{
+			{Name: "bfs.Create", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.Head", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.Open", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.Glob", Attrs: []attribute.KeyValue{bfstrace.PatternKey.String("*.txt")}},
+			{Name: "bfs.Copy", Attrs: []attribute.KeyValue{bfstrace.SrcKey.String("a.txt"), bfstrace.DstKey.String("b.txt")}},
+			{Name: "bfs.Remove", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.Mkdir", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("dir")}},
+		}))
+	})
+
+	It("should trace optional operations", func() {
+		r, err := bfs.OpenRange(ctx, subject, "a.txt", 0, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TEST")))
+		Expect(r.Close()).To(Succeed())
+
+		Expect(bfs.AppendConditional(ctx, subject, "a.txt", []byte("!"))).To(Succeed())
+		Expect(bfs.Rename(ctx, subject, "a.txt", "b.txt")).To(Succeed())
+		_, err = bfs.Grants(ctx, subject, "b.txt")
+		Expect(err).To(Equal(bfs.ErrNotSupported))
+		Expect(bfs.RemoveIfMatch(ctx, subject, "b.txt", "v1")).To(Equal(bfs.ErrNotSupported))
+
+		Expect(spans()[1:]).To(Equal([]span{
+			{Name: "bfs.OpenRange", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.ConditionalUpdate", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("a.txt")}},
+			{Name: "bfs.Rename", Attrs: []attribute.KeyValue{bfstrace.SrcKey.String("a.txt"), bfstrace.DstKey.String("b.txt")}},
+			{Name: "bfs.Grants", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("b.txt")}, Status: codes.Error},
+			{Name: "bfs.RemoveIfMatch", Attrs: []attribute.KeyValue{bfstrace.NameKey.String("b.txt")}, Status: codes.Error},
+		}))
+	})
+
+	It("should record errors", func() {
+		_, err := subject.Head(ctx, "missing.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+
+		ended := recorder.Ended()
+		Expect(ended).To(HaveLen(2))
+		Expect(ended[1].Name()).To(Equal("bfs.Head"))
+		Expect(ended[1].Status().Code).To(Equal(codes.Error))
+		Expect(ended[1].Events()).To(HaveLen(1))
+		Expect(ended[1].Events()[0].Name).To(Equal("exception"))
+	})
+
+	It("should propagate span contexts", func() {
+		ctx, root := provider.Tracer("bfstrace_test").Start(ctx, "root")
+		_, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		root.End()
+
+		ended := recorder.Ended()
+		Expect(ended).To(HaveLen(3))
+		Expect(ended[1].Name()).To(Equal("bfs.Head"))
+		Expect(ended[1].Parent().SpanID()).To(Equal(ended[2].SpanContext().SpanID()))
+	})
+})
+
+// ------------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "bfs/bfstrace")
+}
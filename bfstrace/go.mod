@@ -0,0 +1,14 @@
+module github.com/bsm/bfs/bfstrace
+
+go 1.16
+
+require (
+	github.com/bsm/bfs v0.9.0
+	github.com/onsi/ginkgo v1.8.0
+	github.com/onsi/gomega v1.5.0
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/sdk v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+)
+
+replace github.com/bsm/bfs => ../
@@ -0,0 +1,232 @@
+package bfs
+
+import (
+	"context"
+	"sync"
+)
+
+// WithConcurrencyLimit wraps a bucket and limits the number of operations
+// which are in flight at the same time to max. Operations wait for a free
+// slot or until their context is cancelled. Readers and writers returned by
+// Open, OpenRange and Create hold their slot until they are closed, committed
+// or discarded. Iterators returned by Glob release their slot immediately, so
+// that objects can be opened while iterating.
+func WithConcurrencyLimit(bucket Bucket, max int) Bucket {
+	if max < 1 {
+		max = 1
+	}
+	return &limitedBucket{Bucket: bucket, sem: make(chan struct{}, max)}
+}
+
+type limitedBucket struct {
+	Bucket
+	sem chan struct{}
+}
+
+func (b *limitedBucket) acquire(ctx context.Context) error {
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *limitedBucket) release() { <-b.sem }
+
+// Glob implements Bucket.
+func (b *limitedBucket) Glob(ctx context.Context, pattern string) (Iterator, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return b.Bucket.Glob(ctx, pattern)
+}
+
+// GlobAfter supports GlobAfter.
+func (b *limitedBucket) GlobAfter(ctx context.Context, pattern, after string) (Iterator, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return GlobAfter(ctx, b.Bucket, pattern, after)
+}
+
+// SortedGlob supports SortedGlob.
+func (b *limitedBucket) SortedGlob(ctx context.Context, pattern string) (Iterator, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return SortedGlob(ctx, b.Bucket, pattern)
+}
+
+// Head implements Bucket.
+func (b *limitedBucket) Head(ctx context.Context, name string) (*MetaInfo, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return b.Bucket.Head(ctx, name)
+}
+
+// Open implements Bucket.
+func (b *limitedBucket) Open(ctx context.Context, name string) (Reader, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	rc, err := b.Bucket.Open(ctx, name)
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	return &limitedReader{Reader: rc, release: b.release}, nil
+}
+
+// OpenRange supports OpenRange.
+func (b *limitedBucket) OpenRange(ctx context.Context, name string, offset, length int64) (Reader, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	rc, err := OpenRange(ctx, b.Bucket, name, offset, length)
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	return &limitedReader{Reader: rc, release: b.release}, nil
+}
+
+// Grants supports Grants.
+func (b *limitedBucket) Grants(ctx context.Context, name string) ([]Grant, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return Grants(ctx, b.Bucket, name)
+}
+
+// Create implements Bucket.
+func (b *limitedBucket) Create(ctx context.Context, name string, opts *WriteOptions) (Writer, error) {
+	if err := b.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	w, err := b.Bucket.Create(ctx, name, opts)
+	if err != nil {
+		b.release()
+		return nil, err
+	}
+	return &limitedWriter{Writer: w, release: b.release}, nil
+}
+
+// Remove implements Bucket.
+func (b *limitedBucket) Remove(ctx context.Context, name string) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return b.Bucket.Remove(ctx, name)
+}
+
+// ConditionalUpdate supports ConditionalUpdate.
+func (b *limitedBucket) ConditionalUpdate(ctx context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return ConditionalUpdate(ctx, b.Bucket, name, fn)
+}
+
+// RemoveIfMatch supports RemoveIfMatch.
+func (b *limitedBucket) RemoveIfMatch(ctx context.Context, name, version string) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return RemoveIfMatch(ctx, b.Bucket, name, version)
+}
+
+// Mkdir supports Mkdir.
+func (b *limitedBucket) Mkdir(ctx context.Context, prefix string) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return Mkdir(ctx, b.Bucket, prefix)
+}
+
+// Copy supports copying of objects within the bucket.
+func (b *limitedBucket) Copy(ctx context.Context, src, dst string) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return CopyObject(ctx, b.Bucket, src, dst, nil)
+}
+
+// Rename supports Rename.
+func (b *limitedBucket) Rename(ctx context.Context, src, dst string) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return Rename(ctx, b.Bucket, src, dst)
+}
+
+// Ping supports Ping.
+func (b *limitedBucket) Ping(ctx context.Context) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return Ping(ctx, b.Bucket)
+}
+
+// Describe returns information about the wrapped bucket.
+func (b *limitedBucket) Describe() BucketInfo {
+	info, _ := Describe(b.Bucket)
+	return info
+}
+
+// --------------------------------------------------------------------
+
+type limitedReader struct {
+	Reader
+	release func()
+	once    sync.Once
+}
+
+func (r *limitedReader) Close() error {
+	defer r.once.Do(r.release)
+	return r.Reader.Close()
+}
+
+type limitedWriter struct {
+	Writer
+	release func()
+	once    sync.Once
+}
+
+func (w *limitedWriter) Discard() error {
+	defer w.once.Do(w.release)
+	return w.Writer.Discard()
+}
+
+func (w *limitedWriter) Commit() error {
+	defer w.once.Do(w.release)
+	return w.Writer.Commit()
+}
@@ -0,0 +1,107 @@
+package bfs_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithConcurrencyLimit", func() {
+	var backend *inFlightBucket
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		backend = &inFlightBucket{Bucket: bfs.NewInMem()}
+		subject = bfs.WithConcurrencyLimit(backend, 3)
+		Expect(bfs.WriteObject(ctx, subject, "file.txt", []byte("TESTDATA"), nil)).To(Succeed())
+	})
+
+	It("should limit in-flight operations", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, err := subject.Head(ctx, "file.txt")
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		Expect(atomic.LoadInt32(&backend.peak)).To(BeNumerically("<=", 3))
+		Expect(atomic.LoadInt32(&backend.peak)).To(BeNumerically(">", 0))
+	})
+
+	It("should hold slots until readers and writers are closed", func() {
+		r, err := subject.Open(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+		w, err := subject.Create(ctx, "other.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+		r2, err := subject.Open(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = subject.Head(tctx, "file.txt")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		Expect(r.Close()).To(Succeed())
+		Expect(r.Close()).To(Succeed()) // released only once
+		_, err = subject.Head(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(w.Commit()).To(Succeed())
+		Expect(r2.Close()).To(Succeed())
+		Expect(bfs.List(ctx, subject, "*")).To(HaveLen(2))
+	})
+
+	It("should forward optional interfaces", func() {
+		capable := &capableBucket{InMem: bfs.NewInMem()}
+		subject = bfs.WithConcurrencyLimit(capable, 1)
+		Expect(bfs.WriteObject(ctx, capable, "file.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		r, err := bfs.OpenRange(ctx, subject, "file.txt", 0, 4)
+		Expect(err).NotTo(HaveOccurred())
+
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = bfs.Grants(tctx, subject, "file.txt")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(r.Close()).To(Succeed())
+
+		Expect(bfs.Grants(ctx, subject, "file.txt")).To(BeEmpty())
+		Expect(bfs.ConditionalUpdate(ctx, subject, "file.txt", nil)).To(Succeed())
+		Expect(bfs.Rename(ctx, subject, "file.txt", "other.txt")).To(Succeed())
+		Expect(bfs.RemoveIfMatch(ctx, subject, "file.txt", "v1")).To(Succeed())
+		Expect(capable.calls).To(Equal([]string{"OpenRange", "Grants", "ConditionalUpdate", "Rename", "RemoveIfMatch"}))
+	})
+})
+
+// inFlightBucket tracks the peak number of concurrent Head calls.
+type inFlightBucket struct {
+	bfs.Bucket
+	current, peak int32
+}
+
+func (b *inFlightBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	n := atomic.AddInt32(&b.current, 1)
+	defer atomic.AddInt32(&b.current, -1)
+
+	for {
+		peak := atomic.LoadInt32(&b.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&b.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return b.Bucket.Head(ctx, name)
+}
@@ -0,0 +1,102 @@
+package bfs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Logger is a minimal logging interface, satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ConnectOptions contain defaults which cannot be expressed as URL query
+// parameters. Resolvers can access them via ConnectOptionsFromContext.
+type ConnectOptions struct {
+	// Logger is passed to backends which support custom logging.
+	Logger Logger
+	// HTTPClient is used by HTTP based backends which support custom clients.
+	HTTPClient *http.Client
+	// Timeout is applied to every bucket operation, see WithTimeout.
+	Timeout time.Duration
+	// Resolver overrides the resolver registered for the URL scheme.
+	Resolver Resolver
+}
+
+// ConnectOption configures ConnectWith.
+type ConnectOption func(*ConnectOptions)
+
+// WithLogger sets a custom logger.
+func WithLogger(logger Logger) ConnectOption {
+	return func(o *ConnectOptions) { o.Logger = logger }
+}
+
+// WithHTTPClient sets a custom HTTP client.
+func WithHTTPClient(client *http.Client) ConnectOption {
+	return func(o *ConnectOptions) { o.HTTPClient = client }
+}
+
+// WithDefaultTimeout applies a default timeout to all bucket operations.
+func WithDefaultTimeout(timeout time.Duration) ConnectOption {
+	return func(o *ConnectOptions) { o.Timeout = timeout }
+}
+
+// WithResolver overrides the registered resolver.
+func WithResolver(resv Resolver) ConnectOption {
+	return func(o *ConnectOptions) { o.Resolver = resv }
+}
+
+type connectOptionsKey struct{}
+
+// ConnectOptionsFromContext returns the options passed to ConnectWith.
+// It returns nil if no options were given, e.g. if the bucket is resolved
+// through Connect or Resolve.
+func ConnectOptionsFromContext(ctx context.Context) *ConnectOptions {
+	opts, _ := ctx.Value(connectOptionsKey{}).(*ConnectOptions)
+	return opts
+}
+
+// ConnectWith connects to a bucket via URL, just like Connect, but accepts
+// additional options. Example:
+//
+//   bucket, err := bfs.ConnectWith(context.TODO(), "s3://bucket/prefix",
+//     bfs.WithHTTPClient(client),
+//     bfs.WithDefaultTimeout(time.Minute),
+//   )
+func ConnectWith(ctx context.Context, urlStr string, opts ...ConnectOption) (Bucket, error) {
+	return defaultRegistry.ConnectWith(ctx, urlStr, opts...)
+}
+
+// ConnectWith connects to a bucket via URL, just like Connect, but accepts
+// additional options.
+func (r *Registry) ConnectWith(ctx context.Context, urlStr string, opts ...ConnectOption) (Bucket, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	options := new(ConnectOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
+	if len(opts) != 0 {
+		ctx = context.WithValue(ctx, connectOptionsKey{}, options)
+	}
+
+	var bucket Bucket
+	if options.Resolver != nil {
+		bucket, err = options.Resolver(ctx, u)
+	} else {
+		bucket, err = r.Resolve(ctx, u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Timeout > 0 {
+		bucket = WithTimeout(bucket, options.Timeout)
+	}
+	return bucket, nil
+}
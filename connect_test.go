@@ -0,0 +1,133 @@
+package bfs_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConnectWith", func() {
+	var ctx = context.Background()
+
+	It("should connect", func() {
+		bucket, err := bfs.ConnectWith(ctx, "mem://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket).To(BeAssignableToTypeOf(&bfs.InMem{}))
+		Expect(bucket.Close()).To(Succeed())
+
+		_, err = bfs.ConnectWith(ctx, "unknown://bucket")
+		Expect(err).To(MatchError(`bfs: unknown URL scheme "unknown"`))
+	})
+
+	It("should pass options to resolvers", func() {
+		var opts *bfs.ConnectOptions
+		client := new(http.Client)
+
+		bucket, err := bfs.ConnectWith(ctx, "custom://bucket",
+			bfs.WithHTTPClient(client),
+			bfs.WithResolver(func(ctx context.Context, u *url.URL) (bfs.Bucket, error) {
+				opts = bfs.ConnectOptionsFromContext(ctx)
+				Expect(u.Host).To(Equal("bucket"))
+				return bfs.NewInMem(), nil
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket.Close()).To(Succeed())
+		Expect(opts).NotTo(BeNil())
+		Expect(opts.HTTPClient).To(BeIdenticalTo(client))
+		Expect(bfs.ConnectOptionsFromContext(ctx)).To(BeNil())
+	})
+
+	It("should not pass options to resolvers if none were given", func() {
+		var reg bfs.Registry
+		var opts = new(bfs.ConnectOptions)
+		reg.Register("custom", func(ctx context.Context, _ *url.URL) (bfs.Bucket, error) {
+			opts = bfs.ConnectOptionsFromContext(ctx)
+			return bfs.NewInMem(), nil
+		})
+
+		bucket, err := reg.Connect(ctx, "custom://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket.Close()).To(Succeed())
+		Expect(opts).To(BeNil())
+	})
+
+	It("should apply default timeouts", func() {
+		probe := &deadlineProbe{InMem: bfs.NewInMem()}
+		bucket, err := bfs.ConnectWith(ctx, "mem://bucket",
+			bfs.WithDefaultTimeout(time.Minute),
+			bfs.WithResolver(func(_ context.Context, _ *url.URL) (bfs.Bucket, error) {
+				return probe, nil
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = bucket.Head(ctx, "missing")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+		Expect(probe.deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+	})
+})
+
+type deadlineProbe struct {
+	*bfs.InMem
+	deadline time.Time
+}
+
+func (p *deadlineProbe) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	p.deadline, _ = ctx.Deadline()
+	return p.InMem.Head(ctx, name)
+}
+
+var _ = Describe("Registry", func() {
+	var ctx = context.Background()
+
+	It("should resolve schemes independently", func() {
+		a, b := bfs.NewInMem(), bfs.NewInMem()
+
+		var ra, rb bfs.Registry
+		ra.Register("mem", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) { return a, nil })
+		rb.Register("mem", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) { return b, nil })
+
+		bucket, err := ra.Connect(ctx, "mem://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket).To(BeIdenticalTo(a))
+
+		bucket, err = rb.Connect(ctx, "mem://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket).To(BeIdenticalTo(b))
+
+		u, _ := url.Parse("mem://bucket")
+		Expect(ra.Resolve(ctx, u)).To(BeIdenticalTo(a))
+
+		// the default registry is not affected
+		bucket, err = bfs.Connect(ctx, "mem://bucket")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket).NotTo(BeIdenticalTo(a))
+		Expect(bucket).NotTo(BeIdenticalTo(b))
+	})
+
+	It("should apply options", func() {
+		var r bfs.Registry
+		r.Register("mem", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) { return bfs.NewInMem(), nil })
+
+		bucket, err := r.ConnectWith(ctx, "mem://bucket", bfs.WithDefaultTimeout(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bucket).NotTo(BeAssignableToTypeOf(&bfs.InMem{}))
+	})
+
+	It("should reject unknown and duplicate schemes", func() {
+		var r bfs.Registry
+		_, err := r.Connect(ctx, "mem://bucket")
+		Expect(err).To(MatchError(`bfs: unknown URL scheme "mem"`))
+
+		r.Register("mem", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) { return bfs.NewInMem(), nil })
+		Expect(func() {
+			r.Register("mem", func(_ context.Context, _ *url.URL) (bfs.Bucket, error) { return bfs.NewInMem(), nil })
+		}).To(Panic())
+	})
+})
@@ -0,0 +1,80 @@
+package bfs
+
+import "context"
+
+// ContextBucket binds a bucket to a context, see WithDefaultContext.
+type ContextBucket struct {
+	ctx    context.Context
+	bucket Bucket
+}
+
+// WithDefaultContext binds ctx to a bucket, e.g. a request context in HTTP
+// handlers, and returns a wrapper whose methods omit the context parameter.
+// Once ctx is done, all operations fail with the context error. Readers,
+// writers and iterators inherit the bound context, so writers cannot be
+// committed after ctx is cancelled.
+func WithDefaultContext(ctx context.Context, bucket Bucket) ContextBucket {
+	return ContextBucket{ctx: ctx, bucket: bucket}
+}
+
+// Context returns the bound context.
+func (b ContextBucket) Context() context.Context { return b.ctx }
+
+// Bucket returns the underlying bucket.
+func (b ContextBucket) Bucket() Bucket { return b.bucket }
+
+// Glob lists objects, see Bucket.Glob.
+func (b ContextBucket) Glob(pattern string) (Iterator, error) {
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.bucket.Glob(b.ctx, pattern)
+}
+
+// Head returns an object's meta info, see Bucket.Head.
+func (b ContextBucket) Head(name string) (*MetaInfo, error) {
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.bucket.Head(b.ctx, name)
+}
+
+// Open opens an object for reading, see Bucket.Open.
+func (b ContextBucket) Open(name string) (Reader, error) {
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.bucket.Open(b.ctx, name)
+}
+
+// Create creates/opens an object for writing, see Bucket.Create.
+func (b ContextBucket) Create(name string, opts *WriteOptions) (Writer, error) {
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.bucket.Create(b.ctx, name, opts)
+}
+
+// Remove removes an object, see Bucket.Remove.
+func (b ContextBucket) Remove(name string) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	return b.bucket.Remove(b.ctx, name)
+}
+
+// Copy copies an object, see CopyObject.
+func (b ContextBucket) Copy(src, dst string) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	return CopyObject(b.ctx, b.bucket, src, dst, nil)
+}
+
+// Rename renames an object, see Rename.
+func (b ContextBucket) Rename(src, dst string) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	return Rename(b.ctx, b.bucket, src, dst)
+}
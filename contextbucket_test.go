@@ -0,0 +1,78 @@
+package bfs_test
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithDefaultContext", func() {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var subject bfs.ContextBucket
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		subject = bfs.WithDefaultContext(ctx, bfs.NewInMem())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should use the bound context", func() {
+		w, err := subject.Create("a.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+		Expect(w.Write([]byte("TESTDATA"))).To(Equal(8))
+		Expect(w.Commit()).To(Succeed())
+
+		Expect(subject.Copy("a.txt", "b.txt")).To(Succeed())
+		Expect(subject.Rename("b.txt", "c.txt")).To(Succeed())
+		Expect(subject.Remove("a.txt")).To(Succeed())
+
+		info, err := subject.Head("c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+
+		r, err := subject.Open("c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+
+		iter, err := subject.Glob("*")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Name()).To(Equal("c.txt"))
+		Expect(iter.Next()).To(BeFalse())
+
+		Expect(subject.Context()).To(Equal(ctx))
+	})
+
+	It("should abort operations once the context is cancelled", func() {
+		Expect(bfs.WriteObject(ctx, subject.Bucket(), "a.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		w, err := subject.Create("b.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		cancel()
+		Expect(w.Commit()).To(Equal(context.Canceled))
+
+		_, err = subject.Head("a.txt")
+		Expect(err).To(Equal(context.Canceled))
+		_, err = subject.Open("a.txt")
+		Expect(err).To(Equal(context.Canceled))
+		_, err = subject.Glob("*")
+		Expect(err).To(Equal(context.Canceled))
+		_, err = subject.Create("c.txt", nil)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(subject.Remove("a.txt")).To(Equal(context.Canceled))
+		Expect(subject.Copy("a.txt", "c.txt")).To(Equal(context.Canceled))
+		Expect(subject.Rename("a.txt", "c.txt")).To(Equal(context.Canceled))
+	})
+})
@@ -0,0 +1,113 @@
+package bfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// ErrNotFound must be returned by all implementations
+// when a requested object cannot be found.
+var ErrNotFound = errors.New("bfs: object not found")
+
+// ErrAccessDenied is returned by implementations when an operation
+// is not permitted. It may wrap the original backend error, please
+// use errors.Is to check for it.
+var ErrAccessDenied = errors.New("bfs: access denied")
+
+// ErrNotSupported is returned by implementations when a requested
+// feature or option is not supported by the backend.
+var ErrNotSupported = errors.New("bfs: not supported")
+
+// ErrInvalidName is returned by ValidateName and by implementations
+// which reject unsafe object names.
+var ErrInvalidName = internal.ErrInvalidName
+
+// ErrEmptyPattern is returned by ValidatePattern and by all implementations
+// when Glob is called with an empty pattern. Please use "**" to match all
+// objects.
+var ErrEmptyPattern = errors.New("bfs: empty glob pattern, use \"**\" to match all")
+
+// ErrNotReady is returned by implementations when an object exists but
+// cannot be read yet, e.g. because it is archived and must be restored
+// first. It may wrap the original backend error.
+var ErrNotReady = errors.New("bfs: object not ready")
+
+// ErrMetadataTooLarge is returned by ValidateMetadata and by implementations
+// when the metadata of an object exceeds the backend's size limit.
+var ErrMetadataTooLarge = errors.New("bfs: metadata too large")
+
+// ErrInvalidMetadata is returned by ValidateMetadata and by implementations
+// when metadata keys contain characters which cannot be stored.
+var ErrInvalidMetadata = errors.New("bfs: invalid metadata")
+
+// ErrInvalidRange is returned by ValidateRange and by OpenRange when the
+// offset is negative or the length is not positive.
+var ErrInvalidRange = errors.New("bfs: invalid range")
+
+// ErrVerifyFailed is returned by writers created with
+// WriteOptions.VerifyAfterWrite when a committed object does not
+// match the written content.
+var ErrVerifyFailed = errors.New("bfs: verification failed")
+
+// ErrUnexpectedEOF is returned by readers when the content of an object ends
+// before the announced number of bytes was received, e.g. because the
+// connection was interrupted. It also satisfies
+// errors.Is(err, io.ErrUnexpectedEOF).
+var ErrUnexpectedEOF error = unexpectedEOF{}
+
+type unexpectedEOF struct{}
+
+func (unexpectedEOF) Error() string { return "bfs: unexpected EOF, content is truncated" }
+func (unexpectedEOF) Unwrap() error { return io.ErrUnexpectedEOF }
+
+// ErrConflict is returned by conditional updates when an object was
+// modified concurrently, between reading and writing it.
+var ErrConflict = errors.New("bfs: object was modified concurrently")
+
+// ErrExists is returned by conditional writes and copies when the
+// destination object already exists.
+var ErrExists = errors.New("bfs: object already exists")
+
+// ErrSourceNotRemoved is returned by Rename when an object was copied to its
+// destination, but the source could not be removed. The source still exists
+// and the removal can be retried.
+var ErrSourceNotRemoved = errors.New("bfs: object was copied, but the source could not be removed")
+
+// WrapError annotates a backend-specific cause with a sentinel error,
+// e.g. ErrAccessDenied. The result satisfies errors.Is(err, sentinel) while
+// errors.Unwrap returns the original cause.
+func WrapError(sentinel, cause error) error {
+	return &wrappedError{sentinel: sentinel, cause: cause}
+}
+
+type wrappedError struct {
+	sentinel, cause error
+}
+
+func (e *wrappedError) Error() string        { return e.sentinel.Error() + ": " + e.cause.Error() }
+func (e *wrappedError) Unwrap() error        { return e.cause }
+func (e *wrappedError) Is(target error) bool { return target == e.sentinel }
+
+// BatchError is returned by operations on multiple objects when one or more
+// of them failed. It maps object names to errors.
+type BatchError map[string]error
+
+// Error implements error.
+func (e BatchError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(names))
+	for _, name := range names {
+		msgs = append(msgs, name+": "+e[name].Error())
+	}
+	return fmt.Sprintf("bfs: %d object(s) failed: %s", len(e), strings.Join(msgs, "; "))
+}
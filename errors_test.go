@@ -0,0 +1,30 @@
+package bfs_test
+
+import (
+	"errors"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WrapError", func() {
+	It("should wrap errors", func() {
+		cause := errors.New("forbidden")
+		err := bfs.WrapError(bfs.ErrAccessDenied, cause)
+		Expect(err.Error()).To(Equal("bfs: access denied: forbidden"))
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+		Expect(errors.Is(err, bfs.ErrNotFound)).To(BeFalse())
+		Expect(errors.Unwrap(err)).To(Equal(cause))
+	})
+})
+
+var _ = Describe("BatchError", func() {
+	It("should list failed objects", func() {
+		err := bfs.BatchError{
+			"b.txt": errors.New("boom"),
+			"a.txt": bfs.ErrNotFound,
+		}
+		Expect(err.Error()).To(Equal("bfs: 2 object(s) failed: a.txt: bfs: object not found; b.txt: boom"))
+	})
+})
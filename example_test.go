@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"time"
 
 	"github.com/bsm/bfs"
 )
@@ -58,3 +60,30 @@ func ExampleInMem() {
 		panic(err)
 	}
 }
+
+func ExampleConnectWith() {
+	ctx := context.Background()
+
+	bucket, err := bfs.ConnectWith(ctx, "mem://bucket",
+		bfs.WithDefaultTimeout(time.Minute),
+		bfs.WithHTTPClient(&http.Client{Timeout: 10 * time.Second}),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer bucket.Close()
+
+	// Write object, the operation will time out after a minute
+	if err := bfs.WriteObject(ctx, bucket, "file.txt", []byte("TESTDATA"), nil); err != nil {
+		panic(err)
+	}
+
+	info, err := bucket.Head(ctx, "file.txt")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("INFO: name=%q size=%d\n", info.Name, info.Size)
+
+	// Output:
+	// INFO: name="file.txt" size=8
+}
@@ -0,0 +1,222 @@
+package bfs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// WithExistenceCache wraps a bucket and caches the results of Head, and
+// therefore of Exists, for ttl. Both found objects and ErrNotFound results
+// are cached. Entries are invalidated when an object is written through
+// Create or ConditionalUpdate, removed through Remove or RemoveIfMatch or
+// when it is the destination of Copy or Rename on the returned bucket. Names are normalized, i.e. "/a.txt" and
+// "a.txt" share an entry.
+//
+// Please note that changes which are not made through the returned bucket,
+// e.g. by other processes, are not noticed: Head may report outdated
+// information for up to ttl.
+func WithExistenceCache(bucket Bucket, ttl time.Duration) Bucket {
+	return &existenceCache{
+		Bucket:  bucket,
+		ttl:     ttl,
+		entries: make(map[string]existenceEntry),
+		flights: make(map[string]*existenceFlight),
+	}
+}
+
+type existenceCache struct {
+	Bucket
+	ttl time.Duration
+
+	entries map[string]existenceEntry
+	flights map[string]*existenceFlight
+	mu      sync.Mutex
+}
+
+type existenceEntry struct {
+	info    *MetaInfo // nil if not found
+	expires time.Time
+}
+
+// existenceFlight tracks the Head calls of a name which are in flight. The
+// generation is bumped on invalidation, results of calls which started in an
+// earlier generation are not cached.
+type existenceFlight struct {
+	calls      int
+	generation uint64
+}
+
+// existenceKey normalizes names, e.g. "/a.txt" and "a.txt" share an entry.
+// Trailing slashes of directory markers are retained.
+func existenceKey(name string) string {
+	key := strings.TrimPrefix(internal.WithinNamespace("/", name), "/")
+	if strings.HasSuffix(name, "/") && key != "" {
+		key += "/"
+	}
+	return key
+}
+
+// lookup returns a cached entry. On a miss, it registers a Head call in
+// flight and returns the current generation of the name.
+func (b *existenceCache) lookup(key string) (existenceEntry, uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ent, ok := b.entries[key]
+	if ok && internal.Now().Before(ent.expires) {
+		return ent, 0, true
+	}
+	delete(b.entries, key)
+
+	flight, ok := b.flights[key]
+	if !ok {
+		flight = new(existenceFlight)
+		b.flights[key] = flight
+	}
+	flight.calls++
+	return ent, flight.generation, false
+}
+
+// store caches the result of a Head call, unless the name was invalidated
+// since the call started.
+func (b *existenceCache) store(key string, generation uint64, info *MetaInfo, cache bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	flight := b.flights[key]
+	if cache && flight.generation == generation {
+		b.entries[key] = existenceEntry{info: info, expires: internal.Now().Add(b.ttl)}
+	}
+	if flight.calls--; flight.calls == 0 {
+		delete(b.flights, key)
+	}
+}
+
+func (b *existenceCache) invalidate(names ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, name := range names {
+		key := existenceKey(name)
+		delete(b.entries, key)
+		if flight, ok := b.flights[key]; ok {
+			flight.generation++
+		}
+	}
+}
+
+// Head implements Bucket.
+func (b *existenceCache) Head(ctx context.Context, name string) (*MetaInfo, error) {
+	key := existenceKey(name)
+	ent, generation, ok := b.lookup(key)
+	if ok {
+		if ent.info == nil {
+			return nil, ErrNotFound
+		}
+		info := *ent.info
+		return &info, nil
+	}
+
+	info, err := b.Bucket.Head(ctx, name)
+	if err == ErrNotFound {
+		b.store(key, generation, nil, true)
+	} else if err == nil {
+		cached := *info
+		b.store(key, generation, &cached, true)
+	} else {
+		b.store(key, generation, nil, false)
+	}
+	return info, err
+}
+
+// Create implements Bucket.
+func (b *existenceCache) Create(ctx context.Context, name string, opts *WriteOptions) (Writer, error) {
+	w, err := b.Bucket.Create(ctx, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &existenceWriter{Writer: w, invalidate: func() { b.invalidate(name) }}, nil
+}
+
+// Remove implements Bucket.
+func (b *existenceCache) Remove(ctx context.Context, name string) error {
+	defer b.invalidate(name)
+	return b.Bucket.Remove(ctx, name)
+}
+
+// OpenRange supports OpenRange.
+func (b *existenceCache) OpenRange(ctx context.Context, name string, offset, length int64) (Reader, error) {
+	return OpenRange(ctx, b.Bucket, name, offset, length)
+}
+
+// Grants supports Grants.
+func (b *existenceCache) Grants(ctx context.Context, name string) ([]Grant, error) {
+	return Grants(ctx, b.Bucket, name)
+}
+
+// ConditionalUpdate supports ConditionalUpdate.
+func (b *existenceCache) ConditionalUpdate(ctx context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	defer b.invalidate(name)
+	return ConditionalUpdate(ctx, b.Bucket, name, fn)
+}
+
+// RemoveIfMatch supports RemoveIfMatch.
+func (b *existenceCache) RemoveIfMatch(ctx context.Context, name, version string) error {
+	defer b.invalidate(name)
+	return RemoveIfMatch(ctx, b.Bucket, name, version)
+}
+
+// Mkdir supports Mkdir. Marker objects written by Mkdir are invalidated.
+func (b *existenceCache) Mkdir(ctx context.Context, prefix string) error {
+	defer b.invalidate(strings.Trim(prefix, "/") + "/")
+	return Mkdir(ctx, b.Bucket, prefix)
+}
+
+// Copy supports copying of objects within the bucket.
+func (b *existenceCache) Copy(ctx context.Context, src, dst string) error {
+	defer b.invalidate(dst)
+	return CopyObject(ctx, b.Bucket, src, dst, nil)
+}
+
+// Rename supports Rename.
+func (b *existenceCache) Rename(ctx context.Context, src, dst string) error {
+	defer b.invalidate(src, dst)
+	return Rename(ctx, b.Bucket, src, dst)
+}
+
+// GlobAfter supports GlobAfter.
+func (b *existenceCache) GlobAfter(ctx context.Context, pattern, after string) (Iterator, error) {
+	return GlobAfter(ctx, b.Bucket, pattern, after)
+}
+
+// SortedGlob supports SortedGlob.
+func (b *existenceCache) SortedGlob(ctx context.Context, pattern string) (Iterator, error) {
+	return SortedGlob(ctx, b.Bucket, pattern)
+}
+
+// Ping supports Ping.
+func (b *existenceCache) Ping(ctx context.Context) error {
+	return Ping(ctx, b.Bucket)
+}
+
+// Describe returns information about the wrapped bucket.
+func (b *existenceCache) Describe() BucketInfo {
+	info, _ := Describe(b.Bucket)
+	return info
+}
+
+// --------------------------------------------------------------------
+
+type existenceWriter struct {
+	Writer
+	invalidate func()
+}
+
+func (w *existenceWriter) Commit() error {
+	defer w.invalidate()
+	return w.Writer.Commit()
+}
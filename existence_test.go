@@ -0,0 +1,168 @@
+package bfs_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithExistenceCache", func() {
+	var backend *headRecordingBucket
+	var subject bfs.Bucket
+	var ctx = context.Background()
+	var now time.Time
+	var restoreClock func()
+
+	BeforeEach(func() {
+		now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		restoreClock = internal.SetClock(func() time.Time { return now })
+
+		backend = &headRecordingBucket{Bucket: bfs.NewInMem()}
+		subject = bfs.WithExistenceCache(backend, time.Minute)
+		Expect(bfs.WriteObject(ctx, backend, "a.txt", []byte("TESTDATA"), nil)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		restoreClock()
+	})
+
+	It("should cache existence", func() {
+		for i := 0; i < 3; i++ {
+			Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+			Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeFalse())
+		}
+		Expect(backend.heads()).To(Equal(int32(2)))
+
+		info, err := subject.Head(ctx, "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+		Expect(backend.heads()).To(Equal(int32(2)))
+	})
+
+	It("should invalidate on writes", func() {
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeFalse())
+		Expect(bfs.Exists(ctx, subject, "c.txt")).To(BeFalse())
+
+		Expect(bfs.WriteObject(ctx, subject, "b.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeTrue())
+
+		Expect(subject.Remove(ctx, "a.txt")).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeFalse())
+
+		Expect(bfs.CopyObject(ctx, subject, "b.txt", "c.txt", nil)).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "c.txt")).To(BeTrue())
+
+		Expect(bfs.Rename(ctx, subject, "c.txt", "a.txt")).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(bfs.Exists(ctx, subject, "c.txt")).To(BeFalse())
+		Expect(backend.heads()).To(Equal(int32(8)))
+	})
+
+	It("should forward optional interfaces", func() {
+		capable := &capableBucket{InMem: bfs.NewInMem()}
+		subject = bfs.WithExistenceCache(capable, time.Minute)
+		Expect(bfs.WriteObject(ctx, capable, "a.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		r, err := bfs.OpenRange(ctx, subject, "a.txt", 0, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Close()).To(Succeed())
+		Expect(bfs.Grants(ctx, subject, "a.txt")).To(BeEmpty())
+
+		// removals invalidate cached entries
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(capable.Remove(ctx, "a.txt")).To(Succeed())
+		Expect(bfs.RemoveIfMatch(ctx, subject, "a.txt", "v1")).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeFalse())
+
+		// updates invalidate cached entries
+		Expect(bfs.WriteObject(ctx, capable, "a.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		Expect(bfs.ConditionalUpdate(ctx, subject, "a.txt", nil)).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(capable.calls).To(Equal([]string{"OpenRange", "Grants", "RemoveIfMatch", "ConditionalUpdate"}))
+	})
+
+	It("should normalize names", func() {
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(bfs.Exists(ctx, subject, "/a.txt")).To(BeTrue())
+		Expect(bfs.Exists(ctx, subject, "./a.txt")).To(BeTrue())
+		Expect(backend.heads()).To(Equal(int32(1)))
+
+		Expect(bfs.Exists(ctx, subject, "a.txt/")).To(BeFalse())
+		Expect(backend.heads()).To(Equal(int32(2)))
+
+		Expect(subject.Remove(ctx, "/a.txt")).To(Succeed())
+		Expect(bfs.Exists(ctx, subject, "a.txt")).To(BeTrue())
+		Expect(backend.heads()).To(Equal(int32(3)))
+	})
+
+	It("should not cache results of heads which raced with writes", func() {
+		blocking := &blockingHeadBucket{Bucket: backend, entered: make(chan struct{}), release: make(chan struct{})}
+		subject = bfs.WithExistenceCache(blocking, time.Minute)
+
+		done := make(chan bool)
+		go func() {
+			defer GinkgoRecover()
+
+			ok, err := bfs.Exists(ctx, subject, "b.txt")
+			Expect(err).NotTo(HaveOccurred())
+			done <- ok
+		}()
+
+		<-blocking.entered
+		Expect(bfs.WriteObject(ctx, subject, "b.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		close(blocking.release)
+		Expect(<-done).To(BeFalse())
+
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeTrue())
+	})
+
+	It("should expire entries", func() {
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeFalse())
+
+		// changes through the backend are not noticed until entries expire
+		Expect(bfs.WriteObject(ctx, backend, "b.txt", []byte("TESTDATA"), nil)).To(Succeed())
+		now = now.Add(59 * time.Second)
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeFalse())
+
+		now = now.Add(time.Second)
+		Expect(bfs.Exists(ctx, subject, "b.txt")).To(BeTrue())
+		Expect(backend.heads()).To(Equal(int32(2)))
+	})
+})
+
+// blockingHeadBucket signals entered once the first Head call has
+// completed and blocks it until release is closed.
+type blockingHeadBucket struct {
+	bfs.Bucket
+	entered, release chan struct{}
+	once             sync.Once
+}
+
+func (b *blockingHeadBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	info, err := b.Bucket.Head(ctx, name)
+	b.once.Do(func() {
+		close(b.entered)
+		<-b.release
+	})
+	return info, err
+}
+
+// headRecordingBucket records the number of Head calls.
+type headRecordingBucket struct {
+	bfs.Bucket
+	n int32
+}
+
+func (b *headRecordingBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	atomic.AddInt32(&b.n, 1)
+	return b.Bucket.Head(ctx, name)
+}
+
+func (b *headRecordingBucket) heads() int32 { return atomic.LoadInt32(&b.n) }
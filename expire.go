@@ -0,0 +1,93 @@
+package bfs
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// MetaExpiresAt is the metadata key under which the expiry of an object is
+// recorded as an RFC 3339 timestamp, see WriteOptions.ExpiresIn.
+const MetaExpiresAt = "Bfs-Expires-At"
+
+// ExpiresAt returns the expiry recorded in object metadata, if any.
+func ExpiresAt(meta Metadata) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, meta.Get(MetaExpiresAt))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Expirer removes objects past their recorded expiry, see
+// WriteOptions.ExpiresIn. Object stores cannot delete objects by themselves
+// (unless configured with backend-specific lifecycle rules), so services
+// should run Expire periodically.
+type Expirer struct {
+	bucket      Bucket
+	concurrency int
+}
+
+// NewExpirer inits a new expirer. Up to concurrency objects are inspected
+// and removed in parallel.
+func NewExpirer(bucket Bucket, concurrency int) *Expirer {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Expirer{bucket: bucket, concurrency: concurrency}
+}
+
+// Expire scans all objects matching pattern and removes those which have
+// expired. Objects without a recorded expiry are left untouched. It returns
+// the number of removed objects.
+//
+// A BatchError is returned if one or more objects failed to be inspected or
+// removed.
+func (e *Expirer) Expire(ctx context.Context, pattern string) (int, error) {
+	iter, err := e.bucket.Glob(ctx, pattern)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	now := internal.Now()
+
+	var removed int32
+	failed, err := internal.ForEachName(ctx, iter, e.concurrency, func(name string) error {
+		ok, err := e.expireObject(ctx, name, now)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if ok {
+			atomic.AddInt32(&removed, 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return int(removed), err
+	}
+	if len(failed) != 0 {
+		return int(removed), BatchError(failed)
+	}
+	return int(removed), nil
+}
+
+func (e *Expirer) expireObject(ctx context.Context, name string, now time.Time) (bool, error) {
+	info, err := e.bucket.Head(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	if expiresAt, ok := ExpiresAt(info.Metadata); !ok || expiresAt.After(now) {
+		return false, nil
+	}
+	if err := e.bucket.Remove(ctx, name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
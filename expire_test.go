@@ -0,0 +1,87 @@
+package bfs_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expirer", func() {
+	var bucket *bfs.InMem
+	var subject *bfs.Expirer
+	var ctx = context.Background()
+	var now time.Time
+	var restoreClock func()
+
+	BeforeEach(func() {
+		now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		restoreClock = internal.SetClock(func() time.Time { return now })
+
+		bucket = bfs.NewInMem()
+		subject = bfs.NewExpirer(bucket, 2)
+
+		Expect(bfs.WriteObject(ctx, bucket, "a/1.txt", []byte("one"), &bfs.WriteOptions{ExpiresIn: time.Hour})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "a/2.txt", []byte("two"), &bfs.WriteOptions{ExpiresIn: 48 * time.Hour})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "a/3.txt", []byte("three"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b/4.txt", []byte("four"), &bfs.WriteOptions{ExpiresIn: time.Hour})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		restoreClock()
+	})
+
+	It("should record expiry", func() {
+		info, err := bucket.Head(ctx, "a/1.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(Equal(bfs.Metadata{bfs.MetaExpiresAt: "2020-01-01T13:00:00Z"}))
+
+		expiresAt, ok := bfs.ExpiresAt(info.Metadata)
+		Expect(ok).To(BeTrue())
+		Expect(expiresAt).To(BeTemporally("==", now.Add(time.Hour)))
+
+		info, err = bucket.Head(ctx, "a/3.txt")
+		Expect(err).NotTo(HaveOccurred())
+		_, ok = bfs.ExpiresAt(info.Metadata)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should not overwrite explicit expiry", func() {
+		opts := &bfs.WriteOptions{
+			Metadata:  bfs.Metadata{"bfs-expires-at": "2021-01-01T00:00:00Z"},
+			ExpiresIn: time.Hour,
+		}
+		Expect(opts.GetMetadata()).To(Equal(bfs.Metadata{bfs.MetaExpiresAt: "2021-01-01T00:00:00Z"}))
+	})
+
+	It("should remove expired objects", func() {
+		Expect(subject.Expire(ctx, "**")).To(Equal(0))
+		Expect(bfs.List(ctx, bucket, "**")).To(HaveLen(4))
+
+		now = now.Add(2 * time.Hour)
+		Expect(subject.Expire(ctx, "a/**")).To(Equal(1))
+		Expect(bfs.Exists(ctx, bucket, "a/1.txt")).To(BeFalse())
+		Expect(bfs.Exists(ctx, bucket, "b/4.txt")).To(BeTrue())
+
+		now = now.Add(72 * time.Hour)
+		Expect(subject.Expire(ctx, "**")).To(Equal(2))
+		Expect(bfs.List(ctx, bucket, "**")).To(HaveLen(1))
+		Expect(bfs.Exists(ctx, bucket, "a/3.txt")).To(BeTrue())
+	})
+
+	It("should aggregate errors", func() {
+		now = now.Add(2 * time.Hour)
+
+		n, err := bfs.NewExpirer(unremovableBucket{bucket}, 2).Expire(ctx, "**")
+		Expect(n).To(Equal(0))
+
+		var batch bfs.BatchError
+		Expect(errors.As(err, &batch)).To(BeTrue())
+		Expect(batch).To(HaveLen(2))
+		Expect(batch).To(HaveKeyWithValue("a/1.txt", bfs.ErrAccessDenied))
+	})
+})
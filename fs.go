@@ -0,0 +1,288 @@
+//go:build go1.16
+// +build go1.16
+
+package bfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AsFS returns a read-only fs.FS adapter for the bucket. The adapter
+// implements fs.FS, fs.ReadDirFS and fs.StatFS and can be used with
+// http.FileServer, template.ParseFS and similar.
+//
+// Directories are emulated from object names: a directory exists if at
+// least one object name starts with its path, followed by a slash. Listing
+// a directory requires a full listing of all objects below it. Files opened
+// via the adapter implement io.Seeker, seeking may re-open the underlying
+// object. Writes are not supported.
+//
+// The given context is used for all bucket operations.
+func AsFS(ctx context.Context, bucket Bucket) fs.FS {
+	return &bucketFS{ctx: ctx, bucket: bucket}
+}
+
+type bucketFS struct {
+	ctx    context.Context
+	bucket Bucket
+}
+
+// Open implements fs.FS.
+func (f *bucketFS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &fsDir{fsys: f, name: name, info: info}, nil
+	}
+	return &fsFile{fsys: f, name: name, info: info}, nil
+}
+
+// Stat implements fs.StatFS.
+func (f *bucketFS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *bucketFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		if _, err := f.bucket.Head(f.ctx, name); err == nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return entries, nil
+}
+
+func (f *bucketFS) stat(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &fsInfo{name: ".", dir: true}, nil
+	}
+
+	info, err := f.bucket.Head(f.ctx, name)
+	if err == nil {
+		return &fsInfo{name: path.Base(name), size: info.Size, modTime: info.ModTime}, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	iter, err := f.bucket.Glob(f.ctx, escapePattern(name)+"/**")
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer iter.Close()
+
+	if iter.Next() {
+		return &fsInfo{name: path.Base(name), dir: true}, nil
+	} else if err := iter.Error(); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *bucketFS) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	iter, err := f.bucket.Glob(f.ctx, escapePattern(prefix)+"**")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	seen := make(map[string]struct{})
+	var entries []fs.DirEntry
+	for iter.Next() {
+		rel := strings.TrimPrefix(iter.Name(), prefix)
+
+		var info *fsInfo
+		if pos := strings.IndexByte(rel, '/'); pos > -1 {
+			info = &fsInfo{name: rel[:pos], dir: true}
+		} else {
+			info = &fsInfo{name: rel, size: iter.Size(), modTime: iter.ModTime()}
+		}
+
+		if _, ok := seen[info.name]; ok {
+			continue
+		}
+		seen[info.name] = struct{}{}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// --------------------------------------------------------------------
+
+type fsInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *fsInfo) Name() string       { return i.name }
+func (i *fsInfo) Size() int64        { return i.size }
+func (i *fsInfo) ModTime() time.Time { return i.modTime }
+func (i *fsInfo) IsDir() bool        { return i.dir }
+func (i *fsInfo) Sys() interface{}   { return nil }
+func (i *fsInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// --------------------------------------------------------------------
+
+type fsFile struct {
+	fsys *bucketFS
+	name string
+	info fs.FileInfo
+
+	rc     Reader
+	rcPos  int64 // position of rc
+	pos    int64 // logical position
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.pos >= f.info.Size() {
+		return 0, io.EOF
+	}
+
+	if f.rc == nil || f.rcPos != f.pos {
+		if err := f.reopen(); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	}
+
+	n, err := f.rc.Read(p)
+	f.rcPos += int64(n)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+	return nil
+}
+
+// reopen (re-)opens the object at the current position.
+func (f *fsFile) reopen() error {
+	if f.rc != nil {
+		_ = f.rc.Close()
+		f.rc = nil
+	}
+
+	rc, err := OpenRange(f.fsys.ctx, f.fsys.bucket, f.name, f.pos, f.info.Size()-f.pos)
+	if err != nil {
+		return err
+	}
+
+	f.rc, f.rcPos = rc, f.pos
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type fsDir struct {
+	fsys *bucketFS
+	name string
+	info fs.FileInfo
+
+	entries []fs.DirEntry
+	pos     int
+	read    bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *fsDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.readDir(d.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entries, d.read = entries, true
+	}
+
+	rest := d.entries[d.pos:]
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.pos += n
+	return rest[:n], nil
+}
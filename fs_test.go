@@ -0,0 +1,151 @@
+//go:build go1.22
+// +build go1.22
+
+package bfs_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AsFS", func() {
+	var bucket *bfs.InMem
+	var subject fs.FS
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		bucket = bfs.NewInMem()
+		for name, data := range map[string]string{
+			"index.html":         "<h1>Home</h1>",
+			"css/main.css":       "body {}",
+			"docs/a.txt":         "AAA",
+			"docs/nested/b.json": "{}",
+		} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte(data), nil)).To(Succeed())
+		}
+		subject = bfs.AsFS(ctx, bucket)
+	})
+
+	It("should pass fstest", func() {
+		Expect(fstest.TestFS(subject, "index.html", "css/main.css", "docs/a.txt", "docs/nested/b.json")).To(Succeed())
+	})
+
+	It("should read dirs", func() {
+		entries, err := fs.ReadDir(subject, "docs")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Name()).To(Equal("a.txt"))
+		Expect(entries[0].IsDir()).To(BeFalse())
+		Expect(entries[1].Name()).To(Equal("nested"))
+		Expect(entries[1].IsDir()).To(BeTrue())
+
+		_, err = fs.ReadDir(subject, "missing")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should stat", func() {
+		info, err := fs.Stat(subject, "docs/a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size()).To(Equal(int64(3)))
+		Expect(info.IsDir()).To(BeFalse())
+
+		info, err = fs.Stat(subject, "docs/nested")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.IsDir()).To(BeTrue())
+
+		_, err = fs.Stat(subject, "docs/missing.txt")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+
+		_, err = fs.Stat(subject, "../docs")
+		Expect(errors.Is(err, fs.ErrInvalid)).To(BeTrue())
+	})
+
+	It("should escape directory names", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "v[1]/a.txt", []byte("AAA"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "v1/b.txt", []byte("BBB"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "w1/c.txt", []byte("CCC"), nil)).To(Succeed())
+
+		entries, err := fs.ReadDir(subject, "v[1]")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("a.txt"))
+
+		_, err = fs.Stat(subject, "?1")
+		Expect(errors.Is(err, fs.ErrNotExist)).To(BeTrue())
+	})
+
+	It("should seek using range reads", func() {
+		ranges := &rangeRecordingBucket{InMem: bucket}
+		f, err := bfs.AsFS(ctx, ranges).Open("docs/a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		Expect(f.(io.Seeker).Seek(1, io.SeekStart)).To(Equal(int64(1)))
+		Expect(ioutil.ReadAll(f)).To(Equal([]byte("AA")))
+		Expect(ranges.ranges).To(Equal([][2]int64{{1, 2}}))
+	})
+
+	It("should serve files via HTTP", func() {
+		server := httptest.NewServer(http.FileServerFS(subject))
+		defer server.Close()
+
+		get := func(path string, header http.Header) (int, string) {
+			req, err := http.NewRequest("GET", server.URL+path, nil)
+			Expect(err).NotTo(HaveOccurred())
+			for k, v := range header {
+				req.Header[k] = v
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			return resp.StatusCode, string(body)
+		}
+
+		code, body := get("/", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("<h1>Home</h1>"))
+
+		code, _ = get("/css/main.css", nil)
+		Expect(code).To(Equal(http.StatusOK))
+
+		code, body = get("/docs/a.txt", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("AAA"))
+
+		code, body = get("/docs/a.txt", http.Header{"Range": {"bytes=1-"}})
+		Expect(code).To(Equal(http.StatusPartialContent))
+		Expect(body).To(Equal("AA"))
+
+		code, body = get("/docs/", nil)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(ContainSubstring(`<a href="nested/">nested/</a>`))
+
+		code, _ = get("/missing.txt", nil)
+		Expect(code).To(Equal(http.StatusNotFound))
+	})
+})
+
+// rangeRecordingBucket records the arguments of OpenRange calls.
+type rangeRecordingBucket struct {
+	*bfs.InMem
+	ranges [][2]int64
+}
+
+func (b *rangeRecordingBucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	b.ranges = append(b.ranges, [2]int64{offset, length})
+	return bfs.OpenRange(ctx, b.InMem, name, offset, length)
+}
@@ -1,13 +1,22 @@
 package bfs
 
 import (
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs/internal"
 )
 
 // WriteObject is a quick write helper.
 func WriteObject(ctx context.Context, bucket Bucket, name string, data []byte, opts *WriteOptions) error {
-	w, err := bucket.Create(ctx, name, opts)
+	w, err := CreateObject(ctx, bucket, name, opts)
 	if err != nil {
 		return err
 	}
@@ -19,6 +28,57 @@ func WriteObject(ctx context.Context, bucket Bucket, name string, data []byte, o
 	return w.Commit()
 }
 
+// OpenDecoded opens an object for reading, like Open, but transparently
+// decompresses objects which are stored with a gzip Content-Encoding. Objects
+// with other or no encodings are returned as they are.
+//
+// Some backends, e.g. bfsgs, may already serve decompressed content. Their
+// readers report the encoding of the served body, other buckets require an
+// additional Head request to find out the stored Content-Encoding. Buckets
+// which report neither always return the stored bytes.
+func OpenDecoded(ctx context.Context, bucket Bucket, name string) (io.ReadCloser, error) {
+	rc, err := bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoding string
+	if r, ok := rc.(readerWithContentEncoding); ok {
+		encoding = r.ContentEncoding()
+	} else if info, err := bucket.Head(ctx, name); err != nil {
+		_ = rc.Close()
+		return nil, err
+	} else {
+		encoding = info.ContentEncoding
+	}
+
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+	default:
+		return rc, nil
+	}
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+	return &gzipReader{Reader: zr, rc: rc}, nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+	rc io.ReadCloser
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	if e2 := r.rc.Close(); e2 != nil {
+		err = e2
+	}
+	return err
+}
+
 // CopyObject is a quick helper to copy objects within the same bucket.
 func CopyObject(ctx context.Context, bucket Bucket, src, dst string, dstOpts *WriteOptions) error {
 	if cp, ok := bucket.(supportsCopying); ok {
@@ -31,14 +91,474 @@ func CopyObject(ctx context.Context, bucket Bucket, src, dst string, dstOpts *Wr
 	}
 	defer r.Close()
 
-	w, err := bucket.Create(ctx, dst, dstOpts)
+	w, err := CreateObject(ctx, bucket, dst, dstOpts)
 	if err != nil {
 		return err
 	}
 	defer w.Discard()
 
-	if _, err := io.Copy(w, r); err != nil {
+	if _, err := internal.Copy(ctx, w, r); err != nil {
 		return err
 	}
 	return w.Commit()
 }
+
+// SetCopyBufferSize sets the size of the pooled buffers used to copy object
+// content, e.g. by CopyObject and by backends which copy local files. Larger
+// buffers mean fewer, larger reads and writes. Values <= 0 restore the default
+// of 32KiB.
+func SetCopyBufferSize(n int) {
+	internal.SetCopyBufferSize(n)
+}
+
+// RemoveIfMatch removes an object only if its version still matches the
+// MetaInfo.Version reported by a previous Head. If the object was modified in
+// the meantime, it is kept and an error is returned which satisfies
+// errors.Is(err, ErrConflict). It returns ErrNotSupported if the bucket does
+// not support conditional removal.
+func RemoveIfMatch(ctx context.Context, bucket Bucket, name, version string) error {
+	if rm, ok := bucket.(supportsRemoveIfMatch); ok {
+		return rm.RemoveIfMatch(ctx, name, version)
+	}
+	return ErrNotSupported
+}
+
+// Rename moves an object to a new name within the same bucket. Buckets which
+// cannot rename objects natively copy the object and remove the source. If
+// the copy succeeds but the removal fails, an error is returned which
+// satisfies errors.Is(err, ErrSourceNotRemoved). Renaming an object onto
+// itself is a no-op, ErrNotFound is returned if it does not exist.
+func Rename(ctx context.Context, bucket Bucket, src, dst string) error {
+	if internal.WithinNamespace("/", src) == internal.WithinNamespace("/", dst) {
+		_, err := bucket.Head(ctx, src)
+		return err
+	}
+
+	if r, ok := bucket.(supportsRename); ok {
+		return r.Rename(ctx, src, dst)
+	}
+
+	if err := CopyObject(ctx, bucket, src, dst, nil); err != nil {
+		return err
+	}
+	if err := bucket.Remove(ctx, src); err != nil {
+		return WrapError(ErrSourceNotRemoved, err)
+	}
+	return nil
+}
+
+// Mkdir creates a directory. Local and other file system based buckets
+// create a real directory, including missing parents. Object stores have no
+// directories, Mkdir writes an empty "prefix/" marker object instead, as
+// expected by tools which display folders. Markers are listed by Glob like
+// any other object. Mkdir is idempotent, an empty prefix is a no-op.
+//
+// Please note that buckets which validate names may reject markers.
+func Mkdir(ctx context.Context, bucket Bucket, prefix string) error {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return nil
+	}
+
+	if m, ok := bucket.(supportsMkdir); ok {
+		return m.Mkdir(ctx, prefix)
+	}
+	return WriteObject(ctx, bucket, prefix+"/", nil, nil)
+}
+
+// ReadHead reads up to the first n bytes of an object, e.g. to sniff its
+// format. Buckets which support range reads fetch only the requested bytes,
+// others open the full object and stop reading after n bytes. Objects which
+// are shorter than n bytes are returned completely.
+func ReadHead(ctx context.Context, bucket Bucket, name string, n int64) ([]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	r, err := OpenRange(ctx, bucket, name, 0, n)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(io.LimitReader(r, n))
+}
+
+// OpenRange opens an object for reading, like Open, but only reads up to
+// length bytes, starting at offset. Buckets which support range reads fetch
+// only the requested bytes, others open the full object and skip to offset.
+// The offset must not be negative and the length must be positive, see
+// ValidateRange.
+func OpenRange(ctx context.Context, bucket Bucket, name string, offset, length int64) (Reader, error) {
+	if err := ValidateRange(offset, length); err != nil {
+		return nil, err
+	}
+	if o, ok := bucket.(supportsOpenRange); ok {
+		return o.OpenRange(ctx, name, offset, length)
+	}
+
+	r, err := bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil && err != io.EOF {
+		_ = r.Close()
+		return nil, err
+	}
+	return &rangeReader{Reader: io.LimitReader(r, length), Closer: r}, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// ValidateRange checks the arguments of OpenRange. The offset must not be
+// negative and the length must be positive, there is no notation to read
+// until the end of an object. Errors satisfy errors.Is(err, ErrInvalidRange).
+func ValidateRange(offset, length int64) error {
+	if offset < 0 || length <= 0 {
+		return fmt.Errorf("%w: offset %d, length %d", ErrInvalidRange, offset, length)
+	}
+	return nil
+}
+
+// Exists checks whether an object exists, using Head.
+func Exists(ctx context.Context, bucket Bucket, name string) (bool, error) {
+	if _, err := bucket.Head(ctx, name); err == ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Ping checks that a bucket is reachable and that the credentials are valid,
+// e.g. for readiness probes. Buckets which do not support a dedicated check
+// are probed by listing a single object. An empty bucket is not an error.
+func Ping(ctx context.Context, bucket Bucket) error {
+	if p, ok := bucket.(supportsPing); ok {
+		return p.Ping(ctx)
+	}
+
+	iter, err := bucket.Glob(ctx, "**")
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	iter.Next()
+	return iter.Error()
+}
+
+// Grants returns the access control grants of an object. It returns
+// ErrNotSupported if the bucket does not support ACLs.
+func Grants(ctx context.Context, bucket Bucket, name string) ([]Grant, error) {
+	if g, ok := bucket.(supportsGrants); ok {
+		return g.Grants(ctx, name)
+	}
+	return nil, ErrNotSupported
+}
+
+// Describe returns information about the location of a bucket. It returns
+// false if the bucket does not support this or wraps a bucket which doesn't.
+func Describe(bucket Bucket) (BucketInfo, bool) {
+	if d, ok := bucket.(supportsDescribe); ok {
+		info := d.Describe()
+		return info, info.Scheme != ""
+	}
+	return BucketInfo{}, false
+}
+
+// OpenTee opens an object for reading and writes all bytes read from it to
+// sink, allowing to process and persist (e.g. cache) content in a single pass.
+// Sink receives the full content only once the returned reader is drained.
+// Errors returned by sink are reported by Read. Close closes the underlying
+// reader, but not sink.
+func OpenTee(ctx context.Context, bucket Bucket, name string, sink io.Writer) (Reader, error) {
+	rc, err := bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &teeReader{Reader: io.TeeReader(rc, sink), rc: rc}, nil
+}
+
+type teeReader struct {
+	io.Reader
+	rc Reader
+}
+
+func (r *teeReader) Close() error { return r.rc.Close() }
+
+// GlobAfter lists the files matching a glob pattern, skipping all names which
+// are lexicographically less than or equal to after. It can be used to resume
+// long-running listings from the last processed name.
+func GlobAfter(ctx context.Context, bucket Bucket, pattern, after string) (Iterator, error) {
+	if ga, ok := bucket.(supportsGlobAfter); ok {
+		return ga.GlobAfter(ctx, pattern, after)
+	}
+
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &filterIterator{Iterator: iter, accept: func(it Iterator) bool {
+		return it.Name() > after
+	}}, nil
+}
+
+// SortedGlob lists the files matching a glob pattern, like Glob, but
+// guarantees lexicographic (byte-wise) order of names. Object stores such as
+// S3 or GCS list in this order natively. For other buckets, e.g. local file
+// systems, the full listing is buffered in memory and sorted before the first
+// entry is returned.
+func SortedGlob(ctx context.Context, bucket Bucket, pattern string) (Iterator, error) {
+	if sg, ok := bucket.(supportsSortedGlob); ok {
+		return sg.SortedGlob(ctx, pattern)
+	}
+
+	relist := func() ([]MetaInfo, error) {
+		infos, err := List(ctx, bucket, pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+		return infos, nil
+	}
+
+	infos, err := relist()
+	if err != nil {
+		return nil, err
+	}
+	return &sortedIterator{infos: infos, pos: -1, relist: relist}, nil
+}
+
+// GlobAny lists the files matching any of the given glob patterns in a single
+// pass. The listing is scoped to the longest directory prefix which is common
+// to all patterns, so that backends can limit their scans. Each matching
+// object is yielded only once.
+func GlobAny(ctx context.Context, bucket Bucket, patterns []string) (Iterator, error) {
+	if len(patterns) == 0 {
+		return nil, ErrEmptyPattern
+	}
+
+	var dir string
+	for i, pattern := range patterns {
+		if err := ValidatePattern(pattern); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			dir = staticDir(pattern)
+		} else {
+			dir = commonDir(dir, staticDir(pattern))
+		}
+	}
+
+	pattern := "**"
+	if dir != "" {
+		pattern = dir + "/**"
+	}
+
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &filterIterator{Iterator: iter, accept: func(it Iterator) bool {
+		name := it.Name()
+		for _, pattern := range patterns {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+// GlobExcept lists the files matching the include glob pattern, like Glob,
+// but skips all objects which match any of the exclude patterns.
+func GlobExcept(ctx context.Context, bucket Bucket, include string, exclude ...string) (Iterator, error) {
+	for _, pattern := range exclude {
+		if err := ValidatePattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	iter, err := bucket.Glob(ctx, include)
+	if err != nil {
+		return nil, err
+	}
+	return &filterIterator{Iterator: iter, accept: func(it Iterator) bool {
+		name := it.Name()
+		for _, pattern := range exclude {
+			if ok, _ := doublestar.Match(pattern, name); ok {
+				return false
+			}
+		}
+		return true
+	}}, nil
+}
+
+// GlobModifiedBetween lists the files matching a glob pattern, like Glob, but
+// skips all objects with a modification time outside of the half-open
+// interval [since, until). A zero since or until leaves the respective end of
+// the interval open.
+//
+// Please note that object stores cannot filter by modification time
+// server-side, the full listing is still retrieved.
+func GlobModifiedBetween(ctx context.Context, bucket Bucket, pattern string, since, until time.Time) (Iterator, error) {
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &filterIterator{Iterator: iter, accept: func(it Iterator) bool {
+		modTime := it.ModTime()
+		return !modTime.Before(since) && (until.IsZero() || modTime.Before(until))
+	}}, nil
+}
+
+// GlobDetailed lists the files matching a glob pattern, like Glob, but
+// additionally issues a Head request for each matching object. Lookups are
+// performed ahead of the cursor, with up to concurrency requests in flight.
+// The returned iterator implements:
+//
+//   ContentType() string
+//   Metadata() Metadata
+//
+// This trades additional requests for completeness, as most listings omit
+// content types and metadata. Objects which are removed between listing and
+// lookup are skipped. Please always Close the iterator to release resources.
+func GlobDetailed(ctx context.Context, bucket Bucket, pattern string, concurrency int) (Iterator, error) {
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return newDetailedIterator(ctx, bucket, iter, concurrency), nil
+}
+
+// ResetIterator rewinds an iterator to the beginning, if supported by the
+// implementation. Please note that the listing is re-issued from scratch, so
+// results may change if the bucket was modified in the meantime. Returns
+// ErrNotSupported if the iterator cannot be reset.
+func ResetIterator(iter Iterator) error {
+	if r, ok := iter.(supportsReset); ok {
+		return r.Reset()
+	}
+	return ErrNotSupported
+}
+
+// List drives a Glob iterator and collects the meta info of all matching
+// objects. ContentType is populated if supported by the bucket's iterator.
+//
+// Please note that all results are held in memory. For large buckets,
+// prefer iterating via Glob directly.
+func List(ctx context.Context, bucket Bucket, pattern string) ([]MetaInfo, error) {
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	ct, _ := iter.(interface{ ContentType() string })
+
+	var infos []MetaInfo
+	for iter.Next() {
+		info := MetaInfo{
+			Name:    iter.Name(),
+			Size:    iter.Size(),
+			ModTime: iter.ModTime(),
+		}
+		if ct != nil {
+			info.ContentType = ct.ContentType()
+		}
+		infos = append(infos, info)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// GlobChan lists all objects matching pattern, like List, but streams the
+// results into a channel from a separate goroutine. Once all objects are
+// emitted, the data channel is closed and a final error, or nil, is sent on
+// the error channel. Cancelling ctx stops the listing early and reports the
+// context error. Consumers may stop receiving from the data channel only
+// after cancelling ctx:
+//
+//   infos, errs := bfs.GlobChan(ctx, bucket, "**")
+//   for info := range infos {
+//     ...
+//   }
+//   if err := <-errs; err != nil {
+//     ...
+//   }
+//
+func GlobChan(ctx context.Context, bucket Bucket, pattern string) (<-chan MetaInfo, <-chan error) {
+	infos := make(chan MetaInfo)
+	errs := make(chan error, 1)
+
+	go func() {
+		err := globChan(ctx, bucket, pattern, infos)
+		close(infos)
+		errs <- err
+		close(errs)
+	}()
+	return infos, errs
+}
+
+func globChan(ctx context.Context, bucket Bucket, pattern string, infos chan<- MetaInfo) error {
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	ct, _ := iter.(interface{ ContentType() string })
+
+	for iter.Next() {
+		info := MetaInfo{
+			Name:    iter.Name(),
+			Size:    iter.Size(),
+			ModTime: iter.ModTime(),
+		}
+		if ct != nil {
+			info.ContentType = ct.ContentType()
+		}
+
+		select {
+		case infos <- info:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return iter.Close()
+}
+
+// Usage drives a Glob iterator and sums up the number and total size of all
+// matching objects, e.g. for quota reports. Results are not collected, memory
+// usage is constant.
+//
+// Please note that this requires a full listing of all matching objects,
+// which translates into O(n) list requests on remote buckets.
+func Usage(ctx context.Context, bucket Bucket, pattern string) (objects int64, bytes int64, err error) {
+	iter, err := bucket.Glob(ctx, pattern)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer iter.Close()
+
+	for iter.Next() {
+		objects++
+		bytes += iter.Size()
+	}
+	if err := iter.Error(); err != nil {
+		return 0, 0, err
+	}
+	return objects, bytes, iter.Close()
+}
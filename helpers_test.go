@@ -1,9 +1,19 @@
 package bfs_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/bsm/bfs"
+	"github.com/bsm/bfs/internal"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -36,4 +46,648 @@ var _ = Describe("Helpers", func() {
 		Expect(bucket.ObjectSizes()).
 			To(HaveKeyWithValue("dst.txt", int64(8)))
 	})
+
+	It("should abort copies if context is cancelled", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "src.txt", bytes.Repeat([]byte("testdata"), 32*1024), nil)).To(Succeed())
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		src := &cancellingBucket{Bucket: bucket, cancel: cancel}
+		err := bfs.CopyObject(ctx, src, "src.txt", "dst.txt", nil)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(src.reads).To(Equal(1))
+		Expect(bucket.ObjectSizes()).NotTo(HaveKey("dst.txt"))
+	})
+
+	It("should open tee readers", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "src.txt", []byte("testdata"), nil)).To(Succeed())
+
+		sink := new(bytes.Buffer)
+		r, err := bfs.OpenTee(ctx, bucket, "src.txt", sink)
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		buf := make([]byte, 4)
+		Expect(io.ReadFull(r, buf)).To(Equal(4))
+		Expect(sink.String()).To(Equal("test"))
+
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("data")))
+		Expect(sink.String()).To(Equal("testdata"))
+		Expect(r.Close()).To(Succeed())
+
+		_, err = bfs.OpenTee(ctx, bucket, "missing.txt", sink)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should not support conditional removal by default", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.RemoveIfMatch(ctx, bucket, "a.txt", "1")).To(MatchError(bfs.ErrNotSupported))
+		Expect(bucket.ObjectSizes()).To(HaveKey("a.txt"))
+	})
+
+	It("should not support grants by default", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		_, err := bfs.Grants(ctx, bucket, "a.txt")
+		Expect(err).To(MatchError(bfs.ErrNotSupported))
+	})
+
+	It("should describe buckets", func() {
+		_, ok := bfs.Describe(bucket)
+		Expect(ok).To(BeFalse())
+
+		info, ok := bfs.Describe(describingBucket{Bucket: bucket})
+		Expect(ok).To(BeTrue())
+		Expect(info).To(Equal(bfs.BucketInfo{Scheme: "mem", Bucket: "test", Prefix: "x/"}))
+		Expect(info.String()).To(Equal("mem://test/x/"))
+
+		info, ok = bfs.Describe(bfs.WithTimeout(describingBucket{Bucket: bucket}, time.Second))
+		Expect(ok).To(BeTrue())
+		Expect(info.String()).To(Equal("mem://test/x/"))
+
+		_, ok = bfs.Describe(bfs.WithTimeout(bucket, time.Second))
+		Expect(ok).To(BeFalse())
+		Expect(bfs.BucketInfo{Scheme: "null"}.String()).To(Equal("null://"))
+	})
+
+	It("should reset iterators", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b.txt", []byte("testdata"), nil)).To(Succeed())
+
+		iter, err := bfs.GlobAfter(ctx, bucket, "*", "a.txt")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Name()).To(Equal("b.txt"))
+		Expect(iter.Next()).To(BeFalse())
+
+		Expect(bfs.WriteObject(ctx, bucket, "c.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.ResetIterator(iter)).To(Succeed())
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+		}
+		Expect(names).To(ConsistOf("b.txt", "c.txt"))
+	})
+
+	It("should list objects", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a/1.txt", []byte("testdata"), &bfs.WriteOptions{ContentType: "text/plain"})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "a/2.json", []byte("{}"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b/3.txt", []byte("x"), nil)).To(Succeed())
+
+		infos, err := bfs.List(ctx, bucket, "a/*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+		Expect(infos[0].Name).To(Equal("a/1.txt"))
+		Expect(infos[0].Size).To(Equal(int64(8)))
+		Expect(infos[0].ContentType).To(Equal("text/plain"))
+		Expect(infos[0].ModTime).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(infos[1].Name).To(Equal("a/2.json"))
+		Expect(infos[1].Size).To(Equal(int64(2)))
+
+		infos, err = bfs.List(ctx, bucket, "c/*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+
+	It("should glob into channels", func() {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+		}
+
+		infos, errs := bfs.GlobChan(ctx, bucket, "*.txt")
+		var names []string
+		for info := range infos {
+			Expect(info.Size).To(Equal(int64(8)))
+			names = append(names, info.Name)
+		}
+		Expect(<-errs).To(Succeed())
+		Expect(names).To(ConsistOf("a.txt", "b.txt", "c.txt"))
+
+		infos, errs = bfs.GlobChan(ctx, unreachableBucket{bucket}, "*.txt")
+		Expect(<-errs).To(MatchError(bfs.ErrAccessDenied))
+		Expect(infos).To(BeClosed())
+	})
+
+	It("should stop globbing into channels when cancelled", func() {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+		}
+
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		infos, errs := bfs.GlobChan(cctx, bucket, "*.txt")
+		Eventually(infos).Should(Receive())
+		cancel()
+
+		// the goroutine exits without further receives
+		Eventually(errs).Should(Receive(Equal(context.Canceled)))
+		Eventually(infos).Should(BeClosed())
+	})
+
+	It("should glob by modification time", func() {
+		now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		defer internal.SetClock(func() time.Time { return now })()
+
+		var marks []time.Time
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			marks = append(marks, now)
+			now = now.Add(time.Minute)
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+			now = now.Add(time.Minute)
+		}
+		marks = append(marks, now)
+
+		globNames := func(since, until time.Time) []string {
+			iter, err := bfs.GlobModifiedBetween(ctx, bucket, "*", since, until)
+			Expect(err).NotTo(HaveOccurred())
+			defer iter.Close()
+
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			sort.Strings(names)
+			return names
+		}
+
+		Expect(globNames(marks[0], marks[3])).To(Equal([]string{"a.txt", "b.txt", "c.txt"}))
+		Expect(globNames(marks[1], marks[2])).To(Equal([]string{"b.txt"}))
+		Expect(globNames(marks[1], time.Time{})).To(Equal([]string{"b.txt", "c.txt"}))
+		Expect(globNames(time.Time{}, marks[2])).To(Equal([]string{"a.txt", "b.txt"}))
+		Expect(globNames(marks[3], time.Time{})).To(BeEmpty())
+
+		// until is exclusive
+		info, err := bucket.Head(ctx, "b.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ModTime).To(Equal(marks[1].Add(time.Minute)))
+		Expect(globNames(marks[1], info.ModTime)).To(BeEmpty())
+		Expect(globNames(info.ModTime, marks[2])).To(Equal([]string{"b.txt"}))
+	})
+
+	It("should buffer and sort globs", func() {
+		for _, name := range []string{"b.txt", "a/c.txt", "a.txt"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+		}
+
+		// buckets without native support fall back on sorting in memory
+		iter, err := bfs.SortedGlob(ctx, struct{ bfs.Bucket }{bucket}, "**")
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		drain := func() []string {
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			return names
+		}
+		Expect(drain()).To(Equal([]string{"a.txt", "a/c.txt", "b.txt"}))
+
+		Expect(bfs.WriteObject(ctx, bucket, "0.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.ResetIterator(iter)).To(Succeed())
+		Expect(drain()).To(Equal([]string{"0.txt", "a.txt", "a/c.txt", "b.txt"}))
+	})
+
+	It("should glob any of multiple patterns", func() {
+		for _, name := range []string{"a.json", "a.csv", "b.json", "c.txt", "data/x.json", "data/y/z.csv", "logs/x.json"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+		}
+
+		globs := &globRecordingBucket{InMem: bucket}
+		globNames := func(patterns ...string) []string {
+			iter, err := bfs.GlobAny(ctx, globs, patterns)
+			Expect(err).NotTo(HaveOccurred())
+			defer iter.Close()
+
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			sort.Strings(names)
+			return names
+		}
+
+		// a.json matches both patterns
+		Expect(globNames("*.json", "a.*")).To(Equal([]string{"a.csv", "a.json", "b.json"}))
+		Expect(globNames("data/*.json", "data/**/*.csv")).To(Equal([]string{"data/x.json", "data/y/z.csv"}))
+		Expect(globNames("data/y/*", "data/x.json")).To(Equal([]string{"data/x.json", "data/y/z.csv"}))
+		Expect(globNames("data/*.json", "logs/*.json")).To(Equal([]string{"data/x.json", "logs/x.json"}))
+		Expect(globs.patterns).To(Equal([]string{"**", "data/**", "data/**", "**"}))
+
+		_, err := bfs.GlobAny(ctx, bucket, nil)
+		Expect(err).To(MatchError(bfs.ErrEmptyPattern))
+		_, err = bfs.GlobAny(ctx, bucket, []string{"*.json", ""})
+		Expect(err).To(MatchError(bfs.ErrEmptyPattern))
+	})
+
+	It("should glob with exclusions", func() {
+		for _, name := range []string{"a.txt", "a.tmp", "b/c.txt", "b/c.tmp", "b/d/e.tmp", "f.log"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), nil)).To(Succeed())
+		}
+
+		globNames := func(include string, exclude ...string) []string {
+			iter, err := bfs.GlobExcept(ctx, bucket, include, exclude...)
+			Expect(err).NotTo(HaveOccurred())
+			defer iter.Close()
+
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Expect(iter.Error()).NotTo(HaveOccurred())
+			sort.Strings(names)
+			return names
+		}
+
+		Expect(globNames("**", "**/*.tmp")).To(Equal([]string{"a.txt", "b/c.txt", "f.log"}))
+		Expect(globNames("**", "**/*.tmp", "*.log")).To(Equal([]string{"a.txt", "b/c.txt"}))
+		Expect(globNames("b/**", "b/d/**")).To(Equal([]string{"b/c.tmp", "b/c.txt"}))
+		Expect(globNames("*")).To(Equal([]string{"a.tmp", "a.txt", "f.log"}))
+
+		_, err := bfs.GlobExcept(ctx, bucket, "**", "")
+		Expect(err).To(MatchError(bfs.ErrEmptyPattern))
+	})
+
+	It("should write directory markers", func() {
+		Expect(bfs.Mkdir(ctx, bucket, "/a/b/")).To(Succeed())
+		infos, err := bfs.List(ctx, bucket, "**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Name).To(Equal("a/b/"))
+		Expect(infos[0].Size).To(Equal(int64(0)))
+	})
+
+	It("should make directories through wrappers", func() {
+		backend := &mkdirBucket{InMem: bucket}
+		for _, wrapped := range []bfs.Bucket{
+			bfs.WithTimeout(backend, time.Minute),
+			bfs.WithConcurrencyLimit(backend, 1),
+			bfs.WithExistenceCache(backend, time.Minute),
+		} {
+			Expect(bfs.Mkdir(ctx, wrapped, "/a/b/")).To(Succeed())
+		}
+		Expect(backend.dirs).To(Equal([]string{"a/b", "a/b", "a/b"}))
+		Expect(bfs.List(ctx, bucket, "**")).To(BeEmpty())
+	})
+
+	It("should read heads", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.ReadHead(ctx, bucket, "a.txt", 4)).To(Equal([]byte("test")))
+		Expect(bfs.ReadHead(ctx, bucket, "a.txt", 100)).To(Equal([]byte("testdata")))
+		Expect(bfs.ReadHead(ctx, bucket, "a.txt", 0)).To(BeEmpty())
+
+		_, err := bfs.ReadHead(ctx, bucket, "missing.txt", 4)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should open ranges", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+
+		r, err := bfs.OpenRange(ctx, bucket, "a.txt", 2, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("stda")))
+		Expect(r.Close()).To(Succeed())
+
+		r, err = bfs.OpenRange(ctx, bucket, "a.txt", 20, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(BeEmpty())
+		Expect(r.Close()).To(Succeed())
+
+		_, err = bfs.OpenRange(ctx, bucket, "missing.txt", 0, 4)
+		Expect(err).To(MatchError(bfs.ErrNotFound))
+	})
+
+	It("should reject invalid ranges", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+
+		_, err := bfs.OpenRange(ctx, bucket, "a.txt", -2, 4)
+		Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue())
+		_, err = bfs.OpenRange(ctx, bucket, "a.txt", 2, 0)
+		Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue())
+		_, err = bfs.OpenRange(ctx, bucket, "a.txt", 2, -1)
+		Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue())
+		Expect(err).To(MatchError("bfs: invalid range: offset 2, length -1"))
+
+		// capable buckets are not called
+		capable := &capableBucket{InMem: bfs.NewInMem()}
+		_, err = bfs.OpenRange(ctx, capable, "a.txt", 0, 0)
+		Expect(errors.Is(err, bfs.ErrInvalidRange)).To(BeTrue())
+		Expect(capable.calls).To(BeEmpty())
+	})
+
+	It("should check existence", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.Exists(ctx, bucket, "a.txt")).To(BeTrue())
+		Expect(bfs.Exists(ctx, bucket, "b.txt")).To(BeFalse())
+	})
+
+	It("should ping buckets", func() {
+		Expect(bfs.Ping(ctx, bucket)).To(Succeed())
+
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.Ping(ctx, bucket)).To(Succeed())
+
+		Expect(bfs.Ping(ctx, unreachableBucket{bucket})).To(MatchError(bfs.ErrAccessDenied))
+	})
+
+	It("should rename objects", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), &bfs.WriteOptions{ContentType: "text/plain"})).To(Succeed())
+		Expect(bfs.Rename(ctx, bucket, "a.txt", "b/c.txt")).To(Succeed())
+
+		info, err := bucket.Head(ctx, "b/c.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+		_, err = bucket.Head(ctx, "a.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+
+		Expect(bfs.Rename(ctx, bucket, "a.txt", "d.txt")).To(Equal(bfs.ErrNotFound))
+
+		err = bfs.Rename(ctx, unremovableBucket{bucket}, "b/c.txt", "d.txt")
+		Expect(errors.Is(err, bfs.ErrSourceNotRemoved)).To(BeTrue())
+		Expect(errors.Is(err, bfs.ErrAccessDenied)).To(BeTrue())
+		Expect(bfs.List(ctx, bucket, "**")).To(HaveLen(2))
+	})
+
+	It("should not remove objects renamed onto themselves", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.Rename(ctx, bucket, "a.txt", "a.txt")).To(Succeed())
+		Expect(bfs.Rename(ctx, bucket, "a.txt", "./a.txt")).To(Succeed())
+		Expect(bucket.ObjectSizes()).To(Equal(map[string]int64{"a.txt": 8}))
+
+		Expect(bfs.Rename(ctx, bucket, "b.txt", "b.txt")).To(Equal(bfs.ErrNotFound))
+	})
+
+	It("should open decoded", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("plain content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt.gz", buf.Bytes(), &bfs.WriteOptions{ContentEncoding: "gzip"})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b.txt", []byte("plain content"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "c.txt.br", []byte("brotli"), &bfs.WriteOptions{ContentEncoding: "br"})).To(Succeed())
+
+		readDecoded := func(name string) (string, error) {
+			rc, err := bfs.OpenDecoded(ctx, bucket, name)
+			if err != nil {
+				return "", err
+			}
+			defer rc.Close()
+
+			data, err := ioutil.ReadAll(rc)
+			return string(data), err
+		}
+
+		Expect(readDecoded("a.txt.gz")).To(Equal("plain content"))
+		Expect(readDecoded("b.txt")).To(Equal("plain content"))
+		Expect(readDecoded("c.txt.br")).To(Equal("brotli"))
+
+		_, err = readDecoded("missing.txt")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+
+		Expect(bfs.WriteObject(ctx, bucket, "d.txt", []byte("not gzipped"), &bfs.WriteOptions{ContentEncoding: "gzip"})).To(Succeed())
+		_, err = readDecoded("d.txt")
+		Expect(err).To(Equal(gzip.ErrHeader))
+	})
+
+	It("should calculate usage", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a/1.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "a/2.json", []byte("{}"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "a/b/3.txt", []byte("nested"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "c.txt", []byte("top"), nil)).To(Succeed())
+
+		objects, bytes, err := bfs.Usage(ctx, bucket, "**")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(Equal(int64(4)))
+		Expect(bytes).To(Equal(int64(19)))
+
+		objects, bytes, err = bfs.Usage(ctx, bucket, "a/**/*.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(Equal(int64(2)))
+		Expect(bytes).To(Equal(int64(14)))
+
+		objects, bytes, err = bfs.Usage(ctx, bucket, "x/*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(BeZero())
+		Expect(bytes).To(BeZero())
+	})
+
+	It("should glob with details", func() {
+		for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.json"} {
+			Expect(bfs.WriteObject(ctx, bucket, name, []byte("testdata"), &bfs.WriteOptions{
+				ContentType: "text/plain",
+				Metadata:    bfs.Metadata{"Name": name},
+			})).To(Succeed())
+		}
+
+		heads := &headCountingBucket{InMem: bucket}
+		iter, err := bfs.GlobDetailed(ctx, heads, "*.txt", 2)
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		detailed := iter.(interface {
+			ContentType() string
+			Metadata() bfs.Metadata
+		})
+
+		var names []string
+		for iter.Next() {
+			names = append(names, iter.Name())
+			Expect(iter.Size()).To(Equal(int64(8)))
+			Expect(detailed.ContentType()).To(Equal("text/plain"))
+			Expect(detailed.Metadata()).To(Equal(bfs.Metadata{"Name": iter.Name()}))
+		}
+		Expect(iter.Error()).NotTo(HaveOccurred())
+		Expect(iter.Close()).To(Succeed())
+
+		sort.Strings(names)
+		Expect(names).To(Equal([]string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"}))
+		Expect(heads.max).To(BeNumerically("<=", 2))
+	})
+
+	It("should skip removed objects when globbing with details", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b.txt", []byte("testdata"), nil)).To(Succeed())
+
+		heads := &headCountingBucket{InMem: bucket, missing: "a.txt"}
+		iter, err := bfs.GlobDetailed(ctx, heads, "*", 4)
+		Expect(err).NotTo(HaveOccurred())
+		defer iter.Close()
+
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Name()).To(Equal("b.txt"))
+		Expect(iter.Next()).To(BeFalse())
+		Expect(iter.Error()).NotTo(HaveOccurred())
+	})
+
+	It("should close detailed iterators early", func() {
+		for i := 0; i < 100; i++ {
+			Expect(bfs.WriteObject(ctx, bucket, strconv.Itoa(i)+".txt", []byte("testdata"), nil)).To(Succeed())
+		}
+
+		iter, err := bfs.GlobDetailed(ctx, bucket, "*", 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(iter.Next()).To(BeTrue())
+		Expect(iter.Close()).To(Succeed())
+		Expect(iter.Next()).To(BeFalse())
+	})
 })
+
+// headCountingBucket tracks concurrent Head calls.
+type headCountingBucket struct {
+	*bfs.InMem
+	missing string
+
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (b *headCountingBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	b.mu.Lock()
+	b.cur++
+	if b.cur > b.max {
+		b.max = b.cur
+	}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.cur--
+		b.mu.Unlock()
+	}()
+
+	time.Sleep(time.Millisecond)
+	if name == b.missing {
+		return nil, bfs.ErrNotFound
+	}
+	return b.InMem.Head(ctx, name)
+}
+
+type describingBucket struct {
+	bfs.Bucket
+}
+
+func (describingBucket) Describe() bfs.BucketInfo {
+	return bfs.BucketInfo{Scheme: "mem", Bucket: "test", Prefix: "x/"}
+}
+
+// globRecordingBucket records glob patterns.
+type globRecordingBucket struct {
+	*bfs.InMem
+	patterns []string
+}
+
+func (b *globRecordingBucket) Glob(ctx context.Context, pattern string) (bfs.Iterator, error) {
+	b.patterns = append(b.patterns, pattern)
+	return b.InMem.Glob(ctx, pattern)
+}
+
+// cancellingBucket cancels a context on the first read of an opened object
+// and counts reads, it cannot copy natively.
+type cancellingBucket struct {
+	bfs.Bucket
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (b *cancellingBucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	r, err := b.Bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &cancellingReader{Reader: r, bucket: b}, nil
+}
+
+type cancellingReader struct {
+	bfs.Reader
+	bucket *cancellingBucket
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.bucket.reads++
+	r.bucket.cancel()
+	return r.Reader.Read(p)
+}
+
+// mkdirBucket records created directories.
+type mkdirBucket struct {
+	*bfs.InMem
+	dirs []string
+}
+
+func (b *mkdirBucket) Mkdir(_ context.Context, prefix string) error {
+	b.dirs = append(b.dirs, prefix)
+	return nil
+}
+
+// capableBucket implements all optional interfaces and records their calls
+// and whether the passed contexts had a deadline.
+type capableBucket struct {
+	*bfs.InMem
+
+	mu        sync.Mutex
+	calls     []string
+	deadlines []bool
+}
+
+func (b *capableBucket) record(ctx context.Context, op string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := ctx.Deadline()
+	b.calls = append(b.calls, op)
+	b.deadlines = append(b.deadlines, ok)
+}
+
+func (b *capableBucket) OpenRange(ctx context.Context, name string, offset, length int64) (bfs.Reader, error) {
+	b.record(ctx, "OpenRange")
+	return b.InMem.Open(ctx, name)
+}
+
+func (b *capableBucket) Grants(ctx context.Context, _ string) ([]bfs.Grant, error) {
+	b.record(ctx, "Grants")
+	return nil, nil
+}
+
+func (b *capableBucket) ConditionalUpdate(ctx context.Context, _ string, _ func([]byte) ([]byte, error)) error {
+	b.record(ctx, "ConditionalUpdate")
+	return nil
+}
+
+func (b *capableBucket) Rename(ctx context.Context, _, _ string) error {
+	b.record(ctx, "Rename")
+	return nil
+}
+
+func (b *capableBucket) RemoveIfMatch(ctx context.Context, _, _ string) error {
+	b.record(ctx, "RemoveIfMatch")
+	return nil
+}
+
+// unreachableBucket fails all listings.
+type unreachableBucket struct {
+	bfs.Bucket
+}
+
+func (unreachableBucket) Glob(_ context.Context, _ string) (bfs.Iterator, error) {
+	return nil, bfs.ErrAccessDenied
+}
+
+// unremovableBucket fails all removals.
+type unremovableBucket struct {
+	*bfs.InMem
+}
+
+func (unremovableBucket) Remove(_ context.Context, _ string) error {
+	return bfs.ErrAccessDenied
+}
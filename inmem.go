@@ -3,10 +3,12 @@ package bfs
 import (
 	"bytes"
 	"context"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs/internal"
 )
 
 // InMem is an in-memory Bucket implementation which can be used for mocking.
@@ -24,6 +26,30 @@ func NewInMem() *InMem {
 
 // Glob implements Bucket.
 func (b *InMem) Glob(_ context.Context, pattern string) (Iterator, error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	matches, err := b.glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &inMemIterator{bucket: b, pattern: pattern, entries: matches, pos: -1}, nil
+}
+
+// SortedGlob implements Glob with lexicographic ordering of names.
+func (b *InMem) SortedGlob(ctx context.Context, pattern string) (Iterator, error) {
+	iter, err := b.Glob(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := iter.(*inMemIterator)
+	sorted.sorted = true
+	sorted.sort()
+	return sorted, nil
+}
+
+func (b *InMem) glob(pattern string) ([]*inMemObject, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
@@ -35,7 +61,7 @@ func (b *InMem) Glob(_ context.Context, pattern string) (Iterator, error) {
 			matches = append(matches, b.objects[key])
 		}
 	}
-	return &inMemIterator{entries: matches, pos: -1}, nil
+	return matches, nil
 }
 
 // Head implements Bucket.
@@ -62,6 +88,7 @@ func (b *InMem) Open(_ context.Context, name string) (Reader, error) {
 	}
 	return &inMemReader{
 		Reader: bytes.NewReader(obj.data),
+		info:   obj.info,
 	}, nil
 }
 
@@ -86,6 +113,38 @@ func (b *InMem) Remove(_ context.Context, name string) error {
 	return nil
 }
 
+// ConditionalUpdate reads an object (nil if it does not exist), passes its
+// content to fn and replaces the object with the result. It returns
+// ErrConflict if the object was modified while fn was running. Content type
+// and metadata of existing objects are preserved. fn must not modify the
+// passed slice.
+func (b *InMem) ConditionalUpdate(_ context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	b.mu.RLock()
+	obj := b.objects[name]
+	b.mu.RUnlock()
+
+	var data []byte
+	var opts *WriteOptions
+	if obj != nil {
+		data = obj.data
+		opts = &WriteOptions{ContentType: obj.info.ContentType, Metadata: obj.info.Metadata}
+	}
+
+	update, err := fn(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.objects[name] != obj {
+		return ErrConflict
+	}
+	b.put(name, update, opts)
+	return nil
+}
+
 // ObjectSizes return a map of object sizes by name
 func (b *InMem) ObjectSizes() map[string]int64 {
 	b.mu.RLock()
@@ -105,14 +164,27 @@ func (b *InMem) store(name string, data []byte, opts *WriteOptions) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	b.put(name, data, opts)
+}
+
+func (b *InMem) put(name string, data []byte, opts *WriteOptions) {
+	lockMode, retainUntil := opts.GetRetention()
+
 	b.objects[name] = &inMemObject{
 		data: data,
 		info: MetaInfo{
 			Name:        name,
 			Size:        int64(len(data)),
-			ModTime:     time.Now(),
+			ModTime:     internal.Now(),
 			ContentType: opts.GetContentType(),
 			Metadata:    opts.GetMetadata(),
+			RetainUntil: retainUntil,
+			LockMode:    lockMode,
+
+			CacheControl:       opts.GetCacheControl(),
+			ContentEncoding:    opts.GetContentEncoding(),
+			ContentDisposition: opts.GetContentDisposition(),
+			ContentLanguage:    opts.GetContentLanguage(),
 		},
 	}
 }
@@ -128,9 +200,14 @@ func (o *inMemObject) Size() int64 {
 	return int64(len(o.data))
 }
 
-type inMemReader struct{ *bytes.Reader }
+type inMemReader struct {
+	*bytes.Reader
+	info MetaInfo
+}
 
-func (*inMemReader) Close() error { return nil }
+func (*inMemReader) Close() error          { return nil }
+func (r *inMemReader) ModTime() time.Time  { return r.info.ModTime }
+func (r *inMemReader) ContentType() string { return r.info.ContentType }
 
 type inMemWriter struct {
 	bytes.Buffer
@@ -160,8 +237,15 @@ func (w *inMemWriter) Commit() error {
 }
 
 type inMemIterator struct {
+	bucket  *InMem
+	pattern string
 	entries []*inMemObject
 	pos     int
+	sorted  bool
+}
+
+func (i *inMemIterator) sort() {
+	sort.Slice(i.entries, func(x, y int) bool { return i.entries[x].info.Name < i.entries[y].info.Name })
 }
 
 func (i *inMemIterator) Next() bool {
@@ -190,8 +274,27 @@ func (i *inMemIterator) ModTime() time.Time {
 	return time.Time{}
 }
 
+func (i *inMemIterator) ContentType() string {
+	if i.pos < len(i.entries) {
+		return i.entries[i.pos].info.ContentType
+	}
+	return ""
+}
+
 func (*inMemIterator) Error() error { return nil }
 
+func (i *inMemIterator) Reset() error {
+	matches, err := i.bucket.glob(i.pattern)
+	if err != nil {
+		return err
+	}
+	i.entries, i.pos = matches, -1
+	if i.sorted {
+		i.sort()
+	}
+	return nil
+}
+
 func (i *inMemIterator) Close() error {
 	i.pos = len(i.entries)
 	return nil
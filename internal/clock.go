@@ -0,0 +1,19 @@
+package internal
+
+import "time"
+
+var clock = time.Now
+
+// Now returns the current time. Time-based features should call Now instead
+// of time.Now, which allows tests to control the clock.
+func Now() time.Time {
+	return clock()
+}
+
+// SetClock replaces the clock for testing and returns a func to restore the
+// default.
+func SetClock(fn func() time.Time) func() {
+	prev := clock
+	clock = fn
+	return func() { clock = prev }
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"path"
+	"strings"
+)
+
+// ContentTypeByExt returns the content type which types maps to the extension
+// of name, or an empty string. Keys of types are extensions including the
+// leading dot, e.g. ".md", and are matched case-insensitively.
+func ContentTypeByExt(name string, types map[string]string) string {
+	ext := path.Ext(name)
+	if ext == "" {
+		return ""
+	}
+
+	if ct, ok := types[ext]; ok {
+		return ct
+	}
+	for key, ct := range types {
+		if strings.EqualFold(key, ext) {
+			return ct
+		}
+	}
+	return ""
+}
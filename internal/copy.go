@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCopyBufferSize is the default size of copy buffers.
+const DefaultCopyBufferSize = 32 * 1024
+
+var (
+	copyBufferSize int64 = DefaultCopyBufferSize
+	copyBuffers    sync.Pool
+)
+
+// SetCopyBufferSize sets the size of buffers used by Copy and CopyBuffered.
+// Values <= 0 restore the default. Pooled buffers of a different size are
+// discarded on their next use.
+func SetCopyBufferSize(n int) {
+	if n <= 0 {
+		n = DefaultCopyBufferSize
+	}
+	atomic.StoreInt64(&copyBufferSize, int64(n))
+}
+
+// getCopyBuffer returns a buffer from the pool, or allocates a new one.
+func getCopyBuffer() *[]byte {
+	size := atomic.LoadInt64(&copyBufferSize)
+	if buf, ok := copyBuffers.Get().(*[]byte); ok && int64(len(*buf)) == size {
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+// CopyBuffered copies from src to dst, like io.Copy, but uses a pooled buffer
+// instead of allocating one per call.
+func CopyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	buf := getCopyBuffer()
+	defer copyBuffers.Put(buf)
+
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// Copy copies from src to dst, like CopyBuffered, but checks the context for
+// cancellation between chunks. It returns the context error if the copy was
+// aborted.
+func Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	pooled := getCopyBuffer()
+	defer copyBuffers.Put(pooled)
+	buf := *pooled
+
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		} else if err != nil {
+			return written, err
+		}
+	}
+}
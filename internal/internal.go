@@ -2,9 +2,20 @@ package internal
 
 import (
 	"path"
+	"strings"
 )
 
 // WithinNamespace generates a full path scoped within a namespace.
 func WithinNamespace(ns, name string) string {
 	return path.Join(ns, path.Clean("/"+name))
 }
+
+// WithinNamespaceKey is like WithinNamespace, but retains the trailing slash
+// of directory markers.
+func WithinNamespaceKey(ns, name string) string {
+	key := WithinNamespace(ns, name)
+	if strings.HasSuffix(name, "/") && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return key
+}
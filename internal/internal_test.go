@@ -1,7 +1,14 @@
 package internal_test
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bsm/bfs/internal"
 	. "github.com/onsi/ginkgo"
@@ -22,9 +29,178 @@ var _ = DescribeTable("WithinNamespace",
 	Entry("clever escape attempts", "/file/../../../../secret.txt", "/my/root/secret.txt"),
 )
 
+var _ = DescribeTable("WithinNamespaceKey",
+	func(name, expected string) {
+		Expect(internal.WithinNamespaceKey("my/root", name)).To(Equal(expected))
+	},
+	Entry("blank", "", "my/root"),
+	Entry("file", "file/name.txt", "my/root/file/name.txt"),
+	Entry("directory marker", "path/to/dir/", "my/root/path/to/dir/"),
+	Entry("dirty directory marker", "/path//to/dir//", "my/root/path/to/dir/"),
+)
+
+var _ = DescribeTable("ContentTypeByExt",
+	func(name, expected string) {
+		types := map[string]string{".md": "text/markdown", ".CSV": "text/csv"}
+		Expect(internal.ContentTypeByExt(name, types)).To(Equal(expected))
+	},
+	Entry("mapped", "docs/README.md", "text/markdown"),
+	Entry("case-insensitive", "README.MD", "text/markdown"),
+	Entry("case-insensitive keys", "data.csv", "text/csv"),
+	Entry("unmapped", "image.png", ""),
+	Entry("no extension", "Makefile", ""),
+)
+
+var _ = Describe("SetClock", func() {
+	It("should replace and restore the clock", func() {
+		frozen := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		restore := internal.SetClock(func() time.Time { return frozen })
+		Expect(internal.Now()).To(Equal(frozen))
+
+		restore()
+		Expect(internal.Now()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+})
+
+var _ = Describe("ForEachName", func() {
+	It("should process names concurrently", func() {
+		var mu sync.Mutex
+		var seen []string
+
+		failed, err := internal.ForEachName(context.Background(), &nameIterator{names: []string{"a", "b", "c"}}, 2, func(name string) error {
+			mu.Lock()
+			seen = append(seen, name)
+			mu.Unlock()
+
+			if name == "b" {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(failed).To(Equal(map[string]error{"b": io.ErrUnexpectedEOF}))
+		Expect(seen).To(ConsistOf("a", "b", "c"))
+	})
+
+	It("should stop on cancellation", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := internal.ForEachName(ctx, &nameIterator{names: []string{"a", "b", "c"}}, 1, func(name string) error {
+			return nil
+		})
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
+
+var _ = Describe("Copy", func() {
+	It("should copy", func() {
+		var dst bytes.Buffer
+		n, err := internal.Copy(context.Background(), &dst, strings.NewReader("testdata"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(8)))
+		Expect(dst.String()).To(Equal("testdata"))
+	})
+
+	It("should stop on cancellation", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		src := &cancellingReader{Reader: bytes.NewReader(make([]byte, 1<<20)), cancel: cancel}
+		n, err := internal.Copy(ctx, ioutil.Discard, src)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(n).To(BeNumerically(">", 0))
+		Expect(n).To(BeNumerically("<", 1<<20))
+		Expect(src.reads).To(Equal(1))
+	})
+})
+
+var _ = Describe("CopyBuffered", func() {
+	AfterEach(func() {
+		internal.SetCopyBufferSize(0)
+	})
+
+	It("should copy", func() {
+		var dst bytes.Buffer
+		n, err := internal.CopyBuffered(&dst, strings.NewReader("testdata"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(8)))
+		Expect(dst.String()).To(Equal("testdata"))
+	})
+
+	It("should use the configured buffer size", func() {
+		src := &sizeRecordingReader{Reader: bytes.NewReader(make([]byte, 100))}
+		_, err := internal.CopyBuffered(writerOnly{ioutil.Discard}, src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.sizes).To(Equal([]int{32768, 32768}))
+
+		internal.SetCopyBufferSize(16)
+		src = &sizeRecordingReader{Reader: bytes.NewReader(make([]byte, 100))}
+		_, err = internal.CopyBuffered(writerOnly{ioutil.Discard}, src)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(src.sizes).To(Equal([]int{16, 16, 16, 16, 16, 16, 16, 16}))
+	})
+})
+
+func BenchmarkCopy(b *testing.B) {
+	data := make([]byte, 100*1024)
+
+	b.Run("io.Copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = io.Copy(writerOnly{ioutil.Discard}, readerOnly{bytes.NewReader(data)})
+		}
+	})
+
+	b.Run("CopyBuffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = internal.CopyBuffered(writerOnly{ioutil.Discard}, readerOnly{bytes.NewReader(data)})
+		}
+	})
+}
+
 // ------------------------------------------------------------------------
 
 func TestSuite(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "bfs/internal")
 }
+
+// readerOnly and writerOnly hide optional interfaces, such as io.WriterTo and
+// io.ReaderFrom, which would bypass copy buffers.
+type readerOnly struct{ io.Reader }
+type writerOnly struct{ io.Writer }
+
+// sizeRecordingReader records the sizes of read buffers.
+type sizeRecordingReader struct {
+	io.Reader
+	sizes []int
+}
+
+func (r *sizeRecordingReader) Read(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.Reader.Read(p)
+}
+
+// cancellingReader cancels a context after the first read.
+type cancellingReader struct {
+	io.Reader
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.reads++
+	defer r.cancel()
+	return r.Reader.Read(p)
+}
+
+type nameIterator struct {
+	names []string
+	pos   int
+}
+
+func (i *nameIterator) Next() bool   { i.pos++; return i.pos <= len(i.names) }
+func (i *nameIterator) Name() string { return i.names[i.pos-1] }
+func (i *nameIterator) Error() error { return nil }
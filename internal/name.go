@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidName is re-exported as bfs.ErrInvalidName.
+var ErrInvalidName = errors.New("bfs: invalid object name")
+
+// ValidateName implements bfs.ValidateName.
+func ValidateName(name string) error {
+	if name == "" {
+		return invalidName(name, "empty name")
+	}
+	if !utf8.ValidString(name) {
+		return invalidName(name, "invalid UTF-8")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return invalidName(name, "contains control characters")
+		}
+	}
+	if strings.HasPrefix(name, "/") {
+		return invalidName(name, "leading slash")
+	}
+	if strings.HasSuffix(name, "/") {
+		return invalidName(name, "trailing slash")
+	}
+	for _, seg := range strings.Split(name, "/") {
+		switch seg {
+		case "":
+			return invalidName(name, "empty path segment")
+		case ".", "..":
+			return invalidName(name, "relative path segment")
+		}
+	}
+	return nil
+}
+
+// SanitizeName implements bfs.SanitizeName.
+func SanitizeName(name string) (string, error) {
+	name = strings.TrimLeft(name, "/")
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// CheckName is used by backends with a SanitizeNames option. It returns
+// name unchanged unless sanitize is enabled.
+func CheckName(name string, sanitize bool) (string, error) {
+	if !sanitize {
+		return name, nil
+	}
+	return SanitizeName(name)
+}
+
+func invalidName(name, reason string) error {
+	return fmt.Errorf("%w: %q: %s", ErrInvalidName, name, reason)
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"context"
+	"sync"
+)
+
+// NameIterator is implemented by bfs.Iterator.
+type NameIterator interface {
+	Next() bool
+	Name() string
+	Error() error
+}
+
+// ForEachName calls fn for each name yielded by iter, up to concurrency calls
+// run in parallel. Iteration stops early once ctx is cancelled. It returns the
+// errors returned by fn, keyed by name, and the error of iter or ctx, if any.
+func ForEachName(ctx context.Context, iter NameIterator, concurrency int, fn func(string) error) (map[string]error, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	names := make(chan string)
+	failed := make(map[string]error)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for name := range names {
+				if err := fn(name); err != nil {
+					mu.Lock()
+					failed[name] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+loop:
+	for iter.Next() {
+		select {
+		case names <- iter.Name():
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(names)
+	wg.Wait()
+
+	if err := iter.Error(); err != nil {
+		return failed, err
+	}
+	return failed, ctx.Err()
+}
@@ -0,0 +1,235 @@
+package bfs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// filterIterator wraps an Iterator and skips all entries
+// which are not accepted.
+type filterIterator struct {
+	Iterator
+	accept func(Iterator) bool
+}
+
+func (i *filterIterator) Next() bool {
+	for i.Iterator.Next() {
+		if i.accept(i.Iterator) {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *filterIterator) Reset() error {
+	return ResetIterator(i.Iterator)
+}
+
+// detailedIterator wraps an Iterator and looks up the meta info of each
+// entry ahead of the cursor.
+type detailedIterator struct {
+	iter    Iterator
+	cancel  context.CancelFunc
+	results chan chan headResult // ordered, bounded by concurrency
+	wg      sync.WaitGroup
+
+	current *MetaInfo
+	err     error
+}
+
+type headResult struct {
+	info *MetaInfo
+	err  error
+}
+
+func newDetailedIterator(ctx context.Context, bucket Bucket, iter Iterator, concurrency int) *detailedIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	i := &detailedIterator{
+		iter:    iter,
+		cancel:  cancel,
+		results: make(chan chan headResult, concurrency),
+	}
+
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		defer close(i.results)
+		i.lookup(ctx, bucket, concurrency)
+	}()
+	return i
+}
+
+func (i *detailedIterator) lookup(ctx context.Context, bucket Bucket, concurrency int) {
+	sema := make(chan struct{}, concurrency)
+	for i.iter.Next() {
+		name := i.iter.Name()
+		res := make(chan headResult, 1)
+
+		select {
+		case i.results <- res:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			res <- headResult{err: ctx.Err()}
+			return
+		}
+
+		i.wg.Add(1)
+		go func() {
+			defer i.wg.Done()
+			defer func() { <-sema }()
+
+			info, err := bucket.Head(ctx, name)
+			res <- headResult{info: info, err: err}
+		}()
+	}
+
+	if err := i.iter.Error(); err != nil {
+		res := make(chan headResult, 1)
+		res <- headResult{err: err}
+		select {
+		case i.results <- res:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (i *detailedIterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	for res := range i.results {
+		r := <-res
+		if r.err == ErrNotFound {
+			continue
+		} else if r.err != nil {
+			i.err = r.err
+			i.current = nil
+			return false
+		}
+
+		i.current = r.info
+		return true
+	}
+	i.current = nil
+	return false
+}
+
+func (i *detailedIterator) Name() string {
+	if i.current != nil {
+		return i.current.Name
+	}
+	return ""
+}
+
+func (i *detailedIterator) Size() int64 {
+	if i.current != nil {
+		return i.current.Size
+	}
+	return 0
+}
+
+func (i *detailedIterator) ModTime() time.Time {
+	if i.current != nil {
+		return i.current.ModTime
+	}
+	return time.Time{}
+}
+
+// ContentType returns the content type of the current object.
+func (i *detailedIterator) ContentType() string {
+	if i.current != nil {
+		return i.current.ContentType
+	}
+	return ""
+}
+
+// Metadata returns the metadata of the current object.
+func (i *detailedIterator) Metadata() Metadata {
+	if i.current != nil {
+		return i.current.Metadata
+	}
+	return nil
+}
+
+func (i *detailedIterator) Error() error { return i.err }
+
+func (i *detailedIterator) Close() error {
+	i.cancel()
+	for range i.results { // unblock the lookup
+	}
+	i.wg.Wait()
+	return i.iter.Close()
+}
+
+// sortedIterator iterates over a buffered, sorted listing.
+type sortedIterator struct {
+	infos  []MetaInfo
+	pos    int
+	relist func() ([]MetaInfo, error)
+}
+
+func (i *sortedIterator) Next() bool {
+	if i.pos < len(i.infos) {
+		i.pos++
+	}
+	return i.pos < len(i.infos)
+}
+
+func (i *sortedIterator) current() *MetaInfo {
+	if i.pos > -1 && i.pos < len(i.infos) {
+		return &i.infos[i.pos]
+	}
+	return nil
+}
+
+func (i *sortedIterator) Name() string {
+	if c := i.current(); c != nil {
+		return c.Name
+	}
+	return ""
+}
+
+func (i *sortedIterator) Size() int64 {
+	if c := i.current(); c != nil {
+		return c.Size
+	}
+	return 0
+}
+
+func (i *sortedIterator) ModTime() time.Time {
+	if c := i.current(); c != nil {
+		return c.ModTime
+	}
+	return time.Time{}
+}
+
+// ContentType returns the content type of the current object, if supported
+// by the bucket's iterator.
+func (i *sortedIterator) ContentType() string {
+	if c := i.current(); c != nil {
+		return c.ContentType
+	}
+	return ""
+}
+
+func (*sortedIterator) Error() error { return nil }
+
+func (i *sortedIterator) Reset() error {
+	infos, err := i.relist()
+	if err != nil {
+		return err
+	}
+	i.infos, i.pos = infos, -1
+	return nil
+}
+
+func (i *sortedIterator) Close() error {
+	i.pos = len(i.infos)
+	return nil
+}
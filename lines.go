@@ -0,0 +1,33 @@
+package bfs
+
+import (
+	"bufio"
+	"context"
+)
+
+// LineReader reads newline-delimited records from an object.
+// It is returned by OpenLines.
+type LineReader struct {
+	*bufio.Scanner
+	rc Reader
+}
+
+// OpenLines opens an object for line-by-line reading.
+//
+// Lines are read through a bufio.Scanner, only a single line is held in
+// memory at any time. The buffer grows to fit the longest line, up to
+// bufio.MaxScanTokenSize (64KiB) by default, longer lines fail with
+// bufio.ErrTooLong. Use Buffer to raise the limit before the first call
+// to Scan.
+func OpenLines(ctx context.Context, bucket Bucket, name string) (*LineReader, error) {
+	rc, err := bucket.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &LineReader{Scanner: bufio.NewScanner(rc), rc: rc}, nil
+}
+
+// Close closes the underlying reader.
+func (r *LineReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,58 @@
+package bfs_test
+
+import (
+	"bufio"
+	"context"
+	"strings"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OpenLines", func() {
+	var bucket *bfs.InMem
+	var ctx = context.Background()
+
+	long := strings.Repeat("x", 2*bufio.MaxScanTokenSize)
+
+	BeforeEach(func() {
+		bucket = bfs.NewInMem()
+		Expect(bfs.WriteObject(ctx, bucket, "a.ndjson", []byte("{\"a\":1}\n{\"b\":2}\r\n\n"+long+"\nlast"), nil)).To(Succeed())
+	})
+
+	It("should read lines", func() {
+		r, err := bfs.OpenLines(ctx, bucket, "a.ndjson")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		r.Buffer(nil, 4*bufio.MaxScanTokenSize)
+
+		var lines []string
+		for r.Scan() {
+			lines = append(lines, r.Text())
+		}
+		Expect(r.Err()).NotTo(HaveOccurred())
+		Expect(lines).To(Equal([]string{`{"a":1}`, `{"b":2}`, "", long, "last"}))
+		Expect(r.Close()).To(Succeed())
+	})
+
+	It("should fail on lines exceeding the max size", func() {
+		r, err := bfs.OpenLines(ctx, bucket, "a.ndjson")
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+
+		var n int
+		for r.Scan() {
+			Expect(r.Bytes()).NotTo(BeNil())
+			n++
+		}
+		Expect(n).To(Equal(3))
+		Expect(r.Err()).To(Equal(bufio.ErrTooLong))
+	})
+
+	It("should fail on missing objects", func() {
+		_, err := bfs.OpenLines(ctx, bucket, "missing.ndjson")
+		Expect(err).To(Equal(bfs.ErrNotFound))
+	})
+})
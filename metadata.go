@@ -0,0 +1,58 @@
+package bfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateMetadata checks metadata before it is written. Keys must consist
+// of printable ASCII characters only, excluding spaces and the separators
+// not allowed in HTTP header names. The combined size of all keys and
+// values (in bytes) must not exceed maxSize, unless maxSize is <= 0.
+//
+// Errors satisfy errors.Is(err, ErrInvalidMetadata) or
+// errors.Is(err, ErrMetadataTooLarge) respectively and list the
+// offending keys.
+func ValidateMetadata(meta Metadata, maxSize int) error {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var invalid []string
+	var size int
+	for _, key := range keys {
+		if !isToken(key) {
+			invalid = append(invalid, fmt.Sprintf("%q", key))
+		}
+		size += len(key) + len(meta[key])
+	}
+	if len(invalid) != 0 {
+		return WrapError(ErrInvalidMetadata, fmt.Errorf("invalid keys %s", strings.Join(invalid, ", ")))
+	}
+
+	if maxSize > 0 && size > maxSize {
+		// list the largest entries first
+		sort.SliceStable(keys, func(i, j int) bool {
+			return len(keys[i])+len(meta[keys[i]]) > len(keys[j])+len(meta[keys[j]])
+		})
+		return WrapError(ErrMetadataTooLarge, fmt.Errorf("%d bytes exceed the limit of %d bytes, keys by size: %s", size, maxSize, strings.Join(keys, ", ")))
+	}
+	return nil
+}
+
+// isToken returns true if s is a valid HTTP header token.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, c) != -1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package bfs_test
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateMetadata", func() {
+	It("should accept valid metadata", func() {
+		Expect(bfs.ValidateMetadata(nil, 10)).To(Succeed())
+		Expect(bfs.ValidateMetadata(bfs.Metadata{"Key": "value"}, 8)).To(Succeed())
+		Expect(bfs.ValidateMetadata(bfs.Metadata{"Key": strings.Repeat("x", 100)}, 0)).To(Succeed())
+	})
+
+	It("should reject oversized metadata", func() {
+		err := bfs.ValidateMetadata(bfs.Metadata{"A": "1", "Bb": "long value", "C": "3"}, 10)
+		Expect(errors.Is(err, bfs.ErrMetadataTooLarge)).To(BeTrue())
+		Expect(err).To(MatchError("bfs: metadata too large: 16 bytes exceed the limit of 10 bytes, keys by size: Bb, A, C"))
+	})
+
+	It("should reject invalid keys", func() {
+		err := bfs.ValidateMetadata(bfs.Metadata{"Ok": "1", "Bäd": "2", "With Space": "3", "": "4"}, 0)
+		Expect(errors.Is(err, bfs.ErrInvalidMetadata)).To(BeTrue())
+		Expect(err).To(MatchError(`bfs: invalid metadata: invalid keys "", "Bäd", "With Space"`))
+	})
+})
+
+var _ = Describe("NormMetadata", func() {
+	It("should canonicalize keys", func() {
+		Expect(bfs.NormMetadata(map[string]string{
+			"foo-bar":        "1",
+			"FOO_BAZ":        "2",
+			"mIxEd-CaSe_Key": "3",
+		})).To(Equal(bfs.Metadata{
+			"Foo-Bar":        "1",
+			"Foo-Baz":        "2",
+			"Mixed-Case-Key": "3",
+		}))
+	})
+
+	It("should prefer canonical keys on conflicts", func() {
+		Expect(bfs.NormMetadata(map[string]string{"Foo-Bar": "1", "foo_bar": "2", "FOO-BAR": "3"})).
+			To(Equal(bfs.Metadata{"Foo-Bar": "1"}))
+		Expect((&bfs.WriteOptions{Metadata: bfs.Metadata{"foo_bar": "2", "Foo-Bar": "1"}}).GetMetadata()).
+			To(Equal(bfs.Metadata{"Foo-Bar": "1"}))
+	})
+})
@@ -0,0 +1,97 @@
+package bfs
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// MirrorStats summarizes the objects copied by Mirror.
+type MirrorStats struct {
+	Objects int64 // number of copied objects
+	Bytes   int64 // number of copied bytes
+}
+
+// Mirror copies all objects matching pattern from src to dst, e.g. between
+// two cloud providers. Objects keep their names, content types, metadata and
+// HTTP headers, as reported by Head. Existing objects in dst are always
+// overwritten. Up to concurrency objects are copied in parallel, objects
+// which are removed from src while mirroring are skipped.
+//
+// A BatchError is returned if one or more objects failed to copy, the stats
+// only include successful copies.
+func Mirror(ctx context.Context, src, dst Bucket, pattern string, concurrency int) (MirrorStats, error) {
+	iter, err := src.Glob(ctx, pattern)
+	if err != nil {
+		return MirrorStats{}, err
+	}
+	defer iter.Close()
+
+	var stats MirrorStats
+	var mu sync.Mutex
+	failed, err := internal.ForEachName(ctx, iter, concurrency, func(name string) error {
+		n, err := mirrorObject(ctx, src, dst, name)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		stats.Objects++
+		stats.Bytes += n
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	if len(failed) != 0 {
+		return stats, BatchError(failed)
+	}
+	return stats, nil
+}
+
+func mirrorObject(ctx context.Context, src, dst Bucket, name string) (int64, error) {
+	info, err := src.Head(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := src.Open(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	opts := &WriteOptions{
+		ContentType:        info.ContentType,
+		Metadata:           info.Metadata,
+		CacheControl:       info.CacheControl,
+		ContentEncoding:    info.ContentEncoding,
+		ContentDisposition: info.ContentDisposition,
+		ContentLanguage:    info.ContentLanguage,
+		Size:               info.Size,
+	}
+
+	// the body may have been decompressed in transit, the stored size and
+	// encoding don't apply then
+	if re, ok := r.(readerWithContentEncoding); ok && !strings.EqualFold(re.ContentEncoding(), info.ContentEncoding) {
+		opts.ContentEncoding = re.ContentEncoding()
+		opts.Size = 0
+	}
+
+	w, err := dst.Create(ctx, name, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer w.Discard()
+
+	n, err := internal.Copy(ctx, w, r)
+	if err != nil {
+		return 0, err
+	}
+	return n, w.Commit()
+}
@@ -0,0 +1,123 @@
+package bfs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mirror", func() {
+	var src, dst *bfs.InMem
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		src, dst = bfs.NewInMem(), bfs.NewInMem()
+
+		Expect(bfs.WriteObject(ctx, src, "a/1.txt", []byte("one"), &bfs.WriteOptions{
+			ContentType:  "text/plain",
+			Metadata:     bfs.Metadata{"Author": "alice"},
+			CacheControl: "no-cache",
+		})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, src, "a/b/2.json", []byte("{}"), &bfs.WriteOptions{
+			ContentType:     "application/json",
+			ContentEncoding: "identity",
+		})).To(Succeed())
+		Expect(bfs.WriteObject(ctx, src, "c/3.txt", []byte("three"), nil)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, dst, "a/1.txt", []byte("outdated"), nil)).To(Succeed())
+	})
+
+	It("should copy matching objects", func() {
+		stats, err := bfs.Mirror(ctx, src, dst, "a/**", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(bfs.MirrorStats{Objects: 2, Bytes: 5}))
+
+		Expect(bfs.List(ctx, dst, "**")).To(HaveLen(2))
+
+		info, err := dst.Head(ctx, "a/1.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(3)))
+		Expect(info.ContentType).To(Equal("text/plain"))
+		Expect(info.Metadata).To(Equal(bfs.Metadata{"Author": "alice"}))
+		Expect(info.CacheControl).To(Equal("no-cache"))
+
+		info, err = dst.Head(ctx, "a/b/2.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentType).To(Equal("application/json"))
+		Expect(info.ContentEncoding).To(Equal("identity"))
+	})
+
+	It("should not keep the encoding of decompressed content", func() {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte("plain content"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zw.Close()).To(Succeed())
+		Expect(bfs.WriteObject(ctx, src, "d.txt", buf.Bytes(), &bfs.WriteOptions{ContentEncoding: "gzip"})).To(Succeed())
+
+		stats, err := bfs.Mirror(ctx, transcodingBucket{src}, dst, "d.txt", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(bfs.MirrorStats{Objects: 1, Bytes: 13}))
+
+		info, err := dst.Head(ctx, "d.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.ContentEncoding).To(BeEmpty())
+		Expect(bfs.ReadHead(ctx, dst, "d.txt", 100)).To(Equal([]byte("plain content")))
+	})
+
+	It("should aggregate errors", func() {
+		stats, err := bfs.Mirror(ctx, src, readonlyBucket{dst}, "**", 2)
+		Expect(stats).To(Equal(bfs.MirrorStats{}))
+
+		var batch bfs.BatchError
+		Expect(errors.As(err, &batch)).To(BeTrue())
+		Expect(batch).To(HaveLen(3))
+		Expect(batch).To(HaveKeyWithValue("c/3.txt", bfs.ErrAccessDenied))
+	})
+
+	It("should fail on listing errors", func() {
+		_, err := bfs.Mirror(ctx, unreachableBucket{src}, dst, "**", 2)
+		Expect(err).To(MatchError(bfs.ErrAccessDenied))
+	})
+})
+
+// transcodingBucket serves gzip encoded objects decompressed, like GCS.
+type transcodingBucket struct {
+	*bfs.InMem
+}
+
+func (b transcodingBucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	r, err := b.InMem.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return &transcodingReader{Reader: zr, Closer: r}, nil
+}
+
+type transcodingReader struct {
+	*gzip.Reader
+	io.Closer
+}
+
+func (r *transcodingReader) Close() error            { return r.Closer.Close() }
+func (r *transcodingReader) ContentEncoding() string { return "" }
+
+// readonlyBucket rejects all writes.
+type readonlyBucket struct {
+	bfs.Bucket
+}
+
+func (readonlyBucket) Create(_ context.Context, _ string, _ *bfs.WriteOptions) (bfs.Writer, error) {
+	return nil, bfs.ErrAccessDenied
+}
@@ -0,0 +1,213 @@
+package bfs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs/internal"
+)
+
+// ValidateName checks that an object name is safe to use across all
+// backends. A valid name:
+//
+//   * is not empty
+//   * is valid UTF-8
+//   * contains no control characters (U+0000-U+001F, U+007F-U+009F)
+//   * does not start or end with a slash
+//   * contains no empty, "." or ".." path segments
+//
+// Errors returned by ValidateName satisfy errors.Is(err, ErrInvalidName).
+func ValidateName(name string) error {
+	return internal.ValidateName(name)
+}
+
+// staticDir returns the leading directory of a glob pattern which does not
+// contain any meta characters.
+func staticDir(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[{\`); i > -1 {
+		pattern = pattern[:i]
+	}
+	if i := strings.LastIndexByte(pattern, '/'); i > -1 {
+		return pattern[:i]
+	}
+	return ""
+}
+
+// escapePattern escapes the meta characters of a literal name, so that it
+// can be embedded into a glob pattern.
+func escapePattern(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if strings.IndexByte(`*?[]{}\`, name[i]) > -1 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(name[i])
+	}
+	return sb.String()
+}
+
+// commonDir returns the longest common directory of two slash-separated
+// directories.
+func commonDir(a, b string) string {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return strings.Join(as[:n], "/")
+}
+
+// ValidatePattern checks that a glob pattern is well-formed. Empty patterns
+// are rejected with ErrEmptyPattern, "**" is the canonical way to match all
+// objects. Malformed patterns return an error wrapping
+// doublestar.ErrBadPattern.
+//
+// The whole pattern is checked, doublestar itself only reports syntax errors
+// once a name is matched up to the offending part, e.g. "a/[b" fails on
+// "a/x" but not on "b/x", which would abort iterations half-way through.
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return ErrEmptyPattern
+	}
+	if _, err := doublestar.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bfs: bad glob pattern %q: %w", pattern, err)
+	}
+	if err := checkPatternSyntax(pattern); err != nil {
+		return fmt.Errorf("bfs: bad glob pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// checkPatternSyntax walks pattern and checks escapes, character classes
+// and alternatives, following the grammar of doublestar.
+func checkPatternSyntax(pattern string) error {
+	braces := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i++; i == len(pattern) {
+				return doublestar.ErrBadPattern
+			}
+		case '[':
+			n := strings.IndexByte(pattern[i+1:], ']')
+			for n > 0 && pattern[i+n] == '\\' {
+				m := strings.IndexByte(pattern[i+n+2:], ']')
+				if m < 0 {
+					n = -1
+					break
+				}
+				n += m + 1
+			}
+			if n < 0 {
+				return doublestar.ErrBadPattern
+			}
+			if err := checkPatternClass(pattern[i+1 : i+1+n]); err != nil {
+				return err
+			}
+			i += n + 1
+		case '{':
+			braces++
+		case '}':
+			if braces > 0 {
+				braces--
+			}
+		}
+	}
+	if braces != 0 {
+		return doublestar.ErrBadPattern
+	}
+	return nil
+}
+
+// checkPatternClass checks the contents of a character class, i.e. the part
+// between the square brackets.
+func checkPatternClass(class string) error {
+	if class == "" {
+		return doublestar.ErrBadPattern
+	}
+	runes := []rune(strings.TrimPrefix(class, "^"))
+
+	// next consumes a single, possibly escaped, rune
+	next := func(i int) (int, error) {
+		if runes[i] == '-' {
+			return 0, doublestar.ErrBadPattern
+		}
+		if runes[i] == '\\' {
+			if i++; i == len(runes) {
+				return 0, doublestar.ErrBadPattern
+			}
+		}
+		return i + 1, nil
+	}
+
+	for i := 0; i < len(runes); {
+		var err error
+		if i, err = next(i); err != nil {
+			return err
+		}
+		if i < len(runes) && runes[i] == '-' {
+			if i++; i == len(runes) {
+				return doublestar.ErrBadPattern
+			}
+			if i, err = next(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SanitizeName normalizes an object name by stripping leading slashes
+// before validating it with ValidateName. All other violations are rejected
+// rather than rewritten, as silently mapping a name like "a/../b" to "b"
+// could cause one object to overwrite another.
+func SanitizeName(name string) (string, error) {
+	return internal.SanitizeName(name)
+}
+
+// NormalizeName returns the case-folded form of an object name. Names which
+// normalize to the same value collide on case-insensitive storage, e.g.
+// "Report.PDF" and "report.pdf". Please note that cloud backends (S3, GCS,
+// Azure) are always case-sensitive, while local file systems may not be.
+func NormalizeName(name string) string {
+	return strings.ToLower(name)
+}
+
+// Join joins any number of name elements into a single object name. Unlike
+// filepath.Join, it always uses forward slashes as separators, independent
+// of the OS. Backslashes are not treated as separators. The result is
+// cleaned and stripped of leading and trailing slashes, empty elements are
+// ignored.
+func Join(elem ...string) string {
+	return strings.Trim(path.Join(elem...), "/")
+}
+
+// Dir returns all but the last element of name, typically the name's
+// directory, without a trailing slash. It returns an empty string for
+// top-level names.
+func Dir(name string) string {
+	if dir := path.Dir(strings.Trim(name, "/")); dir != "." {
+		return strings.TrimLeft(dir, "/")
+	}
+	return ""
+}
+
+// Base returns the last element of name. Trailing slashes are removed
+// before extracting the last element. It returns an empty string for empty
+// names.
+func Base(name string) string {
+	if name = strings.Trim(name, "/"); name == "" {
+		return ""
+	}
+	return path.Base(name)
+}
+
+// Ext returns the file name extension used by name, i.e. the suffix
+// beginning at the final dot in the final slash-separated element of name.
+// It returns an empty string if there is no dot.
+func Ext(name string) string {
+	return path.Ext(name)
+}
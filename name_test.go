@@ -0,0 +1,144 @@
+package bfs_test
+
+import (
+	"errors"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateName", func() {
+	DescribeTable("valid names",
+		func(name string) {
+			Expect(bfs.ValidateName(name)).To(Succeed())
+		},
+		Entry("plain", "a.txt"),
+		Entry("nested", "a/b/c.txt"),
+		Entry("dots", "a/..b/c..txt"),
+		Entry("unicode", "ä/ß.txt"),
+	)
+
+	DescribeTable("invalid names",
+		func(name string) {
+			err := bfs.ValidateName(name)
+			Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue())
+		},
+		Entry("empty", ""),
+		Entry("leading slash", "/a.txt"),
+		Entry("trailing slash", "a/"),
+		Entry("double slash", "a//b.txt"),
+		Entry("parent", "../a.txt"),
+		Entry("nested parent", "a/../b.txt"),
+		Entry("current", "./a.txt"),
+		Entry("newline", "a\nb.txt"),
+		Entry("NUL", "a\x00b.txt"),
+		Entry("DEL", "a\x7fb.txt"),
+		Entry("invalid UTF-8", "a\xffb.txt"),
+	)
+})
+
+var _ = Describe("SanitizeName", func() {
+	It("should strip leading slashes", func() {
+		Expect(bfs.SanitizeName("//a/b.txt")).To(Equal("a/b.txt"))
+	})
+
+	It("should reject other violations", func() {
+		_, err := bfs.SanitizeName("/a/../b.txt")
+		Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue())
+
+		_, err = bfs.SanitizeName("/")
+		Expect(errors.Is(err, bfs.ErrInvalidName)).To(BeTrue())
+	})
+})
+
+var _ = Describe("ValidatePattern", func() {
+	It("should accept valid patterns", func() {
+		Expect(bfs.ValidatePattern("**")).To(Succeed())
+		Expect(bfs.ValidatePattern("a/*/[bc]*.txt")).To(Succeed())
+		Expect(bfs.ValidatePattern("{a,b}/**/*.{csv,json}")).To(Succeed())
+		Expect(bfs.ValidatePattern(`a/[\]x-z]/\{b\}`)).To(Succeed())
+		Expect(bfs.ValidatePattern("[^]/}")).To(Succeed())
+	})
+
+	DescribeTable("should reject bad patterns",
+		func(pattern string) {
+			err := bfs.ValidatePattern(pattern)
+			Expect(err).To(HaveOccurred())
+			Expect(errors.Is(err, doublestar.ErrBadPattern)).To(BeTrue())
+		},
+		Entry("unclosed class", "a/[b"),
+		Entry("unclosed class in alternative", "a/{b,[}/c"),
+		Entry("empty class", "a/b[]"),
+		Entry("open range", "a/[b-]"),
+		Entry("reversed dash", "a/[-b]"),
+		Entry("unclosed alternative", "a/b{c,d"),
+		Entry("trailing escape", "a/b\\"),
+		Entry("trailing escape in class", "a/[b\\]"),
+	)
+
+	It("should reject empty patterns", func() {
+		Expect(bfs.ValidatePattern("")).To(MatchError(bfs.ErrEmptyPattern))
+	})
+})
+
+var _ = Describe("path helpers", func() {
+	DescribeTable("Join",
+		func(elem []string, exp string) {
+			Expect(bfs.Join(elem...)).To(Equal(exp))
+		},
+		Entry("plain", []string{"a", "b", "c.txt"}, "a/b/c.txt"),
+		Entry("empty", []string{}, ""),
+		Entry("blanks", []string{"", "a", "", "b.txt"}, "a/b.txt"),
+		Entry("slashes", []string{"/a/", "/b/", "c.txt"}, "a/b/c.txt"),
+		Entry("relative", []string{"a/b", "../c.txt"}, "a/c.txt"),
+		Entry("windows", []string{`C:\dir`, `sub\file.txt`}, `C:\dir/sub\file.txt`),
+	)
+
+	DescribeTable("Dir",
+		func(name, exp string) {
+			Expect(bfs.Dir(name)).To(Equal(exp))
+		},
+		Entry("nested", "a/b/c.txt", "a/b"),
+		Entry("top-level", "c.txt", ""),
+		Entry("empty", "", ""),
+		Entry("leading slash", "/a/c.txt", "a"),
+		Entry("trailing slash", "a/b/", "a"),
+		Entry("windows", `a\b\c.txt`, ""),
+		Entry("mixed", `a/b\c.txt`, "a"),
+	)
+
+	DescribeTable("Base",
+		func(name, exp string) {
+			Expect(bfs.Base(name)).To(Equal(exp))
+		},
+		Entry("nested", "a/b/c.txt", "c.txt"),
+		Entry("top-level", "c.txt", "c.txt"),
+		Entry("empty", "", ""),
+		Entry("slash", "/", ""),
+		Entry("trailing slash", "a/b/", "b"),
+		Entry("windows", `a\b\c.txt`, `a\b\c.txt`),
+		Entry("mixed", `a/b\c.txt`, `b\c.txt`),
+	)
+
+	DescribeTable("Ext",
+		func(name, exp string) {
+			Expect(bfs.Ext(name)).To(Equal(exp))
+		},
+		Entry("plain", "a/b.txt", ".txt"),
+		Entry("multiple", "a/b.tar.gz", ".gz"),
+		Entry("none", "a.d/b", ""),
+		Entry("windows", `a.d\b`, `.d\b`),
+	)
+
+	DescribeTable("NormalizeName",
+		func(name, exp string) {
+			Expect(bfs.NormalizeName(name)).To(Equal(exp))
+		},
+		Entry("lower", "a/b.txt", "a/b.txt"),
+		Entry("mixed", "Dir/Report.PDF", "dir/report.pdf"),
+		Entry("unicode", "Ärger/ÖL.txt", "ärger/öl.txt"),
+	)
+})
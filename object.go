@@ -76,7 +76,7 @@ func (o *Object) Open(ctx context.Context) (Reader, error) {
 
 // Create creates/opens a object for writing.
 func (o *Object) Create(ctx context.Context, opts *WriteOptions) (Writer, error) {
-	return o.bucket.Create(ctx, o.name, opts)
+	return CreateObject(ctx, o.bucket, o.name, opts)
 }
 
 // Remove removes a object.
@@ -0,0 +1,52 @@
+package lint
+
+import (
+	"os"
+	"strconv"
+)
+
+// Config configures the backend under test. It allows to run the lint
+// suite against S3-compatible stores, such as MinIO or localstack, instead
+// of live AWS.
+type Config struct {
+	// Endpoint is a custom S3 endpoint URL, e.g. "http://localhost:9000".
+	// When blank, the default AWS endpoints are used.
+	Endpoint string
+	// ForcePathStyle enables path-style addressing, which is required by
+	// most local S3-compatible stores.
+	ForcePathStyle bool
+	// Bucket overrides the name of the sandbox bucket.
+	Bucket string
+}
+
+// ConfigFromEnv reads the Config from the environment:
+//
+//   BFS_LINT_S3_ENDPOINT         - custom endpoint URL
+//   BFS_LINT_S3_FORCE_PATH_STYLE - force path-style addressing (true/false)
+//   BFS_LINT_S3_BUCKET           - sandbox bucket name
+//
+// Credentials are picked up via the standard AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY variables.
+func ConfigFromEnv() *Config {
+	forcePathStyle, _ := strconv.ParseBool(os.Getenv("BFS_LINT_S3_FORCE_PATH_STYLE"))
+	return &Config{
+		Endpoint:       os.Getenv("BFS_LINT_S3_ENDPOINT"),
+		ForcePathStyle: forcePathStyle,
+		Bucket:         os.Getenv("BFS_LINT_S3_BUCKET"),
+	}
+}
+
+// IsCustom returns true if a custom endpoint is configured.
+// Custom endpoints are not expected to be seeded with readonly
+// samples, so tests which rely on them should be skipped.
+func (c *Config) IsCustom() bool {
+	return c.Endpoint != ""
+}
+
+// BucketOr returns the configured bucket name or the given fallback.
+func (c *Config) BucketOr(fallback string) string {
+	if c.Bucket != "" {
+		return c.Bucket
+	}
+	return fallback
+}
@@ -2,6 +2,8 @@ package lint
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
 	"time"
 
 	"github.com/bsm/bfs"
@@ -15,19 +17,24 @@ const numReadonlySamples = 2121
 type Options struct {
 	Subject, Readonly bfs.Bucket
 
+	// Sanitized is an optional bucket configured with SanitizeNames, backed
+	// by the same storage as Subject.
+	Sanitized bfs.Bucket
+
 	Metadata    bool
 	ContentType bool
 }
 
 // Lint implements a test set.
 func Lint(opts *Options) func() {
-	var subject, readonly bfs.Bucket
+	var subject, readonly, sanitized bfs.Bucket
 	var ctx = context.Background()
 
 	return func() {
 		ginkgo.BeforeEach(func() {
 			subject = opts.Subject
 			readonly = opts.Readonly
+			sanitized = opts.Sanitized
 		})
 
 		ginkgo.It("should write", func() {
@@ -80,7 +87,6 @@ func Lint(opts *Options) func() {
 			Ω.Expect(writeTestData(subject, "path/b/second.txt")).To(Ω.Succeed())
 			Ω.Expect(writeTestData(subject, "path/a/third.json")).To(Ω.Succeed())
 
-			Ω.Expect(subject.Glob(ctx, "")).To(whenDrained(Ω.BeEmpty()))
 			Ω.Expect(subject.Glob(ctx, "path/*")).To(whenDrained(Ω.BeEmpty()))
 			Ω.Expect(subject.Glob(ctx, "path/*/*")).To(whenDrained(Ω.HaveLen(3)))
 			Ω.Expect(subject.Glob(ctx, "*/*/*")).To(whenDrained(Ω.HaveLen(3)))
@@ -92,6 +98,118 @@ func Lint(opts *Options) func() {
 			Ω.Expect(subject.Glob(ctx, "**")).To(whenDrained(Ω.HaveLen(3)))
 		})
 
+		ginkgo.It("should reject empty patterns", func() {
+			Ω.Expect(writeTestData(subject, "path/a/first.txt")).To(Ω.Succeed())
+			Ω.Expect(writeTestData(subject, "second.txt")).To(Ω.Succeed())
+
+			_, err := subject.Glob(ctx, "")
+			Ω.Expect(errors.Is(err, bfs.ErrEmptyPattern)).To(Ω.BeTrue())
+			Ω.Expect(subject.Glob(ctx, "**")).To(whenDrained(Ω.HaveLen(2)))
+		})
+
+		ginkgo.It("should glob after", func() {
+			Ω.Expect(writeTestData(subject, "path/a/first.txt")).To(Ω.Succeed())
+			Ω.Expect(writeTestData(subject, "path/b/second.txt")).To(Ω.Succeed())
+			Ω.Expect(writeTestData(subject, "path/c/third.txt")).To(Ω.Succeed())
+
+			Ω.Expect(bfs.GlobAfter(ctx, subject, "**", "")).To(whenDrained(Ω.HaveLen(3)))
+			Ω.Expect(bfs.GlobAfter(ctx, subject, "**", "path/a/first.txt")).To(whenDrained(Ω.ConsistOf("path/b/second.txt", "path/c/third.txt")))
+			Ω.Expect(bfs.GlobAfter(ctx, subject, "**", "path/b")).To(whenDrained(Ω.ConsistOf("path/b/second.txt", "path/c/third.txt")))
+			Ω.Expect(bfs.GlobAfter(ctx, subject, "**/*.txt", "path/c/third.txt")).To(whenDrained(Ω.BeEmpty()))
+		})
+
+		ginkgo.It("should glob in sorted order", func() {
+			for _, name := range []string{"path/ab.txt", "path/a/b.txt", "path/a.txt", "path/0.txt", "path/a-c.txt"} {
+				Ω.Expect(writeTestData(subject, name)).To(Ω.Succeed())
+			}
+
+			Ω.Expect(bfs.SortedGlob(ctx, subject, "**")).To(whenDrained(Ω.Equal([]string{
+				"path/0.txt",
+				"path/a-c.txt",
+				"path/a.txt",
+				"path/a/b.txt",
+				"path/ab.txt",
+			})))
+			Ω.Expect(bfs.SortedGlob(ctx, subject, "path/*.txt")).To(whenDrained(Ω.Equal([]string{
+				"path/0.txt",
+				"path/a-c.txt",
+				"path/a.txt",
+				"path/ab.txt",
+			})))
+		})
+
+		ginkgo.It("should reset iterators", func() {
+			Ω.Expect(writeTestData(subject, "path/a/first.txt")).To(Ω.Succeed())
+			Ω.Expect(writeTestData(subject, "path/b/second.txt")).To(Ω.Succeed())
+
+			iter, err := subject.Glob(ctx, "path/**")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			defer iter.Close()
+
+			var names []string
+			for iter.Next() {
+				names = append(names, iter.Name())
+			}
+			Ω.Expect(iter.Error()).NotTo(Ω.HaveOccurred())
+			Ω.Expect(names).To(Ω.ConsistOf("path/a/first.txt", "path/b/second.txt"))
+
+			if err := bfs.ResetIterator(iter); err == bfs.ErrNotSupported {
+				ginkgo.Skip("reset is not supported")
+			} else {
+				Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			}
+
+			var again []string
+			for iter.Next() {
+				again = append(again, iter.Name())
+			}
+			Ω.Expect(iter.Error()).NotTo(Ω.HaveOccurred())
+			Ω.Expect(again).To(Ω.ConsistOf(names))
+		})
+
+		ginkgo.It("should expose info on open", func() {
+			Ω.Expect(writeTestData(subject, "path/to/first.txt")).To(Ω.Succeed())
+
+			rc, err := subject.Open(ctx, "path/to/first.txt")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			defer rc.Close()
+
+			info, ok := rc.(bfs.ReadCloserInfo)
+			if !ok {
+				ginkgo.Skip("reader does not implement bfs.ReadCloserInfo")
+			}
+			Ω.Expect(info.Size()).To(Ω.Equal(int64(8)))
+			Ω.Expect(info.ModTime()).To(Ω.BeTemporally("~", time.Now(), time.Minute))
+			if opts.ContentType {
+				Ω.Expect(info.ContentType()).To(Ω.Equal("text/plain"))
+			}
+		})
+
+		ginkgo.It("should write empty objects", func() {
+			Ω.Expect(bfs.WriteObject(ctx, subject, "path/to/empty.txt", nil, nil)).To(Ω.Succeed())
+
+			info, err := subject.Head(ctx, "path/to/empty.txt")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			Ω.Expect(info.Size).To(Ω.Equal(int64(0)))
+
+			r, err := subject.Open(ctx, "path/to/empty.txt")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			defer r.Close()
+			Ω.Expect(ioutil.ReadAll(r)).To(Ω.BeEmpty())
+		})
+
+		ginkgo.It("should make directories", func() {
+			Ω.Expect(bfs.Mkdir(ctx, subject, "path/to/dir")).To(Ω.Succeed())
+			Ω.Expect(bfs.Mkdir(ctx, subject, "path/to/dir/")).To(Ω.Succeed())
+			Ω.Expect(bfs.Mkdir(ctx, subject, "")).To(Ω.Succeed())
+
+			// file systems create real directories, object stores a single marker
+			Ω.Expect(subject.Glob(ctx, "path/**")).To(whenDrained(Ω.Or(Ω.BeEmpty(), Ω.ConsistOf("path/to/dir/"))))
+
+			Ω.Expect(writeTestData(subject, "path/to/dir/first.txt")).To(Ω.Succeed())
+			Ω.Expect(subject.Glob(ctx, "path/**/*.txt")).To(whenDrained(Ω.ConsistOf("path/to/dir/first.txt")))
+		})
+
 		ginkgo.It("should head", func() {
 			Ω.Expect(writeTestData(subject, "path/to/first.txt")).To(Ω.Succeed())
 
@@ -114,6 +232,32 @@ func Lint(opts *Options) func() {
 			}
 		})
 
+		ginkgo.It("should round-trip metadata keys", func() {
+			if !opts.Metadata {
+				ginkgo.Skip("metadata is not supported")
+			}
+
+			Ω.Expect(bfs.WriteObject(ctx, subject, "meta.txt", []byte("TESTDATA"), &bfs.WriteOptions{
+				Metadata: bfs.Metadata{
+					"foo-bar":        "1",
+					"FOO_BAZ":        "2",
+					"mIxEd-CaSe_Key": "3",
+					"Canonical-Key":  "4",
+				},
+			})).To(Ω.Succeed())
+
+			info, err := subject.Head(ctx, "meta.txt")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			Ω.Expect(info.Metadata).To(Ω.Equal(bfs.Metadata{
+				"Foo-Bar":        "1",
+				"Foo-Baz":        "2",
+				"Mixed-Case-Key": "3",
+				"Canonical-Key":  "4",
+			}))
+			Ω.Expect(info.Metadata.Get("foo_bar")).To(Ω.Equal("1"))
+			Ω.Expect(info.Metadata.Get("MIXED-CASE-KEY")).To(Ω.Equal("3"))
+		})
+
 		ginkgo.It("should read", func() {
 			Ω.Expect(writeTestData(subject, "path/to/first.txt")).To(Ω.Succeed())
 
@@ -139,6 +283,27 @@ func Lint(opts *Options) func() {
 			Ω.Expect(subject.Remove(ctx, "missing")).To(Ω.Succeed())
 		})
 
+		ginkgo.It("should sanitize names", func() {
+			if sanitized == nil {
+				ginkgo.Skip("test is disabled")
+			}
+
+			Ω.Expect(writeTestData(sanitized, "/path/to/first.txt")).To(Ω.Succeed())
+			Ω.Expect(subject.Glob(ctx, "*/*/*")).To(whenDrained(Ω.ConsistOf("path/to/first.txt")))
+
+			info, err := sanitized.Head(ctx, "/path/to/first.txt")
+			Ω.Expect(err).NotTo(Ω.HaveOccurred())
+			Ω.Expect(info.Name).To(Ω.Equal("path/to/first.txt"))
+
+			for _, name := range []string{"", "path/../first.txt", "path//to/first.txt", "path/to/"} {
+				_, err := sanitized.Head(ctx, name)
+				Ω.Expect(errors.Is(err, bfs.ErrInvalidName)).To(Ω.BeTrue(), "name %q", name)
+				_, err = sanitized.Create(ctx, name, nil)
+				Ω.Expect(errors.Is(err, bfs.ErrInvalidName)).To(Ω.BeTrue(), "name %q", name)
+				Ω.Expect(errors.Is(sanitized.Remove(ctx, name), bfs.ErrInvalidName)).To(Ω.BeTrue(), "name %q", name)
+			}
+		})
+
 		ginkgo.It("should copy", func() {
 			copier, ok := subject.(interface {
 				Copy(context.Context, string, string) error
@@ -0,0 +1,245 @@
+package bfs
+
+import (
+	"context"
+	"time"
+)
+
+// Operation identifies a bucket operation, see WithTimeouts.
+type Operation string
+
+// Bucket operations.
+const (
+	OpGlob   Operation = "Glob"   // Glob, GlobAfter and SortedGlob
+	OpHead   Operation = "Head"   // Head and Grants
+	OpOpen   Operation = "Open"   // Open and OpenRange
+	OpCreate Operation = "Create" // Create, Mkdir and ConditionalUpdate
+	OpRemove Operation = "Remove" // Remove and RemoveIfMatch
+	OpCopy   Operation = "Copy"   // Copy and Rename
+	OpPing   Operation = "Ping"
+)
+
+var allOperations = []Operation{OpGlob, OpHead, OpOpen, OpCreate, OpRemove, OpCopy, OpPing}
+
+// WithTimeout wraps a bucket and applies a timeout to each operation.
+// For Glob, Open and Create the timeout covers the whole lifetime of the
+// returned iterator, reader or writer.
+func WithTimeout(bucket Bucket, timeout time.Duration) Bucket {
+	timeouts := make(map[Operation]time.Duration, len(allOperations))
+	for _, op := range allOperations {
+		timeouts[op] = timeout
+	}
+	return &timeoutBucket{Bucket: bucket, timeouts: timeouts}
+}
+
+// WithTimeouts wraps a bucket and applies per-operation timeouts, e.g. a
+// short one for Head and a long one for Open. Operations without a
+// configured (positive) timeout use the parent context unchanged. Like in
+// WithTimeout, the timeouts of Glob, Open and Create cover the whole
+// lifetime of the returned iterator, reader or writer.
+func WithTimeouts(bucket Bucket, timeouts map[Operation]time.Duration) Bucket {
+	copied := make(map[Operation]time.Duration, len(timeouts))
+	for op, timeout := range timeouts {
+		if timeout > 0 {
+			copied[op] = timeout
+		}
+	}
+	return &timeoutBucket{Bucket: bucket, timeouts: copied}
+}
+
+type timeoutBucket struct {
+	Bucket
+	timeouts map[Operation]time.Duration
+}
+
+func (b *timeoutBucket) withTimeout(ctx context.Context, op Operation) (context.Context, context.CancelFunc) {
+	if timeout, ok := b.timeouts[op]; ok {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+// Glob implements Bucket.
+func (b *timeoutBucket) Glob(ctx context.Context, pattern string) (Iterator, error) {
+	ctx, cancel := b.withTimeout(ctx, OpGlob)
+	iter, err := b.Bucket.Glob(ctx, pattern)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutIterator{Iterator: iter, cancel: cancel}, nil
+}
+
+// GlobAfter supports GlobAfter.
+func (b *timeoutBucket) GlobAfter(ctx context.Context, pattern, after string) (Iterator, error) {
+	ctx, cancel := b.withTimeout(ctx, OpGlob)
+	iter, err := GlobAfter(ctx, b.Bucket, pattern, after)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutIterator{Iterator: iter, cancel: cancel}, nil
+}
+
+// SortedGlob supports SortedGlob.
+func (b *timeoutBucket) SortedGlob(ctx context.Context, pattern string) (Iterator, error) {
+	ctx, cancel := b.withTimeout(ctx, OpGlob)
+	iter, err := SortedGlob(ctx, b.Bucket, pattern)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutIterator{Iterator: iter, cancel: cancel}, nil
+}
+
+// Head implements Bucket.
+func (b *timeoutBucket) Head(ctx context.Context, name string) (*MetaInfo, error) {
+	ctx, cancel := b.withTimeout(ctx, OpHead)
+	defer cancel()
+
+	return b.Bucket.Head(ctx, name)
+}
+
+// Open implements Bucket.
+func (b *timeoutBucket) Open(ctx context.Context, name string) (Reader, error) {
+	ctx, cancel := b.withTimeout(ctx, OpOpen)
+	rc, err := b.Bucket.Open(ctx, name)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutReader{Reader: rc, cancel: cancel}, nil
+}
+
+// OpenRange supports OpenRange.
+func (b *timeoutBucket) OpenRange(ctx context.Context, name string, offset, length int64) (Reader, error) {
+	ctx, cancel := b.withTimeout(ctx, OpOpen)
+	rc, err := OpenRange(ctx, b.Bucket, name, offset, length)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutReader{Reader: rc, cancel: cancel}, nil
+}
+
+// Grants supports Grants.
+func (b *timeoutBucket) Grants(ctx context.Context, name string) ([]Grant, error) {
+	ctx, cancel := b.withTimeout(ctx, OpHead)
+	defer cancel()
+
+	return Grants(ctx, b.Bucket, name)
+}
+
+// Create implements Bucket.
+func (b *timeoutBucket) Create(ctx context.Context, name string, opts *WriteOptions) (Writer, error) {
+	ctx, cancel := b.withTimeout(ctx, OpCreate)
+	w, err := b.Bucket.Create(ctx, name, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &timeoutWriter{Writer: w, cancel: cancel}, nil
+}
+
+// Remove implements Bucket.
+func (b *timeoutBucket) Remove(ctx context.Context, name string) error {
+	ctx, cancel := b.withTimeout(ctx, OpRemove)
+	defer cancel()
+
+	return b.Bucket.Remove(ctx, name)
+}
+
+// ConditionalUpdate supports ConditionalUpdate.
+func (b *timeoutBucket) ConditionalUpdate(ctx context.Context, name string, fn func([]byte) ([]byte, error)) error {
+	ctx, cancel := b.withTimeout(ctx, OpCreate)
+	defer cancel()
+
+	return ConditionalUpdate(ctx, b.Bucket, name, fn)
+}
+
+// RemoveIfMatch supports RemoveIfMatch.
+func (b *timeoutBucket) RemoveIfMatch(ctx context.Context, name, version string) error {
+	ctx, cancel := b.withTimeout(ctx, OpRemove)
+	defer cancel()
+
+	return RemoveIfMatch(ctx, b.Bucket, name, version)
+}
+
+// Mkdir supports Mkdir.
+func (b *timeoutBucket) Mkdir(ctx context.Context, prefix string) error {
+	ctx, cancel := b.withTimeout(ctx, OpCreate)
+	defer cancel()
+
+	return Mkdir(ctx, b.Bucket, prefix)
+}
+
+// Copy supports copying of objects within the bucket.
+func (b *timeoutBucket) Copy(ctx context.Context, src, dst string) error {
+	ctx, cancel := b.withTimeout(ctx, OpCopy)
+	defer cancel()
+
+	return CopyObject(ctx, b.Bucket, src, dst, nil)
+}
+
+// Rename supports Rename.
+func (b *timeoutBucket) Rename(ctx context.Context, src, dst string) error {
+	ctx, cancel := b.withTimeout(ctx, OpCopy)
+	defer cancel()
+
+	return Rename(ctx, b.Bucket, src, dst)
+}
+
+// Ping supports Ping.
+func (b *timeoutBucket) Ping(ctx context.Context) error {
+	ctx, cancel := b.withTimeout(ctx, OpPing)
+	defer cancel()
+
+	return Ping(ctx, b.Bucket)
+}
+
+// Describe returns information about the wrapped bucket.
+func (b *timeoutBucket) Describe() BucketInfo {
+	info, _ := Describe(b.Bucket)
+	return info
+}
+
+// --------------------------------------------------------------------
+
+type timeoutIterator struct {
+	Iterator
+	cancel context.CancelFunc
+}
+
+func (i *timeoutIterator) Reset() error {
+	return ResetIterator(i.Iterator)
+}
+
+func (i *timeoutIterator) Close() error {
+	defer i.cancel()
+	return i.Iterator.Close()
+}
+
+type timeoutReader struct {
+	Reader
+	cancel context.CancelFunc
+}
+
+func (r *timeoutReader) Close() error {
+	defer r.cancel()
+	return r.Reader.Close()
+}
+
+type timeoutWriter struct {
+	Writer
+	cancel context.CancelFunc
+}
+
+func (w *timeoutWriter) Discard() error {
+	defer w.cancel()
+	return w.Writer.Discard()
+}
+
+func (w *timeoutWriter) Commit() error {
+	defer w.cancel()
+	return w.Writer.Commit()
+}
@@ -0,0 +1,136 @@
+package bfs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithTimeout", func() {
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		subject = bfs.WithTimeout(bfs.NewInMem(), time.Minute)
+	})
+
+	It("should read/write", func() {
+		Expect(bfs.WriteObject(ctx, subject, "file.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		info, err := subject.Head(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Size).To(Equal(int64(8)))
+
+		r, err := subject.Open(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+		Expect(r.Close()).To(Succeed())
+
+		Expect(bfs.CopyObject(ctx, subject, "file.txt", "copy.txt", nil)).To(Succeed())
+		Expect(bfs.List(ctx, subject, "*")).To(HaveLen(2))
+		Expect(subject.Remove(ctx, "file.txt")).To(Succeed())
+		Expect(bfs.List(ctx, subject, "*")).To(HaveLen(1))
+	})
+
+	It("should abort writes on timeout", func() {
+		subject = bfs.WithTimeout(bfs.NewInMem(), time.Millisecond)
+
+		w, err := subject.Create(ctx, "file.txt", nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Discard()
+
+		time.Sleep(5 * time.Millisecond)
+		Expect(w.Commit()).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("should forward optional interfaces", func() {
+		backend := &capableBucket{InMem: bfs.NewInMem()}
+		subject = bfs.WithTimeout(backend, time.Minute)
+		Expect(bfs.WriteObject(ctx, backend, "file.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		Expect(bfs.ReadHead(ctx, subject, "file.txt", 4)).To(Equal([]byte("TEST")))
+		Expect(bfs.Grants(ctx, subject, "file.txt")).To(BeEmpty())
+		Expect(bfs.ConditionalUpdate(ctx, subject, "file.txt", nil)).To(Succeed())
+		Expect(bfs.Rename(ctx, subject, "file.txt", "other.txt")).To(Succeed())
+		Expect(bfs.RemoveIfMatch(ctx, subject, "file.txt", "v1")).To(Succeed())
+		Expect(backend.calls).To(Equal([]string{"OpenRange", "Grants", "ConditionalUpdate", "Rename", "RemoveIfMatch"}))
+		Expect(backend.deadlines).To(Equal([]bool{true, true, true, true, true}))
+
+		subject = bfs.WithTimeout(bfs.NewInMem(), time.Minute)
+		_, err := bfs.Grants(ctx, subject, "file.txt")
+		Expect(err).To(Equal(bfs.ErrNotSupported))
+		Expect(bfs.RemoveIfMatch(ctx, subject, "file.txt", "v1")).To(Equal(bfs.ErrNotSupported))
+	})
+})
+
+var _ = Describe("WithTimeouts", func() {
+	var subject bfs.Bucket
+	var ctx = context.Background()
+
+	BeforeEach(func() {
+		backend := bfs.NewInMem()
+		Expect(bfs.WriteObject(ctx, backend, "file.txt", []byte("TESTDATA"), nil)).To(Succeed())
+
+		subject = bfs.WithTimeouts(&slowBucket{Bucket: backend, delay: 20 * time.Millisecond}, map[bfs.Operation]time.Duration{
+			bfs.OpHead: 5 * time.Millisecond,
+			bfs.OpOpen: time.Minute,
+		})
+	})
+
+	It("should apply per-operation timeouts", func() {
+		_, err := subject.Head(ctx, "file.txt")
+		Expect(err).To(Equal(context.DeadlineExceeded))
+
+		r, err := subject.Open(ctx, "file.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadAll(r)).To(Equal([]byte("TESTDATA")))
+		Expect(r.Close()).To(Succeed())
+	})
+
+	It("should use the parent context for other operations", func() {
+		Expect(subject.Remove(ctx, "file.txt")).To(Succeed())
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(subject.Remove(cctx, "file.txt")).To(Equal(context.Canceled))
+	})
+})
+
+type slowBucket struct {
+	bfs.Bucket
+	delay time.Duration
+}
+
+func (b *slowBucket) wait(ctx context.Context) error {
+	select {
+	case <-time.After(b.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *slowBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Head(ctx, name)
+}
+
+func (b *slowBucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	if err := b.wait(ctx); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Open(ctx, name)
+}
+
+func (b *slowBucket) Remove(ctx context.Context, name string) error {
+	if err := b.wait(ctx); err != nil {
+		return err
+	}
+	return b.Bucket.Remove(ctx, name)
+}
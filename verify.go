@@ -0,0 +1,84 @@
+package bfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/bsm/bfs/internal"
+)
+
+// CreateObject creates an object for writing, just like bucket.Create.
+// Additionally, it applies WriteOptions.VerifyAfterWrite, i.e. Commit
+// re-checks the stored object and returns an error that satisfies
+// errors.Is(err, ErrVerifyFailed) on mismatch. Please note that the object
+// is NOT removed when verification fails.
+func CreateObject(ctx context.Context, bucket Bucket, name string, opts *WriteOptions) (Writer, error) {
+	w, err := bucket.Create(ctx, name, opts)
+	if err != nil || opts == nil || !opts.VerifyAfterWrite {
+		return w, err
+	}
+
+	vw := &verifyWriter{Writer: w, ctx: ctx, bucket: bucket, name: name}
+	if opts.VerifyContent {
+		vw.hash = sha256.New()
+	}
+	return vw, nil
+}
+
+type verifyWriter struct {
+	Writer
+
+	ctx    context.Context
+	bucket Bucket
+	name   string
+	size   int64
+	hash   hash.Hash // nil, unless content is verified
+}
+
+func (w *verifyWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.size += int64(n)
+	if w.hash != nil {
+		_, _ = w.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+func (w *verifyWriter) Commit() error {
+	if err := w.Writer.Commit(); err != nil {
+		return err
+	}
+
+	info, err := w.bucket.Head(w.ctx, w.name)
+	if err != nil {
+		return err
+	}
+	if info.Size != w.size {
+		return fmt.Errorf("%w: %s has %d bytes, %d were written", ErrVerifyFailed, w.name, info.Size, w.size)
+	}
+
+	if w.hash != nil {
+		return w.verifyContent()
+	}
+	return nil
+}
+
+func (w *verifyWriter) verifyContent() error {
+	r, err := w.bucket.Open(w.ctx, w.name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := internal.CopyBuffered(hash, r); err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Sum(nil), w.hash.Sum(nil)) {
+		return fmt.Errorf("%w: %s has a checksum mismatch", ErrVerifyFailed, w.name)
+	}
+	return r.Close()
+}
@@ -0,0 +1,83 @@
+package bfs_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bsm/bfs"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CreateObject", func() {
+	var bucket *faultyBucket
+	var ctx = context.Background()
+	var opts = &bfs.WriteOptions{VerifyAfterWrite: true, VerifyContent: true}
+
+	BeforeEach(func() {
+		bucket = &faultyBucket{InMem: bfs.NewInMem()}
+	})
+
+	It("should verify objects after write", func() {
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), opts)).To(Succeed())
+		Expect(bfs.WriteObject(ctx, bucket, "b.txt", nil, opts)).To(Succeed())
+	})
+
+	It("should detect size mismatches", func() {
+		bucket.truncate = true
+
+		err := bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), &bfs.WriteOptions{VerifyAfterWrite: true})
+		Expect(errors.Is(err, bfs.ErrVerifyFailed)).To(BeTrue())
+		Expect(err).To(MatchError("bfs: verification failed: a.txt has 7 bytes, 8 were written"))
+
+		Expect(bfs.WriteObject(ctx, bucket, "b.txt", []byte("testdata"), nil)).To(Succeed())
+	})
+
+	It("should detect corrupted content", func() {
+		bucket.corrupt = true
+
+		Expect(bfs.WriteObject(ctx, bucket, "a.txt", []byte("testdata"), &bfs.WriteOptions{VerifyAfterWrite: true})).To(Succeed())
+
+		err := bfs.WriteObject(ctx, bucket, "b.txt", []byte("testdata"), opts)
+		Expect(errors.Is(err, bfs.ErrVerifyFailed)).To(BeTrue())
+		Expect(err).To(MatchError("bfs: verification failed: b.txt has a checksum mismatch"))
+	})
+
+	It("should not verify discarded writes", func() {
+		w, err := bfs.CreateObject(ctx, bucket, "a.txt", opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Write([]byte("testdata"))).To(Equal(8))
+		Expect(w.Discard()).To(Succeed())
+		Expect(bucket.ObjectSizes()).To(BeEmpty())
+	})
+})
+
+// faultyBucket misreports stored objects.
+type faultyBucket struct {
+	*bfs.InMem
+	truncate, corrupt bool
+}
+
+func (b *faultyBucket) Head(ctx context.Context, name string) (*bfs.MetaInfo, error) {
+	info, err := b.InMem.Head(ctx, name)
+	if err == nil && b.truncate {
+		info.Size--
+	}
+	return info, err
+}
+
+func (b *faultyBucket) Open(ctx context.Context, name string) (bfs.Reader, error) {
+	r, err := b.InMem.Open(ctx, name)
+	if err != nil || !b.corrupt {
+		return r, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(strings.ToUpper(string(data)))), nil
+}